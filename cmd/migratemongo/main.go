@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/greatjudge/redditclone/pkg/post"
+)
+
+func init() {
+	// loads values from .env into the system
+	if err := godotenv.Load(); err != nil {
+		log.Print("No .env file found")
+	}
+}
+
+// collection returns the collection named by the env variable,
+// or by name if the variable is not set.
+func collection(db *mongo.Database, env string, name string) *mongo.Collection {
+	if fromEnv := os.Getenv(env); fromEnv != "" {
+		name = fromEnv
+	}
+	return db.Collection(name)
+}
+
+// go run ./cmd/migratemongo
+// moves comments, votes and poll votes embedded in posts to their own
+// collections and fills fields added since, posts already migrated are
+// skipped, so it is safe to run on every start.
+func main() {
+	ctx := context.Background()
+	sess, err := mongo.Connect(ctx, options.Client().ApplyURI(os.Getenv("MONGO_URL")))
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := sess.Disconnect(ctx); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	db := sess.Database(os.Getenv("MONGO_DB"))
+	repo := post.NewMongoDBRepo(
+		db.Collection(os.Getenv("MONGO_COLLECTION")),
+		collection(db, "MONGO_COMMENTS_COLLECTION", "comments"),
+		collection(db, "MONGO_VOTES_COLLECTION", "votes"),
+		collection(db, "MONGO_POLL_VOTES_COLLECTION", "poll_votes"),
+	)
+	if err = repo.EnsureIndexes(ctx); err != nil {
+		panic(err)
+	}
+	moved, err := repo.MigrateComments(ctx)
+	if err != nil {
+		panic(fmt.Errorf("moved %v comments before failure: %w", moved, err))
+	}
+	fmt.Printf("moved %v comments\n", moved)
+	moved, err = repo.MigrateVotes(ctx)
+	if err != nil {
+		panic(fmt.Errorf("moved %v votes before failure: %w", moved, err))
+	}
+	fmt.Printf("moved %v votes\n", moved)
+	moved, err = repo.MigratePollVotes(ctx)
+	if err != nil {
+		panic(fmt.Errorf("moved %v poll votes before failure: %w", moved, err))
+	}
+	fmt.Printf("moved %v poll votes\n", moved)
+	updated, err := repo.MigrateNormalizedURLs(ctx)
+	if err != nil {
+		panic(fmt.Errorf("normalized %v links before failure: %w", updated, err))
+	}
+	fmt.Printf("normalized %v links\n", updated)
+	updated, err = repo.MigrateHTML(ctx)
+	if err != nil {
+		panic(fmt.Errorf("rendered %v posts and comments before failure: %w", updated, err))
+	}
+	fmt.Printf("rendered %v posts and comments\n", updated)
+}
@@ -3,11 +3,19 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/smtp"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"text/template"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -18,13 +26,31 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/greatjudge/redditclone/pkg/apitoken"
+	"github.com/greatjudge/redditclone/pkg/controls"
+	"github.com/greatjudge/redditclone/pkg/events"
 	"github.com/greatjudge/redditclone/pkg/handlers"
+	"github.com/greatjudge/redditclone/pkg/mail"
+	"github.com/greatjudge/redditclone/pkg/message"
 	"github.com/greatjudge/redditclone/pkg/middleware"
+	"github.com/greatjudge/redditclone/pkg/notification"
+	"github.com/greatjudge/redditclone/pkg/oidc"
+	"github.com/greatjudge/redditclone/pkg/openapi"
+	"github.com/greatjudge/redditclone/pkg/policy"
 	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/purge"
+	"github.com/greatjudge/redditclone/pkg/saved"
 	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/storage"
+	"github.com/greatjudge/redditclone/pkg/twofactor"
+	"github.com/greatjudge/redditclone/pkg/unfurl"
+	"github.com/greatjudge/redditclone/pkg/upload"
 	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/greatjudge/redditclone/pkg/views"
 )
 
+const shutdownTimeout = 10 * time.Second
+
 func init() {
 	// loads values from .env into the system
 	if err := godotenv.Load(); err != nil {
@@ -46,16 +72,140 @@ func initSQLDB() (*sql.DB, error) {
 	return db, nil
 }
 
-func initMongoDB() (*mongo.Collection, error) {
+// initMongoDB connects to the database of posts, comments and votes.
+func initMongoDB() (*mongo.Database, error) {
 	ctx := context.Background()
 	url := os.Getenv("MONGO_URL")
 	sess, err := mongo.Connect(ctx, options.Client().ApplyURI(url))
 	if err != nil {
 		return nil, fmt.Errorf("fail connect mongo: %w", err)
 	}
-	db := os.Getenv("MONGO_DB")
-	collection := os.Getenv("MONGO_COLLECTION")
-	return sess.Database(db).Collection(collection), nil
+	return sess.Database(os.Getenv("MONGO_DB")), nil
+}
+
+// mongoCollection returns the collection named by the env variable,
+// or by name if the variable is not set.
+func mongoCollection(db *mongo.Database, env string, name string) *mongo.Collection {
+	if fromEnv := os.Getenv(env); fromEnv != "" {
+		name = fromEnv
+	}
+	return db.Collection(name)
+}
+
+func initAccessLogConfig() (middleware.AccessLogConfig, error) {
+	cfg := middleware.AccessLogConfig{SampleRate: 1}
+	if rate := os.Getenv("ACCESS_LOG_SAMPLE_RATE"); rate != "" {
+		val, err := strconv.ParseFloat(rate, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("bad ACCESS_LOG_SAMPLE_RATE: %w", err)
+		}
+		cfg.SampleRate = val
+	}
+	if path := os.Getenv("ACCESS_LOG_FILE"); path != "" {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return cfg, fmt.Errorf("fail to open ACCESS_LOG_FILE: %w", err)
+		}
+		cfg.Combined = f
+	}
+	return cfg, nil
+}
+
+func initPurgeConfig() (purge.Config, error) {
+	cfg := purge.Config{Retention: purge.DefaultRetention}
+	if retention := os.Getenv("DELETE_RETENTION"); retention != "" {
+		val, err := time.ParseDuration(retention)
+		if err != nil {
+			return cfg, fmt.Errorf("bad DELETE_RETENTION: %w", err)
+		}
+		cfg.Retention = val
+	}
+	return cfg, nil
+}
+
+// initDigestInterval returns how often notification digests are emailed,
+// zero if DIGEST_INTERVAL is not set and digests are off.
+func initDigestInterval() (time.Duration, error) {
+	interval := os.Getenv("DIGEST_INTERVAL")
+	if interval == "" {
+		return 0, nil
+	}
+	val, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, fmt.Errorf("bad DIGEST_INTERVAL: %w", err)
+	}
+	return val, nil
+}
+
+// initMailer sends mail through SMTP_ADDR if it is set, otherwise writes it
+// to MAIL_LOG_FILE or to stdout.
+func initMailer() (mail.Mailer, error) {
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		var auth smtp.Auth
+		if username := os.Getenv("SMTP_USERNAME"); username != "" {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, fmt.Errorf("bad SMTP_ADDR: %w", err)
+			}
+			auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		return mail.NewSMTPMailer(addr, os.Getenv("SMTP_FROM"), auth), nil
+	}
+	if path := os.Getenv("MAIL_LOG_FILE"); path != "" {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("fail to open MAIL_LOG_FILE: %w", err)
+		}
+		return mail.NewLogMailer(f), nil
+	}
+	return mail.NewLogMailer(os.Stdout), nil
+}
+
+// initOIDCProvider discovers the provider named by OIDC_ISSUER, it returns
+// nil if external login is not configured.
+func initOIDCProvider() (*oidc.Provider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return oidc.NewProvider(ctx, oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+	}, &http.Client{Timeout: 10 * time.Second})
+}
+
+// grantAdmins gives the admin role to the comma separated
+// ADMIN_USERNAMES, names not registered yet are skipped. It only
+// bootstraps: once there is an admin, roles are changed through the API.
+func grantAdmins(users user.UserRepo, roles policy.RoleRepo, logger *zap.SugaredLogger) error {
+	admins, err := roles.Count(policy.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+	for _, name := range strings.Split(os.Getenv("ADMIN_USERNAMES"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		u, err := users.GetByUsername(name)
+		if errors.Is(err, user.ErrNoUser) {
+			logger.Warnf("no user %v to make admin", name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = roles.SetRole(u.ID, policy.RoleAdmin); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func main() {
@@ -69,7 +219,7 @@ func main() {
 	// }
 	// panic(strings.Join(dirs, " "))
 
-	collection, err := initMongoDB()
+	mongoDB, err := initMongoDB()
 	if err != nil {
 		panic(err)
 	}
@@ -94,6 +244,10 @@ func main() {
 	}()
 	logger := zapLogger.Sugar()
 
+	// background workers stop, and flush what they buffered, on shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	userRepo := user.NewMysqlRepo(db, logger)
 
 	sm := session.NewSessionsManagerMySQL(
@@ -102,20 +256,181 @@ func main() {
 		tokenSecret,
 		logger,
 	)
+	apiTokens := apitoken.NewMysqlRepo(db, logger)
+	roleRepo := policy.NewMysqlRepo(db, logger)
+	// routes check api tokens and bans too, session handlers keep sm
+	auth := policy.NewSessions(apitoken.NewSessions(sm, apiTokens, userRepo), roleRepo)
+
+	mailer, err := initMailer()
+	if err != nil {
+		panic(err)
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "redditclone"
+	}
+	twoFactorRepo := twofactor.NewMysqlRepo(db, logger, issuer)
 
 	userHandler := &handlers.UserHandler{
+		UserRepo:  userRepo,
+		Logger:    logger,
+		Sessions:  sm,
+		Mailer:    mailer,
+		TwoFactor: twoFactorRepo,
+	}
+
+	twoFactorHandler := &handlers.TwoFactorHandler{
+		Logger:    logger,
+		UserRepo:  userRepo,
+		Sessions:  sm,
+		TwoFactor: twoFactorRepo,
+	}
+
+	oidcProvider, err := initOIDCProvider()
+	if err != nil {
+		panic(err)
+	}
+	// with SSO_ONLY accounts are created and signed in only through the
+	// provider
+	ssoOnly := oidcProvider != nil && os.Getenv("SSO_ONLY") == "true"
+
+	postRepo := post.NewMongoDBRepo(
+		mongoDB.Collection(os.Getenv("MONGO_COLLECTION")),
+		mongoCollection(mongoDB, "MONGO_COMMENTS_COLLECTION", "comments"),
+		mongoCollection(mongoDB, "MONGO_VOTES_COLLECTION", "votes"),
+		mongoCollection(mongoDB, "MONGO_POLL_VOTES_COLLECTION", "poll_votes"),
+	)
+	err = postRepo.EnsureIndexes(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	unfurler := unfurl.NewUnfurler(postRepo, logger, unfurl.Config{})
+	unfurler.Start(ctx)
+	// views are flushed for the last time once requests are drained
+	viewsCtx, stopViews := context.WithCancel(context.Background())
+	viewCounter := views.NewCounter(postRepo, logger, views.Config{})
+	viewCounter.Start(viewsCtx)
+	purgeConfig, err := initPurgeConfig()
+	if err != nil {
+		panic(err)
+	}
+	purger := purge.NewPurger(postRepo, logger, purgeConfig)
+	purger.Start(ctx)
+
+	blobStore, err := storage.NewLocalStore(os.Getenv("UPLOAD_DIR"))
+	if err != nil {
+		panic(err)
+	}
+
+	controlsRepo := controls.NewMysqlRepo(db, logger)
+	notificationRepo := notification.NewMysqlRepo(db, logger)
+	digestInterval, err := initDigestInterval()
+	if err != nil {
+		panic(err)
+	}
+	digester := notification.NewDigester(notificationRepo, userRepo, mailer, logger, digestInterval)
+	if digestInterval > 0 {
+		digester.Start(ctx)
+	}
+	hub := events.NewHub()
+
+	if err = grantAdmins(userRepo, roleRepo, logger); err != nil {
+		panic(err)
+	}
+	authorizer := policy.New(roleRepo)
+
+	postHandler := &handlers.PostHandler{
+		PostRepo: notification.NewPostRepo(events.NewPostRepo(postRepo, hub), notificationRepo, userRepo, controlsRepo, logger),
+		Logger:   logger,
+		Unfurler: unfurler,
+		Uploader: upload.NewUploader(blobStore, "/api/files/"),
+		Saved:    saved.NewMysqlRepo(db, logger),
+		Controls: controlsRepo,
+		Views:    viewCounter,
+		Policy:   authorizer,
+		// deleted posts and comments can be restored until they are purged
+		RestoreWindow: purgeConfig.Retention,
+	}
+
+	controlsHandler := &handlers.ControlsHandler{
+		Logger:   logger,
+		Controls: controlsRepo,
+		PostRepo: postRepo,
 		UserRepo: userRepo,
+	}
+
+	profileHandler := &handlers.ProfileHandler{
 		Logger:   logger,
-		Sessions: sm,
+		UserRepo: userRepo,
+		PostRepo: postRepo,
+		Controls: controlsRepo,
 	}
 
-	postRepo := post.NewMongoDBRepo(collection)
-	postHandler := &handlers.PostHandler{
+	messageRepo := message.NewMysqlRepo(db, logger)
+	accountHandler := &handlers.AccountHandler{
+		Logger:        logger,
+		UserRepo:      userRepo,
+		PostRepo:      postRepo,
+		Messages:      messageRepo,
+		Notifications: notificationRepo,
+		Roles:         roleRepo,
+		Tokens:        apiTokens,
+		Sessions:      sm,
+		Mailer:        mailer,
+		Blobs:         blobStore,
+	}
+
+	roleHandler := &handlers.RoleHandler{
+		Logger:   logger,
+		UserRepo: userRepo,
+		Roles:    roleRepo,
+		Bans:     roleRepo,
+		Policy:   authorizer,
+	}
+
+	tokenHandler := &handlers.TokenHandler{
+		Logger: logger,
+		Tokens: apiTokens,
+	}
+
+	// streams never end on their own, shutdown has to cut them
+	streams, stopStreams := context.WithCancel(context.Background())
+	defer stopStreams()
+	eventsHandler := &handlers.EventsHandler{
+		Logger:   logger,
+		Hub:      hub,
 		PostRepo: postRepo,
+		Controls: controlsRepo,
+		Done:     streams.Done(),
+	}
+
+	messageHandler := &handlers.MessageHandler{
 		Logger:   logger,
+		Messages: messageRepo,
+		UserRepo: userRepo,
+		Controls: controlsRepo,
+		Limit:    message.DefaultLimit,
+	}
+
+	notificationHandler := &handlers.NotificationHandler{
+		Logger:        logger,
+		Notifications: notificationRepo,
+	}
+
+	fileHandler := &handlers.FileHandler{
+		Logger: logger,
+		Store:  blobStore,
+	}
+
+	spec, err := openapi.Load()
+	if err != nil {
+		panic(err)
 	}
 
 	router := mux.NewRouter()
+	router.Use(middleware.RecordRoute)
+	router.Use(openapi.Validate(spec))
 
 	staticDir := os.Getenv("STATIC_DIR")
 	routerStatic := router.PathPrefix("/static/").Subrouter()
@@ -125,20 +440,81 @@ func main() {
 	)
 	routerStatic.PathPrefix("/").Handler(staticHandler).Methods("GET")
 
-	router.HandleFunc("/api/register", userHandler.Register).Methods("POST")
-	router.HandleFunc("/api/login", userHandler.Login).Methods("POST")
-	router.HandleFunc("/api/posts/", postHandler.List).Methods("GET")
-	router.HandleFunc("/api/posts/{CATEGORY_NAME}", postHandler.ListByCategory).Methods("GET")
-	router.HandleFunc("/api/post/{POST_ID}", postHandler.GetByID).Methods("GET")
-	router.HandleFunc("/api/user/{USER_LOGIN}", postHandler.GetUserPosts).Methods("GET")
-
-	router.Handle("/api/posts", middleware.Auth(sm, http.HandlerFunc(postHandler.Add))).Methods("POST")
-	router.Handle("/api/post/{POST_ID}", middleware.Auth(sm, http.HandlerFunc(postHandler.AddComment))).Methods("POST")
-	router.Handle("/api/post/{POST_ID}/{COMMENT_ID}", middleware.Auth(sm, http.HandlerFunc(postHandler.DeleteComment))).Methods("DELETE")
-	router.Handle("/api/post/{POST_ID}/upvote", middleware.Auth(sm, http.HandlerFunc(postHandler.Upvote))).Methods("GET")
-	router.Handle("/api/post/{POST_ID}/downvote", middleware.Auth(sm, http.HandlerFunc(postHandler.Downvote))).Methods("GET")
-	router.Handle("/api/post/{POST_ID}/unvote", middleware.Auth(sm, http.HandlerFunc(postHandler.Unvote))).Methods("GET")
-	router.Handle("/api/post/{POST_ID}", middleware.Auth(sm, http.HandlerFunc(postHandler.Delete))).Methods("DELETE")
+	router.Handle("/api/openapi.json", openapi.Handler()).Methods("GET")
+	if !ssoOnly {
+		router.HandleFunc("/api/register", userHandler.Register).Methods("POST")
+		router.HandleFunc("/api/login", userHandler.Login).Methods("POST")
+		router.HandleFunc("/api/login/2fa", twoFactorHandler.Login).Methods("POST")
+		router.HandleFunc("/api/password/reset", accountHandler.RequestPasswordReset).Methods("POST")
+		router.HandleFunc("/api/password/reset/confirm", accountHandler.ResetPassword).Methods("POST")
+	}
+	if oidcProvider != nil {
+		oidcHandler := &handlers.OIDCHandler{
+			Logger:         logger,
+			Provider:       oidcProvider,
+			Identities:     oidc.NewIdentityMysqlRepo(db, logger),
+			UserRepo:       userRepo,
+			Sessions:       sm,
+			InsecureCookie: os.Getenv("OIDC_INSECURE_COOKIE") == "true",
+		}
+		router.HandleFunc("/api/oidc/login", oidcHandler.Login).Methods("GET")
+		router.HandleFunc("/api/oidc/callback", oidcHandler.Callback).Methods("GET")
+		router.Handle("/api/me/oidc/link", middleware.Auth(auth, http.HandlerFunc(oidcHandler.Link))).Methods("POST")
+	}
+	router.HandleFunc("/api/email/verify", accountHandler.VerifyEmail).Methods("POST")
+	router.Handle("/api/posts/", middleware.OptionalAuth(auth, http.HandlerFunc(postHandler.List), apitoken.ScopeRead)).Methods("GET")
+	router.Handle("/api/posts/{CATEGORY_NAME}", middleware.OptionalAuth(auth, http.HandlerFunc(postHandler.ListByCategory), apitoken.ScopeRead)).Methods("GET")
+	router.Handle("/api/post/{POST_ID}", middleware.OptionalAuth(auth, http.HandlerFunc(postHandler.GetByID), apitoken.ScopeRead)).Methods("GET")
+	router.Handle("/api/post/{POST_ID}/comments", middleware.OptionalAuth(auth, http.HandlerFunc(postHandler.ListComments), apitoken.ScopeRead)).Methods("GET")
+	router.Handle("/api/post/{POST_ID}/events", middleware.OptionalAuth(auth, http.HandlerFunc(eventsHandler.Stream), apitoken.ScopeRead)).Methods("GET")
+	router.Handle("/api/user/{USER_LOGIN}", middleware.OptionalAuth(auth, http.HandlerFunc(postHandler.GetUserPosts), apitoken.ScopeRead)).Methods("GET")
+	router.Handle("/api/user/{USER_LOGIN}/profile", middleware.OptionalAuth(auth, http.HandlerFunc(profileHandler.Get), apitoken.ScopeRead)).Methods("GET")
+	router.HandleFunc("/api/files/{KEY}", fileHandler.Get).Methods("GET")
+
+	router.Handle("/api/me/profile", middleware.Auth(auth, http.HandlerFunc(profileHandler.Update))).Methods("PUT")
+	router.Handle("/api/me", middleware.Auth(auth, http.HandlerFunc(accountHandler.Delete))).Methods("DELETE")
+	router.Handle("/api/me/export", middleware.Auth(auth, http.HandlerFunc(accountHandler.Export))).Methods("GET")
+	router.Handle("/api/me/password", middleware.Auth(auth, http.HandlerFunc(accountHandler.ChangePassword))).Methods("POST")
+	router.Handle("/api/me/email/resend", middleware.Auth(auth, http.HandlerFunc(accountHandler.ResendVerification))).Methods("POST")
+	router.Handle("/api/me/2fa", middleware.Auth(auth, http.HandlerFunc(twoFactorHandler.Enroll))).Methods("POST")
+	router.Handle("/api/me/2fa/confirm", middleware.Auth(auth, http.HandlerFunc(twoFactorHandler.Confirm))).Methods("POST")
+	router.Handle("/api/me/2fa", middleware.Auth(auth, http.HandlerFunc(twoFactorHandler.Disable))).Methods("DELETE")
+	router.Handle("/api/me/tokens", middleware.Auth(auth, http.HandlerFunc(tokenHandler.List))).Methods("GET")
+	router.Handle("/api/me/tokens", middleware.Auth(auth, http.HandlerFunc(tokenHandler.Create))).Methods("POST")
+	router.Handle("/api/me/tokens/{TOKEN_ID}", middleware.Auth(auth, http.HandlerFunc(tokenHandler.Revoke))).Methods("DELETE")
+	router.Handle("/api/posts", middleware.Auth(auth, http.HandlerFunc(postHandler.Add), apitoken.ScopePost)).Methods("POST")
+	router.Handle("/api/post/{POST_ID}", middleware.Auth(auth, http.HandlerFunc(postHandler.AddComment), apitoken.ScopeComment)).Methods("POST")
+	router.Handle("/api/post/{POST_ID}/{COMMENT_ID}", middleware.Auth(auth, http.HandlerFunc(postHandler.DeleteComment), apitoken.ScopeComment)).Methods("DELETE")
+	router.Handle("/api/post/{POST_ID}/upvote", middleware.Auth(auth, http.HandlerFunc(postHandler.Upvote), apitoken.ScopeVote)).Methods("GET")
+	router.Handle("/api/post/{POST_ID}/downvote", middleware.Auth(auth, http.HandlerFunc(postHandler.Downvote), apitoken.ScopeVote)).Methods("GET")
+	router.Handle("/api/post/{POST_ID}/unvote", middleware.Auth(auth, http.HandlerFunc(postHandler.Unvote), apitoken.ScopeVote)).Methods("GET")
+	router.Handle("/api/post/{POST_ID}", middleware.Auth(auth, http.HandlerFunc(postHandler.Delete), apitoken.ScopePost)).Methods("DELETE")
+	router.Handle("/api/post/{POST_ID}/restore", middleware.Auth(auth, http.HandlerFunc(postHandler.Restore), apitoken.ScopePost)).Methods("POST")
+	router.Handle("/api/post/{POST_ID}/{COMMENT_ID}/restore", middleware.Auth(auth, http.HandlerFunc(postHandler.RestoreComment), apitoken.ScopeComment)).Methods("POST")
+	router.Handle("/api/post/{POST_ID}/poll/{OPTION}", middleware.Auth(auth, http.HandlerFunc(postHandler.VotePoll), apitoken.ScopeVote)).Methods("POST")
+	router.Handle("/api/post/{POST_ID}/save", middleware.Auth(auth, http.HandlerFunc(postHandler.Save))).Methods("POST")
+	router.Handle("/api/post/{POST_ID}/unsave", middleware.Auth(auth, http.HandlerFunc(postHandler.Unsave))).Methods("POST")
+	router.Handle("/api/post/{POST_ID}/{COMMENT_ID}/save", middleware.Auth(auth, http.HandlerFunc(postHandler.Save))).Methods("POST")
+	router.Handle("/api/post/{POST_ID}/{COMMENT_ID}/unsave", middleware.Auth(auth, http.HandlerFunc(postHandler.Unsave))).Methods("POST")
+	router.Handle("/api/saved", middleware.Auth(auth, http.HandlerFunc(postHandler.ListSaved), apitoken.ScopeRead)).Methods("GET")
+	router.Handle("/api/post/{POST_ID}/hide", middleware.Auth(auth, http.HandlerFunc(controlsHandler.Hide))).Methods("POST")
+	router.Handle("/api/post/{POST_ID}/unhide", middleware.Auth(auth, http.HandlerFunc(controlsHandler.Unhide))).Methods("POST")
+	router.Handle("/api/user/{USER_LOGIN}/block", middleware.Auth(auth, http.HandlerFunc(controlsHandler.Block))).Methods("POST")
+	router.Handle("/api/user/{USER_LOGIN}/unblock", middleware.Auth(auth, http.HandlerFunc(controlsHandler.Unblock))).Methods("POST")
+	router.Handle("/api/user/{USER_LOGIN}/ban", middleware.Auth(auth, http.HandlerFunc(roleHandler.Ban))).Methods("POST")
+	router.Handle("/api/user/{USER_LOGIN}/unban", middleware.Auth(auth, http.HandlerFunc(roleHandler.Unban))).Methods("POST")
+	router.Handle("/api/me/role", middleware.Auth(auth, http.HandlerFunc(roleHandler.Me))).Methods("GET")
+	router.Handle("/api/user/{USER_LOGIN}/role", middleware.Auth(auth, http.HandlerFunc(roleHandler.Set))).Methods("PUT")
+	router.Handle("/api/me/blocked", middleware.Auth(auth, http.HandlerFunc(controlsHandler.ListBlocked))).Methods("GET")
+	router.Handle("/api/notifications", middleware.Auth(auth, http.HandlerFunc(notificationHandler.List), apitoken.ScopeRead)).Methods("GET")
+	router.Handle("/api/notifications/unread_count", middleware.Auth(auth, http.HandlerFunc(notificationHandler.UnreadCount), apitoken.ScopeRead)).Methods("GET")
+	router.Handle("/api/notifications/read", middleware.Auth(auth, http.HandlerFunc(notificationHandler.MarkAllRead))).Methods("POST")
+	router.Handle("/api/notifications/{NOTIFICATION_ID}/read", middleware.Auth(auth, http.HandlerFunc(notificationHandler.MarkRead))).Methods("POST")
+	router.Handle("/api/messages/unread_count", middleware.Auth(auth, http.HandlerFunc(messageHandler.UnreadCount))).Methods("GET")
+	router.Handle("/api/messages/{USER_LOGIN}", middleware.Auth(auth, http.HandlerFunc(messageHandler.Send))).Methods("POST")
+	router.Handle("/api/conversations", middleware.Auth(auth, http.HandlerFunc(messageHandler.ListConversations))).Methods("GET")
+	router.Handle("/api/conversations/{CONVERSATION_ID}", middleware.Auth(auth, http.HandlerFunc(messageHandler.ListMessages))).Methods("GET")
+	router.Handle("/api/conversations/{CONVERSATION_ID}/read", middleware.Auth(auth, http.HandlerFunc(messageHandler.MarkRead))).Methods("POST")
 
 	router.PathPrefix("/").HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
@@ -150,12 +526,35 @@ func main() {
 		},
 	)
 
-	handler := middleware.AccessLog(logger, router)
+	accessLogConfig, err := initAccessLogConfig()
+	if err != nil {
+		panic(err)
+	}
+	handler := middleware.AccessLogWithConfig(logger, accessLogConfig, router)
 	handler = middleware.Panic(logger, handler)
 
+	server := &http.Server{Addr: ":8080", Handler: handler}
+	server.RegisterOnShutdown(stopStreams)
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Errorf("fail to shutdown server: %v", err)
+		}
+	}()
+
 	fmt.Println("listening...")
-	err = http.ListenAndServe(":8080", handler)
-	if err != nil {
+	err = server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
 		panic(err)
 	}
+	<-drained
+	stopViews()
+	viewCounter.Wait()
+	unfurler.Wait()
+	purger.Wait()
+	digester.Wait()
 }
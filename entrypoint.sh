@@ -3,4 +3,7 @@
 echo "Apply database migrations"
 go run /redditclone/migrations/migrate.go
 
+echo "Move embedded comments and votes out of posts"
+go run /redditclone/cmd/migratemongo
+
 ./redditclone
\ No newline at end of file
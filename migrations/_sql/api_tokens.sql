@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS `api_tokens` (
+  `id` BIGINT AUTO_INCREMENT PRIMARY KEY,
+  `token_hash` CHAR(64) NOT NULL UNIQUE,
+  `user_id` VARCHAR(200) NOT NULL,
+  `name` VARCHAR(64) NOT NULL,
+  `scopes` VARCHAR(255) NOT NULL,
+  `created_at` DATETIME NOT NULL,
+  KEY `user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS `blocks` (
+  `user_id` VARCHAR(200) NOT NULL,
+  `blocked_id` VARCHAR(200) NOT NULL,
+  `blocked_at` DATETIME NOT NULL,
+  PRIMARY KEY (`user_id`, `blocked_id`),
+  KEY `blocked_id` (`blocked_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS `conversations` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `user_a` VARCHAR(200) NOT NULL,
+  `user_b` VARCHAR(200) NOT NULL,
+  `updated_at` DATETIME NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `users` (`user_a`, `user_b`),
+  KEY `user_b` (`user_b`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS `email_verifications` (
+  `token_hash` CHAR(64) PRIMARY KEY,
+  `user_id` VARCHAR(200) NOT NULL,
+  `expires_at` DATETIME NOT NULL,
+  `created_at` DATETIME NOT NULL,
+  KEY `user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS `external_identities` (
+  `issuer` VARCHAR(255) NOT NULL,
+  `subject` VARCHAR(255) NOT NULL,
+  `user_id` VARCHAR(200) NOT NULL,
+  PRIMARY KEY (`issuer`, `subject`),
+  KEY `user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
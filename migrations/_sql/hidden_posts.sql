@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS `hidden_posts` (
+  `user_id` VARCHAR(200) NOT NULL,
+  `post_id` VARCHAR(64) NOT NULL,
+  `hidden_at` DATETIME NOT NULL,
+  PRIMARY KEY (`user_id`, `post_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS `login_challenges` (
+  `token_hash` CHAR(64) PRIMARY KEY,
+  `user_id` VARCHAR(200) NOT NULL,
+  `expires_at` DATETIME NOT NULL,
+  `attempts` INT NOT NULL DEFAULT 0,
+  KEY `user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS `messages` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `conversation_id` BIGINT NOT NULL,
+  `sender_id` VARCHAR(200) NOT NULL,
+  `recipient_id` VARCHAR(200) NOT NULL,
+  `body` TEXT NOT NULL,
+  `created_at` DATETIME NOT NULL,
+  `is_read` BOOLEAN NOT NULL DEFAULT FALSE,
+  PRIMARY KEY (`id`),
+  KEY `conversation` (`conversation_id`, `id`),
+  KEY `recipient_unread` (`recipient_id`, `is_read`),
+  KEY `sender_created` (`sender_id`, `created_at`),
+  FOREIGN KEY (`conversation_id`) REFERENCES `conversations` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
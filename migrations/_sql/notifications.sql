@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS `notifications` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `user_id` VARCHAR(200) NOT NULL,
+  `kind` VARCHAR(16) NOT NULL,
+  `actor_id` VARCHAR(200) NOT NULL,
+  `actor_username` VARCHAR(200) NOT NULL,
+  `post_id` VARCHAR(64) NOT NULL,
+  `comment_id` VARCHAR(64) NOT NULL,
+  `created_at` DATETIME NOT NULL,
+  `is_read` BOOLEAN NOT NULL DEFAULT FALSE,
+  PRIMARY KEY (`id`),
+  KEY `user_unread` (`user_id`, `is_read`, `id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,3 @@
+ALTER TABLE `notifications`
+  ADD COLUMN `digest_pending` BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD KEY `digest_pending` (`digest_pending`, `user_id`);
\ No newline at end of file
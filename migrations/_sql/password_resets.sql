@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS `password_resets` (
+  `token_hash` CHAR(64) PRIMARY KEY,
+  `user_id` VARCHAR(200) NOT NULL,
+  `expires_at` DATETIME NOT NULL,
+  KEY `user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
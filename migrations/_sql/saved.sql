@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS `saved` (
+  `user_id` VARCHAR(200) NOT NULL,
+  `post_id` VARCHAR(64) NOT NULL,
+  `comment_id` VARCHAR(64) NOT NULL DEFAULT '',
+  `saved_at` DATETIME NOT NULL,
+  PRIMARY KEY (`user_id`, `post_id`, `comment_id`),
+  KEY `user_saved_at` (`user_id`, `saved_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS `two_factor` (
+  `user_id` VARCHAR(200) PRIMARY KEY,
+  `secret` VARCHAR(64) NOT NULL,
+  `enabled` BOOLEAN NOT NULL DEFAULT FALSE,
+  `last_step` BIGINT NOT NULL DEFAULT 0
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE `two_factor`
+  ADD COLUMN `failures` INT NOT NULL DEFAULT 0,
+  ADD COLUMN `locked_until` DATETIME NULL;
\ No newline at end of file
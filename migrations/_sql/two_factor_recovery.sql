@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS `two_factor_recovery` (
+  `code_hash` CHAR(64) PRIMARY KEY,
+  `user_id` VARCHAR(200) NOT NULL,
+  KEY `user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS `user_bans` (
+  `user_id` VARCHAR(200) PRIMARY KEY,
+  `banned_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS `user_roles` (
+  `user_id` VARCHAR(200) PRIMARY KEY,
+  `role` VARCHAR(32) NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE `users`
+  ADD COLUMN `email` VARCHAR(255) NULL,
+  ADD COLUMN `email_verified` BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD UNIQUE KEY `email` (`email`);
\ No newline at end of file
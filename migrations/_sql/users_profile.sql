@@ -0,0 +1,4 @@
+ALTER TABLE `users`
+  ADD COLUMN `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  ADD COLUMN `bio` VARCHAR(500) NOT NULL DEFAULT '',
+  ADD COLUMN `avatar_url` VARCHAR(2048) NOT NULL DEFAULT '';
\ No newline at end of file
@@ -14,6 +14,25 @@ func migrate(db *sql.DB, migrationsDir string) {
 	files := []string{
 		"sessions.sql",
 		"users.sql",
+		"users_profile.sql",
+		"saved.sql",
+		"hidden_posts.sql",
+		"blocks.sql",
+		"notifications.sql",
+		"conversations.sql",
+		"messages.sql",
+		"password_resets.sql",
+		"users_email.sql",
+		"email_verifications.sql",
+		"two_factor.sql",
+		"two_factor_recovery.sql",
+		"login_challenges.sql",
+		"external_identities.sql",
+		"api_tokens.sql",
+		"user_roles.sql",
+		"user_bans.sql",
+		"two_factor_lockout.sql",
+		"notifications_digest.sql",
 	}
 	for _, filename := range files {
 		filepath := path.Join(migrationsDir, filename)
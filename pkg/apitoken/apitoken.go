@@ -0,0 +1,52 @@
+package apitoken
+
+import (
+	"errors"
+	"time"
+)
+
+// Scopes a token can be given, each route names the one it needs.
+const (
+	ScopeRead    = "read"
+	ScopePost    = "post"
+	ScopeComment = "comment"
+	ScopeVote    = "vote"
+)
+
+var AllScopes = []string{ScopeRead, ScopePost, ScopeComment, ScopeVote}
+
+// Prefix tells API tokens from session tokens.
+const Prefix = "rcpat_"
+
+var ErrNoToken = errors.New("no api token found")
+
+// Token describes an API token, the secret itself is shown only once on
+// creation.
+type Token struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+}
+
+//go:generate mockgen -source=apitoken.go -destination=repo_mock.go -package=apitoken Repo
+type Repo interface {
+	// Create returns the token and its secret, only the hash of the secret
+	// is stored.
+	Create(userID, name string, scopes []string) (Token, string, error)
+	List(userID string) ([]Token, error)
+	Revoke(userID string, id int64) error
+	RevokeAll(userID string) error
+	// Lookup returns the user and the scopes of the secret.
+	Lookup(secret string) (string, []string, error)
+}
+
+// ValidScope reports whether the scope is one of AllScopes.
+func ValidScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package apitoken
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+)
+
+const mysqlDatetimeFormat = "2006-01-02 15:04:05"
+
+type MysqlRepo struct {
+	DB     *sql.DB
+	Logger *zap.SugaredLogger
+	now    func() time.Time
+}
+
+func NewMysqlRepo(db *sql.DB, logger *zap.SugaredLogger) *MysqlRepo {
+	return &MysqlRepo{
+		DB:     db,
+		Logger: logger,
+		now:    time.Now,
+	}
+}
+
+func (repo *MysqlRepo) Create(userID, name string, scopes []string) (Token, string, error) {
+	random, _, err := user.NewToken()
+	if err != nil {
+		return Token{}, "", err
+	}
+	secret := Prefix + random
+	created := repo.now().UTC().Truncate(time.Second)
+	result, err := repo.DB.Exec(
+		"INSERT INTO api_tokens (`token_hash`, `user_id`, `name`, `scopes`, `created_at`) VALUES (?, ?, ?, ?, ?)",
+		user.HashToken(secret),
+		userID,
+		name,
+		strings.Join(scopes, ","),
+		created.Format(mysqlDatetimeFormat),
+	)
+	if err != nil {
+		repo.Logger.Error("in Create api token: ", err)
+		return Token{}, "", err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		repo.Logger.Error("in Create api token, LastInsertId: ", err)
+		return Token{}, "", err
+	}
+	return Token{ID: id, Name: name, Scopes: scopes, Created: created}, secret, nil
+}
+
+func (repo *MysqlRepo) List(userID string) ([]Token, error) {
+	rows, err := repo.DB.Query(
+		"SELECT id, name, scopes, created_at FROM api_tokens WHERE user_id = ? ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		repo.Logger.Error("in List api tokens: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := make([]Token, 0)
+	for rows.Next() {
+		t, scopes, created := Token{}, "", ""
+		if err = rows.Scan(&t.ID, &t.Name, &scopes, &created); err != nil {
+			repo.Logger.Error("in List api tokens, scan: ", err)
+			return nil, err
+		}
+		t.Scopes = splitScopes(scopes)
+		t.Created, err = time.Parse(mysqlDatetimeFormat, created)
+		if err != nil {
+			repo.Logger.Error("in List api tokens, parse created_at: ", err)
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (repo *MysqlRepo) Revoke(userID string, id int64) error {
+	result, err := repo.DB.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		repo.Logger.Error("in Revoke api token: ", err)
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		repo.Logger.Error("in Revoke api token, RowsAffected: ", err)
+		return err
+	}
+	if deleted == 0 {
+		return ErrNoToken
+	}
+	return nil
+}
+
+func (repo *MysqlRepo) RevokeAll(userID string) error {
+	_, err := repo.DB.Exec("DELETE FROM api_tokens WHERE user_id = ?", userID)
+	if err != nil {
+		repo.Logger.Error("in RevokeAll api tokens: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *MysqlRepo) Lookup(secret string) (string, []string, error) {
+	userID, scopes := "", ""
+	err := repo.DB.
+		QueryRow("SELECT user_id, scopes FROM api_tokens WHERE token_hash = ?", user.HashToken(secret)).
+		Scan(&userID, &scopes)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "", nil, ErrNoToken
+	case err != nil:
+		repo.Logger.Error("in Lookup api token: ", err)
+		return "", nil, err
+	}
+	return userID, splitScopes(scopes), nil
+}
+
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
+}
@@ -0,0 +1,101 @@
+package apitoken
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var testNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+	repo.now = func() time.Time { return testNow }
+
+	mock.ExpectExec("INSERT INTO api_tokens").
+		WithArgs(sqlmock.AnyArg(), "1", "bot", "read,post", "2024-05-01 12:00:00").
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	token, secret, err := repo.Create("1", "bot", []string{ScopeRead, ScopePost})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(secret, Prefix))
+	assert.Equal(t, Token{ID: 7, Name: "bot", Scopes: []string{ScopeRead, ScopePost}, Created: testNow}, token)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+	repo.now = func() time.Time { return testNow }
+
+	mock.ExpectQuery(`SELECT id, name, scopes, created_at FROM api_tokens WHERE user_id = \?`).WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "scopes", "created_at"}).
+			AddRow(1, "bot", "read,vote", "2024-05-01 12:00:00"))
+	tokens, err := repo.List("1")
+	assert.Nil(t, err)
+	assert.Equal(t, []Token{{ID: 1, Name: "bot", Scopes: []string{ScopeRead, ScopeVote}, Created: testNow}}, tokens)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRevoke(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+	repo.now = func() time.Time { return testNow }
+	query := `DELETE FROM api_tokens WHERE id = \? AND user_id = \?`
+
+	mock.ExpectExec(query).WithArgs(3, "1").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, repo.Revoke("1", 3))
+
+	// tokens of other users are not found
+	mock.ExpectExec(query).WithArgs(4, "1").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Equal(t, ErrNoToken, repo.Revoke("1", 4))
+
+	mock.ExpectExec(`DELETE FROM api_tokens WHERE user_id = \?`).WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 2))
+	assert.Nil(t, repo.RevokeAll("1"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestLookup(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+	repo.now = func() time.Time { return testNow }
+	query := `SELECT user_id, scopes FROM api_tokens WHERE token_hash = \?`
+
+	mock.ExpectQuery(query).WithArgs(user.HashToken("rcpat_a")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "scopes"}).AddRow("1", "comment"))
+	userID, scopes, err := repo.Lookup("rcpat_a")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", userID)
+	assert.Equal(t, []string{ScopeComment}, scopes)
+
+	mock.ExpectQuery(query).WithArgs(user.HashToken("rcpat_b")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "scopes"}))
+	_, _, err = repo.Lookup("rcpat_b")
+	assert.Equal(t, ErrNoToken, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,41 @@
+package apitoken
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/user"
+)
+
+// Sessions checks API tokens and passes session tokens on, so the auth
+// middleware accepts both. Sessions of API tokens carry their scopes.
+type Sessions struct {
+	session.SessionsManager
+	Tokens Repo
+	Users  user.UserRepo
+}
+
+func NewSessions(sm session.SessionsManager, tokens Repo, users user.UserRepo) *Sessions {
+	return &Sessions{
+		SessionsManager: sm,
+		Tokens:          tokens,
+		Users:           users,
+	}
+}
+
+func (s *Sessions) Check(r *http.Request) (session.Session, error) {
+	secret := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !strings.HasPrefix(secret, Prefix) {
+		return s.SessionsManager.Check(r)
+	}
+	userID, scopes, err := s.Tokens.Lookup(secret)
+	if err != nil {
+		return session.Session{}, session.ErrNoAuth
+	}
+	u, err := s.Users.GetByID(userID)
+	if err != nil {
+		return session.Session{}, session.ErrNoAuth
+	}
+	return session.Session{User: u, APIToken: true, Scopes: scopes}, nil
+}
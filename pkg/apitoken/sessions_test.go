@@ -0,0 +1,42 @@
+package apitoken
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionsCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sm := session.NewMockSessionsManager(ctrl)
+	tokens := NewMockRepo(ctrl)
+	users := user.NewMockUserRepo(ctrl)
+	s := NewSessions(sm, tokens, users)
+	u := user.User{ID: "1", Username: "bot"}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer rcpat_a")
+	tokens.EXPECT().Lookup("rcpat_a").Return("1", []string{ScopeRead}, nil)
+	users.EXPECT().GetByID("1").Return(u, nil)
+	sess, err := s.Check(r)
+	assert.Nil(t, err)
+	assert.Equal(t, session.Session{User: u, APIToken: true, Scopes: []string{ScopeRead}}, sess)
+
+	r.Header.Set("Authorization", "Bearer rcpat_b")
+	tokens.EXPECT().Lookup("rcpat_b").Return("", nil, ErrNoToken)
+	_, err = s.Check(r)
+	assert.Equal(t, session.ErrNoAuth, err)
+
+	// session tokens go to the wrapped manager
+	r.Header.Set("Authorization", "Bearer jwt")
+	sm.EXPECT().Check(r).Return(session.Session{Token: "jwt", User: u}, nil)
+	sess, err = s.Check(r)
+	assert.Nil(t, err)
+	assert.False(t, sess.APIToken)
+}
@@ -2,21 +2,68 @@ package comment
 
 import (
 	"errors"
+	"time"
 
+	"github.com/greatjudge/redditclone/pkg/markdown"
 	"github.com/greatjudge/redditclone/pkg/user"
 )
 
+const MaxBodyLength = 10000
+
+// DeletedBody stands in for the body of a deleted comment that is kept
+// in its thread because it has replies.
+const DeletedBody = "[deleted]"
+
 var (
 	ErrNoComment = errors.New("no comment found")
 )
 
 type Comment struct {
-	Created string    `json:"created" bson:"created"`
-	Author  user.User `json:"author" bson:"author"`
-	ID      string    `json:"id" bson:"id"`
-	Body    string    `json:"body" bson:"body"`
+	Created  string    `json:"created" bson:"created"`
+	Author   user.User `json:"author" bson:"author"`
+	ID       string    `json:"id" bson:"id"`
+	PostID   string    `json:"post_id,omitempty" bson:"post_id,omitempty"`
+	Body     string    `json:"body" bson:"body"`
+	BodyHTML string    `json:"body_html,omitempty" bson:"body_html,omitempty"`
+	// ParentID is the comment this one replies to, empty for top level comments
+	ParentID string `json:"parent_id,omitempty" bson:"parent_id,omitempty"`
+	// ReplyCount counts stored replies, deleted or not
+	ReplyCount int        `json:"-" bson:"reply_count,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	// Saved is set per viewer
+	Saved bool `json:"saved" bson:"-"`
+}
+
+// NewComment keeps the markdown source for editing next to its rendered html.
+func NewComment(author user.User, body string) Comment {
+	return Comment{
+		Author:   author,
+		Body:     body,
+		BodyHTML: markdown.Render(body),
+	}
+}
+
+// Placeholder drops the author and the body of a deleted comment and keeps
+// what places it in the thread.
+func (c Comment) Placeholder() Comment {
+	return Comment{
+		Created:    c.Created,
+		ID:         c.ID,
+		PostID:     c.PostID,
+		Body:       DeletedBody,
+		ParentID:   c.ParentID,
+		ReplyCount: c.ReplyCount,
+		DeletedAt:  c.DeletedAt,
+	}
+}
+
+// Visible tells whether a comment is shown in its thread: deleted comments
+// are shown as placeholders while they have replies.
+func (c Comment) Visible() bool {
+	return c.DeletedAt == nil || c.ReplyCount > 0
 }
 
 type CommentForm struct {
-	Comment string `json:"comment"`
+	Comment  string `json:"comment" valid:"required~is required"` // at most MaxBodyLength
+	ParentID string `json:"parent_id"`
 }
@@ -0,0 +1,26 @@
+package controls
+
+import (
+	"errors"
+
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/user"
+)
+
+var ErrSelfBlock = errors.New("can not block yourself")
+
+// ControlsRepo keeps what each user hid or blocked.
+//
+//go:generate mockgen -source=controls.go -destination=repo_mock.go -package=controls ControlsRepo
+type ControlsRepo interface {
+	// Hide, Unhide, Block and Unblock are idempotent.
+	Hide(userID, postID string) error
+	Unhide(userID, postID string) error
+	Block(userID, blockedID string) error
+	Unblock(userID, blockedID string) error
+	// IsBlocked tells whether userID blocked otherID.
+	IsBlocked(userID, otherID string) (bool, error)
+	ListBlocked(userID string) ([]user.User, error)
+	// Filter is what has to be left out of responses for the user.
+	Filter(userID string) (post.Filter, error)
+}
@@ -0,0 +1,137 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: controls.go
+
+// Package controls is a generated GoMock package.
+package controls
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	post "github.com/greatjudge/redditclone/pkg/post"
+	user "github.com/greatjudge/redditclone/pkg/user"
+)
+
+// MockControlsRepo is a mock of ControlsRepo interface.
+type MockControlsRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockControlsRepoMockRecorder
+}
+
+// MockControlsRepoMockRecorder is the mock recorder for MockControlsRepo.
+type MockControlsRepoMockRecorder struct {
+	mock *MockControlsRepo
+}
+
+// NewMockControlsRepo creates a new mock instance.
+func NewMockControlsRepo(ctrl *gomock.Controller) *MockControlsRepo {
+	mock := &MockControlsRepo{ctrl: ctrl}
+	mock.recorder = &MockControlsRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockControlsRepo) EXPECT() *MockControlsRepoMockRecorder {
+	return m.recorder
+}
+
+// Block mocks base method.
+func (m *MockControlsRepo) Block(userID, blockedID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Block", userID, blockedID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Block indicates an expected call of Block.
+func (mr *MockControlsRepoMockRecorder) Block(userID, blockedID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Block", reflect.TypeOf((*MockControlsRepo)(nil).Block), userID, blockedID)
+}
+
+// Filter mocks base method.
+func (m *MockControlsRepo) Filter(userID string) (post.Filter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Filter", userID)
+	ret0, _ := ret[0].(post.Filter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Filter indicates an expected call of Filter.
+func (mr *MockControlsRepoMockRecorder) Filter(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Filter", reflect.TypeOf((*MockControlsRepo)(nil).Filter), userID)
+}
+
+// Hide mocks base method.
+func (m *MockControlsRepo) Hide(userID, postID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Hide", userID, postID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Hide indicates an expected call of Hide.
+func (mr *MockControlsRepoMockRecorder) Hide(userID, postID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Hide", reflect.TypeOf((*MockControlsRepo)(nil).Hide), userID, postID)
+}
+
+// IsBlocked mocks base method.
+func (m *MockControlsRepo) IsBlocked(userID, otherID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsBlocked", userID, otherID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsBlocked indicates an expected call of IsBlocked.
+func (mr *MockControlsRepoMockRecorder) IsBlocked(userID, otherID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsBlocked", reflect.TypeOf((*MockControlsRepo)(nil).IsBlocked), userID, otherID)
+}
+
+// ListBlocked mocks base method.
+func (m *MockControlsRepo) ListBlocked(userID string) ([]user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListBlocked", userID)
+	ret0, _ := ret[0].([]user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListBlocked indicates an expected call of ListBlocked.
+func (mr *MockControlsRepoMockRecorder) ListBlocked(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListBlocked", reflect.TypeOf((*MockControlsRepo)(nil).ListBlocked), userID)
+}
+
+// Unblock mocks base method.
+func (m *MockControlsRepo) Unblock(userID, blockedID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unblock", userID, blockedID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unblock indicates an expected call of Unblock.
+func (mr *MockControlsRepoMockRecorder) Unblock(userID, blockedID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unblock", reflect.TypeOf((*MockControlsRepo)(nil).Unblock), userID, blockedID)
+}
+
+// Unhide mocks base method.
+func (m *MockControlsRepo) Unhide(userID, postID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unhide", userID, postID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unhide indicates an expected call of Unhide.
+func (mr *MockControlsRepoMockRecorder) Unhide(userID, postID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unhide", reflect.TypeOf((*MockControlsRepo)(nil).Unhide), userID, postID)
+}
@@ -0,0 +1,154 @@
+package controls
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+)
+
+const mysqlDatetimeFormat = "2006-01-02 15:04:05"
+
+type ControlsMysqlRepository struct {
+	DB     *sql.DB
+	Logger *zap.SugaredLogger
+}
+
+func NewMysqlRepo(db *sql.DB, logger *zap.SugaredLogger) *ControlsMysqlRepository {
+	return &ControlsMysqlRepository{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+func now() string {
+	return time.Now().UTC().Format(mysqlDatetimeFormat)
+}
+
+func (repo *ControlsMysqlRepository) Hide(userID, postID string) error {
+	_, err := repo.DB.Exec(
+		"INSERT IGNORE INTO hidden_posts (`user_id`, `post_id`, `hidden_at`) VALUES (?, ?, ?)",
+		userID,
+		postID,
+		now(),
+	)
+	if err != nil {
+		repo.Logger.Error("in Hide: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *ControlsMysqlRepository) Unhide(userID, postID string) error {
+	_, err := repo.DB.Exec(
+		"DELETE FROM hidden_posts WHERE user_id = ? AND post_id = ?",
+		userID,
+		postID,
+	)
+	if err != nil {
+		repo.Logger.Error("in Unhide: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *ControlsMysqlRepository) Block(userID, blockedID string) error {
+	if userID == blockedID {
+		return ErrSelfBlock
+	}
+	_, err := repo.DB.Exec(
+		"INSERT IGNORE INTO blocks (`user_id`, `blocked_id`, `blocked_at`) VALUES (?, ?, ?)",
+		userID,
+		blockedID,
+		now(),
+	)
+	if err != nil {
+		repo.Logger.Error("in Block: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *ControlsMysqlRepository) Unblock(userID, blockedID string) error {
+	_, err := repo.DB.Exec(
+		"DELETE FROM blocks WHERE user_id = ? AND blocked_id = ?",
+		userID,
+		blockedID,
+	)
+	if err != nil {
+		repo.Logger.Error("in Unblock: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *ControlsMysqlRepository) IsBlocked(userID, otherID string) (bool, error) {
+	count := 0
+	err := repo.DB.
+		QueryRow("SELECT COUNT(*) FROM blocks WHERE user_id = ? AND blocked_id = ?", userID, otherID).
+		Scan(&count)
+	if err != nil {
+		repo.Logger.Error("in IsBlocked: ", err)
+		return false, err
+	}
+	return count != 0, nil
+}
+
+func (repo *ControlsMysqlRepository) ListBlocked(userID string) ([]user.User, error) {
+	rows, err := repo.DB.Query(
+		"SELECT MD5(u.id), u.username FROM blocks b JOIN users u ON MD5(u.id) = b.blocked_id "+
+			"WHERE b.user_id = ? ORDER BY b.blocked_at DESC, u.username",
+		userID,
+	)
+	if err != nil {
+		repo.Logger.Error("in ListBlocked: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]user.User, 0)
+	for rows.Next() {
+		usr := user.User{}
+		err = rows.Scan(&usr.ID, &usr.Username)
+		if err != nil {
+			return nil, fmt.Errorf("fail to scan blocked user: %w", err)
+		}
+		users = append(users, usr)
+	}
+	return users, rows.Err()
+}
+
+func (repo *ControlsMysqlRepository) column(query, userID string) ([]string, error) {
+	rows, err := repo.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vals := make([]string, 0)
+	for rows.Next() {
+		val := ""
+		if err = rows.Scan(&val); err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
+	}
+	return vals, rows.Err()
+}
+
+func (repo *ControlsMysqlRepository) Filter(userID string) (post.Filter, error) {
+	hidden, err := repo.column("SELECT post_id FROM hidden_posts WHERE user_id = ?", userID)
+	if err != nil {
+		repo.Logger.Error("in Filter, hidden posts: ", err)
+		return post.Filter{}, err
+	}
+	blocked, err := repo.column("SELECT blocked_id FROM blocks WHERE user_id = ?", userID)
+	if err != nil {
+		repo.Logger.Error("in Filter, blocks: ", err)
+		return post.Filter{}, err
+	}
+	return post.Filter{HiddenPosts: hidden, BlockedUsers: blocked}, nil
+}
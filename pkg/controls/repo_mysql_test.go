@@ -0,0 +1,123 @@
+package controls
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestHideBlock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	mock.ExpectExec(`INSERT IGNORE INTO hidden_posts`).
+		WithArgs("u", "p", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM hidden_posts WHERE user_id = \? AND post_id = \?`).
+		WithArgs("u", "p").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT IGNORE INTO blocks`).
+		WithArgs("u", "b", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM blocks WHERE user_id = \? AND blocked_id = \?`).
+		WithArgs("u", "b").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	for _, err := range []error{
+		repo.Hide("u", "p"),
+		repo.Unhide("u", "p"),
+		repo.Block("u", "b"),
+		repo.Unblock("u", "b"),
+	} {
+		if err != nil {
+			t.Errorf("unexpected err: %s", err)
+		}
+	}
+	if err := repo.Block("u", "u"); err != ErrSelfBlock {
+		t.Errorf("expected ErrSelfBlock, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIsBlocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM blocks WHERE user_id = \? AND blocked_id = \?`).
+		WithArgs("u", "b").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	blocked, err := repo.IsBlocked("u", "b")
+	if err != nil || !blocked {
+		t.Errorf("expected blocked, got %v, %v", blocked, err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListBlocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	mock.ExpectQuery(`SELECT MD5\(u.id\), u.username FROM blocks b JOIN users u`).
+		WithArgs("u").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("b", "bob"))
+	users, err := repo.ListBlocked("u")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	expect := []user.User{user.NewUser("b", "bob", "")}
+	if !reflect.DeepEqual(users, expect) {
+		t.Errorf("results not match, want %v, have %v", expect, users)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	mock.ExpectQuery(`SELECT post_id FROM hidden_posts WHERE user_id = \?`).
+		WithArgs("u").
+		WillReturnRows(sqlmock.NewRows([]string{"post_id"}).AddRow("p1").AddRow("p2"))
+	mock.ExpectQuery(`SELECT blocked_id FROM blocks WHERE user_id = \?`).
+		WithArgs("u").
+		WillReturnRows(sqlmock.NewRows([]string{"blocked_id"}).AddRow("b"))
+
+	f, err := repo.Filter("u")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	expect := post.Filter{HiddenPosts: []string{"p1", "p2"}, BlockedUsers: []string{"b"}}
+	if !reflect.DeepEqual(f, expect) {
+		t.Errorf("results not match, want %v, have %v", expect, f)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,135 @@
+package events
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/greatjudge/redditclone/pkg/comment"
+)
+
+const (
+	TypeCommentAdded   = "comment_added"
+	TypeCommentDeleted = "comment_deleted"
+	TypeScore          = "score"
+	TypePostDeleted    = "post_deleted"
+	// TypeLagged is sent to a subscriber dropped for falling behind
+	TypeLagged = "lagged"
+)
+
+const (
+	DefaultBufferSize     = 16
+	DefaultMaxSubscribers = 10000
+)
+
+var ErrTooManySubscribers = errors.New("too many subscribers")
+
+type Score struct {
+	Score            int `json:"score"`
+	UpvotePercentage int `json:"upvotePercentage"`
+	Votes            int `json:"votes"`
+}
+
+// Event is a change of a post pushed to its subscribers.
+type Event struct {
+	Type      string           `json:"type"`
+	PostID    string           `json:"post_id"`
+	Score     *Score           `json:"score,omitempty"`
+	Comment   *comment.Comment `json:"comment,omitempty"`
+	CommentID string           `json:"comment_id,omitempty"`
+}
+
+// Subscription receives events of one post until it is closed.
+// C is closed when the subscriber falls behind by more than the buffer,
+// Lagged tells this apart from Close.
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	postID string
+	hub    *Hub
+	lagged bool
+}
+
+func (s *Subscription) Close() {
+	s.hub.remove(s, false)
+}
+
+func (s *Subscription) Lagged() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.lagged
+}
+
+// Hub fans out post events. Publish never blocks: a subscriber whose
+// buffer is full is dropped and has to reload the post.
+type Hub struct {
+	BufferSize     int
+	MaxSubscribers int
+
+	mu    sync.Mutex
+	subs  map[string]map[*Subscription]struct{}
+	count int
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		BufferSize:     DefaultBufferSize,
+		MaxSubscribers: DefaultMaxSubscribers,
+		subs:           make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+func (h *Hub) Subscribe(postID string) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count >= h.MaxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+	c := make(chan Event, h.BufferSize)
+	sub := &Subscription{C: c, c: c, postID: postID, hub: h}
+	if h.subs[postID] == nil {
+		h.subs[postID] = make(map[*Subscription]struct{})
+	}
+	h.subs[postID][sub] = struct{}{}
+	h.count++
+	return sub, nil
+}
+
+func (h *Hub) Publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs[e.PostID] {
+		select {
+		case sub.c <- e:
+		default:
+			h.removeLocked(sub, true)
+		}
+	}
+}
+
+// Subscribers counts the open subscriptions.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Hub) remove(sub *Subscription, lagged bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(sub, lagged)
+}
+
+// removeLocked closes the channel once, the hub is the only writer.
+func (h *Hub) removeLocked(sub *Subscription, lagged bool) {
+	subs := h.subs[sub.postID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subs, sub.postID)
+	}
+	h.count--
+	sub.lagged = lagged
+	close(sub.c)
+}
@@ -0,0 +1,66 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublish(t *testing.T) {
+	hub := NewHub()
+	sub, err := hub.Subscribe("p1")
+	assert.Nil(t, err)
+	other, err := hub.Subscribe("p2")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, hub.Subscribers())
+
+	hub.Publish(Event{Type: TypeScore, PostID: "p1"})
+	assert.Equal(t, Event{Type: TypeScore, PostID: "p1"}, <-sub.C)
+	assert.Len(t, other.C, 0)
+
+	sub.Close()
+	sub.Close()
+	_, ok := <-sub.C
+	assert.False(t, ok)
+	assert.False(t, sub.Lagged())
+	assert.Equal(t, 1, hub.Subscribers())
+
+	// publishing to a post nobody listens to is fine
+	hub.Publish(Event{Type: TypeScore, PostID: "p3"})
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	hub := NewHub()
+	hub.BufferSize = 2
+	slow, _ := hub.Subscribe("p1")
+	fast, _ := hub.Subscribe("p1")
+
+	for i := 0; i < 3; i++ {
+		hub.Publish(Event{Type: TypeScore, PostID: "p1"})
+		if i < 2 {
+			<-fast.C
+		}
+	}
+	// slow never read, fast still has the last event
+	assert.Len(t, fast.C, 1)
+	received := 0
+	for range slow.C {
+		received++
+	}
+	assert.Equal(t, 2, received)
+	assert.True(t, slow.Lagged())
+	assert.Equal(t, 1, hub.Subscribers())
+}
+
+func TestMaxSubscribers(t *testing.T) {
+	hub := NewHub()
+	hub.MaxSubscribers = 1
+	sub, err := hub.Subscribe("p1")
+	assert.Nil(t, err)
+	_, err = hub.Subscribe("p2")
+	assert.Equal(t, ErrTooManySubscribers, err)
+
+	sub.Close()
+	_, err = hub.Subscribe("p2")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,87 @@
+package events
+
+import (
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/post"
+)
+
+// PostRepo publishes the changes made through a post.PostRepo.
+type PostRepo struct {
+	post.PostRepo
+	Hub *Hub
+}
+
+func NewPostRepo(repo post.PostRepo, hub *Hub) *PostRepo {
+	return &PostRepo{
+		PostRepo: repo,
+		Hub:      hub,
+	}
+}
+
+func scoreEvent(p post.Post) Event {
+	return Event{
+		Type:   TypeScore,
+		PostID: p.ID,
+		Score: &Score{
+			Score:            p.Score,
+			UpvotePercentage: p.UpvotePercentage,
+			Votes:            p.VoteCount(),
+		},
+	}
+}
+
+func (repo *PostRepo) AddComment(postID string, comm comment.Comment) (comment.Comment, error) {
+	added, err := repo.PostRepo.AddComment(postID, comm)
+	if err != nil {
+		return added, err
+	}
+	repo.Hub.Publish(Event{Type: TypeCommentAdded, PostID: postID, Comment: &added})
+	return added, nil
+}
+
+func (repo *PostRepo) DeleteComment(postID string, commentID string) error {
+	err := repo.PostRepo.DeleteComment(postID, commentID)
+	if err == nil {
+		repo.Hub.Publish(Event{Type: TypeCommentDeleted, PostID: postID, CommentID: commentID})
+	}
+	return err
+}
+
+// RestoreComment publishes a restored comment as added again.
+func (repo *PostRepo) RestoreComment(postID string, commentID string, deletedAfter time.Time) (comment.Comment, error) {
+	restored, err := repo.PostRepo.RestoreComment(postID, commentID, deletedAfter)
+	if err != nil {
+		return restored, err
+	}
+	repo.Hub.Publish(Event{Type: TypeCommentAdded, PostID: postID, Comment: &restored})
+	return restored, nil
+}
+
+func (repo *PostRepo) Upvote(postID string, userID string) (post.Post, error) {
+	return repo.publishScore(repo.PostRepo.Upvote(postID, userID))
+}
+
+func (repo *PostRepo) Downvote(postID string, userID string) (post.Post, error) {
+	return repo.publishScore(repo.PostRepo.Downvote(postID, userID))
+}
+
+func (repo *PostRepo) Unvote(postID string, userID string) (post.Post, error) {
+	return repo.publishScore(repo.PostRepo.Unvote(postID, userID))
+}
+
+func (repo *PostRepo) publishScore(p post.Post, err error) (post.Post, error) {
+	if err == nil {
+		repo.Hub.Publish(scoreEvent(p))
+	}
+	return p, err
+}
+
+func (repo *PostRepo) Delete(postID string) error {
+	err := repo.PostRepo.Delete(postID)
+	if err == nil {
+		repo.Hub.Publish(Event{Type: TypePostDeleted, PostID: postID})
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/vote"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoPublishes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	inner := post.NewMockPostRepo(ctrl)
+	hub := NewHub()
+	repo := NewPostRepo(inner, hub)
+	sub, _ := hub.Subscribe("p1")
+	defer sub.Close()
+
+	inner.EXPECT().AddComment("p1", gomock.Any()).DoAndReturn(
+		func(postID string, c comment.Comment) (comment.Comment, error) {
+			c.ID, c.PostID = "new", postID
+			return c, nil
+		})
+	_, err := repo.AddComment("p1", comment.Comment{Body: "hi"})
+	assert.Nil(t, err)
+	e := <-sub.C
+	assert.Equal(t, TypeCommentAdded, e.Type)
+	assert.Equal(t, "hi", e.Comment.Body)
+	assert.Equal(t, "new", e.Comment.ID)
+
+	inner.EXPECT().Upvote("p1", "u").Return(post.Post{
+		ID:               "p1",
+		Score:            1,
+		UpvotePercentage: 100,
+		Upvotes:          1,
+		Votes:            []vote.Vote{{UserID: "u", Value: 1}},
+	}, nil)
+	_, err = repo.Upvote("p1", "u")
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Type: TypeScore, PostID: "p1", Score: &Score{Score: 1, UpvotePercentage: 100, Votes: 1}}, <-sub.C)
+
+	inner.EXPECT().DeleteComment("p1", "old").Return(nil)
+	err = repo.DeleteComment("p1", "old")
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Type: TypeCommentDeleted, PostID: "p1", CommentID: "old"}, <-sub.C)
+
+	restored := comment.Comment{ID: "old", PostID: "p1", Body: "back"}
+	inner.EXPECT().RestoreComment("p1", "old", gomock.Any()).Return(restored, nil)
+	_, err = repo.RestoreComment("p1", "old", time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Type: TypeCommentAdded, PostID: "p1", Comment: &restored}, <-sub.C)
+
+	// failed changes publish nothing
+	inner.EXPECT().Unvote("p1", "u").Return(post.Post{}, post.ErrNoPost)
+	inner.EXPECT().Delete("p2").Return(post.ErrNoPost)
+	_, _ = repo.Unvote("p1", "u")
+	_ = repo.Delete("p2")
+	assert.Len(t, sub.C, 0)
+
+	inner.EXPECT().Delete("p1").Return(nil)
+	assert.Nil(t, repo.Delete("p1"))
+	assert.Equal(t, Event{Type: TypePostDeleted, PostID: "p1"}, <-sub.C)
+}
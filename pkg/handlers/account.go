@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/apitoken"
+	"github.com/greatjudge/redditclone/pkg/mail"
+	"github.com/greatjudge/redditclone/pkg/message"
+	"github.com/greatjudge/redditclone/pkg/notification"
+	"github.com/greatjudge/redditclone/pkg/policy"
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/sending"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/storage"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+)
+
+// SessionStore lists and ends sessions of a user,
+// session.SessionsManagerMySQL implements it.
+type SessionStore interface {
+	List(userID string) ([]session.Sessions, error)
+	// Revoke ends every session of the user but the except one.
+	Revoke(userID string, except string) error
+}
+
+type AccountHandler struct {
+	Logger        *zap.SugaredLogger
+	UserRepo      user.UserRepo
+	PostRepo      post.PostRepo
+	Messages      message.MessageRepo
+	Notifications notification.NotificationRepo
+	Roles         policy.RoleRepo
+	Tokens        apitoken.Repo
+	Sessions      SessionStore
+	Mailer        mail.Mailer
+	Blobs         storage.BlobStore
+}
+
+type PasswordForm struct {
+	Current  string `json:"current_password" valid:"required"`
+	Password string `json:"new_password" valid:"required,length(8|255)"`
+	// RevokeTokens also revokes every API token of the user.
+	RevokeTokens bool `json:"revoke_api_tokens"`
+}
+
+type ResetRequestForm struct {
+	Username string `json:"username" valid:"required"`
+}
+
+type VerifyForm struct {
+	Token string `json:"token" valid:"required"`
+}
+
+type ResetForm struct {
+	Token    string `json:"token" valid:"required"`
+	Password string `json:"password" valid:"required,length(8|255)"`
+}
+
+// ExportedVote is a vote in the export archive, it names the post voted for.
+type ExportedVote struct {
+	PostID string `json:"post_id"`
+	Vote   int    `json:"vote"`
+}
+
+// Delete removes the account of the logged in user with all their sessions.
+// The content query parameter chooses what happens to their posts and
+// comments: they are anonymized by default or deleted.
+func (h *AccountHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	erase := post.ErasePolicy(r.URL.Query().Get("content"))
+	switch erase {
+	case "":
+		erase = post.EraseAnonymize
+	case post.EraseAnonymize, post.EraseDelete:
+	default:
+		sending.SendFieldErrors(w, []sending.FieldError{{
+			Location: "query",
+			Param:    "content",
+			Value:    string(erase),
+			Msg:      fmt.Sprintf("must be %v or %v", post.EraseAnonymize, post.EraseDelete),
+		}})
+		return
+	}
+	last, err := h.lastAdmin(sess.User.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if last {
+		sending.SendJSONMessage(w, policy.ErrLastAdmin.Error(), http.StatusConflict)
+		return
+	}
+
+	// content goes first: while the account exists a failed erase can be
+	// retried. Image files go before the posts, which are not found by
+	// author once anonymized.
+	err = h.deleteImages(r.Context(), sess.User.ID)
+	if err != nil {
+		h.Logger.Errorf("fail to delete images of %v: %v", sess.User.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = h.PostRepo.EraseUser(sess.User.ID, erase)
+	if err != nil {
+		h.Logger.Errorf("fail to erase content of %v: %v", sess.User.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = h.Notifications.EraseActor(sess.User.ID, post.ErasedAuthor)
+	if err != nil {
+		h.Logger.Errorf("fail to erase notifications by %v: %v", sess.User.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = h.UserRepo.Delete(sess.User.ID)
+	if err != nil {
+		handleUserErrors(err, w)
+		return
+	}
+	h.Logger.Infof("delete account %v, content %v", sess.User.ID, erase)
+	sending.SendJSONMessage(w, "success", http.StatusOK)
+}
+
+// deleteImages removes the files of images the user posted, files gone
+// already are skipped so that a failed deletion can be retried.
+func (h *AccountHandler) deleteImages(ctx context.Context, userID string) error {
+	images, err := h.PostRepo.UserImages(userID)
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		for _, key := range []string{img.Key, img.ThumbnailKey} {
+			err = h.Blobs.Delete(ctx, key)
+			if err != nil && !errors.Is(err, storage.ErrNoBlob) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lastAdmin tells whether the user is the only admin, whose account must
+// stay as their role would.
+func (h *AccountHandler) lastAdmin(userID string) (bool, error) {
+	role, err := h.Roles.Role(userID)
+	if err != nil || role != policy.RoleAdmin {
+		return false, err
+	}
+	admins, err := h.Roles.Count(policy.RoleAdmin)
+	if err != nil {
+		return false, err
+	}
+	return admins <= 1, nil
+}
+
+// Export answers with a zip archive of json files holding everything kept
+// about the logged in user.
+func (h *AccountHandler) Export(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	profile, err := h.UserRepo.GetProfile(sess.User.Username)
+	if err != nil {
+		handleUserErrors(err, w)
+		return
+	}
+	data, err := h.PostRepo.ExportUserData(sess.User.ID)
+	if err != nil {
+		h.Logger.Errorf("fail to export posts of %v: %v", sess.User.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	messages, err := h.Messages.ExportUserData(sess.User.ID)
+	if err != nil {
+		h.Logger.Errorf("fail to export messages of %v: %v", sess.User.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	notifications, err := h.Notifications.ExportUserData(sess.User.ID)
+	if err != nil {
+		h.Logger.Errorf("fail to export notifications of %v: %v", sess.User.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sessions, err := h.Sessions.List(sess.User.ID)
+	if err != nil {
+		h.Logger.Errorf("fail to export sessions of %v: %v", sess.User.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	votes := make([]ExportedVote, len(data.Votes))
+	for i, v := range data.Votes {
+		votes[i] = ExportedVote{PostID: v.PostID, Vote: v.Value}
+	}
+	images, err := h.imageEntries(r.Context(), data.Posts)
+	if err != nil {
+		h.Logger.Errorf("fail to export images of %v: %v", sess.User.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// the archive is built in memory so a failure is still a clean 500
+	archive, err := zipEntries(append([]zipEntry{
+		{"profile.json", profile},
+		{"posts.json", data.Posts},
+		{"comments.json", data.Comments},
+		{"votes.json", votes},
+		{"poll_votes.json", data.PollVotes},
+		{"messages.json", messages},
+		{"notifications.json", notifications},
+		{"sessions.json", sessions},
+	}, images...))
+	if err != nil {
+		h.Logger.Errorf("fail to build export of %v: %v", sess.User.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("export data of %v", sess.User.ID)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%v.zip"`, sess.User.Username))
+	_, err = w.Write(archive)
+	if err != nil {
+		h.Logger.Errorf("fail to send export of %v: %v", sess.User.ID, err)
+	}
+}
+
+// imageEntries reads the files of images in the posts, files deleted
+// already are left out.
+func (h *AccountHandler) imageEntries(ctx context.Context, posts []post.Post) ([]zipEntry, error) {
+	entries := make([]zipEntry, 0)
+	seen := make(map[string]bool)
+	for _, p := range posts {
+		if p.Image == nil || seen[p.Image.Key] {
+			continue
+		}
+		seen[p.Image.Key] = true
+		rc, _, err := h.Blobs.Get(ctx, p.Image.Key)
+		if errors.Is(err, storage.ErrNoBlob) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("fail to read image %v: %w", p.Image.Key, err)
+		}
+		entries = append(entries, zipEntry{"images/" + p.Image.Key, data})
+	}
+	return entries, nil
+}
+
+// zipEntry is a file of the archive, obj is encoded as json unless it
+// holds raw bytes.
+type zipEntry struct {
+	name string
+	obj  any
+}
+
+func zipEntries(entries []zipEntry) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, e := range entries {
+		f, err := zw.Create(e.name)
+		if err != nil {
+			return nil, fmt.Errorf("fail to create %v: %w", e.name, err)
+		}
+		if raw, ok := e.obj.([]byte); ok {
+			if _, err = f.Write(raw); err != nil {
+				return nil, fmt.Errorf("fail to write %v: %w", e.name, err)
+			}
+			continue
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(e.obj); err != nil {
+			return nil, fmt.Errorf("fail to encode %v: %w", e.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("fail to close archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// formFromBody reads and validates a json form, it answers the request
+// itself when the form is bad.
+func formFromBody(w http.ResponseWriter, r *http.Request, form any) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+	if err = json.Unmarshal(body, form); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+	if fieldErrs := validateStruct(form); len(fieldErrs) != 0 {
+		sending.SendFieldErrors(w, fieldErrs)
+		return false
+	}
+	return true
+}
+
+// ChangePassword sets a new password of the logged in user and ends their
+// other sessions, and their API tokens if asked to.
+func (h *AccountHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	form := PasswordForm{}
+	if !formFromBody(w, r, &form) {
+		return
+	}
+	err = h.UserRepo.ChangePassword(sess.User.ID, form.Current, form.Password)
+	if err != nil {
+		handleUserErrors(err, w)
+		return
+	}
+	err = h.Sessions.Revoke(sess.User.ID, sess.Token)
+	if err != nil {
+		h.Logger.Errorf("fail to revoke sessions of %v: %v", sess.User.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if form.RevokeTokens {
+		if err = h.Tokens.RevokeAll(sess.User.ID); err != nil {
+			h.Logger.Errorf("fail to revoke api tokens of %v: %v", sess.User.ID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	h.Logger.Infof("change password of %v", sess.User.ID)
+	sending.SendJSONMessage(w, "success", http.StatusOK)
+}
+
+// RequestPasswordReset mails a reset token to the verified email of the
+// user. The answer is the same whether the user exists or not.
+func (h *AccountHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	form := ResetRequestForm{}
+	if !formFromBody(w, r, &form) {
+		return
+	}
+	u, err := h.UserRepo.GetByUsername(form.Username)
+	switch {
+	case errors.Is(err, user.ErrNoUser):
+		sending.SendJSONMessage(w, "reset token sent", http.StatusOK)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// tokens go only to addresses the user proved to own
+	email, err := h.UserRepo.GetEmail(u.ID)
+	switch {
+	case errors.Is(err, user.ErrNoEmail) || (err == nil && !email.Verified):
+		h.Logger.Infof("no verified email to send password reset of %v", u.ID)
+		sending.SendJSONMessage(w, "reset token sent", http.StatusOK)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	token, err := h.UserRepo.CreatePasswordReset(u.ID, time.Now().Add(user.PasswordResetTTL))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = h.Mailer.Send(mail.Message{
+		To:      email.Address,
+		Subject: "Password reset",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password of %v.\nUse this token within %v to set a new one:\n\n%v\n\nIgnore this message if it was not you.",
+			u.Username, user.PasswordResetTTL, token,
+		),
+	})
+	if err != nil {
+		h.Logger.Errorf("fail to send reset token to %v: %v", u.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("send password reset to %v", u.ID)
+	sending.SendJSONMessage(w, "reset token sent", http.StatusOK)
+}
+
+// ResetPassword sets a new password by a reset token and ends all sessions
+// and API tokens of the user, a reset may follow a takeover.
+func (h *AccountHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	form := ResetForm{}
+	if !formFromBody(w, r, &form) {
+		return
+	}
+	u, err := h.UserRepo.ResetPassword(form.Token, form.Password)
+	if err != nil {
+		handleUserErrors(err, w)
+		return
+	}
+	err = h.Sessions.Revoke(u.ID, "")
+	if err != nil {
+		h.Logger.Errorf("fail to revoke sessions of %v: %v", u.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err = h.Tokens.RevokeAll(u.ID); err != nil {
+		h.Logger.Errorf("fail to revoke api tokens of %v: %v", u.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("reset password of %v", u.ID)
+	sending.SendJSONMessage(w, "success", http.StatusOK)
+}
+
+// sendVerification mails a token that verifies the address of the user.
+func sendVerification(users user.UserRepo, mailer mail.Mailer, u user.User, address string) error {
+	token, err := users.CreateEmailVerification(u.ID, time.Now().Add(user.EmailVerificationTTL))
+	if err != nil {
+		return err
+	}
+	return mailer.Send(mail.Message{
+		To:      address,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Confirm that this is the email of %v with this token within %v:\n\n%v\n\nIgnore this message if you did not register.",
+			u.Username, user.EmailVerificationTTL, token,
+		),
+	})
+}
+
+// ResendVerification mails a new verification token to the logged in user,
+// at most once per user.EmailResendInterval.
+func (h *AccountHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	email, err := h.UserRepo.GetEmail(sess.User.ID)
+	if err != nil {
+		handleUserErrors(err, w)
+		return
+	}
+	if email.Verified {
+		sending.SendJSONMessage(w, "email already verified", http.StatusBadRequest)
+		return
+	}
+	err = sendVerification(h.UserRepo, h.Mailer, sess.User, email.Address)
+	if err != nil {
+		if !errors.Is(err, user.ErrResendTooSoon) {
+			h.Logger.Errorf("fail to send verification to %v: %v", sess.User.ID, err)
+		}
+		handleUserErrors(err, w)
+		return
+	}
+	h.Logger.Infof("resend verification to %v", sess.User.ID)
+	sending.SendJSONMessage(w, "verification sent", http.StatusOK)
+}
+
+// VerifyEmail marks the email of the user verified by a token.
+func (h *AccountHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	form := VerifyForm{}
+	if !formFromBody(w, r, &form) {
+		return
+	}
+	u, err := h.UserRepo.VerifyEmail(form.Token)
+	if err != nil {
+		handleUserErrors(err, w)
+		return
+	}
+	h.Logger.Infof("verify email of %v", u.ID)
+	sending.SendJSONMessage(w, "success", http.StatusOK)
+}
@@ -0,0 +1,531 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/greatjudge/redditclone/pkg/apitoken"
+	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/mail"
+	"github.com/greatjudge/redditclone/pkg/message"
+	"github.com/greatjudge/redditclone/pkg/notification"
+	"github.com/greatjudge/redditclone/pkg/policy"
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/storage"
+	"github.com/greatjudge/redditclone/pkg/upload"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/greatjudge/redditclone/pkg/vote"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeSessions struct {
+	sessions []session.Sessions
+	err      error
+	// revoked records user and except token of every Revoke call
+	revoked [][2]string
+}
+
+func (s *fakeSessions) List(userID string) ([]session.Sessions, error) {
+	return s.sessions, s.err
+}
+
+func (s *fakeSessions) Revoke(userID string, except string) error {
+	s.revoked = append(s.revoked, [2]string{userID, except})
+	return s.err
+}
+
+type failingMailer struct{}
+
+func (failingMailer) Send(msg mail.Message) error {
+	return fmt.Errorf("smtp error")
+}
+
+func accountRequest(method, target string) *http.Request {
+	return accountRequestWithBody(method, target, "")
+}
+
+func accountRequestWithBody(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	sess := session.Session{Token: "current", User: user.User{ID: "1", Username: "u"}}
+	return req.WithContext(session.ContextWithSession(req.Context(), sess))
+}
+
+func TestDeleteAccount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	posts := post.NewMockPostRepo(ctrl)
+	roles := policy.NewMockRoleRepo(ctrl)
+	notifications := notification.NewMockNotificationRepo(ctrl)
+	blobs := storage.NewMockBlobStore(ctrl)
+	service := AccountHandler{
+		Logger:        zap.NewNop().Sugar(),
+		UserRepo:      users,
+		PostRepo:      posts,
+		Notifications: notifications,
+		Roles:         roles,
+		Blobs:         blobs,
+	}
+
+	posts.EXPECT().UserImages("1").Return([]upload.Image{}, nil).AnyTimes()
+	notifications.EXPECT().EraseActor("1", post.ErasedAuthor).Return(nil).AnyTimes()
+	roles.EXPECT().Role("1").Return(policy.RoleUser, nil).Times(4)
+	gomock.InOrder(
+		posts.EXPECT().EraseUser("1", post.EraseAnonymize).Return(nil),
+		users.EXPECT().Delete("1").Return(nil),
+	)
+	w := httptest.NewRecorder()
+	service.Delete(w, accountRequest("DELETE", "/api/me"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	posts.EXPECT().EraseUser("1", post.EraseDelete).Return(nil)
+	users.EXPECT().Delete("1").Return(nil)
+	w = httptest.NewRecorder()
+	service.Delete(w, accountRequest("DELETE", "/api/me?content=delete"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	service.Delete(w, accountRequest("DELETE", "/api/me?content=keep"))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// the account stays when its content could not be erased
+	posts.EXPECT().EraseUser("1", post.EraseAnonymize).Return(fmt.Errorf("db error"))
+	w = httptest.NewRecorder()
+	service.Delete(w, accountRequest("DELETE", "/api/me"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	posts.EXPECT().EraseUser("1", post.EraseAnonymize).Return(nil)
+	users.EXPECT().Delete("1").Return(user.ErrNoUser)
+	w = httptest.NewRecorder()
+	service.Delete(w, accountRequest("DELETE", "/api/me"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	service.Delete(w, httptest.NewRequest("DELETE", "/api/me", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// the last admin keeps the account, one of two may go
+	roles.EXPECT().Role("1").Return(policy.RoleAdmin, nil).Times(2)
+	roles.EXPECT().Count(policy.RoleAdmin).Return(1, nil)
+	w = httptest.NewRecorder()
+	service.Delete(w, accountRequest("DELETE", "/api/me"))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	roles.EXPECT().Count(policy.RoleAdmin).Return(2, nil)
+	posts.EXPECT().EraseUser("1", post.EraseAnonymize).Return(nil)
+	users.EXPECT().Delete("1").Return(nil)
+	w = httptest.NewRecorder()
+	service.Delete(w, accountRequest("DELETE", "/api/me"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	roles.EXPECT().Role("1").Return(policy.Role(""), fmt.Errorf("db error"))
+	w = httptest.NewRecorder()
+	service.Delete(w, accountRequest("DELETE", "/api/me"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestDeleteAccountErasesFiles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	posts := post.NewMockPostRepo(ctrl)
+	roles := policy.NewMockRoleRepo(ctrl)
+	notifications := notification.NewMockNotificationRepo(ctrl)
+	blobs := storage.NewMockBlobStore(ctrl)
+	service := AccountHandler{
+		Logger:        zap.NewNop().Sugar(),
+		UserRepo:      users,
+		PostRepo:      posts,
+		Notifications: notifications,
+		Roles:         roles,
+		Blobs:         blobs,
+	}
+	roles.EXPECT().Role("1").Return(policy.RoleUser, nil).AnyTimes()
+	images := []upload.Image{{Key: "a.png", ThumbnailKey: "a_thumb.jpg"}}
+
+	// a file deleted by an earlier attempt is not an error
+	gomock.InOrder(
+		posts.EXPECT().UserImages("1").Return(images, nil),
+		blobs.EXPECT().Delete(gomock.Any(), "a.png").Return(storage.ErrNoBlob),
+		blobs.EXPECT().Delete(gomock.Any(), "a_thumb.jpg").Return(nil),
+		posts.EXPECT().EraseUser("1", post.EraseAnonymize).Return(nil),
+		notifications.EXPECT().EraseActor("1", post.ErasedAuthor).Return(nil),
+		users.EXPECT().Delete("1").Return(nil),
+	)
+	w := httptest.NewRecorder()
+	service.Delete(w, accountRequest("DELETE", "/api/me"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	posts.EXPECT().UserImages("1").Return(images, nil)
+	blobs.EXPECT().Delete(gomock.Any(), "a.png").Return(fmt.Errorf("disk error"))
+	w = httptest.NewRecorder()
+	service.Delete(w, accountRequest("DELETE", "/api/me"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	posts.EXPECT().UserImages("1").Return(nil, nil)
+	posts.EXPECT().EraseUser("1", post.EraseAnonymize).Return(nil)
+	notifications.EXPECT().EraseActor("1", post.ErasedAuthor).Return(fmt.Errorf("db error"))
+	w = httptest.NewRecorder()
+	service.Delete(w, accountRequest("DELETE", "/api/me"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestExportAccount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	posts := post.NewMockPostRepo(ctrl)
+	messages := message.NewMockMessageRepo(ctrl)
+	notifications := notification.NewMockNotificationRepo(ctrl)
+	blobs := storage.NewMockBlobStore(ctrl)
+	expiration := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	service := AccountHandler{
+		Logger:        zap.NewNop().Sugar(),
+		UserRepo:      users,
+		PostRepo:      posts,
+		Messages:      messages,
+		Notifications: notifications,
+		Sessions:      &fakeSessions{sessions: []session.Sessions{{Token: "secret", UserID: "1", Expiration: expiration}}},
+		Blobs:         blobs,
+	}
+	profile := user.Profile{User: user.User{ID: "1", Username: "u"}, Bio: "bio"}
+	users.EXPECT().GetProfile("u").Return(profile, nil)
+	posts.EXPECT().ExportUserData("1").Return(post.UserData{
+		Posts: []post.Post{
+			{ID: "p1", Title: "mine"},
+			{ID: "p3", Title: "pic", Image: &upload.Image{Key: "a.png"}},
+			{ID: "p4", Title: "gone", Image: &upload.Image{Key: "b.png"}},
+		},
+		Comments:  []comment.Comment{{ID: "c1", PostID: "p2", Body: "hi"}},
+		Votes:     []vote.Vote{{PostID: "p2", UserID: "1", Value: -1}},
+		PollVotes: []post.PollVote{{PostID: "p5", UserID: "1", Option: 2}},
+	}, nil)
+	messages.EXPECT().ExportUserData("1").Return([]message.Message{{ID: 1, Body: "private"}}, nil)
+	notifications.EXPECT().ExportUserData("1").Return([]notification.Notification{{ID: 1, Kind: notification.KindReply}}, nil)
+	blobs.EXPECT().Get(gomock.Any(), "a.png").Return(io.NopCloser(strings.NewReader("png data")), storage.BlobInfo{}, nil)
+	blobs.EXPECT().Get(gomock.Any(), "b.png").Return(nil, storage.BlobInfo{}, storage.ErrNoBlob)
+
+	w := httptest.NewRecorder()
+	service.Export(w, accountRequest("GET", "/api/me/export"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("cant read archive: %v", err)
+	}
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("cant open %v: %v", f.Name, err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	assert.Len(t, files, 9)
+	assert.Contains(t, string(files["profile.json"]), `"bio": "bio"`)
+	assert.Contains(t, string(files["posts.json"]), `"title": "mine"`)
+	assert.Contains(t, string(files["comments.json"]), `"body": "hi"`)
+	votes := []ExportedVote{}
+	assert.Nil(t, json.Unmarshal(files["votes.json"], &votes))
+	assert.Equal(t, []ExportedVote{{PostID: "p2", Vote: -1}}, votes)
+	assert.Contains(t, string(files["messages.json"]), `"body": "private"`)
+	assert.Contains(t, string(files["poll_votes.json"]), `"option": 2`)
+	assert.Contains(t, string(files["notifications.json"]), `"kind": "reply"`)
+	assert.Equal(t, "png data", string(files["images/a.png"]))
+	// session tokens are credentials and are left out
+	assert.NotContains(t, string(files["sessions.json"]), "secret")
+	assert.Contains(t, string(files["sessions.json"]), "2023-01-02T03:04:05Z")
+
+	users.EXPECT().GetProfile("u").Return(profile, nil)
+	posts.EXPECT().ExportUserData("1").Return(post.UserData{}, fmt.Errorf("db error"))
+	w = httptest.NewRecorder()
+	service.Export(w, accountRequest("GET", "/api/me/export"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	users.EXPECT().GetProfile("u").Return(profile, nil)
+	posts.EXPECT().ExportUserData("1").Return(post.UserData{}, nil)
+	messages.EXPECT().ExportUserData("1").Return(nil, fmt.Errorf("db error"))
+	w = httptest.NewRecorder()
+	service.Export(w, accountRequest("GET", "/api/me/export"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	users.EXPECT().GetProfile("u").Return(profile, nil)
+	posts.EXPECT().ExportUserData("1").Return(post.UserData{}, nil)
+	messages.EXPECT().ExportUserData("1").Return([]message.Message{}, nil)
+	notifications.EXPECT().ExportUserData("1").Return(nil, fmt.Errorf("db error"))
+	w = httptest.NewRecorder()
+	service.Export(w, accountRequest("GET", "/api/me/export"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	users.EXPECT().GetProfile("u").Return(profile, nil)
+	posts.EXPECT().ExportUserData("1").Return(post.UserData{
+		Posts: []post.Post{{ID: "p3", Image: &upload.Image{Key: "a.png"}}},
+	}, nil)
+	messages.EXPECT().ExportUserData("1").Return([]message.Message{}, nil)
+	notifications.EXPECT().ExportUserData("1").Return([]notification.Notification{}, nil)
+	blobs.EXPECT().Get(gomock.Any(), "a.png").Return(nil, storage.BlobInfo{}, fmt.Errorf("disk error"))
+	w = httptest.NewRecorder()
+	service.Export(w, accountRequest("GET", "/api/me/export"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	service.Sessions = &fakeSessions{err: fmt.Errorf("db error")}
+	users.EXPECT().GetProfile("u").Return(profile, nil)
+	posts.EXPECT().ExportUserData("1").Return(post.UserData{}, nil)
+	messages.EXPECT().ExportUserData("1").Return([]message.Message{}, nil)
+	notifications.EXPECT().ExportUserData("1").Return([]notification.Notification{}, nil)
+	w = httptest.NewRecorder()
+	service.Export(w, accountRequest("GET", "/api/me/export"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestChangePassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	tokens := apitoken.NewMockRepo(ctrl)
+	sessions := &fakeSessions{}
+	service := AccountHandler{
+		Logger:   zap.NewNop().Sugar(),
+		UserRepo: users,
+		Tokens:   tokens,
+		Sessions: sessions,
+	}
+	body := `{"current_password": "old password", "new_password": "new password"}`
+
+	// the session making the change stays
+	users.EXPECT().ChangePassword("1", "old password", "new password").Return(nil)
+	w := httptest.NewRecorder()
+	service.ChangePassword(w, accountRequestWithBody("POST", "/api/me/password", body))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, [][2]string{{"1", "current"}}, sessions.revoked)
+
+	// api tokens go only when asked
+	users.EXPECT().ChangePassword("1", "old password", "new password").Return(nil)
+	tokens.EXPECT().RevokeAll("1").Return(nil)
+	w = httptest.NewRecorder()
+	service.ChangePassword(w, accountRequestWithBody("POST", "/api/me/password",
+		`{"current_password": "old password", "new_password": "new password", "revoke_api_tokens": true}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	users.EXPECT().ChangePassword("1", "old password", "new password").Return(user.ErrBadPass)
+	w = httptest.NewRecorder()
+	service.ChangePassword(w, accountRequestWithBody("POST", "/api/me/password", body))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Len(t, sessions.revoked, 2)
+
+	w = httptest.NewRecorder()
+	service.ChangePassword(w, accountRequestWithBody("POST", "/api/me/password", `{"current_password": "old password", "new_password": "short"}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = httptest.NewRecorder()
+	service.ChangePassword(w, accountRequestWithBody("POST", "/api/me/password", "{"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	service.ChangePassword(w, httptest.NewRequest("POST", "/api/me/password", strings.NewReader(body)))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	outbox := mail.NewOutbox()
+	service := AccountHandler{
+		Logger:   zap.NewNop().Sugar(),
+		UserRepo: users,
+		Mailer:   outbox,
+	}
+	request := func(body string) *http.Request {
+		return httptest.NewRequest("POST", "/api/password/reset", strings.NewReader(body))
+	}
+	u := user.User{ID: "1", Username: "u"}
+
+	users.EXPECT().GetByUsername("u").Return(u, nil)
+	users.EXPECT().GetEmail("1").Return(user.Email{Address: "u@example.com", Verified: true}, nil)
+	users.EXPECT().CreatePasswordReset("1", gomock.Any()).DoAndReturn(
+		func(userID string, expires time.Time) (string, error) {
+			assert.WithinDuration(t, time.Now().Add(user.PasswordResetTTL), expires, time.Minute)
+			return "reset-token", nil
+		})
+	w := httptest.NewRecorder()
+	service.RequestPasswordReset(w, request(`{"username": "u"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	if sent := outbox.Messages(); assert.Len(t, sent, 1) {
+		assert.Equal(t, "u@example.com", sent[0].To)
+		assert.Contains(t, sent[0].Body, "reset-token")
+	}
+
+	// unknown users and users without a verified email get the same
+	// answer and no mail
+	users.EXPECT().GetByUsername("ghost").Return(user.User{}, user.ErrNoUser)
+	w = httptest.NewRecorder()
+	service.RequestPasswordReset(w, request(`{"username": "ghost"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	users.EXPECT().GetByUsername("u").Return(u, nil)
+	users.EXPECT().GetEmail("1").Return(user.Email{}, user.ErrNoEmail)
+	w = httptest.NewRecorder()
+	service.RequestPasswordReset(w, request(`{"username": "u"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	users.EXPECT().GetByUsername("u").Return(u, nil)
+	users.EXPECT().GetEmail("1").Return(user.Email{Address: "u@example.com"}, nil)
+	w = httptest.NewRecorder()
+	service.RequestPasswordReset(w, request(`{"username": "u"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, outbox.Messages(), 1)
+
+	w = httptest.NewRecorder()
+	service.RequestPasswordReset(w, request(`{}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	service.Mailer = failingMailer{}
+	users.EXPECT().GetByUsername("u").Return(u, nil)
+	users.EXPECT().GetEmail("1").Return(user.Email{Address: "u@example.com", Verified: true}, nil)
+	users.EXPECT().CreatePasswordReset("1", gomock.Any()).Return("reset-token", nil)
+	w = httptest.NewRecorder()
+	service.RequestPasswordReset(w, request(`{"username": "u"}`))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestResetPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	tokens := apitoken.NewMockRepo(ctrl)
+	sessions := &fakeSessions{}
+	service := AccountHandler{
+		Logger:   zap.NewNop().Sugar(),
+		UserRepo: users,
+		Tokens:   tokens,
+		Sessions: sessions,
+	}
+	request := func(body string) *http.Request {
+		return httptest.NewRequest("POST", "/api/password/reset/confirm", strings.NewReader(body))
+	}
+	body := `{"token": "reset-token", "password": "new password"}`
+
+	// every session and api token ends
+	users.EXPECT().ResetPassword("reset-token", "new password").Return(user.User{ID: "1", Username: "u"}, nil)
+	tokens.EXPECT().RevokeAll("1").Return(nil)
+	w := httptest.NewRecorder()
+	service.ResetPassword(w, request(body))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, [][2]string{{"1", ""}}, sessions.revoked)
+
+	users.EXPECT().ResetPassword("reset-token", "new password").Return(user.User{}, user.ErrBadResetToken)
+	w = httptest.NewRecorder()
+	service.ResetPassword(w, request(body))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	service.ResetPassword(w, request(`{"token": "reset-token", "password": "short"}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	users.EXPECT().ResetPassword("reset-token", "new password").Return(user.User{ID: "1", Username: "u"}, nil)
+	tokens.EXPECT().RevokeAll("1").Return(fmt.Errorf("db error"))
+	w = httptest.NewRecorder()
+	service.ResetPassword(w, request(body))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestResendVerification(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	outbox := mail.NewOutbox()
+	service := AccountHandler{
+		Logger:   zap.NewNop().Sugar(),
+		UserRepo: users,
+		Mailer:   outbox,
+	}
+	unverified := user.Email{Address: "u@example.com"}
+
+	users.EXPECT().GetEmail("1").Return(unverified, nil)
+	users.EXPECT().CreateEmailVerification("1", gomock.Any()).DoAndReturn(
+		func(userID string, expires time.Time) (string, error) {
+			assert.WithinDuration(t, time.Now().Add(user.EmailVerificationTTL), expires, time.Minute)
+			return "verify-token", nil
+		})
+	w := httptest.NewRecorder()
+	service.ResendVerification(w, accountRequest("POST", "/api/me/email/resend"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	if sent := outbox.Messages(); assert.Len(t, sent, 1) {
+		assert.Equal(t, "u@example.com", sent[0].To)
+		assert.Contains(t, sent[0].Body, "verify-token")
+	}
+
+	users.EXPECT().GetEmail("1").Return(unverified, nil)
+	users.EXPECT().CreateEmailVerification("1", gomock.Any()).Return("", user.ErrResendTooSoon)
+	w = httptest.NewRecorder()
+	service.ResendVerification(w, accountRequest("POST", "/api/me/email/resend"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Len(t, outbox.Messages(), 1)
+
+	users.EXPECT().GetEmail("1").Return(user.Email{Address: "u@example.com", Verified: true}, nil)
+	w = httptest.NewRecorder()
+	service.ResendVerification(w, accountRequest("POST", "/api/me/email/resend"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	users.EXPECT().GetEmail("1").Return(user.Email{}, user.ErrNoEmail)
+	w = httptest.NewRecorder()
+	service.ResendVerification(w, accountRequest("POST", "/api/me/email/resend"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	service.Mailer = failingMailer{}
+	users.EXPECT().GetEmail("1").Return(unverified, nil)
+	users.EXPECT().CreateEmailVerification("1", gomock.Any()).Return("verify-token", nil)
+	w = httptest.NewRecorder()
+	service.ResendVerification(w, accountRequest("POST", "/api/me/email/resend"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	service := AccountHandler{
+		Logger:   zap.NewNop().Sugar(),
+		UserRepo: users,
+	}
+	request := func(body string) *http.Request {
+		return httptest.NewRequest("POST", "/api/email/verify", strings.NewReader(body))
+	}
+
+	users.EXPECT().VerifyEmail("verify-token").Return(user.User{ID: "1", Username: "u"}, nil)
+	w := httptest.NewRecorder()
+	service.VerifyEmail(w, request(`{"token": "verify-token"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	users.EXPECT().VerifyEmail("used-token").Return(user.User{}, user.ErrBadVerifyToken)
+	w = httptest.NewRecorder()
+	service.VerifyEmail(w, request(`{"token": "used-token"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	service.VerifyEmail(w, request(`{}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
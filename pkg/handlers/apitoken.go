@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/apitoken"
+	"github.com/greatjudge/redditclone/pkg/sending"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"go.uber.org/zap"
+)
+
+type TokenForm struct {
+	Name   string   `json:"name" valid:"required,length(1|64)"`
+	Scopes []string `json:"scopes"`
+}
+
+// CreatedToken holds the secret of a new token, it is never shown again.
+type CreatedToken struct {
+	apitoken.Token
+	Secret string `json:"token"`
+}
+
+type TokenHandler struct {
+	Logger *zap.SugaredLogger
+	Tokens apitoken.Repo
+}
+
+func (h *TokenHandler) List(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	tokens, err := h.Tokens.List(sess.User.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	JSONMarshalAndSend(w, tokens)
+}
+
+// Create makes an API token of the logged in user with the given scopes.
+func (h *TokenHandler) Create(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	form := TokenForm{}
+	if !formFromBody(w, r, &form) {
+		return
+	}
+	if fieldErrs := validateScopes(form.Scopes); len(fieldErrs) != 0 {
+		sending.SendFieldErrors(w, fieldErrs)
+		return
+	}
+	token, secret, err := h.Tokens.Create(sess.User.ID, form.Name, form.Scopes)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("create api token %v of %v with %v", token.ID, sess.User.ID, token.Scopes)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	JSONMarshalAndSend(w, CreatedToken{Token: token, Secret: secret})
+}
+
+func (h *TokenHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["TOKEN_ID"], 10, 64)
+	if err == nil {
+		err = h.Tokens.Revoke(sess.User.ID, id)
+	} else {
+		err = apitoken.ErrNoToken
+	}
+	switch {
+	case errors.Is(err, apitoken.ErrNoToken):
+		sending.SendJSONMessage(w, "invalid token id", http.StatusNotFound)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("revoke api token %v of %v", id, sess.User.ID)
+	sending.SendJSONMessage(w, "success", http.StatusOK)
+}
+
+func validateScopes(scopes []string) []sending.FieldError {
+	if len(scopes) == 0 {
+		return []sending.FieldError{{
+			Location: "body",
+			Param:    "scopes",
+			Msg:      "at least one scope is required",
+		}}
+	}
+	seen := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		if !apitoken.ValidScope(scope) || seen[scope] {
+			return []sending.FieldError{{
+				Location: "body",
+				Param:    "scopes",
+				Value:    scope,
+				Msg:      fmt.Sprintf("must be distinct scopes of %v", strings.Join(apitoken.AllScopes, ", ")),
+			}}
+		}
+		seen[scope] = true
+	}
+	return nil
+}
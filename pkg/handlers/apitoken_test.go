@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/apitoken"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTokens(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tokens := apitoken.NewMockRepo(ctrl)
+	service := TokenHandler{
+		Logger: zap.NewNop().Sugar(),
+		Tokens: tokens,
+	}
+
+	tokens.EXPECT().List("1").Return([]apitoken.Token{{ID: 1, Name: "bot"}}, nil)
+	w := httptest.NewRecorder()
+	service.List(w, accountRequest("GET", "/api/me/tokens"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	scopes := []string{apitoken.ScopeRead, apitoken.ScopePost}
+	tokens.EXPECT().Create("1", "bot", scopes).Return(apitoken.Token{ID: 2, Name: "bot", Scopes: scopes}, "rcpat_secret", nil)
+	w = httptest.NewRecorder()
+	service.Create(w, accountRequestWithBody("POST", "/api/me/tokens", `{"name":"bot","scopes":["read","post"]}`))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	created := CreatedToken{}
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, "rcpat_secret", created.Secret)
+	assert.Equal(t, int64(2), created.ID)
+
+	for _, body := range []string{
+		`{"name":"bot","scopes":["admin"]}`,
+		`{"name":"bot","scopes":["read","read"]}`,
+		`{"name":"bot","scopes":[]}`,
+		`{"scopes":["read"]}`,
+	} {
+		w = httptest.NewRecorder()
+		service.Create(w, accountRequestWithBody("POST", "/api/me/tokens", body))
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+	}
+
+	tokens.EXPECT().Revoke("1", int64(2)).Return(nil)
+	w = httptest.NewRecorder()
+	service.Revoke(w, mux.SetURLVars(accountRequest("DELETE", "/"), map[string]string{"TOKEN_ID": "2"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	tokens.EXPECT().Revoke("1", int64(3)).Return(apitoken.ErrNoToken)
+	w = httptest.NewRecorder()
+	service.Revoke(w, mux.SetURLVars(accountRequest("DELETE", "/"), map[string]string{"TOKEN_ID": "3"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	service.Revoke(w, mux.SetURLVars(accountRequest("DELETE", "/"), map[string]string{"TOKEN_ID": "x"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
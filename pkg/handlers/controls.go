@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/controls"
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/sending"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+)
+
+type ControlsHandler struct {
+	Logger   *zap.SugaredLogger
+	Controls controls.ControlsRepo
+	PostRepo post.PostRepo
+	UserRepo user.UserRepo
+}
+
+func (h *ControlsHandler) Hide(w http.ResponseWriter, r *http.Request) {
+	h.setHidden(w, r, true)
+}
+
+func (h *ControlsHandler) Unhide(w http.ResponseWriter, r *http.Request) {
+	h.setHidden(w, r, false)
+}
+
+func (h *ControlsHandler) setHidden(w http.ResponseWriter, r *http.Request, hide bool) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	postID := mux.Vars(r)["POST_ID"]
+	if !hide {
+		// posts deleted since can still be unhidden
+		if err = h.Controls.Unhide(sess.User.ID, postID); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		h.Logger.Infof("unhide post %v by %v", postID, sess.User.ID)
+		sending.SendJSONMessage(w, "unhidden", http.StatusOK)
+		return
+	}
+
+	posts, err := h.PostRepo.GetByIDs([]string{postID})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(posts) == 0 {
+		handlePostRepoErrors(w, post.ErrNoPost)
+		return
+	}
+	if err = h.Controls.Hide(sess.User.ID, postID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("hide post %v by %v", postID, sess.User.ID)
+	sending.SendJSONMessage(w, "hidden", http.StatusOK)
+}
+
+func (h *ControlsHandler) Block(w http.ResponseWriter, r *http.Request) {
+	h.setBlocked(w, r, true)
+}
+
+func (h *ControlsHandler) Unblock(w http.ResponseWriter, r *http.Request) {
+	h.setBlocked(w, r, false)
+}
+
+func (h *ControlsHandler) setBlocked(w http.ResponseWriter, r *http.Request, block bool) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	username := mux.Vars(r)["USER_LOGIN"]
+	other, err := h.UserRepo.GetByUsername(username)
+	switch {
+	case errors.Is(err, user.ErrNoUser):
+		sending.SendJSONMessage(w, "user not found", http.StatusNotFound)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	message := "unblocked"
+	if block {
+		message = "blocked"
+		err = h.Controls.Block(sess.User.ID, other.ID)
+	} else {
+		err = h.Controls.Unblock(sess.User.ID, other.ID)
+	}
+	switch {
+	case errors.Is(err, controls.ErrSelfBlock):
+		sending.SendJSONMessage(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("%v %v by %v", message, other.ID, sess.User.ID)
+	sending.SendJSONMessage(w, message, http.StatusOK)
+}
+
+func (h *ControlsHandler) ListBlocked(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	users, err := h.Controls.ListBlocked(sess.User.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	JSONMarshalAndSend(w, users)
+}
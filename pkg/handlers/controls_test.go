@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/controls"
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/greatjudge/redditclone/pkg/vote"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestBlock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	controlsRepo := controls.NewMockControlsRepo(ctrl)
+	service := ControlsHandler{
+		Logger:   zap.NewNop().Sugar(),
+		Controls: controlsRepo,
+		UserRepo: users,
+	}
+	bob := user.NewUser("b1", "bob", "")
+
+	users.EXPECT().GetByUsername("bob").Return(bob, nil)
+	controlsRepo.EXPECT().Block("u1", "b1").Return(nil)
+	w := httptest.NewRecorder()
+	service.Block(w, authRequest("POST", "/", map[string]string{"USER_LOGIN": "bob"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	users.EXPECT().GetByUsername("nobody").Return(user.User{}, user.ErrNoUser)
+	w = httptest.NewRecorder()
+	service.Block(w, authRequest("POST", "/", map[string]string{"USER_LOGIN": "nobody"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	users.EXPECT().GetByUsername("u").Return(user.NewUser("u1", "u", ""), nil)
+	controlsRepo.EXPECT().Block("u1", "u1").Return(controls.ErrSelfBlock)
+	w = httptest.NewRecorder()
+	service.Block(w, authRequest("POST", "/", map[string]string{"USER_LOGIN": "u"}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	users.EXPECT().GetByUsername("bob").Return(bob, nil)
+	controlsRepo.EXPECT().Unblock("u1", "b1").Return(nil)
+	w = httptest.NewRecorder()
+	service.Unblock(w, authRequest("POST", "/", map[string]string{"USER_LOGIN": "bob"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	controlsRepo.EXPECT().ListBlocked("u1").Return([]user.User{bob}, nil)
+	w = httptest.NewRecorder()
+	service.ListBlocked(w, authRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"id":"b1","username":"bob"}]`, w.Body.String())
+}
+
+func TestHide(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	posts := post.NewMockPostRepo(ctrl)
+	controlsRepo := controls.NewMockControlsRepo(ctrl)
+	service := ControlsHandler{
+		Logger:   zap.NewNop().Sugar(),
+		Controls: controlsRepo,
+		PostRepo: posts,
+	}
+
+	posts.EXPECT().GetByIDs([]string{"p1"}).Return([]post.Post{{ID: "p1"}}, nil)
+	controlsRepo.EXPECT().Hide("u1", "p1").Return(nil)
+	w := httptest.NewRecorder()
+	service.Hide(w, authRequest("POST", "/", map[string]string{"POST_ID": "p1"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	posts.EXPECT().GetByIDs([]string{"gone"}).Return([]post.Post{}, nil)
+	w = httptest.NewRecorder()
+	service.Hide(w, authRequest("POST", "/", map[string]string{"POST_ID": "gone"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	controlsRepo.EXPECT().Unhide("u1", "gone").Return(nil)
+	w = httptest.NewRecorder()
+	service.Unhide(w, authRequest("POST", "/", map[string]string{"POST_ID": "gone"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestPostsFilteredForViewer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	posts := post.NewMockPostRepo(ctrl)
+	controlsRepo := controls.NewMockControlsRepo(ctrl)
+	service := PostHandler{
+		Logger:   zap.NewNop().Sugar(),
+		PostRepo: posts,
+		Controls: controlsRepo,
+	}
+	bob := user.NewUser("b1", "bob", "")
+	alice := user.NewUser("a1", "alice", "")
+	f := post.Filter{HiddenPosts: []string{"p3"}, BlockedUsers: []string{"b1"}}
+	controlsRepo.EXPECT().Filter("u1").Return(f, nil).AnyTimes()
+
+	// listings pass the filter to the repository
+	posts.EXPECT().GetAll(f).Return([]post.Post{}, nil)
+	w := httptest.NewRecorder()
+	service.List(w, authRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	posts.EXPECT().GetByCategory("music", f).Return([]post.Post{}, nil)
+	w = httptest.NewRecorder()
+	service.ListByCategory(w, authRequest("GET", "/", map[string]string{"CATEGORY_NAME": "music"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// posts of blocked users are not found, their comments are dropped
+	posts.EXPECT().GetByID("p2").Return(post.Post{ID: "p2", Author: bob}, nil)
+	w = httptest.NewRecorder()
+	service.GetByID(w, authRequest("GET", "/", map[string]string{"POST_ID": "p2"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	posts.EXPECT().GetByID("p1").Return(post.Post{ID: "p1", Author: alice}, nil)
+	posts.EXPECT().GetVotes("u1", []string{"p1"}).Return([]vote.Vote{}, nil)
+	posts.EXPECT().GetComments("p1", f, 0, PostCommentsLimit).
+		Return([]comment.Comment{{ID: "c2", Author: alice}}, nil)
+	w = httptest.NewRecorder()
+	service.GetByID(w, authRequest("GET", "/", map[string]string{"POST_ID": "p1"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	got := post.Post{}
+	_ = json.Unmarshal(w.Body.Bytes(), &got)
+	if assert.Len(t, got.Comments, 1) {
+		assert.Equal(t, "c2", got.Comments[0].ID)
+	}
+
+	// hidden posts are left out of a user's posts too
+	posts.EXPECT().GetUserPosts("alice").Return([]post.Post{{ID: "p1", Author: alice}, {ID: "p3", Author: alice}}, nil)
+	posts.EXPECT().GetVotes("u1", []string{"p1"}).Return([]vote.Vote{}, nil)
+	w = httptest.NewRecorder()
+	service.GetUserPosts(w, authRequest("GET", "/", map[string]string{"USER_LOGIN": "alice"}))
+	list := []post.Post{}
+	_ = json.Unmarshal(w.Body.Bytes(), &list)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, "p1", list[0].ID)
+	}
+}
+
+func TestBlockedUserCanNotReply(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	posts := post.NewMockPostRepo(ctrl)
+	controlsRepo := controls.NewMockControlsRepo(ctrl)
+	service := PostHandler{
+		Logger:   zap.NewNop().Sugar(),
+		PostRepo: posts,
+		Controls: controlsRepo,
+	}
+	alice := user.NewUser("a1", "alice", "")
+	posts.EXPECT().GetByID("p1").Return(post.Post{ID: "p1", Author: alice}, nil)
+	controlsRepo.EXPECT().IsBlocked("a1", "u1").Return(true, nil)
+
+	req := authRequest("POST", "/", map[string]string{"POST_ID": "p1"})
+	req.Body = io.NopCloser(bytes.NewBufferString(`{"comment":"hi"}`))
+	w := httptest.NewRecorder()
+	service.AddComment(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// replying to a comment of someone who blocked you is refused too
+	bob := user.NewUser("b1", "bob", "")
+	posts.EXPECT().GetByID("p1").Return(post.Post{ID: "p1", Author: alice}, nil)
+	posts.EXPECT().GetComment("p1", "c1").Return(comment.Comment{ID: "c1", Author: bob}, nil)
+	controlsRepo.EXPECT().IsBlocked("a1", "u1").Return(false, nil)
+	controlsRepo.EXPECT().IsBlocked("b1", "u1").Return(true, nil)
+	req = authRequest("POST", "/", map[string]string{"POST_ID": "p1"})
+	req.Body = io.NopCloser(bytes.NewBufferString(`{"comment":"hi","parent_id":"c1"}`))
+	w = httptest.NewRecorder()
+	service.AddComment(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/controls"
+	"github.com/greatjudge/redditclone/pkg/events"
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/sending"
+	"go.uber.org/zap"
+)
+
+// DefaultKeepAlive keeps proxies from closing an idle stream.
+const DefaultKeepAlive = 25 * time.Second
+
+type EventsHandler struct {
+	Logger    *zap.SugaredLogger
+	Hub       *events.Hub
+	PostRepo  post.PostRepo
+	Controls  controls.ControlsRepo
+	KeepAlive time.Duration
+	// Done ends open streams once closed, so they do not hold up a server
+	// shutdown.
+	Done <-chan struct{}
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	return err
+}
+
+// Stream pushes changes of a post as server-sent events. A client that
+// can not keep up gets a lagged event and the stream ends, it has to
+// reload the post and reconnect.
+func (h *EventsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	postID := mux.Vars(r)["POST_ID"]
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sending.SendJSONMessage(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	posts, err := h.PostRepo.GetByIDs([]string{postID})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(posts) == 0 {
+		handlePostRepoErrors(w, post.ErrNoPost)
+		return
+	}
+	f := post.Filter{}
+	if userID := viewerID(r); userID != "" && h.Controls != nil {
+		f, err = h.Controls.Filter(userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	// posts of blocked users are not found, as in GetByID
+	if f.Blocks(posts[0].Author.ID) {
+		handlePostRepoErrors(w, post.ErrNoPost)
+		return
+	}
+
+	sub, err := h.Hub.Subscribe(postID)
+	switch {
+	case errors.Is(err, events.ErrTooManySubscribers):
+		w.Header().Set("Retry-After", "30")
+		sending.SendJSONMessage(w, "too many listeners, try later", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer sub.Close()
+
+	keepAlive := h.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = DefaultKeepAlive
+	}
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+	h.Logger.Infof("stream events of post %v", postID)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.Done:
+			return
+		case <-ticker.C:
+			if _, err = fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				if sub.Lagged() {
+					_ = writeEvent(w, events.Event{Type: events.TypeLagged, PostID: postID})
+					flusher.Flush()
+				}
+				return
+			}
+			if e.Comment != nil && f.Blocks(e.Comment.Author.ID) {
+				continue
+			}
+			if err = writeEvent(w, e); err != nil {
+				return
+			}
+			if e.Type == events.TypePostDeleted {
+				flusher.Flush()
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/controls"
+	"github.com/greatjudge/redditclone/pkg/events"
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+// readEvent skips comment lines and returns the next event.
+func readEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	e := sseEvent{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && e.name != "":
+			return e
+		case strings.HasPrefix(line, "event: "):
+			e.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func newEventsServer(t *testing.T, ctrl *gomock.Controller) (*httptest.Server, *events.Hub, *post.MockPostRepo) {
+	repo := post.NewMockPostRepo(ctrl)
+	hub := events.NewHub()
+	service := &EventsHandler{
+		Logger:    zap.NewNop().Sugar(),
+		Hub:       hub,
+		PostRepo:  repo,
+		KeepAlive: time.Hour,
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/post/{POST_ID}/events", service.Stream)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, hub, repo
+}
+
+// waitSubscribers waits for the handler to subscribe before publishing.
+func waitSubscribers(t *testing.T, hub *events.Hub, count int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for hub.Subscribers() != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("want %v subscribers, have %v", count, hub.Subscribers())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStream(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	server, hub, repo := newEventsServer(t, ctrl)
+
+	repo.EXPECT().GetByIDs([]string{"p1"}).Return([]post.Post{{ID: "p1"}}, nil)
+	resp, err := http.Get(server.URL + "/api/post/p1/events")
+	if err != nil {
+		t.Fatalf("fail to connect: %v", err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	waitSubscribers(t, hub, 1)
+
+	body := bufio.NewReader(resp.Body)
+	hub.Publish(events.Event{Type: events.TypeScore, PostID: "p1", Score: &events.Score{Score: 3}})
+	hub.Publish(events.Event{
+		Type:    events.TypeCommentAdded,
+		PostID:  "p1",
+		Comment: &comment.Comment{ID: "c1", Author: user.NewUser("a", "alice", "")},
+	})
+
+	e := readEvent(t, body)
+	assert.Equal(t, events.TypeScore, e.name)
+	got := events.Event{}
+	assert.Nil(t, json.Unmarshal([]byte(e.data), &got))
+	assert.Equal(t, 3, got.Score.Score)
+
+	e = readEvent(t, body)
+	assert.Equal(t, events.TypeCommentAdded, e.name)
+
+	// the stream ends with the post
+	hub.Publish(events.Event{Type: events.TypePostDeleted, PostID: "p1"})
+	e = readEvent(t, body)
+	assert.Equal(t, events.TypePostDeleted, e.name)
+	waitSubscribers(t, hub, 0)
+}
+
+func TestStreamLagged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	server, hub, repo := newEventsServer(t, ctrl)
+	hub.BufferSize = 1
+
+	repo.EXPECT().GetByIDs([]string{"p1"}).Return([]post.Post{{ID: "p1"}}, nil)
+	resp, err := http.Get(server.URL + "/api/post/p1/events")
+	if err != nil {
+		t.Fatalf("fail to connect: %v", err)
+	}
+	defer resp.Body.Close()
+	waitSubscribers(t, hub, 1)
+
+	// a burst the handler can not take at once drops the subscriber
+	for i := 0; i < 100 && hub.Subscribers() != 0; i++ {
+		hub.Publish(events.Event{Type: events.TypeScore, PostID: "p1", Score: &events.Score{}})
+	}
+	assert.Equal(t, 0, hub.Subscribers())
+
+	body := bufio.NewReader(resp.Body)
+	for {
+		e := readEvent(t, body)
+		if e.name == events.TypeLagged {
+			break
+		}
+		assert.Equal(t, events.TypeScore, e.name)
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	server, hub, repo := newEventsServer(t, ctrl)
+
+	repo.EXPECT().GetByIDs([]string{"gone"}).Return([]post.Post{}, nil)
+	resp, err := http.Get(server.URL + "/api/post/gone/events")
+	if err != nil {
+		t.Fatalf("fail to connect: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	hub.MaxSubscribers = 0
+	repo.EXPECT().GetByIDs([]string{"p1"}).Return([]post.Post{{ID: "p1"}}, nil)
+	resp, err = http.Get(server.URL + "/api/post/p1/events")
+	if err != nil {
+		t.Fatalf("fail to connect: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestStreamBlockedAuthor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := post.NewMockPostRepo(ctrl)
+	controlsRepo := controls.NewMockControlsRepo(ctrl)
+	service := &EventsHandler{
+		Logger:   zap.NewNop().Sugar(),
+		Hub:      events.NewHub(),
+		PostRepo: repo,
+		Controls: controlsRepo,
+	}
+
+	repo.EXPECT().GetByIDs([]string{"p1"}).Return([]post.Post{{ID: "p1", Author: user.User{ID: "a"}}}, nil)
+	controlsRepo.EXPECT().Filter("u1").Return(post.Filter{BlockedUsers: []string{"a"}}, nil)
+	w := httptest.NewRecorder()
+	service.Stream(w, authRequest("GET", "/api/post/p1/events", map[string]string{"POST_ID": "p1"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, 0, service.Hub.Subscribers())
+}
+
+func TestStreamShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := post.NewMockPostRepo(ctrl)
+	done := make(chan struct{})
+	service := &EventsHandler{
+		Logger:    zap.NewNop().Sugar(),
+		Hub:       events.NewHub(),
+		PostRepo:  repo,
+		KeepAlive: time.Hour,
+		Done:      done,
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/post/{POST_ID}/events", service.Stream)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	repo.EXPECT().GetByIDs([]string{"p1"}).Return([]post.Post{{ID: "p1"}}, nil)
+	resp, err := http.Get(server.URL + "/api/post/p1/events")
+	if err != nil {
+		t.Fatalf("fail to connect: %v", err)
+	}
+	defer resp.Body.Close()
+	waitSubscribers(t, service.Hub, 1)
+
+	close(done)
+	_, err = io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	waitSubscribers(t, service.Hub, 0)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/sending"
+	"github.com/greatjudge/redditclone/pkg/storage"
+	"go.uber.org/zap"
+)
+
+type FileHandler struct {
+	Logger *zap.SugaredLogger
+	Store  storage.BlobStore
+}
+
+// Get serves an uploaded file. Keys are derived from the content,
+// so responses may be cached forever.
+func (h *FileHandler) Get(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["KEY"]
+	rc, info, err := h.Store.Get(r.Context(), key)
+	switch {
+	case errors.Is(err, storage.ErrNoBlob), errors.Is(err, storage.ErrInvalidKey):
+		sending.SendJSONMessage(w, "file not found", http.StatusNotFound)
+		return
+	case err != nil:
+		h.Logger.Errorf("fail to get file %v: %v", key, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	etag := `"` + key + `"`
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+
+	if rs, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", info.ModTime, rs)
+		return
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	if _, err = io.Copy(w, rc); err != nil {
+		h.Logger.Infof("fail to send file %v: %v", key, err)
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestFileGet(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	_ = store.Put(context.Background(), "abc.png", strings.NewReader("png data"), "image/png")
+
+	service := FileHandler{Logger: zap.NewNop().Sugar(), Store: store}
+	get := func(key string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/files/"+key, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req = mux.SetURLVars(req, map[string]string{"KEY": key})
+		w := httptest.NewRecorder()
+		service.Get(w, req)
+		return w
+	}
+
+	w := get("abc.png", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "png data", w.Body.String())
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, `"abc.png"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Header().Get("Cache-Control"), "immutable")
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+	w = get("abc.png", http.Header{"If-None-Match": {`"abc.png"`}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = get("abc.png", http.Header{"Range": {"bytes=0-2"}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "png", w.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, get("missing.png", nil).Code)
+	assert.Equal(t, http.StatusNotFound, get("..", nil).Code)
+}
+
+func TestFileGetNotSeekable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := storage.NewMockBlobStore(ctrl)
+	store.EXPECT().Get(gomock.Any(), "k.gif").Return(
+		io.NopCloser(strings.NewReader("gif")),
+		storage.BlobInfo{Key: "k.gif", ContentType: "image/gif", Size: 3},
+		nil,
+	).Times(2)
+	service := FileHandler{Logger: zap.NewNop().Sugar(), Store: store}
+
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/api/files/k.gif", nil), map[string]string{"KEY": "k.gif"})
+	w := httptest.NewRecorder()
+	service.Get(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gif", w.Body.String())
+	assert.Equal(t, "3", w.Header().Get("Content-Length"))
+
+	req.Header.Set("If-None-Match", `"k.gif"`)
+	w = httptest.NewRecorder()
+	service.Get(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
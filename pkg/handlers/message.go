@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/controls"
+	"github.com/greatjudge/redditclone/pkg/message"
+	"github.com/greatjudge/redditclone/pkg/sending"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+)
+
+type ConversationPage struct {
+	Items   []message.Conversation `json:"items"`
+	Offset  int                    `json:"offset"`
+	Limit   int                    `json:"limit"`
+	HasMore bool                   `json:"has_more"`
+}
+
+type MessagePage struct {
+	Items   []message.Message `json:"items"`
+	Offset  int               `json:"offset"`
+	Limit   int               `json:"limit"`
+	HasMore bool              `json:"has_more"`
+}
+
+type MessageHandler struct {
+	Logger   *zap.SugaredLogger
+	Messages message.MessageRepo
+	UserRepo user.UserRepo
+	Controls controls.ControlsRepo
+	Limit    message.Limit
+}
+
+// blockedEither tells whether one of the users blocked the other.
+func (h *MessageHandler) blockedEither(userID, otherID string) (bool, error) {
+	if h.Controls == nil {
+		return false, nil
+	}
+	for _, ids := range [][2]string{{userID, otherID}, {otherID, userID}} {
+		blocked, err := h.Controls.IsBlocked(ids[0], ids[1])
+		if err != nil || blocked {
+			return blocked, err
+		}
+	}
+	return false, nil
+}
+
+func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	form := message.MessageForm{}
+	if err = json.Unmarshal(body, &form); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	form.Body = strings.TrimSpace(form.Body)
+	fieldErrs := validateStruct(form)
+	fieldErrs = append(fieldErrs, maxLength("body", form.Body, message.MaxBodyLength)...)
+	if len(fieldErrs) != 0 {
+		sending.SendFieldErrors(w, fieldErrs)
+		return
+	}
+
+	to, err := h.UserRepo.GetByUsername(mux.Vars(r)["USER_LOGIN"])
+	switch {
+	case errors.Is(err, user.ErrNoUser):
+		sending.SendJSONMessage(w, "user not found", http.StatusNotFound)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	case to.ID == sess.User.ID:
+		sending.SendJSONMessage(w, message.ErrSelfMessage.Error(), http.StatusBadRequest)
+		return
+	}
+	blocked, err := h.blockedEither(sess.User.ID, to.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		sending.SendJSONMessage(w, "you can not message this user", http.StatusForbidden)
+		return
+	}
+
+	limit := h.Limit
+	if limit.Count == 0 {
+		limit = message.DefaultLimit
+	}
+	msg, err := h.Messages.Send(sess.User, to, form.Body, limit)
+	switch {
+	case errors.Is(err, message.ErrRateLimited):
+		w.Header().Set("Retry-After", strconv.Itoa(int(limit.Window.Seconds())))
+		sending.SendJSONMessage(w, "too many messages, try later", http.StatusTooManyRequests)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("message %v from %v to %v", msg.ID, sess.User.ID, to.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	JSONMarshalAndSend(w, msg)
+}
+
+func (h *MessageHandler) ListConversations(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	offset, limit, fieldErrs := pageFromQuery(r)
+	if len(fieldErrs) != 0 {
+		sending.SendFieldErrors(w, fieldErrs)
+		return
+	}
+	// one extra item tells whether there is a next page
+	items, err := h.Messages.ListConversations(sess.User.ID, offset, limit+1)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	page := ConversationPage{Items: items, Offset: offset, Limit: limit}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.HasMore = true
+	}
+	JSONMarshalAndSend(w, page)
+}
+
+func conversationID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["CONVERSATION_ID"], 10, 64)
+	if err != nil {
+		return 0, message.ErrNoConversation
+	}
+	return id, nil
+}
+
+func handleMessageRepoErrors(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, message.ErrNoConversation):
+		sending.SendJSONMessage(w, "invalid conversation id", http.StatusNotFound)
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (h *MessageHandler) ListMessages(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	offset, limit, fieldErrs := pageFromQuery(r)
+	if len(fieldErrs) != 0 {
+		sending.SendFieldErrors(w, fieldErrs)
+		return
+	}
+	id, err := conversationID(r)
+	if err != nil {
+		handleMessageRepoErrors(w, err)
+		return
+	}
+	items, err := h.Messages.ListMessages(sess.User.ID, id, offset, limit+1)
+	if err != nil {
+		handleMessageRepoErrors(w, err)
+		return
+	}
+	page := MessagePage{Items: items, Offset: offset, Limit: limit}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.HasMore = true
+	}
+	JSONMarshalAndSend(w, page)
+}
+
+func (h *MessageHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	id, err := conversationID(r)
+	if err == nil {
+		err = h.Messages.MarkRead(sess.User.ID, id)
+	}
+	if err != nil {
+		handleMessageRepoErrors(w, err)
+		return
+	}
+	h.Logger.Infof("read conversation %v by %v", id, sess.User.ID)
+	sending.SendJSONMessage(w, "read", http.StatusOK)
+}
+
+func (h *MessageHandler) UnreadCount(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	count, err := h.Messages.UnreadCount(sess.User.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	JSONMarshalAndSend(w, UnreadCountAnswer{Unread: count})
+}
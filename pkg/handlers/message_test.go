@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/greatjudge/redditclone/pkg/controls"
+	"github.com/greatjudge/redditclone/pkg/message"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func sendRequest(to, body string) *http.Request {
+	req := authRequest("POST", "/", map[string]string{"USER_LOGIN": to})
+	req.Body = io.NopCloser(bytes.NewBufferString(body))
+	return req
+}
+
+func TestSendMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	messages := message.NewMockMessageRepo(ctrl)
+	users := user.NewMockUserRepo(ctrl)
+	controlsRepo := controls.NewMockControlsRepo(ctrl)
+	service := MessageHandler{
+		Logger:   zap.NewNop().Sugar(),
+		Messages: messages,
+		UserRepo: users,
+		Controls: controlsRepo,
+		Limit:    message.Limit{Count: 2, Window: time.Minute},
+	}
+	me := user.NewUser("u1", "u", "")
+	bob := user.NewUser("b1", "bob", "")
+
+	users.EXPECT().GetByUsername("bob").Return(bob, nil).AnyTimes()
+	controlsRepo.EXPECT().IsBlocked("u1", "b1").Return(false, nil).AnyTimes()
+
+	controlsRepo.EXPECT().IsBlocked("b1", "u1").Return(false, nil)
+	messages.EXPECT().Send(me, bob, "hi", service.Limit).Return(message.Message{ID: 1}, nil)
+	w := httptest.NewRecorder()
+	service.Send(w, sendRequest("bob", `{"body":" hi "}`))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	controlsRepo.EXPECT().IsBlocked("b1", "u1").Return(false, nil)
+	messages.EXPECT().Send(me, bob, "hi", service.Limit).Return(message.Message{}, message.ErrRateLimited)
+	w = httptest.NewRecorder()
+	service.Send(w, sendRequest("bob", `{"body":"hi"}`))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	controlsRepo.EXPECT().IsBlocked("b1", "u1").Return(true, nil)
+	w = httptest.NewRecorder()
+	service.Send(w, sendRequest("bob", `{"body":"hi"}`))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	service.Send(w, sendRequest("bob", `{"body":""}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = httptest.NewRecorder()
+	service.Send(w, sendRequest("bob", `{"body":"`+strings.Repeat("я", message.MaxBodyLength+1)+`"}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	users.EXPECT().GetByUsername("u").Return(me, nil)
+	w = httptest.NewRecorder()
+	service.Send(w, sendRequest("u", `{"body":"hi"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	users.EXPECT().GetByUsername("nobody").Return(user.User{}, user.ErrNoUser)
+	w = httptest.NewRecorder()
+	service.Send(w, sendRequest("nobody", `{"body":"hi"}`))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestConversations(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	messages := message.NewMockMessageRepo(ctrl)
+	service := MessageHandler{
+		Logger:   zap.NewNop().Sugar(),
+		Messages: messages,
+	}
+
+	messages.EXPECT().ListConversations("u1", 0, 2).Return([]message.Conversation{{ID: 1}}, nil)
+	w := httptest.NewRecorder()
+	service.ListConversations(w, authRequest("GET", "/api/conversations?limit=1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"has_more":false`)
+
+	messages.EXPECT().ListMessages("u1", int64(3), 0, DefaultPageLimit+1).Return([]message.Message{}, nil)
+	w = httptest.NewRecorder()
+	service.ListMessages(w, authRequest("GET", "/", map[string]string{"CONVERSATION_ID": "3"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	messages.EXPECT().ListMessages("u1", int64(4), 0, DefaultPageLimit+1).Return(nil, message.ErrNoConversation)
+	w = httptest.NewRecorder()
+	service.ListMessages(w, authRequest("GET", "/", map[string]string{"CONVERSATION_ID": "4"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	service.MarkRead(w, authRequest("POST", "/", map[string]string{"CONVERSATION_ID": "x"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	messages.EXPECT().MarkRead("u1", int64(3)).Return(nil)
+	w = httptest.NewRecorder()
+	service.MarkRead(w, authRequest("POST", "/", map[string]string{"CONVERSATION_ID": "3"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	messages.EXPECT().UnreadCount("u1").Return(2, nil)
+	w = httptest.NewRecorder()
+	service.UnreadCount(w, authRequest("GET", "/", nil))
+	assert.JSONEq(t, `{"unread":2}`, w.Body.String())
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/notification"
+	"github.com/greatjudge/redditclone/pkg/sending"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"go.uber.org/zap"
+)
+
+type NotificationPage struct {
+	Items   []notification.Notification `json:"items"`
+	Offset  int                         `json:"offset"`
+	Limit   int                         `json:"limit"`
+	HasMore bool                        `json:"has_more"`
+}
+
+type UnreadCountAnswer struct {
+	Unread int `json:"unread"`
+}
+
+type NotificationHandler struct {
+	Logger        *zap.SugaredLogger
+	Notifications notification.NotificationRepo
+}
+
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	offset, limit, fieldErrs := pageFromQuery(r)
+	unreadOnly := false
+	if raw := r.URL.Query().Get("unread"); raw != "" {
+		unreadOnly, err = strconv.ParseBool(raw)
+		if err != nil {
+			fieldErrs = append(fieldErrs, sending.FieldError{
+				Location: "query",
+				Param:    "unread",
+				Value:    raw,
+				Msg:      "must be true or false",
+			})
+		}
+	}
+	if len(fieldErrs) != 0 {
+		sending.SendFieldErrors(w, fieldErrs)
+		return
+	}
+
+	// one extra item tells whether there is a next page
+	items, err := h.Notifications.List(sess.User.ID, unreadOnly, offset, limit+1)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	page := NotificationPage{
+		Items:  items,
+		Offset: offset,
+		Limit:  limit,
+	}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.HasMore = true
+	}
+	JSONMarshalAndSend(w, page)
+}
+
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["NOTIFICATION_ID"], 10, 64)
+	if err == nil {
+		err = h.Notifications.MarkRead(sess.User.ID, id)
+	} else {
+		err = notification.ErrNoNotification
+	}
+	switch {
+	case errors.Is(err, notification.ErrNoNotification):
+		sending.SendJSONMessage(w, "invalid notification id", http.StatusNotFound)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("mark notification %v read by %v", id, sess.User.ID)
+	sending.SendJSONMessage(w, "read", http.StatusOK)
+}
+
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err = h.Notifications.MarkAllRead(sess.User.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("mark all notifications read by %v", sess.User.ID)
+	sending.SendJSONMessage(w, "read", http.StatusOK)
+}
+
+func (h *NotificationHandler) UnreadCount(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	count, err := h.Notifications.UnreadCount(sess.User.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	JSONMarshalAndSend(w, UnreadCountAnswer{Unread: count})
+}
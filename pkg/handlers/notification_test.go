@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/greatjudge/redditclone/pkg/notification"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestNotifications(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := notification.NewMockNotificationRepo(ctrl)
+	service := NotificationHandler{
+		Logger:        zap.NewNop().Sugar(),
+		Notifications: repo,
+	}
+
+	repo.EXPECT().List("u1", true, 0, 2).Return([]notification.Notification{{ID: 2}, {ID: 1}}, nil)
+	w := httptest.NewRecorder()
+	service.List(w, authRequest("GET", "/api/notifications?unread=true&limit=1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	page := NotificationPage{}
+	_ = json.Unmarshal(w.Body.Bytes(), &page)
+	assert.True(t, page.HasMore)
+	assert.Len(t, page.Items, 1)
+
+	w = httptest.NewRecorder()
+	service.List(w, authRequest("GET", "/api/notifications?unread=maybe", nil))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	repo.EXPECT().MarkRead("u1", int64(5)).Return(nil)
+	w = httptest.NewRecorder()
+	service.MarkRead(w, authRequest("POST", "/", map[string]string{"NOTIFICATION_ID": "5"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	repo.EXPECT().MarkRead("u1", int64(6)).Return(notification.ErrNoNotification)
+	w = httptest.NewRecorder()
+	service.MarkRead(w, authRequest("POST", "/", map[string]string{"NOTIFICATION_ID": "6"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	service.MarkRead(w, authRequest("POST", "/", map[string]string{"NOTIFICATION_ID": "abc"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	repo.EXPECT().MarkAllRead("u1").Return(nil)
+	w = httptest.NewRecorder()
+	service.MarkAllRead(w, authRequest("POST", "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	repo.EXPECT().UnreadCount("u1").Return(3, nil)
+	w = httptest.NewRecorder()
+	service.UnreadCount(w, authRequest("GET", "/", nil))
+	assert.JSONEq(t, `{"unread":3}`, w.Body.String())
+}
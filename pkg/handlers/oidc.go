@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/greatjudge/redditclone/pkg/oidc"
+	"github.com/greatjudge/redditclone/pkg/sending"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+)
+
+const (
+	oidcCookie = "oidc_login"
+	// oidcCookieAge is how long the user has to sign in at the provider.
+	oidcCookieAge = 600
+	// usernameAttempts is how many free usernames are tried for a new
+	// account before giving up.
+	usernameAttempts = 5
+)
+
+var notUsernameChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// errLinkRequired is returned for a first login whose verified email belongs
+// to a local account, the owner has to link the identity while logged in.
+var errLinkRequired = errors.New("an account with this email exists, log in and link the external login to it")
+
+// OIDCProvider is the external provider users sign in with,
+// oidc.Provider implements it.
+type OIDCProvider interface {
+	Issuer() string
+	AuthCodeURL(state, nonce, verifier string) string
+	Exchange(ctx context.Context, code, verifier, nonce string) (oidc.Claims, error)
+}
+
+type OIDCHandler struct {
+	Logger     *zap.SugaredLogger
+	Provider   OIDCProvider
+	Identities oidc.IdentityRepo
+	UserRepo   user.UserRepo
+	Sessions   session.SessionsManager
+	// InsecureCookie drops the Secure flag of the login state cookie,
+	// for development over plain http only.
+	InsecureCookie bool
+}
+
+type LinkAnswer struct {
+	URL string `json:"url"`
+}
+
+// start keeps state, nonce and the PKCE verifier for the callback in a
+// cookie only this browser has and returns the provider URL. A link also
+// keeps the session token of the user who started it.
+func (h *OIDCHandler) start(w http.ResponseWriter, sessionToken string) (string, error) {
+	values := make([]string, 3)
+	for i := range values {
+		value, err := oidc.NewState()
+		if err != nil {
+			return "", err
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+	if sessionToken != "" {
+		values = append(values, sessionToken)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    strings.Join(values, "."),
+		Path:     "/api/oidc",
+		MaxAge:   oidcCookieAge,
+		HttpOnly: true,
+		Secure:   !h.InsecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return h.Provider.AuthCodeURL(state, nonce, verifier), nil
+}
+
+// Login sends the user to the provider.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	url, err := h.start(w, "")
+	if err != nil {
+		h.Logger.Errorf("fail to start external login: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// Link answers the logged in user with the provider URL to open in the
+// browser, the callback then links the external identity to the user.
+func (h *OIDCHandler) Link(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	url, err := h.start(w, sess.Token)
+	if err != nil {
+		h.Logger.Errorf("fail to start external link of %v: %v", sess.User.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	JSONMarshalAndSend(w, LinkAnswer{URL: url})
+}
+
+// Callback finishes the login the provider redirected back from and
+// answers with a session token. On first login an external subject gets a
+// new user, unless a local account verified the same email: it is never
+// linked implicitly, since that would skip the password and two-factor
+// check of the account. Callbacks of Link link the subject instead.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(oidcCookie)
+	// the login state is single use
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: "/api/oidc", MaxAge: -1})
+	if err != nil {
+		sending.SendJSONMessage(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+	// a session token has dots of its own and goes last
+	values := strings.SplitN(cookie.Value, ".", 4)
+	query := r.URL.Query()
+	if len(values) < 3 || subtle.ConstantTimeCompare([]byte(values[0]), []byte(query.Get("state"))) != 1 {
+		sending.SendJSONMessage(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+	if reason := query.Get("error"); reason != "" {
+		sending.SendJSONMessage(w, "external login failed: "+reason, http.StatusUnauthorized)
+		return
+	}
+	nonce, verifier := values[1], values[2]
+
+	claims, err := h.Provider.Exchange(r.Context(), query.Get("code"), verifier, nonce)
+	if err != nil {
+		h.Logger.Errorf("fail to finish external login: %v", err)
+		sending.SendJSONMessage(w, "external login failed", http.StatusUnauthorized)
+		return
+	}
+	if len(values) == 4 {
+		h.link(w, r, values[3], claims)
+		return
+	}
+	u, err := h.userFor(claims)
+	if errors.Is(err, errLinkRequired) {
+		sending.SendJSONMessage(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.Logger.Errorf("fail to find user of %v at %v: %v", claims.Subject, claims.Issuer, err)
+		handleUserErrors(err, w)
+		return
+	}
+	token, err := h.Sessions.Create(u)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("created session for %v by %v", u.ID, claims.Issuer)
+	sending.JSONMarshalAndSend(w, LoginAnswer{Token: token})
+}
+
+func (h *OIDCHandler) userFor(claims oidc.Claims) (user.User, error) {
+	userID, err := h.Identities.FindUser(claims.Issuer, claims.Subject)
+	switch {
+	case err == nil:
+		return h.UserRepo.GetByID(userID)
+	case !errors.Is(err, oidc.ErrNoIdentity):
+		return user.User{}, err
+	}
+
+	if claims.Email != "" && claims.EmailVerified {
+		_, err = h.UserRepo.GetByVerifiedEmail(claims.Email)
+		switch {
+		case err == nil:
+			return user.User{}, errLinkRequired
+		case !errors.Is(err, user.ErrNoUser):
+			return user.User{}, err
+		}
+	}
+	u, err := h.register(claims)
+	if err != nil {
+		return user.User{}, err
+	}
+	if err = h.Identities.Link(claims.Issuer, claims.Subject, u.ID); err != nil {
+		return user.User{}, err
+	}
+	h.Logger.Infof("link %v at %v to %v", claims.Subject, claims.Issuer, u.ID)
+	return u, nil
+}
+
+// link links the subject to the user of the session that started the flow.
+func (h *OIDCHandler) link(w http.ResponseWriter, r *http.Request, token string, claims oidc.Claims) {
+	authed := r.Clone(r.Context())
+	authed.Header.Set("Authorization", "Bearer "+token)
+	sess, err := h.Sessions.Check(authed)
+	if err != nil {
+		sending.SendJSONMessage(w, "session expired, log in again", http.StatusUnauthorized)
+		return
+	}
+	userID, err := h.Identities.FindUser(claims.Issuer, claims.Subject)
+	switch {
+	case err == nil && userID == sess.User.ID:
+		sending.SendJSONMessage(w, "linked", http.StatusOK)
+		return
+	case err == nil:
+		sending.SendJSONMessage(w, oidc.ErrAlreadyLinked.Error(), http.StatusConflict)
+		return
+	case !errors.Is(err, oidc.ErrNoIdentity):
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = h.Identities.Link(claims.Issuer, claims.Subject, sess.User.ID)
+	switch {
+	case errors.Is(err, oidc.ErrAlreadyLinked):
+		sending.SendJSONMessage(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("link %v at %v to %v", claims.Subject, claims.Issuer, sess.User.ID)
+	sending.SendJSONMessage(w, "linked", http.StatusOK)
+}
+
+// register creates a user named after the claims. Its password is random,
+// an email the provider verified is stored as verified so that a password
+// can be set later through a reset. Without one the account signs in only
+// through the provider.
+func (h *OIDCHandler) register(claims oidc.Claims) (user.User, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	base = strings.Trim(notUsernameChars.ReplaceAllString(base, "_"), "_")
+	if base == "" {
+		base = "user"
+	}
+	password, _, err := user.NewToken()
+	if err != nil {
+		return user.User{}, err
+	}
+	email := ""
+	if claims.EmailVerified {
+		email = claims.Email
+	}
+	username := base
+	for i := 0; i < usernameAttempts; i++ {
+		u, err := h.registerUser(username, password, email)
+		if errors.Is(err, user.ErrEmailTaken) {
+			// an account that has not verified the email keeps it
+			email = ""
+			u, err = h.registerUser(username, password, email)
+		}
+		if !errors.Is(err, user.ErrAlreadyExists) {
+			return u, err
+		}
+		suffix, _, err := user.NewToken()
+		if err != nil {
+			return user.User{}, err
+		}
+		username = fmt.Sprintf("%v_%v", base, suffix[:4])
+	}
+	return user.User{}, user.ErrAlreadyExists
+}
+
+func (h *OIDCHandler) registerUser(username, password, email string) (user.User, error) {
+	if email == "" {
+		return h.UserRepo.Register(username, password, "")
+	}
+	return h.UserRepo.RegisterVerified(username, password, email)
+}
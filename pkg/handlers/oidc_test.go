@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/greatjudge/redditclone/pkg/oidc"
+	"github.com/greatjudge/redditclone/pkg/oidc/oidctest"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type oidcMocks struct {
+	identities *oidc.MockIdentityRepo
+	users      *user.MockUserRepo
+	sessions   *session.MockSessionsManager
+}
+
+func newTestOIDCHandler(t *testing.T, ctrl *gomock.Controller) (*OIDCHandler, *oidctest.Provider, oidcMocks) {
+	fake := oidctest.NewProvider("client", "secret")
+	t.Cleanup(fake.Close)
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:       fake.Issuer(),
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/api/oidc/callback",
+	}, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("cant discover provider: %v", err)
+	}
+	mocks := oidcMocks{
+		identities: oidc.NewMockIdentityRepo(ctrl),
+		users:      user.NewMockUserRepo(ctrl),
+		sessions:   session.NewMockSessionsManager(ctrl),
+	}
+	return &OIDCHandler{
+		Logger:     zap.NewNop().Sugar(),
+		Provider:   provider,
+		Identities: mocks.identities,
+		UserRepo:   mocks.users,
+		Sessions:   mocks.sessions,
+	}, fake, mocks
+}
+
+// signIn runs the login redirect, the sign in at the provider and the
+// callback, it returns the callback answer.
+func signIn(t *testing.T, service *OIDCHandler, fake *oidctest.Provider, u oidctest.User) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	service.Login(w, httptest.NewRequest("GET", "/api/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected redirect, got %v", w.Code)
+	}
+	back, err := fake.Login(w.Header().Get("Location"), u)
+	if err != nil {
+		t.Fatalf("cant sign in at provider: %v", err)
+	}
+	req := httptest.NewRequest("GET", back.String(), nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	service.Callback(w, req)
+	return w
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	service, fake, mocks := newTestOIDCHandler(t, ctrl)
+
+	w := httptest.NewRecorder()
+	service.Login(w, httptest.NewRequest("GET", "/api/oidc/login", nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Location"), fake.Issuer()+"/authorize?"))
+	cookies := w.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.True(t, cookies[0].HttpOnly)
+		assert.True(t, cookies[0].Secure)
+		// the verifier stays in the browser cookie, only its challenge
+		// goes to the provider
+		verifier := strings.Split(cookies[0].Value, ".")[2]
+		assert.NotContains(t, w.Header().Get("Location"), verifier)
+		assert.Contains(t, w.Header().Get("Location"), oidc.Challenge(verifier))
+	}
+
+	// a linked subject
+	alice := user.User{ID: "1", Username: "alice"}
+	mocks.identities.EXPECT().FindUser(fake.Issuer(), "alice-id").Return("1", nil)
+	mocks.users.EXPECT().GetByID("1").Return(alice, nil)
+	mocks.sessions.EXPECT().Create(alice).Return("session-token", nil)
+	w = signIn(t, service, fake, oidctest.User{Subject: "alice-id"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "session-token")
+}
+
+func TestOIDCFirstLogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	service, fake, mocks := newTestOIDCHandler(t, ctrl)
+
+	// the user who verified the same email has to link it while logged in
+	bob := user.User{ID: "2", Username: "bob"}
+	mocks.identities.EXPECT().FindUser(fake.Issuer(), "bob-id").Return("", oidc.ErrNoIdentity)
+	mocks.users.EXPECT().GetByVerifiedEmail("bob@example.com").Return(bob, nil)
+	w := signIn(t, service, fake, oidctest.User{Subject: "bob-id", Email: "bob@example.com", EmailVerified: true})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// an unverified email is not trusted, a new account is created with a
+	// free username
+	carol := user.User{ID: "3", Username: "carol_smith_ab12"}
+	mocks.identities.EXPECT().FindUser(fake.Issuer(), "carol-id").Return("", oidc.ErrNoIdentity)
+	gomock.InOrder(
+		mocks.users.EXPECT().Register("carol_smith", gomock.Any(), "").Return(user.User{}, user.ErrAlreadyExists),
+		mocks.users.EXPECT().Register(gomock.Any(), gomock.Any(), "").DoAndReturn(
+			func(username, password, email string) (user.User, error) {
+				assert.Regexp(t, `^carol_smith_[0-9a-f]{4}$`, username)
+				assert.Len(t, password, 64)
+				return carol, nil
+			}),
+	)
+	mocks.identities.EXPECT().Link(fake.Issuer(), "carol-id", "3").Return(nil)
+	mocks.sessions.EXPECT().Create(carol).Return("session-token", nil)
+	w = signIn(t, service, fake, oidctest.User{Subject: "carol-id", Email: "carol@example.com", PreferredUsername: "carol.smith"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// a verified email is kept verified, so a password can be set by a
+	// reset, unless another account holds it unverified
+	dave := user.User{ID: "4", Username: "dave"}
+	mocks.identities.EXPECT().FindUser(fake.Issuer(), "dave-id").Return("", oidc.ErrNoIdentity)
+	mocks.users.EXPECT().GetByVerifiedEmail("dave@example.com").Return(user.User{}, user.ErrNoUser)
+	mocks.users.EXPECT().RegisterVerified("dave", gomock.Any(), "dave@example.com").Return(dave, nil)
+	mocks.identities.EXPECT().Link(fake.Issuer(), "dave-id", "4").Return(nil)
+	mocks.sessions.EXPECT().Create(dave).Return("session-token", nil)
+	w = signIn(t, service, fake, oidctest.User{Subject: "dave-id", Email: "dave@example.com", EmailVerified: true})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	erin := user.User{ID: "5", Username: "erin"}
+	mocks.identities.EXPECT().FindUser(fake.Issuer(), "erin-id").Return("", oidc.ErrNoIdentity)
+	mocks.users.EXPECT().GetByVerifiedEmail("erin@example.com").Return(user.User{}, user.ErrNoUser)
+	gomock.InOrder(
+		mocks.users.EXPECT().RegisterVerified("erin", gomock.Any(), "erin@example.com").Return(user.User{}, user.ErrEmailTaken),
+		mocks.users.EXPECT().Register("erin", gomock.Any(), "").Return(erin, nil),
+	)
+	mocks.identities.EXPECT().Link(fake.Issuer(), "erin-id", "5").Return(nil)
+	mocks.sessions.EXPECT().Create(erin).Return("session-token", nil)
+	w = signIn(t, service, fake, oidctest.User{Subject: "erin-id", Email: "erin@example.com", EmailVerified: true})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestOIDCLink(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	service, fake, mocks := newTestOIDCHandler(t, ctrl)
+	bob := user.User{ID: "2", Username: "bob"}
+
+	// link runs the usual callback with the session of who started it
+	link := func(subject string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/me/oidc/link", nil)
+		req = req.WithContext(session.ContextWithSession(req.Context(), session.NewSession("a.b.c", bob)))
+		w := httptest.NewRecorder()
+		service.Link(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected ok, got %v", w.Code)
+		}
+		answer := LinkAnswer{}
+		if err := json.Unmarshal(w.Body.Bytes(), &answer); err != nil {
+			t.Fatalf("cant unmarshal answer: %v", err)
+		}
+		back, err := fake.Login(answer.URL, oidctest.User{Subject: subject})
+		if err != nil {
+			t.Fatalf("cant sign in at provider: %v", err)
+		}
+		req = httptest.NewRequest("GET", back.String(), nil)
+		for _, c := range w.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		w = httptest.NewRecorder()
+		service.Callback(w, req)
+		return w
+	}
+	checkSession := func(r *http.Request) (session.Session, error) {
+		assert.Equal(t, "Bearer a.b.c", r.Header.Get("Authorization"))
+		return session.NewSession("a.b.c", bob), nil
+	}
+
+	mocks.sessions.EXPECT().Check(gomock.Any()).DoAndReturn(checkSession)
+	mocks.identities.EXPECT().FindUser(fake.Issuer(), "bob-id").Return("", oidc.ErrNoIdentity)
+	mocks.identities.EXPECT().Link(fake.Issuer(), "bob-id", "2").Return(nil)
+	w := link("bob-id")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the subject belongs to someone else
+	mocks.sessions.EXPECT().Check(gomock.Any()).DoAndReturn(checkSession)
+	mocks.identities.EXPECT().FindUser(fake.Issuer(), "alice-id").Return("1", nil)
+	w = link("alice-id")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// the session ended in the meantime
+	mocks.sessions.EXPECT().Check(gomock.Any()).Return(session.Session{}, session.ErrBadToken)
+	w = link("bob-id")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestOIDCCallbackErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	service, fake, _ := newTestOIDCHandler(t, ctrl)
+
+	// no login state cookie
+	w := httptest.NewRecorder()
+	service.Callback(w, httptest.NewRequest("GET", "/api/oidc/callback?code=c&state=s", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// state of another login
+	w = httptest.NewRecorder()
+	service.Login(w, httptest.NewRequest("GET", "/api/oidc/login", nil))
+	back, err := fake.Login(w.Header().Get("Location"), oidctest.User{Subject: "alice-id"})
+	assert.Nil(t, err)
+	query := back.Query()
+	query.Set("state", "forged")
+	back.RawQuery = query.Encode()
+	req := httptest.NewRequest("GET", back.String(), nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	w = httptest.NewRecorder()
+	service.Callback(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// the user declined at the provider
+	w = httptest.NewRecorder()
+	service.Login(w, httptest.NewRequest("GET", "/api/oidc/login", nil))
+	cookie := w.Result().Cookies()[0]
+	state := strings.Split(cookie.Value, ".")[0]
+	req = httptest.NewRequest("GET", "/api/oidc/callback?error=access_denied&state="+state, nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	service.Callback(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// a made up code
+	req = httptest.NewRequest("GET", "/api/oidc/callback?code=made-up&state="+state, nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	service.Callback(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
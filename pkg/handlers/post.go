@@ -3,14 +3,29 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/asaskevich/govalidator"
 	"github.com/gorilla/mux"
 	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/controls"
+	"github.com/greatjudge/redditclone/pkg/policy"
 	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/saved"
 	"github.com/greatjudge/redditclone/pkg/sending"
 	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/upload"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/greatjudge/redditclone/pkg/vote"
 	"go.uber.org/zap"
 )
 
@@ -28,40 +43,256 @@ func JSONMarshalAndSend(w http.ResponseWriter, obj any) {
 	}
 }
 
+// LinkUnfurler fetches link previews in background.
+type LinkUnfurler interface {
+	Enqueue(postID, rawURL string)
+}
+
+// ViewCounter counts post views in background.
+type ViewCounter interface {
+	Record(postID, viewer string) bool
+}
+
+// Authorizer decides who may do what, policy.Policy implements it.
+type Authorizer interface {
+	Authorize(subject user.User, action policy.Action, resource policy.Resource) error
+}
+
+type DuplicateLinkAnswer struct {
+	Message string `json:"message"`
+	PostID  string `json:"post_id"`
+}
+
 type PostHandler struct {
 	Logger   *zap.SugaredLogger
 	PostRepo post.PostRepo
+	Unfurler LinkUnfurler
+	Uploader *upload.Uploader
+	Saved    saved.SavedRepo
+	Controls controls.ControlsRepo
+	Views    ViewCounter
+	Policy   Authorizer
+	// RestoreWindow is how long after deletion posts and comments can be
+	// restored.
+	RestoreWindow time.Duration
+}
+
+// PostCommentsLimit is how many comments come with a single post,
+// the rest are paged through separately.
+const PostCommentsLimit = MaxPageLimit
+
+type CommentsPage struct {
+	Items   []comment.Comment `json:"items"`
+	Offset  int               `json:"offset"`
+	Limit   int               `json:"limit"`
+	HasMore bool              `json:"has_more"`
+}
+
+// multipartOverhead is allowed on top of the file size for form fields
+// and part headers.
+const multipartOverhead = 1 << 20
+
+// viewerID is the id of the logged in user, empty for anonymous requests.
+func viewerID(r *http.Request) string {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		return ""
+	}
+	return sess.User.ID
+}
+
+// viewerKey tells viewers apart for view counting, by user when logged in
+// and by address otherwise.
+func viewerKey(r *http.Request) string {
+	if userID := viewerID(r); userID != "" {
+		return "u:" + userID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// viewerFilter loads what the logged in viewer hid or blocked.
+func (h *PostHandler) viewerFilter(r *http.Request) (post.Filter, error) {
+	userID := viewerID(r)
+	if userID == "" || h.Controls == nil {
+		return post.Filter{}, nil
+	}
+	return h.Controls.Filter(userID)
+}
+
+// forViewer hides what the viewer is not allowed to see yet, such as
+// poll results and comments of blocked users, and marks what the viewer
+// saved and how they voted.
+func (h *PostHandler) forViewer(r *http.Request, f post.Filter, posts []post.Post) []post.Post {
+	userID, now := viewerID(r), time.Now()
+	posts = h.withPollVotes(userID, posts)
+	for i := range posts {
+		posts[i] = f.Apply(posts[i].ForViewer(now))
+	}
+	posts = h.withVotes(userID, posts)
+	if userID == "" || h.Saved == nil || len(posts) == 0 {
+		return posts
+	}
+	ids := make([]string, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	set, err := h.Saved.SavedIn(userID, ids)
+	if err != nil {
+		// saved flags are not worth failing the whole response
+		h.Logger.Errorf("fail to get saved items of %v: %v", userID, err)
+		return posts
+	}
+	for i := range posts {
+		posts[i].Saved = set.Post(posts[i].ID)
+		if len(posts[i].Comments) == 0 {
+			continue
+		}
+		comments := make([]comment.Comment, len(posts[i].Comments))
+		for j, comm := range posts[i].Comments {
+			comm.Saved = set.Comment(posts[i].ID, comm.ID)
+			comments[j] = comm
+		}
+		posts[i].Comments = comments
+	}
+	return posts
+}
+
+// withVotes sets the vote of the viewer in posts that do not carry one,
+// posts returned by a vote already do.
+func (h *PostHandler) withVotes(userID string, posts []post.Post) []post.Post {
+	ids := make([]string, 0, len(posts))
+	for i, p := range posts {
+		if p.Votes != nil {
+			continue
+		}
+		posts[i].Votes = make([]vote.Vote, 0)
+		if userID != "" {
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return posts
+	}
+	votes, err := h.PostRepo.GetVotes(userID, ids)
+	if err != nil {
+		// as with saved flags the response is still useful without votes
+		h.Logger.Errorf("fail to get votes of %v: %v", userID, err)
+		return posts
+	}
+	byPost := make(map[string]int, len(votes))
+	for _, v := range votes {
+		byPost[v.PostID] = v.Value
+	}
+	for i, p := range posts {
+		if value, ok := byPost[p.ID]; ok {
+			posts[i] = p.WithVote(userID, value)
+		}
+	}
+	return posts
+}
+
+// withPollVotes marks the option the viewer chose in polls that do not
+// carry one, polls returned by a vote already do.
+func (h *PostHandler) withPollVotes(userID string, posts []post.Post) []post.Post {
+	if userID == "" {
+		return posts
+	}
+	ids := make([]string, 0)
+	for _, p := range posts {
+		if p.Poll != nil && p.Poll.VotedOption == nil {
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return posts
+	}
+	votes, err := h.PostRepo.GetPollVotes(userID, ids)
+	if err != nil {
+		// results stay hidden, as they are from anonymous viewers
+		h.Logger.Errorf("fail to get poll votes of %v: %v", userID, err)
+		return posts
+	}
+	byPost := make(map[string]int, len(votes))
+	for _, v := range votes {
+		byPost[v.PostID] = v.Option
+	}
+	for i, p := range posts {
+		if option, ok := byPost[p.ID]; ok {
+			posts[i] = p.WithPollVote(option)
+		}
+	}
+	return posts
+}
+
+// sendPost answers with a single post and the first page of its comments,
+// the viewer filter only strips comments here: the post itself was asked
+// for explicitly.
+func (h *PostHandler) sendPost(w http.ResponseWriter, r *http.Request, p post.Post) {
+	f, err := h.viewerFilter(r)
+	if err != nil {
+		h.Logger.Errorf("fail to get filter of %v: %v", viewerID(r), err)
+	}
+	p.Comments, err = h.PostRepo.GetComments(p.ID, f, 0, PostCommentsLimit)
+	if err != nil {
+		// the change is already made, comments are not worth failing it
+		h.Logger.Errorf("fail to get comments of post %v: %v", p.ID, err)
+	}
+	JSONMarshalAndSend(w, h.forViewer(r, f, []post.Post{p})[0])
 }
 
 func (h *PostHandler) List(w http.ResponseWriter, r *http.Request) {
-	elems, err := h.PostRepo.GetAll()
+	f, err := h.viewerFilter(r)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	JSONMarshalAndSend(w, elems)
+	elems, err := h.PostRepo.GetAll(f)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	JSONMarshalAndSend(w, h.forViewer(r, f, elems))
 }
 
 func (h *PostHandler) ListByCategory(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	category := vars["CATEGORY_NAME"]
-	elems, err := h.PostRepo.GetByCategory(category)
+	f, err := h.viewerFilter(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	elems, err := h.PostRepo.GetByCategory(category, f)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	h.Logger.Infof("get posts by category %v", category)
-	JSONMarshalAndSend(w, elems)
+	JSONMarshalAndSend(w, h.forViewer(r, f, elems))
 }
 
 func handlePostRepoErrors(w http.ResponseWriter, err error) {
 	switch {
 	case errors.Is(err, post.ErrNoPost):
 		sending.SendJSONMessage(w, "invalid post id", http.StatusNotFound)
-	case errors.Is(err, post.ErrNoAccess):
+	case errors.Is(err, policy.ErrForbidden):
 		sending.SendJSONMessage(w, "no access", http.StatusForbidden)
 	case errors.Is(err, comment.ErrNoComment):
 		sending.SendJSONMessage(w, "invalid comment id", http.StatusNotFound)
+	case errors.Is(err, post.ErrNotPoll):
+		sending.SendJSONMessage(w, "post is not a poll", http.StatusBadRequest)
+	case errors.Is(err, post.ErrNoPollOption):
+		sending.SendJSONMessage(w, "invalid poll option", http.StatusNotFound)
+	case errors.Is(err, post.ErrPollClosed):
+		sending.SendJSONMessage(w, "poll is closed", http.StatusConflict)
+	case errors.Is(err, post.ErrAlreadyVoted):
+		sending.SendJSONMessage(w, "already voted", http.StatusConflict)
+	case errors.Is(err, post.ErrNotRestorable):
+		sending.SendJSONMessage(w, "nothing to restore", http.StatusNotFound)
 	case err != nil:
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -69,13 +300,185 @@ func handlePostRepoErrors(w http.ResponseWriter, err error) {
 
 func (h *PostHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
+	f, err := h.viewerFilter(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 	p, err := h.PostRepo.GetByID(vars["POST_ID"])
 	if err != nil {
 		handlePostRepoErrors(w, err)
 		return
 	}
+	if f.Blocks(p.Author.ID) {
+		handlePostRepoErrors(w, post.ErrNoPost)
+		return
+	}
+	p.Comments, err = h.PostRepo.GetComments(p.ID, f, 0, PostCommentsLimit)
+	if err != nil {
+		h.Logger.Errorf("fail to get comments of post %v: %v", p.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if h.Views != nil {
+		h.Views.Record(p.ID, viewerKey(r))
+	}
 	h.Logger.Infof("get post %v", p.ID)
-	JSONMarshalAndSend(w, p)
+	JSONMarshalAndSend(w, h.forViewer(r, f, []post.Post{p})[0])
+}
+
+// validateStruct runs govalidator tags and reports errors per json field.
+func validateStruct(obj any) []sending.FieldError {
+	fieldErrs := make([]sending.FieldError, 0)
+	_, err := govalidator.ValidateStruct(obj)
+	allErrs, ok := err.(govalidator.Errors)
+	if !ok {
+		return fieldErrs
+	}
+	for _, e := range allErrs.Errors() {
+		var fldErr govalidator.Error
+		if errors.As(e, &fldErr) {
+			fieldErrs = append(fieldErrs, sending.FieldError{
+				Location: "body",
+				Param:    fldErr.Name,
+				Msg:      fldErr.Err.Error(),
+			})
+		}
+	}
+	return fieldErrs
+}
+
+// maxLength reports the body field if it is longer than max characters.
+func maxLength(param string, value string, max int) []sending.FieldError {
+	if utf8.RuneCountInString(value) <= max {
+		return nil
+	}
+	return []sending.FieldError{{
+		Location: "body",
+		Param:    param,
+		Msg:      fmt.Sprintf("must be at most %d characters long", max),
+	}}
+}
+
+// validatePostForm checks the tags of the form and the post.Max* lengths.
+func validatePostForm(form post.PostForm) []sending.FieldError {
+	fieldErrs := validateStruct(form)
+	fieldErrs = append(fieldErrs, maxLength("title", form.Title, post.MaxTitleLength)...)
+	fieldErrs = append(fieldErrs, maxLength("category", form.Category, post.MaxCategoryLength)...)
+	return append(fieldErrs, maxLength("text", form.Text, post.MaxTextLength)...)
+}
+
+func validateLinkURL(rawURL string) string {
+	if rawURL == "" {
+		return "is required"
+	}
+	if utf8.RuneCountInString(rawURL) > post.MaxURLLength {
+		return "is too long"
+	}
+	u, err := url.ParseRequestURI(rawURL)
+	if err != nil || u.Host == "" {
+		return "is invalid"
+	}
+	for _, scheme := range post.URLSchemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return ""
+		}
+	}
+	return "scheme must be one of " + strings.Join(post.URLSchemes, ", ")
+}
+
+func validatePoll(form *post.PostForm) []sending.FieldError {
+	fieldErrs := make([]sending.FieldError, 0)
+	if len(form.Options) < post.MinPollOptions || len(form.Options) > post.MaxPollOptions {
+		fieldErrs = append(fieldErrs, sending.FieldError{
+			Location: "body",
+			Param:    "options",
+			Msg:      fmt.Sprintf("must contain from %d to %d options", post.MinPollOptions, post.MaxPollOptions),
+		})
+	}
+	seen := make(map[string]bool, len(form.Options))
+	for i, option := range form.Options {
+		option = strings.TrimSpace(option)
+		form.Options[i] = option
+		msg := ""
+		switch {
+		case option == "":
+			msg = "is required"
+		case utf8.RuneCountInString(option) > post.MaxPollOptionLength:
+			msg = fmt.Sprintf("must be at most %d characters long", post.MaxPollOptionLength)
+		case seen[strings.ToLower(option)]:
+			msg = "duplicates another option"
+		}
+		seen[strings.ToLower(option)] = true
+		if msg != "" {
+			fieldErrs = append(fieldErrs, sending.FieldError{
+				Location: "body",
+				Param:    "options." + strconv.Itoa(i),
+				Value:    option,
+				Msg:      msg,
+			})
+		}
+	}
+	if form.ClosesAt != nil && !form.ClosesAt.After(time.Now()) {
+		fieldErrs = append(fieldErrs, sending.FieldError{
+			Location: "body",
+			Param:    "closes_at",
+			Value:    form.ClosesAt,
+			Msg:      "must be in the future",
+		})
+	}
+	return fieldErrs
+}
+
+// PostFormFromBody parses a new post and returns field errors
+// if it can not be created as is.
+func PostFormFromBody(body []byte) (post.PostForm, []sending.FieldError, error) {
+	raw := map[string]json.RawMessage{}
+	err := json.Unmarshal(body, &raw)
+	if err != nil {
+		return post.PostForm{}, nil, err
+	}
+	form := post.PostForm{}
+	err = json.Unmarshal(body, &form)
+	if err != nil {
+		return post.PostForm{}, nil, err
+	}
+	form.Title = strings.TrimSpace(form.Title)
+	form.Category = strings.TrimSpace(form.Category)
+
+	fieldErrs := make([]sending.FieldError, 0)
+	for _, field := range post.ReadOnlyFields {
+		if _, ok := raw[field]; ok {
+			fieldErrs = append(fieldErrs, sending.FieldError{
+				Location: "body",
+				Param:    field,
+				Msg:      "is read-only",
+			})
+		}
+	}
+	fieldErrs = append(fieldErrs, validatePostForm(form)...)
+	if form.Type == post.IMAGE {
+		fieldErrs = append(fieldErrs, sending.FieldError{
+			Location: "body",
+			Param:    "type",
+			Value:    form.Type,
+			Msg:      "image posts must be sent as multipart/form-data",
+		})
+	}
+	if form.Type == post.POLL {
+		fieldErrs = append(fieldErrs, validatePoll(&form)...)
+	}
+	if form.Type == post.LINK {
+		if msg := validateLinkURL(form.URL); msg != "" {
+			fieldErrs = append(fieldErrs, sending.FieldError{
+				Location: "body",
+				Param:    "url",
+				Value:    form.URL,
+				Msg:      msg,
+			})
+		}
+	}
+	return form, fieldErrs, nil
 }
 
 func (h *PostHandler) Add(w http.ResponseWriter, r *http.Request) {
@@ -84,20 +487,44 @@ func (h *PostHandler) Add(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-
-	p := post.Post{}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		h.addImage(w, r, sess)
+		return
+	}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	err = json.Unmarshal(body, &p)
+	form, fieldErrs, err := PostFormFromBody(body)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	if len(fieldErrs) != 0 {
+		sending.SendFieldErrors(w, fieldErrs)
+		return
+	}
+	p := form.Post()
 	post.InitPost(&p, sess.User)
-
+	if p.Type == post.LINK && r.URL.Query().Get("force") != "true" {
+		existing, err := h.PostRepo.GetByNormalizedURL(p.Category, p.NormalizedURL)
+		switch {
+		case err == nil:
+			h.Logger.Infof("link %v already posted in %v as %v", p.URL, p.Category, existing.ID)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			JSONMarshalAndSend(w, DuplicateLinkAnswer{
+				Message: "link already posted",
+				PostID:  existing.ID,
+			})
+			return
+		case !errors.Is(err, post.ErrNoPost):
+			h.Logger.Errorf("fail to look up duplicate link: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
 	p, err = h.PostRepo.Add(p)
 	if err != nil {
 		h.Logger.Error("fail add post: %w", err)
@@ -105,8 +532,93 @@ func (h *PostHandler) Add(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	h.Logger.Infof("add post %v", p.ID)
+	if p.Type == post.LINK && h.Unfurler != nil {
+		h.Unfurler.Enqueue(p.ID, p.URL)
+	}
 	w.WriteHeader(http.StatusCreated)
-	JSONMarshalAndSend(w, p)
+	h.sendPost(w, r, p)
+}
+
+func (h *PostHandler) addImage(w http.ResponseWriter, r *http.Request, sess session.Session) {
+	if h.Uploader == nil {
+		sending.SendJSONMessage(w, "uploads are disabled", http.StatusNotImplemented)
+		return
+	}
+	maxSize := h.Uploader.Limits.MaxSize + multipartOverhead
+	if r.ContentLength > maxSize {
+		sending.SendJSONMessage(w, "file is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	err := r.ParseMultipartForm(multipartOverhead)
+	if err != nil {
+		sending.SendJSONMessage(w, "invalid multipart form", http.StatusBadRequest)
+		return
+	}
+	defer func() {
+		_ = r.MultipartForm.RemoveAll()
+	}()
+
+	form := post.PostForm{
+		Type:     r.FormValue("type"),
+		Title:    strings.TrimSpace(r.FormValue("title")),
+		Category: strings.TrimSpace(r.FormValue("category")),
+	}
+	fieldErrs := validatePostForm(form)
+	if form.Type != "" && form.Type != post.IMAGE {
+		fieldErrs = append(fieldErrs, sending.FieldError{
+			Location: "body",
+			Param:    "type",
+			Value:    form.Type,
+			Msg:      "must be image for multipart/form-data",
+		})
+	}
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		fieldErrs = append(fieldErrs, sending.FieldError{
+			Location: "body",
+			Param:    "image",
+			Msg:      "is required",
+		})
+	}
+	if len(fieldErrs) != 0 {
+		sending.SendFieldErrors(w, fieldErrs)
+		return
+	}
+	defer file.Close()
+
+	img, err := h.Uploader.UploadImage(r.Context(), file)
+	switch {
+	case errors.Is(err, upload.ErrTooLarge):
+		sending.SendJSONMessage(w, "file is too large", http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, upload.ErrUnsupportedType),
+		errors.Is(err, upload.ErrBadImage),
+		errors.Is(err, upload.ErrTooManyPixels):
+		sending.SendFieldErrors(w, []sending.FieldError{{
+			Location: "body",
+			Param:    "image",
+			Msg:      err.Error(),
+		}})
+		return
+	case err != nil:
+		h.Logger.Errorf("fail to upload image: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	p := form.Post()
+	p.Image = &img
+	post.InitPost(&p, sess.User)
+	p, err = h.PostRepo.Add(p)
+	if err != nil {
+		h.Logger.Errorf("fail add post: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("add image post %v", p.ID)
+	w.WriteHeader(http.StatusCreated)
+	h.sendPost(w, r, p)
 }
 
 func (h *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
@@ -129,20 +641,67 @@ func (h *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	commForm.Comment = strings.TrimSpace(commForm.Comment)
+	commForm.ParentID = strings.TrimSpace(commForm.ParentID)
+	fieldErrs := validateStruct(commForm)
+	fieldErrs = append(fieldErrs, maxLength("comment", commForm.Comment, comment.MaxBodyLength)...)
+	if len(fieldErrs) != 0 {
+		sending.SendFieldErrors(w, fieldErrs)
+		return
+	}
 
-	comm := comment.Comment{
-		Author: sess.User,
-		Body:   commForm.Comment,
+	if h.Controls != nil {
+		blocked, err := h.blockedFromReply(vars["POST_ID"], commForm.ParentID, sess.User.ID)
+		if err != nil {
+			handlePostRepoErrors(w, err)
+			return
+		}
+		if blocked {
+			sending.SendJSONMessage(w, "you are blocked by the author", http.StatusForbidden)
+			return
+		}
 	}
 
-	post, err := h.PostRepo.AddComment(vars["POST_ID"], comm)
+	comm := comment.NewComment(sess.User, commForm.Comment)
+	comm.ParentID = commForm.ParentID
+
+	comm, err = h.PostRepo.AddComment(vars["POST_ID"], comm)
 	if err != nil {
 		handlePostRepoErrors(w, err)
 		return
 	}
-	h.Logger.Infof("add comment to post %v by %v", post.ID, sess.User.ID)
+	post, err := h.PostRepo.GetByID(comm.PostID)
+	if err != nil {
+		handlePostRepoErrors(w, err)
+		return
+	}
+	h.Logger.Infof("add comment %v to post %v by %v", comm.ID, post.ID, sess.User.ID)
 	w.WriteHeader(http.StatusCreated)
-	JSONMarshalAndSend(w, post)
+	h.sendPost(w, r, post)
+}
+
+// blockedFromReply tells whether the author of the post, or of the comment
+// replied to, blocked the user.
+func (h *PostHandler) blockedFromReply(postID, parentID, userID string) (bool, error) {
+	p, err := h.PostRepo.GetByID(postID)
+	if err != nil {
+		return false, err
+	}
+	authors := []string{p.Author.ID}
+	if parentID != "" {
+		parent, err := h.PostRepo.GetComment(postID, parentID)
+		if err != nil {
+			return false, err
+		}
+		authors = append(authors, parent.Author.ID)
+	}
+	for _, authorID := range authors {
+		blocked, err := h.Controls.IsBlocked(authorID, userID)
+		if err != nil || blocked {
+			return blocked, err
+		}
+	}
+	return false, nil
 }
 
 func (h *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
@@ -153,13 +712,63 @@ func (h *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	vars := mux.Vars(r)
-	post, err := h.PostRepo.DeleteComment(vars["POST_ID"], vars["COMMENT_ID"], sess.User.ID)
+	if !h.authorize(w, sess.User, policy.DeleteComment, vars["POST_ID"], vars["COMMENT_ID"]) {
+		return
+	}
+	err = h.PostRepo.DeleteComment(vars["POST_ID"], vars["COMMENT_ID"])
+	if err != nil {
+		handlePostRepoErrors(w, err)
+		return
+	}
+	post, err := h.PostRepo.GetByID(vars["POST_ID"])
+	if err != nil {
+		handlePostRepoErrors(w, err)
+		return
+	}
+	h.Logger.Infof("delete comment %v from post %v by %v", vars["COMMENT_ID"], post.ID, sess.User.ID)
+	h.sendPost(w, r, post)
+}
+
+// ListComments pages through comments of a post in the order they were added.
+func (h *PostHandler) ListComments(w http.ResponseWriter, r *http.Request) {
+	offset, limit, fieldErrs := pageFromQuery(r)
+	if len(fieldErrs) != 0 {
+		sending.SendFieldErrors(w, fieldErrs)
+		return
+	}
+	f, err := h.viewerFilter(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	p, err := h.PostRepo.GetByID(mux.Vars(r)["POST_ID"])
 	if err != nil {
 		handlePostRepoErrors(w, err)
 		return
 	}
-	h.Logger.Infof("add comment from post %v by %v", post.ID, sess.User.ID)
-	JSONMarshalAndSend(w, post)
+	if f.Blocks(p.Author.ID) {
+		handlePostRepoErrors(w, post.ErrNoPost)
+		return
+	}
+
+	// one extra comment tells whether there is a next page
+	p.Comments, err = h.PostRepo.GetComments(p.ID, f, offset, limit+1)
+	if err != nil {
+		h.Logger.Errorf("fail to get comments of post %v: %v", p.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	page := CommentsPage{Offset: offset, Limit: limit}
+	if len(p.Comments) > limit {
+		p.Comments = p.Comments[:limit]
+		page.HasMore = true
+	}
+	page.Items = h.forViewer(r, f, []post.Post{p})[0].Comments
+	if page.Items == nil {
+		page.Items = make([]comment.Comment, 0)
+	}
+	h.Logger.Infof("list comments of post %v", p.ID)
+	JSONMarshalAndSend(w, page)
 }
 
 func (h *PostHandler) Upvote(w http.ResponseWriter, r *http.Request) {
@@ -175,7 +784,7 @@ func (h *PostHandler) Upvote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	h.Logger.Infof("upvote post %v by %v", post.ID, sess.User.ID)
-	JSONMarshalAndSend(w, post)
+	h.sendPost(w, r, post)
 }
 
 func (h *PostHandler) Downvote(w http.ResponseWriter, r *http.Request) {
@@ -191,7 +800,7 @@ func (h *PostHandler) Downvote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	h.Logger.Infof("downvote post %v by %v", post.ID, sess.User.ID)
-	JSONMarshalAndSend(w, post)
+	h.sendPost(w, r, post)
 }
 
 func (h *PostHandler) Unvote(w http.ResponseWriter, r *http.Request) {
@@ -207,7 +816,28 @@ func (h *PostHandler) Unvote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	h.Logger.Infof("unvote post %v by %v", post.ID, sess.User.ID)
-	JSONMarshalAndSend(w, post)
+	h.sendPost(w, r, post)
+}
+
+func (h *PostHandler) VotePoll(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	option, err := strconv.Atoi(vars["OPTION"])
+	if err != nil {
+		sending.SendJSONMessage(w, "invalid poll option", http.StatusNotFound)
+		return
+	}
+	post, err := h.PostRepo.VotePoll(vars["POST_ID"], sess.User.ID, option)
+	if err != nil {
+		handlePostRepoErrors(w, err)
+		return
+	}
+	h.Logger.Infof("vote for option %v in poll %v by %v", option, post.ID, sess.User.ID)
+	h.sendPost(w, r, post)
 }
 
 func (h *PostHandler) Delete(w http.ResponseWriter, r *http.Request) {
@@ -217,7 +847,10 @@ func (h *PostHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	vars := mux.Vars(r)
-	err = h.PostRepo.Delete(vars["POST_ID"], sess.User.ID)
+	if !h.authorize(w, sess.User, policy.DeletePost, vars["POST_ID"], "") {
+		return
+	}
+	err = h.PostRepo.Delete(vars["POST_ID"])
 	if err != nil {
 		handlePostRepoErrors(w, err)
 		return
@@ -226,13 +859,77 @@ func (h *PostHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	sending.SendJSONMessage(w, "success", http.StatusOK)
 }
 
+// authorize checks the user may do the action with the post, or its
+// comment for a non empty commentID, and answers the request otherwise.
+func (h *PostHandler) authorize(w http.ResponseWriter, u user.User, action policy.Action, postID string, commentID string) bool {
+	authorID, err := h.PostRepo.GetAuthorID(postID, commentID)
+	if err == nil {
+		err = h.Policy.Authorize(u, action, policy.Owned(authorID))
+	}
+	if err != nil {
+		handlePostRepoErrors(w, err)
+		return false
+	}
+	return true
+}
+
+func (h *PostHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	if !h.authorize(w, sess.User, policy.RestorePost, vars["POST_ID"], "") {
+		return
+	}
+	deletedAfter := time.Now().Add(-h.RestoreWindow)
+	post, err := h.PostRepo.Restore(vars["POST_ID"], deletedAfter)
+	if err != nil {
+		handlePostRepoErrors(w, err)
+		return
+	}
+	h.Logger.Infof("restore post %v by %v", post.ID, sess.User.ID)
+	h.sendPost(w, r, post)
+}
+
+func (h *PostHandler) RestoreComment(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	vars := mux.Vars(r)
+	if !h.authorize(w, sess.User, policy.RestoreComment, vars["POST_ID"], vars["COMMENT_ID"]) {
+		return
+	}
+	deletedAfter := time.Now().Add(-h.RestoreWindow)
+	_, err = h.PostRepo.RestoreComment(vars["POST_ID"], vars["COMMENT_ID"], deletedAfter)
+	if err != nil {
+		handlePostRepoErrors(w, err)
+		return
+	}
+	post, err := h.PostRepo.GetByID(vars["POST_ID"])
+	if err != nil {
+		handlePostRepoErrors(w, err)
+		return
+	}
+	h.Logger.Infof("restore comment %v of post %v by %v", vars["COMMENT_ID"], post.ID, sess.User.ID)
+	h.sendPost(w, r, post)
+}
+
 func (h *PostHandler) GetUserPosts(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
+	f, err := h.viewerFilter(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 	elems, err := h.PostRepo.GetUserPosts(vars["USER_LOGIN"])
 	if err != nil {
 		handlePostRepoErrors(w, err)
 		return
 	}
 	h.Logger.Infof("get posts created by %v", vars["USER_LOGIN"])
-	JSONMarshalAndSend(w, elems)
+	JSONMarshalAndSend(w, h.forViewer(r, f, f.ApplyAll(elems)))
 }
@@ -2,23 +2,35 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 
 	"github.com/golang/mock/gomock"
 	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/policy"
 	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/sending"
 	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/storage"
+	"github.com/greatjudge/redditclone/pkg/upload"
 	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/greatjudge/redditclone/pkg/views"
 	"github.com/greatjudge/redditclone/pkg/vote"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap"
 )
@@ -218,7 +230,8 @@ func CheckTestList(t *testing.T, tc TestCaseList) {
 	defer ctrl.Finish()
 
 	st := post.NewMockPostRepo(ctrl)
-	st.EXPECT().GetAll().Return(tc.ReturnPosts, tc.ReturnError)
+	expectComments(st, nil)
+	st.EXPECT().GetAll(post.Filter{}).Return(tc.ReturnPosts, tc.ReturnError)
 
 	service := PostHandler{
 		Logger:   zap.NewNop().Sugar(),
@@ -299,7 +312,8 @@ func CheckListByCategory(t *testing.T, tc TestCaseListByCategory) {
 	defer ctrl.Finish()
 
 	st := post.NewMockPostRepo(ctrl)
-	st.EXPECT().GetByCategory(tc.Category).Return(tc.ReturnPosts, tc.ReturnError)
+	expectComments(st, nil)
+	st.EXPECT().GetByCategory(tc.Category, post.Filter{}).Return(tc.ReturnPosts, tc.ReturnError)
 
 	service := PostHandler{
 		Logger:   zap.NewNop().Sugar(),
@@ -388,6 +402,7 @@ func CheckGetByID(t *testing.T, tc TestCaseGetByID) {
 	defer ctrl.Finish()
 
 	st := post.NewMockPostRepo(ctrl)
+	expectComments(st, tc.ReturnPost.Comments)
 	st.EXPECT().GetByID(tc.PostID).Return(tc.ReturnPost, tc.ReturnError)
 
 	service := PostHandler{
@@ -470,11 +485,17 @@ func TestGetByID(t *testing.T) {
 	}
 }
 
+// expectComments answers the first comments page of single post responses.
+func expectComments(st *post.MockPostRepo, comments []comment.Comment) {
+	st.EXPECT().GetComments(gomock.Any(), gomock.Any(), 0, PostCommentsLimit).Return(comments, nil).AnyTimes()
+}
+
 func CheckSessionError(t *testing.T, method string) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	st := post.NewMockPostRepo(ctrl)
+	expectComments(st, nil)
 
 	service := PostHandler{
 		Logger:   zap.NewNop().Sugar(),
@@ -499,6 +520,10 @@ func CheckSessionError(t *testing.T, method string) {
 		service.Unvote(w, req)
 	case "Delete":
 		service.Delete(w, req)
+	case "Restore":
+		service.Restore(w, req)
+	case "RestoreComment":
+		service.RestoreComment(w, req)
 	}
 
 	if w.Code != http.StatusInternalServerError {
@@ -525,8 +550,19 @@ func CheckTestAdd(t *testing.T, tc TestCaseAdd) {
 	p := tc.ReturnPost
 	post.InitPost(&p, p.Author)
 
+	form := post.PostForm{
+		Type:     p.Type,
+		Title:    p.Title,
+		Category: p.Category,
+		URL:      p.URL,
+		Text:     p.Text,
+	}
+	added := form.Post()
+	post.InitPost(&added, p.Author)
+
 	st := post.NewMockPostRepo(ctrl)
-	st.EXPECT().Add(p).Return(p, tc.ReturnError)
+	expectComments(st, p.Comments)
+	st.EXPECT().Add(added).Return(p, tc.ReturnError)
 
 	service := PostHandler{
 		Logger:   zap.NewNop().Sugar(),
@@ -538,7 +574,7 @@ func CheckTestAdd(t *testing.T, tc TestCaseAdd) {
 		User:  p.Author,
 	}
 
-	postBytes, err := json.Marshal(p)
+	postBytes, err := json.Marshal(form)
 	if err != nil {
 		t.Errorf("marshall err: %v", err.Error())
 	}
@@ -594,7 +630,7 @@ func TestAdd(t *testing.T) {
 			CaseName:    "normal",
 		},
 		{
-			ReturnPost:  post.Post{},
+			ReturnPost:  Posts[1],
 			ReturnError: fmt.Errorf("some error"),
 			StatusCode:  http.StatusBadRequest,
 			CaseName:    "some err",
@@ -607,6 +643,368 @@ func TestAdd(t *testing.T) {
 	}
 }
 
+func TestAddValidation(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   string
+		params []string
+	}{
+		{
+			name:   "empty title and category",
+			body:   `{"type":"text","title":"  ","category":"","text":"t"}`,
+			params: []string{"title", "category"},
+		},
+		{
+			name:   "unknown type",
+			body:   `{"type":"video","title":"t","category":"music"}`,
+			params: []string{"type"},
+		},
+		{
+			name:   "link without url",
+			body:   `{"type":"link","title":"t","category":"music"}`,
+			params: []string{"url"},
+		},
+		{
+			name:   "link with forbidden scheme",
+			body:   `{"type":"link","title":"t","category":"music","url":"javascript://x/%0aalert(1)"}`,
+			params: []string{"url"},
+		},
+		{
+			name:   "too long title",
+			body:   `{"type":"text","title":"` + strings.Repeat("й", post.MaxTitleLength+1) + `","category":"music"}`,
+			params: []string{"title"},
+		},
+		{
+			name:   "too long category and text",
+			body:   `{"type":"text","title":"t","category":"` + strings.Repeat("a", post.MaxCategoryLength+1) + `","text":"` + strings.Repeat("a", post.MaxTextLength+1) + `"}`,
+			params: []string{"category", "text"},
+		},
+		{
+			name:   "poll with one option",
+			body:   `{"type":"poll","title":"q","category":"music","options":["a"]}`,
+			params: []string{"options"},
+		},
+		{
+			name:   "poll with blank and duplicate options",
+			body:   `{"type":"poll","title":"q","category":"music","options":["Yes"," ","yes "]}`,
+			params: []string{"options.1", "options.2"},
+		},
+		{
+			name:   "poll closing in the past",
+			body:   `{"type":"poll","title":"q","category":"music","options":["a","b"],"closes_at":"2001-01-01T00:00:00Z"}`,
+			params: []string{"closes_at"},
+		},
+		{
+			name:   "image as json",
+			body:   `{"type":"image","title":"t","category":"music"}`,
+			params: []string{"type"},
+		},
+		{
+			name:   "client supplied fields",
+			body:   `{"type":"text","title":"t","category":"music","id":"1","score":100,"votes":[],"views":5}`,
+			params: []string{"id", "score", "votes", "views"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := PostHandler{
+				Logger:   zap.NewNop().Sugar(),
+				PostRepo: post.NewMockPostRepo(ctrl),
+			}
+
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+			req = req.WithContext(session.ContextWithSession(req.Context(), session.Session{}))
+			w := httptest.NewRecorder()
+
+			service.Add(w, req)
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Errorf("bad response code, expected %d, got %d", http.StatusUnprocessableEntity, w.Code)
+				return
+			}
+			resp := sending.FieldErrors{}
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			if err != nil {
+				t.Errorf("cant unmarshall %v", w.Body.String())
+				return
+			}
+			params := make([]string, 0, len(resp.Errors))
+			for _, e := range resp.Errors {
+				params = append(params, e.Param)
+			}
+			assert.ElementsMatch(t, tc.params, params)
+		})
+	}
+}
+
+func multipartPost(t *testing.T, fields map[string]string, file []byte) *http.Request {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for name, val := range fields {
+		_ = mw.WriteField(name, val)
+	}
+	if file != nil {
+		part, err := mw.CreateFormFile("image", "photo.png")
+		if err != nil {
+			t.Fatalf("cant create form file: %v", err)
+		}
+		_, _ = part.Write(file)
+	}
+	_ = mw.Close()
+	req := httptest.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	sess := session.Session{User: user.User{ID: "1", Username: "u"}}
+	return req.WithContext(session.ContextWithSession(req.Context(), sess))
+}
+
+func TestAddImage(t *testing.T) {
+	pngBuf := &bytes.Buffer{}
+	_ = png.Encode(pngBuf, image.NewRGBA(image.Rect(0, 0, 50, 40)))
+	fields := map[string]string{"type": "image", "title": " cat ", "category": "funny"}
+
+	cases := []struct {
+		name   string
+		fields map[string]string
+		file   []byte
+		code   int
+		params []string
+	}{
+		{
+			name:   "png",
+			fields: fields,
+			file:   pngBuf.Bytes(),
+			code:   http.StatusCreated,
+		},
+		{
+			name:   "not an image",
+			fields: fields,
+			file:   []byte("<html><script>alert(1)</script></html>"),
+			code:   http.StatusUnprocessableEntity,
+			params: []string{"image"},
+		},
+		{
+			name:   "no file",
+			fields: fields,
+			code:   http.StatusUnprocessableEntity,
+			params: []string{"image"},
+		},
+		{
+			name:   "wrong type and no title",
+			fields: map[string]string{"type": "text", "category": "funny"},
+			file:   pngBuf.Bytes(),
+			code:   http.StatusUnprocessableEntity,
+			params: []string{"type", "title"},
+		},
+		{
+			name:   "too large",
+			fields: fields,
+			file:   bytes.Repeat([]byte{0}, 2<<10),
+			code:   http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store, err := storage.NewLocalStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			uploader := upload.NewUploader(store, "/api/files/")
+			uploader.Limits.MaxSize = 1 << 10
+
+			st := post.NewMockPostRepo(ctrl)
+			expectComments(st, nil)
+			if tc.code == http.StatusCreated {
+				st.EXPECT().Add(gomock.Any()).DoAndReturn(func(p post.Post) (post.Post, error) {
+					p.ID = "1"
+					return p, nil
+				})
+			}
+			service := PostHandler{
+				Logger:   zap.NewNop().Sugar(),
+				PostRepo: st,
+				Uploader: uploader,
+			}
+
+			w := httptest.NewRecorder()
+			service.Add(w, multipartPost(t, tc.fields, tc.file))
+			assert.Equal(t, tc.code, w.Code)
+
+			if tc.params != nil {
+				resp := sending.FieldErrors{}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("cant unmarshall %v", w.Body.String())
+				}
+				params := make([]string, 0, len(resp.Errors))
+				for _, e := range resp.Errors {
+					params = append(params, e.Param)
+				}
+				assert.ElementsMatch(t, tc.params, params)
+			}
+			if tc.code != http.StatusCreated {
+				return
+			}
+
+			p := post.Post{}
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatalf("cant unmarshall %v", w.Body.String())
+			}
+			assert.Equal(t, post.IMAGE, p.Type)
+			assert.Equal(t, "cat", p.Title)
+			if assert.NotNil(t, p.Image) {
+				assert.Equal(t, 50, p.Image.Width)
+				assert.Equal(t, "image/png", p.Image.ContentType)
+				key := strings.TrimPrefix(p.Image.URL, "/api/files/")
+				rc, _, err := store.Get(context.Background(), key)
+				if assert.Nil(t, err) {
+					rc.Close()
+				}
+			}
+		})
+	}
+}
+
+func TestAddImageUploadsDisabled(t *testing.T) {
+	service := PostHandler{Logger: zap.NewNop().Sugar()}
+	w := httptest.NewRecorder()
+	service.Add(w, multipartPost(t, map[string]string{"type": "image"}, []byte("x")))
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
+
+func TestVotePoll(t *testing.T) {
+	cases := []struct {
+		name   string
+		option string
+		err    error
+		code   int
+	}{
+		{name: "normal", option: "1", code: http.StatusOK},
+		{name: "not a number", option: "x", code: http.StatusNotFound},
+		{name: "no option", option: "5", err: post.ErrNoPollOption, code: http.StatusNotFound},
+		{name: "not a poll", option: "0", err: post.ErrNotPoll, code: http.StatusBadRequest},
+		{name: "closed", option: "0", err: post.ErrPollClosed, code: http.StatusConflict},
+		{name: "voted twice", option: "0", err: post.ErrAlreadyVoted, code: http.StatusConflict},
+		{name: "no post", option: "0", err: post.ErrNoPost, code: http.StatusNotFound},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			form := post.PostForm{Type: post.POLL, Title: "q", Category: "c", Options: []string{"a", "b"}}
+			p := form.Post()
+			p.ID = "1"
+			_ = p.VotePoll(1, time.Now())
+			_ = p.VotePoll(0, time.Now())
+
+			st := post.NewMockPostRepo(ctrl)
+			expectComments(st, nil)
+			if tc.option != "x" {
+				option, _ := strconv.Atoi(tc.option)
+				if tc.err != nil {
+					st.EXPECT().VotePoll("1", "2", option).Return(post.Post{}, tc.err)
+				} else {
+					st.EXPECT().VotePoll("1", "2", option).Return(p.WithPollVote(option), nil)
+					st.EXPECT().GetVotes("2", []string{"1"}).Return([]vote.Vote{}, nil)
+				}
+			}
+			service := PostHandler{
+				Logger:   zap.NewNop().Sugar(),
+				PostRepo: st,
+			}
+
+			req := httptest.NewRequest("POST", "/", nil)
+			req = mux.SetURLVars(req, map[string]string{"POST_ID": "1", "OPTION": tc.option})
+			sess := session.Session{User: user.User{ID: "2", Username: "u"}}
+			req = req.WithContext(session.ContextWithSession(req.Context(), sess))
+			w := httptest.NewRecorder()
+
+			service.VotePoll(w, req)
+			assert.Equal(t, tc.code, w.Code)
+			if tc.code != http.StatusOK {
+				return
+			}
+			resp := post.Post{}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("cant unmarshall %v", w.Body.String())
+			}
+			assert.True(t, resp.Poll.ResultsVisible)
+			assert.Equal(t, 2, resp.Poll.TotalVotes)
+			assert.NotContains(t, w.Body.String(), "voters")
+		})
+	}
+}
+
+func TestPollResultsHiddenFromAnonymous(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	form := post.PostForm{Type: post.POLL, Title: "q", Category: "c", Options: []string{"a", "b"}}
+	p := form.Post()
+	p.ID = "1"
+	_ = p.VotePoll(1, time.Now())
+
+	st := post.NewMockPostRepo(ctrl)
+	expectComments(st, nil)
+	st.EXPECT().GetByID("1").Return(p, nil)
+	service := PostHandler{
+		Logger:   zap.NewNop().Sugar(),
+		PostRepo: st,
+	}
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/", nil), map[string]string{"POST_ID": "1"})
+	w := httptest.NewRecorder()
+	service.GetByID(w, req)
+
+	resp := post.Post{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("cant unmarshall %v", w.Body.String())
+	}
+	assert.False(t, resp.Poll.ResultsVisible)
+	assert.Equal(t, 0, resp.Poll.TotalVotes)
+	assert.Equal(t, 0, resp.Poll.Options[1].Votes)
+}
+
+func TestPollResultsShownToVoter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	form := post.PostForm{Type: post.POLL, Title: "q", Category: "c", Options: []string{"a", "b"}}
+	p := form.Post()
+	p.ID = "1"
+	_ = p.VotePoll(1, time.Now())
+
+	st := post.NewMockPostRepo(ctrl)
+	expectComments(st, nil)
+	st.EXPECT().GetByID("1").Return(p, nil)
+	st.EXPECT().GetPollVotes("u1", []string{"1"}).
+		Return([]post.PollVote{{PostID: "1", UserID: "u1", Option: 1}}, nil)
+	st.EXPECT().GetVotes("u1", []string{"1"}).Return([]vote.Vote{}, nil)
+	service := PostHandler{
+		Logger:   zap.NewNop().Sugar(),
+		PostRepo: st,
+	}
+	w := httptest.NewRecorder()
+	service.GetByID(w, authRequest("GET", "/", map[string]string{"POST_ID": "1"}))
+
+	resp := post.Post{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("cant unmarshall %v", w.Body.String())
+	}
+	assert.True(t, resp.Poll.ResultsVisible)
+	if assert.NotNil(t, resp.Poll.VotedOption) {
+		assert.Equal(t, 1, *resp.Poll.VotedOption)
+	}
+	assert.Equal(t, 1, resp.Poll.Options[1].Votes)
+}
+
 func TestAddSessionError(t *testing.T) {
 	CheckSessionError(t, "Add")
 }
@@ -616,6 +1014,7 @@ func TestAddReadBodyErr(t *testing.T) {
 	defer ctrl.Finish()
 
 	st := post.NewMockPostRepo(ctrl)
+	expectComments(st, nil)
 
 	service := PostHandler{
 		Logger:   zap.NewNop().Sugar(),
@@ -653,6 +1052,7 @@ func TestAddReadBodyUnmarshallErr(t *testing.T) {
 	defer ctrl.Finish()
 
 	st := post.NewMockPostRepo(ctrl)
+	expectComments(st, nil)
 
 	service := PostHandler{
 		Logger:   zap.NewNop().Sugar(),
@@ -698,6 +1098,7 @@ func TestAddCommentReadBodyErr(t *testing.T) {
 	defer ctrl.Finish()
 
 	st := post.NewMockPostRepo(ctrl)
+	expectComments(st, nil)
 
 	service := PostHandler{
 		Logger:   zap.NewNop().Sugar(),
@@ -735,6 +1136,7 @@ func TestAddCommentUnmarshallError(t *testing.T) {
 	defer ctrl.Finish()
 
 	st := post.NewMockPostRepo(ctrl)
+	expectComments(st, nil)
 
 	service := PostHandler{
 		Logger:   zap.NewNop().Sugar(),
@@ -780,13 +1182,17 @@ func CheckAddComment(t *testing.T, tc TestCaseAddComment) {
 
 	commForm := tc.CommForm
 
-	comm := comment.Comment{
-		Author: p.Author,
-		Body:   commForm.Comment,
-	}
+	comm := comment.NewComment(p.Author, commForm.Comment)
+
+	added := comm
+	added.ID, added.PostID = "new", p.ID
 
 	st := post.NewMockPostRepo(ctrl)
-	st.EXPECT().AddComment(p.ID, comm).Return(p, tc.ReturnError)
+	expectComments(st, p.Comments)
+	st.EXPECT().AddComment(p.ID, comm).Return(added, tc.ReturnError)
+	if tc.ReturnError == nil {
+		st.EXPECT().GetByID(p.ID).Return(p, nil)
+	}
 
 	service := PostHandler{
 		Logger:   zap.NewNop().Sugar(),
@@ -864,14 +1270,14 @@ func TestAddComment(t *testing.T) {
 		},
 		{
 			ReturnPost:  post.Post{},
-			CommForm:    comment.CommentForm{},
+			CommForm:    comment.CommentForm{Comment: "some comment"},
 			ReturnError: fmt.Errorf("some error"),
 			StatusCode:  http.StatusInternalServerError,
 			CaseName:    "some error",
 		},
 		{
 			ReturnPost:  post.Post{},
-			CommForm:    comment.CommentForm{},
+			CommForm:    comment.CommentForm{Comment: "some comment"},
 			ReturnError: post.ErrNoPost,
 			StatusCode:  http.StatusNotFound,
 			CaseName:    "no post err",
@@ -884,9 +1290,38 @@ func TestAddComment(t *testing.T) {
 	}
 }
 
+func TestAddCommentValidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	service := PostHandler{
+		Logger:   zap.NewNop().Sugar(),
+		PostRepo: post.NewMockPostRepo(ctrl),
+	}
+
+	for _, body := range []string{
+		`{"comment":"   "}`,
+		`{"comment":"` + strings.Repeat("a", comment.MaxBodyLength+1) + `"}`,
+	} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"POST_ID": "1"})
+		req = req.WithContext(session.ContextWithSession(req.Context(), session.Session{}))
+		w := httptest.NewRecorder()
+
+		service.AddComment(w, req)
+
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("bad response code, expected %d, got %d", http.StatusUnprocessableEntity, w.Code)
+		}
+	}
+}
+
 type TestCaseDeleteComment struct {
-	ReturnPost  post.Post
-	CommID      string
+	ReturnPost post.Post
+	CommID     string
+	// AuthorID is the author of the comment, the post author if empty.
+	AuthorID    string
+	Role        policy.Role
 	ReturnError error
 	StatusCode  int
 	CaseName    string
@@ -902,13 +1337,29 @@ func CheckDeleteComment(t *testing.T, tc TestCaseDeleteComment) {
 
 	p := tc.ReturnPost
 	commID := tc.CommID
+	authorID := tc.AuthorID
+	if authorID == "" {
+		authorID = p.Author.ID
+	}
 
 	st := post.NewMockPostRepo(ctrl)
-	st.EXPECT().DeleteComment(p.ID, commID, p.Author.ID).Return(p, tc.ReturnError)
+	roles := policy.NewMockRoleRepo(ctrl)
+	expectComments(st, p.Comments)
+	st.EXPECT().GetAuthorID(p.ID, commID).Return(authorID, nil)
+	if tc.Role != "" {
+		roles.EXPECT().Role(p.Author.ID).Return(tc.Role, nil)
+	}
+	if tc.StatusCode != http.StatusForbidden {
+		st.EXPECT().DeleteComment(p.ID, commID).Return(tc.ReturnError)
+	}
+	if tc.ReturnError == nil && tc.StatusCode == http.StatusOK {
+		st.EXPECT().GetByID(p.ID).Return(p, nil)
+	}
 
 	service := PostHandler{
 		Logger:   zap.NewNop().Sugar(),
 		PostRepo: st,
+		Policy:   policy.New(roles),
 	}
 
 	sess := session.Session{
@@ -940,7 +1391,7 @@ func CheckDeleteComment(t *testing.T, tc TestCaseDeleteComment) {
 		return
 	}
 
-	if tc.ReturnError != nil {
+	if tc.StatusCode != http.StatusOK {
 		return
 	}
 
@@ -974,32 +1425,41 @@ func TestDeleteComment(t *testing.T) {
 			CaseName:    "normal",
 		},
 		{
-			ReturnPost:  post.Post{},
+			ReturnPost:  Posts[0],
 			CommID:      "1",
 			ReturnError: fmt.Errorf("some error"),
 			StatusCode:  http.StatusInternalServerError,
 			CaseName:    "some error",
 		},
 		{
-			ReturnPost:  post.Post{},
+			ReturnPost:  Posts[0],
 			CommID:      "1",
 			ReturnError: post.ErrNoPost,
 			StatusCode:  http.StatusNotFound,
 			CaseName:    "no post err",
 		},
 		{
-			ReturnPost:  post.Post{},
+			ReturnPost:  Posts[0],
 			CommID:      "1",
 			ReturnError: comment.ErrNoComment,
 			StatusCode:  http.StatusNotFound,
 			CaseName:    "no comment err",
 		},
 		{
-			ReturnPost:  post.Post{},
-			CommID:      "1",
-			ReturnError: post.ErrNoAccess,
-			StatusCode:  http.StatusForbidden,
-			CaseName:    "no access err",
+			ReturnPost: Posts[0],
+			CommID:     "1",
+			AuthorID:   "other",
+			Role:       policy.RoleUser,
+			StatusCode: http.StatusForbidden,
+			CaseName:   "no access err",
+		},
+		{
+			ReturnPost: Posts[0],
+			CommID:     "1",
+			AuthorID:   "other",
+			Role:       policy.RoleModerator,
+			StatusCode: http.StatusOK,
+			CaseName:   "moderator",
 		},
 	}
 	for _, tc := range cases {
@@ -1030,6 +1490,7 @@ func CheckVote(t *testing.T, tc TestCaseVote) {
 	p := tc.ReturnPost
 
 	st := post.NewMockPostRepo(ctrl)
+	expectComments(st, p.Comments)
 	switch tc.VoteMethod {
 	case UPVOTE:
 		st.EXPECT().Upvote(p.ID, p.Author.ID).Return(p, tc.ReturnError)
@@ -1211,6 +1672,9 @@ func TestUnvoteSessionError(t *testing.T) {
 type TestCaseDelete struct {
 	PostID      string
 	UserID      string
+	AuthorID    string
+	Role        policy.Role
+	AuthorError error
 	ReturnError error
 	StatusCode  int
 	CaseName    string
@@ -1221,11 +1685,20 @@ func CheckDelete(t *testing.T, tc TestCaseDelete) {
 	defer ctrl.Finish()
 
 	st := post.NewMockPostRepo(ctrl)
-	st.EXPECT().Delete(tc.PostID, tc.UserID).Return(tc.ReturnError)
+	roles := policy.NewMockRoleRepo(ctrl)
+	expectComments(st, nil)
+	st.EXPECT().GetAuthorID(tc.PostID, "").Return(tc.AuthorID, tc.AuthorError)
+	if tc.Role != "" {
+		roles.EXPECT().Role(tc.UserID).Return(tc.Role, nil)
+	}
+	if tc.AuthorError == nil && tc.StatusCode != http.StatusForbidden {
+		st.EXPECT().Delete(tc.PostID).Return(tc.ReturnError)
+	}
 
 	service := PostHandler{
 		Logger:   zap.NewNop().Sugar(),
 		PostRepo: st,
+		Policy:   policy.New(roles),
 	}
 
 	sess := session.Session{
@@ -1265,6 +1738,7 @@ func TestDelete(t *testing.T) {
 		{
 			PostID:      "1",
 			UserID:      "1",
+			AuthorID:    "1",
 			ReturnError: nil,
 			StatusCode:  http.StatusOK,
 			CaseName:    "normal",
@@ -1272,6 +1746,7 @@ func TestDelete(t *testing.T) {
 		{
 			PostID:      "1",
 			UserID:      "1",
+			AuthorID:    "1",
 			ReturnError: fmt.Errorf("some error"),
 			StatusCode:  http.StatusInternalServerError,
 			CaseName:    "some error",
@@ -1279,16 +1754,25 @@ func TestDelete(t *testing.T) {
 		{
 			PostID:      "1",
 			UserID:      "1",
-			ReturnError: post.ErrNoPost,
+			AuthorError: post.ErrNoPost,
 			StatusCode:  http.StatusNotFound,
 			CaseName:    "no post err",
 		},
 		{
-			PostID:      "1",
-			UserID:      "1",
-			ReturnError: post.ErrNoAccess,
-			StatusCode:  http.StatusForbidden,
-			CaseName:    "no access",
+			PostID:     "1",
+			UserID:     "1",
+			AuthorID:   "2",
+			Role:       policy.RoleUser,
+			StatusCode: http.StatusForbidden,
+			CaseName:   "no access",
+		},
+		{
+			PostID:     "1",
+			UserID:     "1",
+			AuthorID:   "2",
+			Role:       policy.RoleAdmin,
+			StatusCode: http.StatusOK,
+			CaseName:   "admin",
 		},
 	}
 	for _, tc := range cases {
@@ -1315,6 +1799,7 @@ func CheckGetUserPosts(t *testing.T, tc TestCaseGetUserPosts) {
 	defer ctrl.Finish()
 
 	st := post.NewMockPostRepo(ctrl)
+	expectComments(st, nil)
 	st.EXPECT().GetUserPosts(tc.Username).Return(tc.ReturnPosts, tc.ReturnError)
 
 	service := PostHandler{
@@ -1390,3 +1875,304 @@ func TestGetUserPosts(t *testing.T) {
 		})
 	}
 }
+
+func TestAddDuplicateLink(t *testing.T) {
+	form := post.PostForm{
+		Type:     post.LINK,
+		Title:    "title",
+		Category: "music",
+		URL:      "https://www.example.com/page/?utm_source=feed",
+	}
+	author := user.User{ID: "1", Username: "username"}
+	added := form.Post()
+	post.InitPost(&added, author)
+	existing := Posts[2]
+
+	newRequest := func(target string) *http.Request {
+		body, err := json.Marshal(form)
+		if err != nil {
+			t.Fatalf("marshall err: %v", err)
+		}
+		req := httptest.NewRequest("POST", target, bytes.NewReader(body))
+		return req.WithContext(session.ContextWithSession(req.Context(), session.Session{User: author}))
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		st := post.NewMockPostRepo(ctrl)
+		expectComments(st, nil)
+		st.EXPECT().GetByNormalizedURL("music", "https://example.com/page").Return(existing, nil)
+		service := PostHandler{Logger: zap.NewNop().Sugar(), PostRepo: st}
+
+		w := httptest.NewRecorder()
+		service.Add(w, newRequest("/api/posts"))
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		answer := DuplicateLinkAnswer{}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &answer))
+		assert.Equal(t, existing.ID, answer.PostID)
+	})
+
+	t.Run("new link", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		st := post.NewMockPostRepo(ctrl)
+		expectComments(st, nil)
+		st.EXPECT().GetByNormalizedURL("music", "https://example.com/page").Return(post.Post{}, post.ErrNoPost)
+		st.EXPECT().Add(added).Return(added, nil)
+		service := PostHandler{Logger: zap.NewNop().Sugar(), PostRepo: st}
+
+		w := httptest.NewRecorder()
+		service.Add(w, newRequest("/api/posts"))
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("forced", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		st := post.NewMockPostRepo(ctrl)
+		expectComments(st, nil)
+		st.EXPECT().Add(added).Return(added, nil)
+		service := PostHandler{Logger: zap.NewNop().Sugar(), PostRepo: st}
+
+		w := httptest.NewRecorder()
+		service.Add(w, newRequest("/api/posts?force=true"))
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("lookup error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		st := post.NewMockPostRepo(ctrl)
+		expectComments(st, nil)
+		st.EXPECT().GetByNormalizedURL("music", "https://example.com/page").Return(post.Post{}, fmt.Errorf("some error"))
+		service := PostHandler{Logger: zap.NewNop().Sugar(), PostRepo: st}
+
+		w := httptest.NewRecorder()
+		service.Add(w, newRequest("/api/posts"))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+type viewsStore struct {
+	counts map[string]int
+}
+
+func (s *viewsStore) AddViews(counts map[string]int) error {
+	for postID, n := range counts {
+		s.counts[postID] += n
+	}
+	return nil
+}
+
+func TestGetByIDCountsViews(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	st := post.NewMockPostRepo(ctrl)
+	expectComments(st, nil)
+	st.EXPECT().GetByID("1").Return(Posts[0], nil).Times(4)
+	store := &viewsStore{counts: make(map[string]int)}
+	counter := views.NewCounter(store, zap.NewNop().Sugar(), views.Config{})
+	service := PostHandler{
+		Logger:   zap.NewNop().Sugar(),
+		PostRepo: st,
+		Views:    counter,
+	}
+
+	anonymous := func(addr string) *http.Request {
+		req := httptest.NewRequest("GET", "/api/post/1", nil)
+		req.RemoteAddr = addr
+		return mux.SetURLVars(req, map[string]string{"POST_ID": "1"})
+	}
+	for _, req := range []*http.Request{
+		anonymous("10.0.0.1:1234"),
+		// same address from another port is the same viewer
+		anonymous("10.0.0.1:4321"),
+		anonymous("10.0.0.2:1234"),
+		authRequest("GET", "/api/post/1", map[string]string{"POST_ID": "1"}),
+	} {
+		w := httptest.NewRecorder()
+		service.GetByID(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	assert.Nil(t, counter.Flush())
+	assert.Equal(t, 3, store.counts["1"])
+}
+
+func TestListComments(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	st := post.NewMockPostRepo(ctrl)
+	service := PostHandler{
+		Logger:   zap.NewNop().Sugar(),
+		PostRepo: st,
+	}
+	vars := map[string]string{"POST_ID": "1"}
+	comments := []comment.Comment{{ID: "c1", PostID: "1"}, {ID: "c2", PostID: "1"}, {ID: "c3", PostID: "1"}}
+
+	st.EXPECT().GetByID("1").Return(Posts[0], nil)
+	st.EXPECT().GetComments("1", post.Filter{}, 2, 3).Return(comments, nil)
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/api/post/1/comments?offset=2&limit=2", nil), vars)
+	w := httptest.NewRecorder()
+	service.ListComments(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	page := CommentsPage{}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("cant unmarshall %v", w.Body.String())
+	}
+	assert.Equal(t, CommentsPage{Items: comments[:2], Offset: 2, Limit: 2, HasMore: true}, page)
+
+	// the last page is an empty list, not null
+	st.EXPECT().GetByID("1").Return(Posts[0], nil)
+	st.EXPECT().GetComments("1", post.Filter{}, 0, DefaultPageLimit+1).Return(nil, nil)
+	req = mux.SetURLVars(httptest.NewRequest("GET", "/api/post/1/comments", nil), vars)
+	w = httptest.NewRecorder()
+	service.ListComments(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"items":[]`)
+
+	st.EXPECT().GetByID("1").Return(post.Post{}, post.ErrNoPost)
+	req = mux.SetURLVars(httptest.NewRequest("GET", "/api/post/1/comments", nil), vars)
+	w = httptest.NewRecorder()
+	service.ListComments(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	st.EXPECT().GetByID("1").Return(Posts[0], nil)
+	st.EXPECT().GetComments("1", post.Filter{}, 0, 2).Return(nil, fmt.Errorf("db error"))
+	req = mux.SetURLVars(httptest.NewRequest("GET", "/api/post/1/comments?limit=1", nil), vars)
+	w = httptest.NewRecorder()
+	service.ListComments(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	req = mux.SetURLVars(httptest.NewRequest("GET", "/api/post/1/comments?limit=0", nil), vars)
+	w = httptest.NewRecorder()
+	service.ListComments(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestRestore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	st := post.NewMockPostRepo(ctrl)
+	roles := policy.NewMockRoleRepo(ctrl)
+	expectComments(st, nil)
+	st.EXPECT().GetVotes(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	st.EXPECT().GetAuthorID("1", "").Return("1", nil).AnyTimes()
+	roles.EXPECT().Role("2").Return(policy.RoleAdmin, nil).AnyTimes()
+	roles.EXPECT().Role("3").Return(policy.RoleUser, nil).AnyTimes()
+	service := PostHandler{
+		Logger:        zap.NewNop().Sugar(),
+		PostRepo:      st,
+		Policy:        policy.New(roles),
+		RestoreWindow: time.Hour,
+	}
+	vars := map[string]string{"POST_ID": "1"}
+	request := func(u user.User) *http.Request {
+		req := mux.SetURLVars(httptest.NewRequest("POST", "/api/post/1/restore", nil), vars)
+		return req.WithContext(session.ContextWithSession(req.Context(), session.Session{User: u}))
+	}
+	inWindow := gomock.AssignableToTypeOf(time.Time{})
+
+	st.EXPECT().Restore("1", inWindow).DoAndReturn(
+		func(postID string, deletedAfter time.Time) (post.Post, error) {
+			assert.WithinDuration(t, time.Now().Add(-time.Hour), deletedAfter, time.Minute)
+			return Posts[0], nil
+		})
+	w := httptest.NewRecorder()
+	service.Restore(w, request(user.User{ID: "1", Username: "u"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"`+Posts[0].ID+`"`)
+
+	// admins restore posts of anyone
+	st.EXPECT().Restore("1", inWindow).Return(Posts[0], nil)
+	w = httptest.NewRecorder()
+	service.Restore(w, request(user.User{ID: "2", Username: "admin"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	service.Restore(w, request(user.User{ID: "3", Username: "other"}))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	for _, tc := range []struct {
+		err    error
+		status int
+	}{
+		{post.ErrNotRestorable, http.StatusNotFound},
+		{post.ErrNoPost, http.StatusNotFound},
+		{fmt.Errorf("db error"), http.StatusInternalServerError},
+	} {
+		st.EXPECT().Restore("1", inWindow).Return(post.Post{}, tc.err)
+		w = httptest.NewRecorder()
+		service.Restore(w, request(user.User{ID: "1", Username: "u"}))
+		assert.Equal(t, tc.status, w.Code)
+	}
+}
+
+func TestRestoreSessionError(t *testing.T) {
+	CheckSessionError(t, "Restore")
+}
+
+func TestRestoreComment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	st := post.NewMockPostRepo(ctrl)
+	roles := policy.NewMockRoleRepo(ctrl)
+	expectComments(st, nil)
+	st.EXPECT().GetVotes(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	roles.EXPECT().Role("2").Return(policy.RoleModerator, nil).AnyTimes()
+	roles.EXPECT().Role("3").Return(policy.RoleUser, nil).AnyTimes()
+	service := PostHandler{
+		Logger:        zap.NewNop().Sugar(),
+		PostRepo:      st,
+		Policy:        policy.New(roles),
+		RestoreWindow: time.Hour,
+	}
+	vars := map[string]string{"POST_ID": "1", "COMMENT_ID": "c1"}
+	request := func(u user.User) *http.Request {
+		req := mux.SetURLVars(httptest.NewRequest("POST", "/api/post/1/c1/restore", nil), vars)
+		return req.WithContext(session.ContextWithSession(req.Context(), session.Session{User: u}))
+	}
+
+	st.EXPECT().GetAuthorID("1", "c1").Return("1", nil).Times(5)
+	st.EXPECT().RestoreComment("1", "c1", gomock.Any()).Return(comment.Comment{ID: "c1", PostID: "1"}, nil)
+	st.EXPECT().GetByID("1").Return(Posts[0], nil)
+	w := httptest.NewRecorder()
+	service.RestoreComment(w, request(user.User{ID: "1", Username: "u"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// moderators restore comments of anyone
+	st.EXPECT().RestoreComment("1", "c1", gomock.Any()).Return(comment.Comment{ID: "c1", PostID: "1"}, nil)
+	st.EXPECT().GetByID("1").Return(Posts[0], nil)
+	w = httptest.NewRecorder()
+	service.RestoreComment(w, request(user.User{ID: "2", Username: "moderator"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	service.RestoreComment(w, request(user.User{ID: "3", Username: "other"}))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	st.EXPECT().RestoreComment("1", "c1", gomock.Any()).Return(comment.Comment{}, post.ErrNotRestorable)
+	w = httptest.NewRecorder()
+	service.RestoreComment(w, request(user.User{ID: "1", Username: "u"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	st.EXPECT().RestoreComment("1", "c1", gomock.Any()).Return(comment.Comment{}, post.ErrNoPost)
+	w = httptest.NewRecorder()
+	service.RestoreComment(w, request(user.User{ID: "1", Username: "u"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	st.EXPECT().GetAuthorID("1", "c1").Return("", comment.ErrNoComment)
+	w = httptest.NewRecorder()
+	service.RestoreComment(w, request(user.User{ID: "1", Username: "u"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRestoreCommentSessionError(t *testing.T) {
+	CheckSessionError(t, "RestoreComment")
+}
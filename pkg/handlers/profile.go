@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/controls"
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/sending"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultPageLimit = 25
+	MaxPageLimit     = 100
+	// MaxPageOffset bounds how deep pages go, repositories read offset+limit
+	// items to skip the first ones.
+	MaxPageOffset = 1000
+)
+
+type KarmaAnswer struct {
+	post.Karma
+	Total int `json:"total"`
+}
+
+type ActivityPage struct {
+	Items   []post.Activity `json:"items"`
+	Offset  int             `json:"offset"`
+	Limit   int             `json:"limit"`
+	HasMore bool            `json:"has_more"`
+}
+
+type ProfileAnswer struct {
+	user.Profile
+	Karma    KarmaAnswer  `json:"karma"`
+	Activity ActivityPage `json:"activity"`
+}
+
+type ProfileHandler struct {
+	Logger   *zap.SugaredLogger
+	UserRepo user.UserRepo
+	PostRepo post.PostRepo
+	Controls controls.ControlsRepo
+}
+
+// pageFromQuery reads offset and limit query parameters.
+func pageFromQuery(r *http.Request) (int, int, []sending.FieldError) {
+	fieldErrs := make([]sending.FieldError, 0)
+	offset, limit := 0, DefaultPageLimit
+	query := r.URL.Query()
+	if raw := query.Get("offset"); raw != "" {
+		val, err := strconv.Atoi(raw)
+		if err != nil || val < 0 || val > MaxPageOffset {
+			fieldErrs = append(fieldErrs, sending.FieldError{
+				Location: "query",
+				Param:    "offset",
+				Value:    raw,
+				Msg:      fmt.Sprintf("must be an integer from 0 to %d", MaxPageOffset),
+			})
+		}
+		offset = val
+	}
+	if raw := query.Get("limit"); raw != "" {
+		val, err := strconv.Atoi(raw)
+		if err != nil || val < 1 || val > MaxPageLimit {
+			fieldErrs = append(fieldErrs, sending.FieldError{
+				Location: "query",
+				Param:    "limit",
+				Value:    raw,
+				Msg:      fmt.Sprintf("must be an integer from 1 to %d", MaxPageLimit),
+			})
+		}
+		limit = val
+	}
+	return offset, limit, fieldErrs
+}
+
+// checkBlocked hides users blocked by the viewer as if they did not exist.
+func (h *ProfileHandler) checkBlocked(r *http.Request, userID string) error {
+	viewer := viewerID(r)
+	if viewer == "" || h.Controls == nil {
+		return nil
+	}
+	f, err := h.Controls.Filter(viewer)
+	if err != nil {
+		return err
+	}
+	if f.Blocks(userID) {
+		return user.ErrNoUser
+	}
+	return nil
+}
+
+func (h *ProfileHandler) Get(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["USER_LOGIN"]
+	offset, limit, fieldErrs := pageFromQuery(r)
+	if len(fieldErrs) != 0 {
+		sending.SendFieldErrors(w, fieldErrs)
+		return
+	}
+
+	profile, err := h.UserRepo.GetProfile(username)
+	if err == nil {
+		err = h.checkBlocked(r, profile.User.ID)
+	}
+	switch {
+	case errors.Is(err, user.ErrNoUser):
+		sending.SendJSONMessage(w, "user not found", http.StatusNotFound)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	karma, err := h.PostRepo.GetUserKarma(username)
+	if err != nil {
+		h.Logger.Errorf("fail to get karma of %v: %v", username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// one extra item tells whether there is a next page
+	items, err := h.PostRepo.GetUserActivity(username, offset, limit+1)
+	if err != nil {
+		h.Logger.Errorf("fail to get activity of %v: %v", username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	page := ActivityPage{
+		Items:  items,
+		Offset: offset,
+		Limit:  limit,
+	}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.HasMore = true
+	}
+
+	h.Logger.Infof("get profile of %v", username)
+	JSONMarshalAndSend(w, ProfileAnswer{
+		Profile:  profile,
+		Karma:    KarmaAnswer{Karma: karma, Total: karma.Total()},
+		Activity: page,
+	})
+}
+
+func (h *ProfileHandler) Update(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	form := user.ProfileForm{}
+	err = json.Unmarshal(body, &form)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	form.Bio = strings.TrimSpace(form.Bio)
+	form.AvatarURL = strings.TrimSpace(form.AvatarURL)
+
+	fieldErrs := validateStruct(form)
+	if form.AvatarURL != "" {
+		if msg := validateLinkURL(form.AvatarURL); msg != "" {
+			fieldErrs = append(fieldErrs, sending.FieldError{
+				Location: "body",
+				Param:    "avatar_url",
+				Value:    form.AvatarURL,
+				Msg:      msg,
+			})
+		}
+	}
+	if len(fieldErrs) != 0 {
+		sending.SendFieldErrors(w, fieldErrs)
+		return
+	}
+
+	profile, err := h.UserRepo.UpdateProfile(sess.User.ID, form)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("update profile of %v", sess.User.ID)
+	JSONMarshalAndSend(w, profile)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/controls"
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/sending"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestProfileGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	posts := post.NewMockPostRepo(ctrl)
+	service := ProfileHandler{
+		Logger:   zap.NewNop().Sugar(),
+		UserRepo: users,
+		PostRepo: posts,
+	}
+	profile := user.Profile{
+		User:      user.User{ID: "1", Username: "u"},
+		CreatedAt: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		Bio:       "hello",
+	}
+	items := []post.Activity{
+		{Kind: post.ActivityComment, PostID: "p1", CommentID: "c1"},
+		{Kind: post.ActivityPost, PostID: "p1"},
+		{Kind: post.ActivityPost, PostID: "p0"},
+	}
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/user/u/profile"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"USER_LOGIN": "u"})
+		w := httptest.NewRecorder()
+		service.Get(w, req)
+		return w
+	}
+
+	users.EXPECT().GetProfile("u").Return(profile, nil)
+	posts.EXPECT().GetUserKarma("u").Return(post.Karma{Post: 5, PostCount: 2, CommentCount: 2}, nil)
+	posts.EXPECT().GetUserActivity("u", 0, 3).Return(items, nil)
+	w := get("?limit=2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	resp := ProfileAnswer{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("cant unmarshall %v", w.Body.String())
+	}
+	assert.Equal(t, profile, resp.Profile)
+	assert.Equal(t, 5, resp.Karma.Total)
+	assert.Equal(t, items[:2], resp.Activity.Items)
+	assert.True(t, resp.Activity.HasMore)
+	assert.Equal(t, 2, resp.Activity.Limit)
+
+	users.EXPECT().GetProfile("u").Return(user.Profile{}, user.ErrNoUser)
+	assert.Equal(t, http.StatusNotFound, get("").Code)
+
+	// users blocked by the viewer are not found
+	controlsRepo := controls.NewMockControlsRepo(ctrl)
+	service.Controls = controlsRepo
+	users.EXPECT().GetProfile("u").Return(profile, nil)
+	controlsRepo.EXPECT().Filter("u1").Return(post.Filter{BlockedUsers: []string{"1"}}, nil)
+	w = httptest.NewRecorder()
+	service.Get(w, authRequest("GET", "/api/user/u/profile", map[string]string{"USER_LOGIN": "u"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	service.Controls = nil
+
+	users.EXPECT().GetProfile("u").Return(profile, nil)
+	posts.EXPECT().GetUserKarma("u").Return(post.Karma{}, fmt.Errorf("some error"))
+	assert.Equal(t, http.StatusInternalServerError, get("").Code)
+
+	w = get("?offset=-1&limit=1000")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	fieldErrs := sending.FieldErrors{}
+	_ = json.Unmarshal(w.Body.Bytes(), &fieldErrs)
+	assert.Len(t, fieldErrs.Errors, 2)
+
+	w = get("?offset=1001")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestProfileUpdate(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   string
+		form   *user.ProfileForm
+		code   int
+		params []string
+	}{
+		{
+			name: "normal",
+			body: `{"bio":"  hi  ","avatar_url":"https://example.com/a.png"}`,
+			form: &user.ProfileForm{Bio: "hi", AvatarURL: "https://example.com/a.png"},
+			code: http.StatusOK,
+		},
+		{
+			name: "clear avatar",
+			body: `{"bio":"","avatar_url":""}`,
+			form: &user.ProfileForm{},
+			code: http.StatusOK,
+		},
+		{
+			name:   "bad avatar and long bio",
+			body:   `{"bio":"` + strings.Repeat("a", user.MaxBioLength+1) + `","avatar_url":"javascript:alert(1)"}`,
+			code:   http.StatusUnprocessableEntity,
+			params: []string{"bio", "avatar_url"},
+		},
+		{
+			name: "broken json",
+			body: `{"bio":`,
+			code: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			users := user.NewMockUserRepo(ctrl)
+			if tc.form != nil {
+				users.EXPECT().UpdateProfile("1", *tc.form).Return(user.Profile{Bio: tc.form.Bio}, nil)
+			}
+			service := ProfileHandler{
+				Logger:   zap.NewNop().Sugar(),
+				UserRepo: users,
+			}
+			req := httptest.NewRequest("PUT", "/api/me/profile", strings.NewReader(tc.body))
+			sess := session.Session{User: user.User{ID: "1", Username: "u"}}
+			req = req.WithContext(session.ContextWithSession(req.Context(), sess))
+			w := httptest.NewRecorder()
+			service.Update(w, req)
+
+			assert.Equal(t, tc.code, w.Code)
+			if tc.params == nil {
+				return
+			}
+			resp := sending.FieldErrors{}
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			params := make([]string, 0, len(resp.Errors))
+			for _, e := range resp.Errors {
+				params = append(params, e.Param)
+			}
+			assert.ElementsMatch(t, tc.params, params)
+		})
+	}
+}
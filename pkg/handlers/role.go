@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/policy"
+	"github.com/greatjudge/redditclone/pkg/sending"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+)
+
+type RoleForm struct {
+	Role string `json:"role" valid:"required"`
+}
+
+type RoleAnswer struct {
+	Role        policy.Role         `json:"role"`
+	Permissions []policy.Permission `json:"permissions"`
+}
+
+type RoleHandler struct {
+	Logger   *zap.SugaredLogger
+	UserRepo user.UserRepo
+	Roles    policy.RoleRepo
+	Bans     policy.BanRepo
+	Policy   Authorizer
+}
+
+// Me answers with the role of the logged in user and what it permits.
+func (h *RoleHandler) Me(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	role, err := h.Roles.Role(sess.User.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	JSONMarshalAndSend(w, RoleAnswer{Role: role, Permissions: policy.Permissions(role)})
+}
+
+// Set gives a user a role, it takes the role.assign permission.
+func (h *RoleHandler) Set(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = h.Policy.Authorize(sess.User, policy.AssignRole, policy.Resource{})
+	switch {
+	case errors.Is(err, policy.ErrForbidden):
+		sending.SendJSONMessage(w, "no access", http.StatusForbidden)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	form := RoleForm{}
+	if !formFromBody(w, r, &form) {
+		return
+	}
+	role, err := policy.ParseRole(form.Role)
+	if err != nil {
+		sending.SendFieldErrors(w, []sending.FieldError{{
+			Location: "body",
+			Param:    "role",
+			Value:    form.Role,
+			Msg:      fmt.Sprintf("must be one of %v", policy.Roles),
+		}})
+		return
+	}
+	u, err := h.UserRepo.GetByUsername(mux.Vars(r)["USER_LOGIN"])
+	if err != nil {
+		handleUserErrors(err, w)
+		return
+	}
+	err = h.Roles.SetRole(u.ID, role)
+	switch {
+	case errors.Is(err, policy.ErrLastAdmin):
+		sending.SendJSONMessage(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("set role %v of %v by %v", role, u.ID, sess.User.ID)
+	JSONMarshalAndSend(w, RoleAnswer{Role: role, Permissions: policy.Permissions(role)})
+}
+
+// Ban stops a user from using their sessions and API tokens, it takes the
+// user.ban permission. Only users of a lower role can be banned.
+func (h *RoleHandler) Ban(w http.ResponseWriter, r *http.Request) {
+	sess, u, ok := h.banTarget(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Bans.Ban(u.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("ban %v by %v", u.ID, sess.User.ID)
+	sending.SendJSONMessage(w, "banned", http.StatusOK)
+}
+
+// Unban lifts the ban of a user, it takes the user.ban permission.
+func (h *RoleHandler) Unban(w http.ResponseWriter, r *http.Request) {
+	sess, u, ok := h.banTarget(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Bans.Unban(u.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("unban %v by %v", u.ID, sess.User.ID)
+	sending.SendJSONMessage(w, "unbanned", http.StatusOK)
+}
+
+// banTarget authorizes the ban and finds the user of the route, who must
+// have a lower role than the caller. It answers the request itself when
+// not ok.
+func (h *RoleHandler) banTarget(w http.ResponseWriter, r *http.Request) (session.Session, user.User, bool) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return session.Session{}, user.User{}, false
+	}
+	err = h.Policy.Authorize(sess.User, policy.BanUser, policy.Resource{})
+	switch {
+	case errors.Is(err, policy.ErrForbidden):
+		sending.SendJSONMessage(w, "no access", http.StatusForbidden)
+		return session.Session{}, user.User{}, false
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return session.Session{}, user.User{}, false
+	}
+	u, err := h.UserRepo.GetByUsername(mux.Vars(r)["USER_LOGIN"])
+	if err != nil {
+		handleUserErrors(err, w)
+		return session.Session{}, user.User{}, false
+	}
+	if u.ID == sess.User.ID {
+		sending.SendJSONMessage(w, "can not ban yourself", http.StatusBadRequest)
+		return session.Session{}, user.User{}, false
+	}
+	roles := make([]policy.Role, 2)
+	for i, userID := range []string{sess.User.ID, u.ID} {
+		roles[i], err = h.Roles.Role(userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return session.Session{}, user.User{}, false
+		}
+	}
+	if !policy.Outranks(roles[0], roles[1]) {
+		sending.SendJSONMessage(w, "can only ban users of a lower role", http.StatusForbidden)
+		return session.Session{}, user.User{}, false
+	}
+	return sess, u, true
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/policy"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRoles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	roles := policy.NewMockRoleRepo(ctrl)
+	service := RoleHandler{
+		Logger:   zap.NewNop().Sugar(),
+		UserRepo: users,
+		Roles:    roles,
+		Policy:   policy.New(roles),
+	}
+	request := func(body string) *http.Request {
+		req := accountRequestWithBody("PUT", "/api/user/rick/role", body)
+		return mux.SetURLVars(req, map[string]string{"USER_LOGIN": "rick"})
+	}
+
+	roles.EXPECT().Role("1").Return(policy.RoleModerator, nil)
+	w := httptest.NewRecorder()
+	service.Me(w, accountRequest("GET", "/api/me/role"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"role":"moderator","permissions":["post.delete.any","post.restore.any","comment.remove","comment.restore.any","user.ban"]}`, w.Body.String())
+
+	// only admins assign roles
+	roles.EXPECT().Role("1").Return(policy.RoleModerator, nil)
+	w = httptest.NewRecorder()
+	service.Set(w, request(`{"role":"admin"}`))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	roles.EXPECT().Role("1").Return(policy.RoleAdmin, nil).Times(5)
+	users.EXPECT().GetByUsername("rick").Return(user.User{ID: "2", Username: "rick"}, nil).Times(2)
+	roles.EXPECT().SetRole("2", policy.RoleModerator).Return(nil)
+	w = httptest.NewRecorder()
+	service.Set(w, request(`{"role":"moderator"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	roles.EXPECT().SetRole("2", policy.RoleUser).Return(policy.ErrLastAdmin)
+	w = httptest.NewRecorder()
+	service.Set(w, request(`{"role":"user"}`))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	service.Set(w, request(`{"role":"root"}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = httptest.NewRecorder()
+	service.Set(w, request(`{}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	users.EXPECT().GetByUsername("rick").Return(user.User{}, user.ErrNoUser)
+	w = httptest.NewRecorder()
+	service.Set(w, request(`{"role":"user"}`))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestBan(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	roles := policy.NewMockRoleRepo(ctrl)
+	bans := policy.NewMockBanRepo(ctrl)
+	service := RoleHandler{
+		Logger:   zap.NewNop().Sugar(),
+		UserRepo: users,
+		Roles:    roles,
+		Bans:     bans,
+		Policy:   policy.New(roles),
+	}
+	request := func(login string) *http.Request {
+		req := accountRequest("POST", "/api/user/"+login+"/ban")
+		return mux.SetURLVars(req, map[string]string{"USER_LOGIN": login})
+	}
+	rick := user.User{ID: "2", Username: "rick"}
+
+	roles.EXPECT().Role("1").Return(policy.RoleUser, nil)
+	w := httptest.NewRecorder()
+	service.Ban(w, request("rick"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	roles.EXPECT().Role("1").Return(policy.RoleModerator, nil).AnyTimes()
+	users.EXPECT().GetByUsername("rick").Return(rick, nil).AnyTimes()
+	roles.EXPECT().Role("2").Return(policy.RoleUser, nil)
+	bans.EXPECT().Ban("2").Return(nil)
+	w = httptest.NewRecorder()
+	service.Ban(w, request("rick"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	roles.EXPECT().Role("2").Return(policy.RoleUser, nil)
+	bans.EXPECT().Unban("2").Return(nil)
+	w = httptest.NewRecorder()
+	service.Unban(w, request("rick"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// moderators can not ban each other, nor admins
+	roles.EXPECT().Role("2").Return(policy.RoleModerator, nil)
+	w = httptest.NewRecorder()
+	service.Ban(w, request("rick"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	roles.EXPECT().Role("2").Return(policy.RoleAdmin, nil)
+	w = httptest.NewRecorder()
+	service.Ban(w, request("rick"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	users.EXPECT().GetByUsername("u").Return(user.User{ID: "1", Username: "u"}, nil)
+	w = httptest.NewRecorder()
+	service.Ban(w, request("u"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	users.EXPECT().GetByUsername("nobody").Return(user.User{}, user.ErrNoUser)
+	w = httptest.NewRecorder()
+	service.Ban(w, request("nobody"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/sending"
+	"github.com/greatjudge/redditclone/pkg/session"
+)
+
+type SavedItemAnswer struct {
+	Kind    string           `json:"kind"`
+	SavedAt time.Time        `json:"saved_at"`
+	Post    post.Post        `json:"post"`
+	Comment *comment.Comment `json:"comment,omitempty"`
+}
+
+type SavedPage struct {
+	Items   []SavedItemAnswer `json:"items"`
+	Offset  int               `json:"offset"`
+	Limit   int               `json:"limit"`
+	HasMore bool              `json:"has_more"`
+}
+
+func (h *PostHandler) Save(w http.ResponseWriter, r *http.Request) {
+	h.setSaved(w, r, true)
+}
+
+func (h *PostHandler) Unsave(w http.ResponseWriter, r *http.Request) {
+	h.setSaved(w, r, false)
+}
+
+// setSaved handles both posts and comments, COMMENT_ID is empty for posts.
+func (h *PostHandler) setSaved(w http.ResponseWriter, r *http.Request, save bool) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if h.Saved == nil {
+		sending.SendJSONMessage(w, "saving is disabled", http.StatusNotImplemented)
+		return
+	}
+	vars := mux.Vars(r)
+	postID, commentID := vars["POST_ID"], vars["COMMENT_ID"]
+
+	if !save {
+		err = h.Saved.Unsave(sess.User.ID, postID, commentID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		h.Logger.Infof("unsave post %v comment %v by %v", postID, commentID, sess.User.ID)
+		sending.SendJSONMessage(w, "unsaved", http.StatusOK)
+		return
+	}
+
+	if commentID != "" {
+		_, err = h.PostRepo.GetComment(postID, commentID)
+	} else {
+		_, err = h.PostRepo.GetByID(postID)
+	}
+	if err != nil {
+		handlePostRepoErrors(w, err)
+		return
+	}
+	err = h.Saved.Save(sess.User.ID, postID, commentID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("save post %v comment %v by %v", postID, commentID, sess.User.ID)
+	sending.SendJSONMessage(w, "saved", http.StatusOK)
+}
+
+func (h *PostHandler) ListSaved(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if h.Saved == nil {
+		sending.SendJSONMessage(w, "saving is disabled", http.StatusNotImplemented)
+		return
+	}
+	offset, limit, fieldErrs := pageFromQuery(r)
+	if len(fieldErrs) != 0 {
+		sending.SendFieldErrors(w, fieldErrs)
+		return
+	}
+
+	// one extra item tells whether there is a next page
+	items, err := h.Saved.List(sess.User.ID, offset, limit+1)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	page := SavedPage{
+		Items:  make([]SavedItemAnswer, 0, len(items)),
+		Offset: offset,
+		Limit:  limit,
+	}
+	if len(items) > limit {
+		items = items[:limit]
+		page.HasMore = true
+	}
+
+	ids := make([]string, 0, len(items))
+	commentIDs := make([]string, 0)
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if !seen[item.PostID] {
+			seen[item.PostID] = true
+			ids = append(ids, item.PostID)
+		}
+		if item.CommentID != "" {
+			commentIDs = append(commentIDs, item.CommentID)
+		}
+	}
+	f, err := h.viewerFilter(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	posts, err := h.PostRepo.GetByIDs(ids)
+	if err != nil {
+		h.Logger.Errorf("fail to get saved posts: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	byID := make(map[string]post.Post, len(posts))
+	for _, p := range h.forViewer(r, f, posts) {
+		if !f.Blocks(p.Author.ID) {
+			byID[p.ID] = p
+		}
+	}
+	comments := make(map[string]comment.Comment, len(commentIDs))
+	if len(commentIDs) != 0 {
+		found, err := h.PostRepo.GetCommentsByIDs(commentIDs)
+		if err != nil {
+			h.Logger.Errorf("fail to get saved comments: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for _, comm := range found {
+			if !f.Blocks(comm.Author.ID) {
+				comm.Saved = true
+				comments[comm.ID] = comm
+			}
+		}
+	}
+
+	// items of deleted posts and comments, and of blocked users, are skipped
+	for _, item := range items {
+		p, ok := byID[item.PostID]
+		if !ok {
+			continue
+		}
+		answer := SavedItemAnswer{
+			Kind:    post.ActivityPost,
+			SavedAt: item.SavedAt,
+			Post:    p,
+		}
+		if item.CommentID != "" {
+			comm, ok := comments[item.CommentID]
+			if !ok || comm.PostID != item.PostID {
+				continue
+			}
+			answer.Kind = post.ActivityComment
+			answer.Comment = &comm
+		}
+		page.Items = append(page.Items, answer)
+	}
+	h.Logger.Infof("list saved of %v", sess.User.ID)
+	JSONMarshalAndSend(w, page)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/saved"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/greatjudge/redditclone/pkg/vote"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func authRequest(method, target string, vars map[string]string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req = mux.SetURLVars(req, vars)
+	sess := session.Session{User: user.User{ID: "u1", Username: "u"}}
+	return req.WithContext(session.ContextWithSession(req.Context(), sess))
+}
+
+func TestSave(t *testing.T) {
+	cases := []struct {
+		name      string
+		commentID string
+		lookupErr error
+		saveErr   error
+		code      int
+	}{
+		{name: "post", code: http.StatusOK},
+		{name: "comment", commentID: "c1", code: http.StatusOK},
+		{name: "no post", lookupErr: post.ErrNoPost, code: http.StatusNotFound},
+		{name: "no comment", commentID: "c2", lookupErr: comment.ErrNoComment, code: http.StatusNotFound},
+		{name: "db error", saveErr: fmt.Errorf("db"), code: http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			posts := post.NewMockPostRepo(ctrl)
+			savedRepo := saved.NewMockSavedRepo(ctrl)
+			if tc.commentID != "" {
+				posts.EXPECT().GetComment("p1", tc.commentID).Return(comment.Comment{ID: tc.commentID}, tc.lookupErr)
+			} else {
+				posts.EXPECT().GetByID("p1").Return(post.Post{ID: "p1"}, tc.lookupErr)
+			}
+			if tc.lookupErr == nil {
+				savedRepo.EXPECT().Save("u1", "p1", tc.commentID).Return(tc.saveErr)
+			}
+			service := PostHandler{
+				Logger:   zap.NewNop().Sugar(),
+				PostRepo: posts,
+				Saved:    savedRepo,
+			}
+			w := httptest.NewRecorder()
+			service.Save(w, authRequest("POST", "/", map[string]string{"POST_ID": "p1", "COMMENT_ID": tc.commentID}))
+			assert.Equal(t, tc.code, w.Code)
+		})
+	}
+}
+
+func TestUnsave(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	savedRepo := saved.NewMockSavedRepo(ctrl)
+	// no lookup, so items of deleted posts can be removed too
+	savedRepo.EXPECT().Unsave("u1", "gone", "").Return(nil)
+	service := PostHandler{
+		Logger: zap.NewNop().Sugar(),
+		Saved:  savedRepo,
+	}
+	w := httptest.NewRecorder()
+	service.Unsave(w, authRequest("POST", "/", map[string]string{"POST_ID": "gone"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestListSaved(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	posts := post.NewMockPostRepo(ctrl)
+	savedRepo := saved.NewMockSavedRepo(ctrl)
+	service := PostHandler{
+		Logger:   zap.NewNop().Sugar(),
+		PostRepo: posts,
+		Saved:    savedRepo,
+	}
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	p1 := post.Post{ID: "p1"}
+	items := []saved.Item{
+		{PostID: "p1", CommentID: "c1", SavedAt: now},
+		{PostID: "gone", SavedAt: now},
+		{PostID: "p1", SavedAt: now},
+		{PostID: "p1", CommentID: "deleted", SavedAt: now},
+		{PostID: "next", SavedAt: now},
+	}
+	savedRepo.EXPECT().List("u1", 0, 5).Return(items, nil)
+	posts.EXPECT().GetByIDs([]string{"p1", "gone"}).Return([]post.Post{p1}, nil)
+	posts.EXPECT().GetVotes("u1", []string{"p1"}).Return([]vote.Vote{}, nil)
+	posts.EXPECT().GetCommentsByIDs([]string{"c1", "deleted"}).
+		Return([]comment.Comment{{ID: "c1", PostID: "p1"}}, nil)
+	savedRepo.EXPECT().SavedIn("u1", []string{"p1"}).Return(saved.Set{
+		{PostID: "p1"}:                  true,
+		{PostID: "p1", CommentID: "c1"}: true,
+	}, nil)
+
+	w := httptest.NewRecorder()
+	service.ListSaved(w, authRequest("GET", "/api/saved?limit=4", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	page := SavedPage{}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("cant unmarshall %v", w.Body.String())
+	}
+	assert.True(t, page.HasMore)
+	if assert.Len(t, page.Items, 2) {
+		assert.Equal(t, post.ActivityComment, page.Items[0].Kind)
+		assert.Equal(t, "c1", page.Items[0].Comment.ID)
+		assert.True(t, page.Items[0].Comment.Saved)
+		assert.Equal(t, post.ActivityPost, page.Items[1].Kind)
+		assert.True(t, page.Items[1].Post.Saved)
+	}
+}
+
+func TestListingsMarkSaved(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	posts := post.NewMockPostRepo(ctrl)
+	savedRepo := saved.NewMockSavedRepo(ctrl)
+	service := PostHandler{
+		Logger:   zap.NewNop().Sugar(),
+		PostRepo: posts,
+		Saved:    savedRepo,
+	}
+	posts.EXPECT().GetAll(post.Filter{}).DoAndReturn(func(post.Filter) ([]post.Post, error) {
+		return []post.Post{{ID: "p1"}, {ID: "p2"}}, nil
+	}).Times(3)
+	savedRepo.EXPECT().SavedIn("u1", []string{"p1", "p2"}).Return(saved.Set{{PostID: "p2"}: true}, nil)
+	posts.EXPECT().GetVotes("u1", []string{"p1", "p2"}).
+		Return([]vote.Vote{{PostID: "p1", UserID: "u1", Value: -1}}, nil)
+
+	w := httptest.NewRecorder()
+	service.List(w, authRequest("GET", "/", nil))
+	got := []post.Post{}
+	_ = json.Unmarshal(w.Body.Bytes(), &got)
+	assert.False(t, got[0].Saved)
+	assert.True(t, got[1].Saved)
+	// only the vote of the viewer is sent
+	assert.Equal(t, []vote.Vote{{UserID: "u1", Value: -1}}, got[0].Votes)
+	assert.Equal(t, []vote.Vote{}, got[1].Votes)
+
+	// anonymous viewers never hit the saved or the votes storage
+	w = httptest.NewRecorder()
+	service.List(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"votes":[]`)
+
+	// failing lookups only drop the flags
+	savedRepo.EXPECT().SavedIn("u1", gomock.Any()).Return(nil, fmt.Errorf("db"))
+	posts.EXPECT().GetVotes("u1", gomock.Any()).Return(nil, fmt.Errorf("db"))
+	w = httptest.NewRecorder()
+	service.List(w, authRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
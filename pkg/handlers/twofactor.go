@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/greatjudge/redditclone/pkg/sending"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/twofactor"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+)
+
+type TwoFactorHandler struct {
+	Logger    *zap.SugaredLogger
+	UserRepo  user.UserRepo
+	Sessions  session.SessionsManager
+	TwoFactor twofactor.Repo
+}
+
+type CodeForm struct {
+	Code string `json:"code" valid:"required"`
+}
+
+type DisableTwoFactorForm struct {
+	Password string `json:"password" valid:"required"`
+	Code     string `json:"code" valid:"required"`
+}
+
+type TwoFactorLoginForm struct {
+	LoginToken string `json:"login_token" valid:"required"`
+	Code       string `json:"code" valid:"required"`
+}
+
+type RecoveryCodesAnswer struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func handleTwoFactorErrors(err error, w http.ResponseWriter) {
+	switch {
+	case errors.Is(err, twofactor.ErrNotEnrolled):
+		sending.SendJSONMessage(w, "two-factor authentication is not enabled", http.StatusBadRequest)
+	case errors.Is(err, twofactor.ErrAlreadyEnabled):
+		sending.SendJSONMessage(w, "two-factor authentication is already enabled", http.StatusBadRequest)
+	case errors.Is(err, twofactor.ErrBadCode):
+		sending.SendJSONMessage(w, "invalid code", http.StatusBadRequest)
+	case errors.Is(err, twofactor.ErrBadChallenge):
+		sending.SendJSONMessage(w, "invalid or expired login token", http.StatusUnauthorized)
+	case errors.Is(err, twofactor.ErrLocked):
+		sending.SendJSONMessage(w, "too many invalid codes, try again later", http.StatusTooManyRequests)
+	default:
+		handleUserErrors(err, w)
+	}
+}
+
+// Enroll starts two-factor enrollment of the logged in user, it is enabled
+// once Confirm gets a code from the authenticator app.
+func (h *TwoFactorHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	enrollment, err := h.TwoFactor.Enroll(sess.User)
+	if err != nil {
+		handleTwoFactorErrors(err, w)
+		return
+	}
+	sending.JSONMarshalAndSend(w, enrollment)
+}
+
+// Confirm enables two-factor authentication and answers with recovery
+// codes, they are shown only this once.
+func (h *TwoFactorHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	form := CodeForm{}
+	if !formFromBody(w, r, &form) {
+		return
+	}
+	codes, err := h.TwoFactor.Confirm(sess.User.ID, form.Code)
+	if err != nil {
+		handleTwoFactorErrors(err, w)
+		return
+	}
+	h.Logger.Infof("enable two-factor authentication of %v", sess.User.ID)
+	sending.JSONMarshalAndSend(w, RecoveryCodesAnswer{RecoveryCodes: codes})
+}
+
+// Disable turns two-factor authentication off, it takes the password
+// along with a code or a recovery code.
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessionFromContext(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	form := DisableTwoFactorForm{}
+	if !formFromBody(w, r, &form) {
+		return
+	}
+	_, err = h.UserRepo.Authorize(sess.User.Username, form.Password)
+	if errors.Is(err, user.ErrBadUserPass) {
+		err = user.ErrBadPass
+	}
+	if err != nil {
+		handleUserErrors(err, w)
+		return
+	}
+	err = h.TwoFactor.Disable(sess.User.ID, form.Code)
+	if err != nil {
+		handleTwoFactorErrors(err, w)
+		return
+	}
+	h.Logger.Infof("disable two-factor authentication of %v", sess.User.ID)
+	sending.SendJSONMessage(w, "success", http.StatusOK)
+}
+
+// Login is the second login step, it trades the login token from
+// UserHandler.Login and a code for a session.
+func (h *TwoFactorHandler) Login(w http.ResponseWriter, r *http.Request) {
+	form := TwoFactorLoginForm{}
+	if !formFromBody(w, r, &form) {
+		return
+	}
+	userID, err := h.TwoFactor.CompleteChallenge(form.LoginToken, form.Code)
+	if err != nil {
+		handleTwoFactorErrors(err, w)
+		return
+	}
+	u, err := h.UserRepo.GetByID(userID)
+	if err != nil {
+		handleUserErrors(err, w)
+		return
+	}
+	token, err := h.Sessions.Create(u)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.Logger.Infof("created session for %v", u.ID)
+	sending.JSONMarshalAndSend(w, LoginAnswer{Token: token})
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/twofactor"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestLoginAsksForSecondFactor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	sessions := session.NewMockSessionsManager(ctrl)
+	twoFactor := twofactor.NewMockRepo(ctrl)
+	service := &UserHandler{
+		Logger:    zap.NewNop().Sugar(),
+		UserRepo:  users,
+		Sessions:  sessions,
+		TwoFactor: twoFactor,
+	}
+	body := `{"username": "u", "password": "password"}`
+	u := user.User{ID: "1", Username: "u"}
+
+	// no session until the second step
+	users.EXPECT().Authorize("u", "password").Return(u, nil)
+	twoFactor.EXPECT().Enabled("1").Return(true, nil)
+	twoFactor.EXPECT().CreateChallenge("1").Return("login-token", nil)
+	w := httptest.NewRecorder()
+	service.Login(w, httptest.NewRequest("POST", "/api/login", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	answer := TwoFactorAnswer{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &answer))
+	assert.Equal(t, TwoFactorAnswer{TwoFactorRequired: true, LoginToken: "login-token"}, answer)
+
+	users.EXPECT().Authorize("u", "password").Return(u, nil)
+	twoFactor.EXPECT().Enabled("1").Return(false, fmt.Errorf("db error"))
+	w = httptest.NewRecorder()
+	service.Login(w, httptest.NewRequest("POST", "/api/login", strings.NewReader(body)))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	sessions := session.NewMockSessionsManager(ctrl)
+	twoFactor := twofactor.NewMockRepo(ctrl)
+	service := &TwoFactorHandler{
+		Logger:    zap.NewNop().Sugar(),
+		UserRepo:  users,
+		Sessions:  sessions,
+		TwoFactor: twoFactor,
+	}
+	request := func(body string) *http.Request {
+		return httptest.NewRequest("POST", "/api/login/2fa", strings.NewReader(body))
+	}
+	body := `{"login_token": "login-token", "code": "123456"}`
+	u := user.User{ID: "1", Username: "u"}
+
+	twoFactor.EXPECT().CompleteChallenge("login-token", "123456").Return("1", nil)
+	users.EXPECT().GetByID("1").Return(u, nil)
+	sessions.EXPECT().Create(u).Return("session-token", nil)
+	w := httptest.NewRecorder()
+	service.Login(w, request(body))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "session-token")
+
+	twoFactor.EXPECT().CompleteChallenge("login-token", "123456").Return("", twofactor.ErrBadCode)
+	w = httptest.NewRecorder()
+	service.Login(w, request(body))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	twoFactor.EXPECT().CompleteChallenge("login-token", "123456").Return("", twofactor.ErrBadChallenge)
+	w = httptest.NewRecorder()
+	service.Login(w, request(body))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	twoFactor.EXPECT().CompleteChallenge("login-token", "123456").Return("", twofactor.ErrLocked)
+	w = httptest.NewRecorder()
+	service.Login(w, request(body))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	w = httptest.NewRecorder()
+	service.Login(w, request(`{"login_token": "login-token"}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	twoFactor := twofactor.NewMockRepo(ctrl)
+	service := &TwoFactorHandler{
+		Logger:    zap.NewNop().Sugar(),
+		TwoFactor: twoFactor,
+	}
+	u := user.User{ID: "1", Username: "u"}
+
+	enrollment := twofactor.Enrollment{Secret: "SECRET", URI: "otpauth://totp/redditclone:u?secret=SECRET"}
+	twoFactor.EXPECT().Enroll(u).Return(enrollment, nil)
+	w := httptest.NewRecorder()
+	service.Enroll(w, accountRequest("POST", "/api/me/2fa"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	got := twofactor.Enrollment{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, enrollment, got)
+
+	twoFactor.EXPECT().Enroll(u).Return(twofactor.Enrollment{}, twofactor.ErrAlreadyEnabled)
+	w = httptest.NewRecorder()
+	service.Enroll(w, accountRequest("POST", "/api/me/2fa"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	codes := []string{"abcde-12345", "fghij-67890"}
+	twoFactor.EXPECT().Confirm("1", "123456").Return(codes, nil)
+	w = httptest.NewRecorder()
+	service.Confirm(w, accountRequestWithBody("POST", "/api/me/2fa/confirm", `{"code": "123456"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	answer := RecoveryCodesAnswer{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &answer))
+	assert.Equal(t, codes, answer.RecoveryCodes)
+
+	twoFactor.EXPECT().Confirm("1", "654321").Return(nil, twofactor.ErrBadCode)
+	w = httptest.NewRecorder()
+	service.Confirm(w, accountRequestWithBody("POST", "/api/me/2fa/confirm", `{"code": "654321"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	service.Enroll(w, httptest.NewRequest("POST", "/api/me/2fa", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestTwoFactorDisable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := user.NewMockUserRepo(ctrl)
+	twoFactor := twofactor.NewMockRepo(ctrl)
+	service := &TwoFactorHandler{
+		Logger:    zap.NewNop().Sugar(),
+		UserRepo:  users,
+		TwoFactor: twoFactor,
+	}
+	body := `{"password": "password", "code": "123456"}`
+	u := user.User{ID: "1", Username: "u"}
+
+	users.EXPECT().Authorize("u", "password").Return(u, nil)
+	twoFactor.EXPECT().Disable("1", "123456").Return(nil)
+	w := httptest.NewRecorder()
+	service.Disable(w, accountRequestWithBody("DELETE", "/api/me/2fa", body))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the password is checked before the code
+	users.EXPECT().Authorize("u", "password").Return(user.User{}, user.ErrBadUserPass)
+	w = httptest.NewRecorder()
+	service.Disable(w, accountRequestWithBody("DELETE", "/api/me/2fa", body))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid password")
+
+	users.EXPECT().Authorize("u", "password").Return(u, nil)
+	twoFactor.EXPECT().Disable("1", "123456").Return(twofactor.ErrNotEnrolled)
+	w = httptest.NewRecorder()
+	service.Disable(w, accountRequestWithBody("DELETE", "/api/me/2fa", body))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	service.Disable(w, accountRequestWithBody("DELETE", "/api/me/2fa", `{"password": "password"}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
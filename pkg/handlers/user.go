@@ -8,8 +8,10 @@ import (
 	"net/http"
 
 	"github.com/asaskevich/govalidator"
+	"github.com/greatjudge/redditclone/pkg/mail"
 	"github.com/greatjudge/redditclone/pkg/sending"
 	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/twofactor"
 	"github.com/greatjudge/redditclone/pkg/user"
 
 	"go.uber.org/zap"
@@ -21,20 +23,31 @@ var (
 )
 
 type UserHandler struct {
-	Logger   *zap.SugaredLogger
-	UserRepo user.UserRepo
-	Sessions session.SessionsManager
+	Logger    *zap.SugaredLogger
+	UserRepo  user.UserRepo
+	Sessions  session.SessionsManager
+	Mailer    mail.Mailer
+	TwoFactor twofactor.Repo
 }
 
 type LoginForm struct {
 	Username string `json:"username" valid:"required,matches(^[a-zA-Z0-9_]+$)"`
 	Password string `json:"password" valid:"required,length(8|255)"`
+	// Email is optional and only read on registration.
+	Email string `json:"email,omitempty" valid:"email,length(0|255)"`
 }
 
 type LoginAnswer struct {
 	Token string `json:"token"`
 }
 
+// TwoFactorAnswer asks for the second login step, the login token goes
+// with the code to /api/login/2fa.
+type TwoFactorAnswer struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	LoginToken        string `json:"login_token"`
+}
+
 func Validate(lf *LoginForm) []string {
 	_, err := govalidator.ValidateStruct(lf)
 	valErrs := make([]string, 0)
@@ -71,6 +84,16 @@ func handleUserErrors(err error, w http.ResponseWriter) {
 		sending.SendJSONMessage(w, "invalid password", http.StatusBadRequest)
 	case errors.Is(err, user.ErrAlreadyExists):
 		sending.SendJSONMessage(w, "user already exists", http.StatusBadRequest)
+	case errors.Is(err, user.ErrBadResetToken):
+		sending.SendJSONMessage(w, "invalid or expired reset token", http.StatusBadRequest)
+	case errors.Is(err, user.ErrEmailTaken):
+		sending.SendJSONMessage(w, "email already taken", http.StatusBadRequest)
+	case errors.Is(err, user.ErrNoEmail):
+		sending.SendJSONMessage(w, "no email set", http.StatusBadRequest)
+	case errors.Is(err, user.ErrBadVerifyToken):
+		sending.SendJSONMessage(w, "invalid or expired verification token", http.StatusBadRequest)
+	case errors.Is(err, user.ErrResendTooSoon):
+		sending.SendJSONMessage(w, "verification email sent recently", http.StatusTooManyRequests)
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -111,6 +134,22 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	enabled, err := h.TwoFactor.Enabled(u.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		loginToken, err := h.TwoFactor.CreateChallenge(u.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		h.Logger.Infof("ask %v for the second factor", u.ID)
+		sending.JSONMarshalAndSend(w, TwoFactorAnswer{TwoFactorRequired: true, LoginToken: loginToken})
+		return
+	}
+
 	token, err := h.Sessions.Create(u)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -127,11 +166,18 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	u, err := h.UserRepo.Register(lf.Username, lf.Password)
+	u, err := h.UserRepo.Register(lf.Username, lf.Password, lf.Email)
 	if err != nil {
 		handleUserErrors(err, w)
 		return
 	}
+	if lf.Email != "" {
+		// the user can ask for another one, registration goes on
+		err = sendVerification(h.UserRepo, h.Mailer, u, lf.Email)
+		if err != nil {
+			h.Logger.Errorf("fail to send verification to %v: %v", u.ID, err)
+		}
+	}
 
 	token, err := h.Sessions.Create(u)
 	if err != nil {
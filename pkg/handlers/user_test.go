@@ -11,8 +11,10 @@ import (
 	"testing"
 
 	"github.com/golang/mock/gomock"
+	"github.com/greatjudge/redditclone/pkg/mail"
 	"github.com/greatjudge/redditclone/pkg/sending"
 	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/twofactor"
 	"github.com/greatjudge/redditclone/pkg/user"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -183,17 +185,22 @@ func CheckLoginTest(t *testing.T, tc TestCaseLogin) {
 	if tc.Method == LOGIN {
 		st.EXPECT().Authorize(usr.Username, password).Return(usr, tc.RepoErr)
 	} else {
-		st.EXPECT().Register(usr.Username, password).Return(usr, tc.RepoErr)
+		st.EXPECT().Register(usr.Username, password, "").Return(usr, tc.RepoErr)
 	}
 
+	twoFactor := twofactor.NewMockRepo(ctrl)
 	if tc.RepoErr == nil {
+		if tc.Method == LOGIN {
+			twoFactor.EXPECT().Enabled(usr.ID).Return(false, nil)
+		}
 		sessMock.EXPECT().Create(usr).Return(token, tc.CreateErr)
 	}
 
 	service := &UserHandler{
-		Logger:   zap.NewNop().Sugar(),
-		UserRepo: st,
-		Sessions: sessMock,
+		Logger:    zap.NewNop().Sugar(),
+		UserRepo:  st,
+		Sessions:  sessMock,
+		TwoFactor: twoFactor,
 	}
 
 	lf := LoginForm{
@@ -371,3 +378,49 @@ func TestRegister(t *testing.T) {
 		CheckLoginTest(t, tc)
 	}
 }
+
+func TestRegisterWithEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	st := user.NewMockUserRepo(ctrl)
+	sessMock := session.NewMockSessionsManager(ctrl)
+	outbox := mail.NewOutbox()
+	service := &UserHandler{
+		Logger:   zap.NewNop().Sugar(),
+		UserRepo: st,
+		Sessions: sessMock,
+		Mailer:   outbox,
+	}
+	usr := user.NewUser("id", "username", "")
+	register := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		service.Register(w, httptest.NewRequest("POST", "/api/register", strings.NewReader(body)))
+		return w
+	}
+
+	st.EXPECT().Register("username", "password", "u@example.com").Return(usr, nil)
+	st.EXPECT().CreateEmailVerification("id", gomock.Any()).Return("verify-token", nil)
+	sessMock.EXPECT().Create(usr).Return("token", nil)
+	w := register(`{"username": "username", "password": "password", "email": "u@example.com"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	if sent := outbox.Messages(); assert.Len(t, sent, 1) {
+		assert.Equal(t, "u@example.com", sent[0].To)
+		assert.Contains(t, sent[0].Body, "verify-token")
+	}
+
+	// a failed mail does not fail the registration
+	st.EXPECT().Register("username", "password", "u@example.com").Return(usr, nil)
+	st.EXPECT().CreateEmailVerification("id", gomock.Any()).Return("", fmt.Errorf("db error"))
+	sessMock.EXPECT().Create(usr).Return("token", nil)
+	w = register(`{"username": "username", "password": "password", "email": "u@example.com"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	st.EXPECT().Register("username", "password", "u@example.com").Return(user.User{}, user.ErrEmailTaken)
+	w = register(`{"username": "username", "password": "password", "email": "u@example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "email already taken")
+
+	w = register(`{"username": "username", "password": "password", "email": "not an email"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages to users.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// LogMailer writes messages to w instead of sending them, for local runs
+// and tests.
+type LogMailer struct {
+	w   io.Writer
+	mu  *sync.Mutex
+	now func() time.Time
+}
+
+func NewLogMailer(w io.Writer) *LogMailer {
+	return &LogMailer{
+		w:   w,
+		mu:  &sync.Mutex{},
+		now: time.Now,
+	}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(
+		m.w,
+		"Date: %v\nTo: %v\nSubject: %v\n\n%v\n\n",
+		m.now().Format(time.RFC1123Z),
+		msg.To,
+		msg.Subject,
+		msg.Body,
+	)
+	if err != nil {
+		return fmt.Errorf("fail to write message to %v: %w", msg.To, err)
+	}
+	return nil
+}
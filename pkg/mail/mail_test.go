@@ -0,0 +1,115 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("disk full")
+}
+
+func TestLogMailer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	m := NewLogMailer(buf)
+	m.now = func() time.Time { return time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	err := m.Send(Message{To: "u", Subject: "Hi", Body: "line one\nline two"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Date: Mon, 02 Jan 2023 03:04:05 +0000\nTo: u\nSubject: Hi\n\nline one\nline two\n\n", buf.String())
+
+	assert.NotNil(t, NewLogMailer(failingWriter{}).Send(Message{To: "u"}))
+}
+
+func TestOutbox(t *testing.T) {
+	o := NewOutbox()
+	assert.Empty(t, o.Messages())
+
+	assert.Nil(t, o.Send(Message{To: "a@example.com", Subject: "one"}))
+	assert.Nil(t, o.Send(Message{To: "b@example.com", Subject: "two"}))
+	messages := o.Messages()
+	assert.Equal(t, []Message{
+		{To: "a@example.com", Subject: "one"},
+		{To: "b@example.com", Subject: "two"},
+	}, messages)
+
+	// the returned slice is a copy
+	messages[0].Subject = "changed"
+	assert.Equal(t, "one", o.Messages()[0].Subject)
+}
+
+// fakeSMTP accepts one connection, answers the commands smtp.SendMail
+// issues and sends what it received to the returned channel.
+func fakeSMTP(t *testing.T, rcptReply string) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cant listen: %v", err)
+	}
+	received := make(chan string, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tc := textproto.NewConn(conn)
+		log := &strings.Builder{}
+		_ = tc.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tc.ReadLine()
+			if err != nil {
+				break
+			}
+			log.WriteString(line + "\n")
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch cmd {
+			case "EHLO", "HELO":
+				_ = tc.PrintfLine("250 fake")
+			case "RCPT":
+				_ = tc.PrintfLine(rcptReply)
+			case "DATA":
+				_ = tc.PrintfLine("354 go ahead")
+				data, _ := tc.ReadDotLines()
+				log.WriteString(strings.Join(data, "\n") + "\n")
+				_ = tc.PrintfLine("250 queued")
+			case "QUIT":
+				_ = tc.PrintfLine("221 bye")
+				received <- log.String()
+				return
+			default:
+				_ = tc.PrintfLine("250 ok")
+			}
+		}
+		received <- log.String()
+	}()
+	return l.Addr().String(), received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, received := fakeSMTP(t, "250 ok")
+	m := NewSMTPMailer(addr, "noreply@example.com", nil)
+	m.now = func() time.Time { return time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	err := m.Send(Message{To: "u@example.com", Subject: "Hi", Body: "line one\nline two"})
+	assert.Nil(t, err)
+	session := <-received
+	assert.Contains(t, session, "MAIL FROM:<noreply@example.com>")
+	assert.Contains(t, session, "RCPT TO:<u@example.com>")
+	assert.Contains(t, session, "From: noreply@example.com\nTo: u@example.com\nSubject: Hi\nDate: Mon, 02 Jan 2023 03:04:05 +0000\n")
+	assert.Contains(t, session, "\nline one\nline two\n")
+
+	addr, received = fakeSMTP(t, "550 no such user")
+	m = NewSMTPMailer(addr, "noreply@example.com", nil)
+	assert.NotNil(t, m.Send(Message{To: "ghost@example.com", Subject: "Hi"}))
+	<-received
+}
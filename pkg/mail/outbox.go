@@ -0,0 +1,33 @@
+package mail
+
+import "sync"
+
+// Outbox keeps sent messages in memory, tests read them back instead of
+// running an SMTP server.
+type Outbox struct {
+	mu       *sync.Mutex
+	messages []Message
+}
+
+func NewOutbox() *Outbox {
+	return &Outbox{
+		mu:       &sync.Mutex{},
+		messages: make([]Message, 0),
+	}
+}
+
+func (o *Outbox) Send(msg Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// Messages returns the sent messages in order.
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	messages := make([]Message, len(o.messages))
+	copy(messages, o.messages)
+	return messages
+}
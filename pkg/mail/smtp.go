@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPMailer sends messages through an SMTP server.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+	now  func() time.Time
+}
+
+// NewSMTPMailer sends from the from address through the server at addr,
+// auth may be nil for servers that accept mail without it.
+func NewSMTPMailer(addr, from string, auth smtp.Auth) *SMTPMailer {
+	return &SMTPMailer{
+		addr: addr,
+		from: from,
+		auth: auth,
+		now:  time.Now,
+	}
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, m.format(msg))
+	if err != nil {
+		return fmt.Errorf("fail to send message to %v: %w", msg.To, err)
+	}
+	return nil
+}
+
+// format builds a plain text message with CRLF line endings.
+func (m *SMTPMailer) format(msg Message) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "From: %v\r\n", m.from)
+	fmt.Fprintf(buf, "To: %v\r\n", msg.To)
+	fmt.Fprintf(buf, "Subject: %v\r\n", msg.Subject)
+	fmt.Fprintf(buf, "Date: %v\r\n", m.now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,32 @@
+package markdown
+
+import (
+	"bytes"
+	"html"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var md = goldmark.New(
+	goldmark.WithExtensions(
+		extension.Strikethrough,
+		extension.NewTable(
+			extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute),
+		),
+		SpoilerExtension,
+	),
+)
+
+// Render converts CommonMark source to sanitized html. Raw html in the
+// source is never passed through.
+func Render(source string) string {
+	if source == "" {
+		return ""
+	}
+	buf := &bytes.Buffer{}
+	if err := md.Convert([]byte(source), buf); err != nil {
+		return html.EscapeString(source)
+	}
+	return Sanitize(buf.String())
+}
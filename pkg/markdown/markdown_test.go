@@ -0,0 +1,118 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{
+			name:     "emphasis and strikethrough",
+			source:   "*a* **b** ~~c~~",
+			expected: "<p><em>a</em> <strong>b</strong> <del>c</del></p>\n",
+		},
+		{
+			name:     "spoiler",
+			source:   "the end: >!everyone **dies**!< sorry",
+			expected: "<p>the end: <span class=\"spoiler\">everyone <strong>dies</strong></span> sorry</p>\n",
+		},
+		{
+			name:     "unclosed spoiler",
+			source:   "a >!b",
+			expected: "<p>a &gt;!b</p>\n",
+		},
+		{
+			name:   "table",
+			source: "| a | b |\n|:--|--:|\n| 1 | 2 |",
+			expected: "<table>\n<thead>\n<tr>\n<th align=\"left\">a</th>\n<th align=\"right\">b</th>\n</tr>\n</thead>\n" +
+				"<tbody>\n<tr>\n<td align=\"left\">1</td>\n<td align=\"right\">2</td>\n</tr>\n</tbody>\n</table>\n",
+		},
+		{
+			name:     "link",
+			source:   "[site](https://example.com)",
+			expected: "<p><a href=\"https://example.com\" rel=\"nofollow noopener ugc\">site</a></p>\n",
+		},
+		{
+			name:     "code block",
+			source:   "```go\nx := \"<b>\"\n```",
+			expected: "<pre><code class=\"language-go\">x := &#34;&lt;b&gt;&#34;\n</code></pre>\n",
+		},
+		{
+			name:     "empty",
+			source:   "",
+			expected: "",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Render(tc.source))
+		})
+	}
+}
+
+// xssPayloads is a selection of the OWASP filter evasion cheat sheet.
+var xssPayloads = []string{
+	`<script>alert(1)</script>`,
+	`<SCRIPT SRC=http://xss.rocks/xss.js></SCRIPT>`,
+	`<img src=x onerror=alert(1)>`,
+	`<IMG SRC="javascript:alert('XSS');">`,
+	`<a href="javascript:alert(1)">x</a>`,
+	`<a href="JaVaScRiPt:alert(1)">x</a>`,
+	`<a href="java&#x09;script:alert(1)">x</a>`,
+	`<a href="&#106;&#97;&#118;&#97;&#115;&#99;&#114;&#105;&#112;&#116;&#58;alert(1)">x</a>`,
+	`<a href=" javascript:alert(1)">x</a>`,
+	`<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">x</a>`,
+	`<a href="vbscript:msgbox(1)">x</a>`,
+	`<svg/onload=alert(1)>`,
+	`<svg><script>alert(1)</script></svg>`,
+	`<iframe src="javascript:alert(1)"></iframe>`,
+	`<body onload=alert(1)>`,
+	`<div style="background:url(javascript:alert(1))">x</div>`,
+	`<p onmouseover="alert(1)">x</p>`,
+	`<span class="spoiler" onclick="alert(1)">x</span>`,
+	`<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`,
+	`<<script>script>alert(1)<</script>/script>`,
+	`<a href="//evil.example/x">x</a>`,
+	`<object data="javascript:alert(1)"></object>`,
+	`<embed src="javascript:alert(1)">`,
+	`<form action="javascript:alert(1)"><input type=submit></form>`,
+	`<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`,
+	`<style>@import 'http://xss.rocks/xss.css';</style>`,
+	`<code class="x onmouseover=alert(1)">x</code>`,
+}
+
+func TestSanitizeXSSPayloads(t *testing.T) {
+	for _, payload := range xssPayloads {
+		clean := strings.ToLower(Sanitize(payload))
+		for _, bad := range []string{"<script", "<img", "<svg", "<iframe", "<object", "<embed", "<style", "<form", "<meta", "onerror", "onload", "onclick", "onmouseover", "javascript:", "vbscript:", "data:", "style=", "//evil"} {
+			assert.NotContains(t, clean, bad, "payload %q sanitized to %q", payload, clean)
+		}
+	}
+}
+
+func TestRenderXSSPayloads(t *testing.T) {
+	for _, payload := range xssPayloads {
+		clean := strings.ToLower(Render(payload))
+		// payloads may survive as escaped text, but never as markup
+		for _, bad := range []string{"<script", "<img", "<svg", "<iframe", "<object", "<embed", "<style", `href="javascript`, `href="data`, " onerror=", " style="} {
+			assert.NotContains(t, clean, bad, "payload %q rendered to %q", payload, clean)
+		}
+	}
+	assert.NotContains(t, Render("[x](javascript:alert(1))"), "javascript:")
+}
+
+func TestSanitizeKeepsAllowedMarkup(t *testing.T) {
+	assert.Equal(t,
+		`<p><a href="/r/golang" rel="nofollow noopener ugc">x</a> <span class="spoiler">s</span></p>`,
+		Sanitize(`<p><a href="/r/golang" target="_blank">x</a> <span class="spoiler">s</span></p>`),
+	)
+	// unclosed and stray tags are balanced
+	assert.Equal(t, "<em><strong>x</strong></em>", Sanitize("<em><strong>x</em></div>"))
+}
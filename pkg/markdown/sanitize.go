@@ -0,0 +1,204 @@
+package markdown
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// allowedAttrs lists the tags that survive sanitizing and the attributes
+// each of them may keep. Everything else is dropped, text is kept.
+var allowedAttrs = map[string]map[string]bool{
+	"p":          {},
+	"br":         {},
+	"hr":         {},
+	"em":         {},
+	"strong":     {},
+	"del":        {},
+	"code":       {"class": true},
+	"pre":        {},
+	"blockquote": {},
+	"ul":         {},
+	"ol":         {"start": true},
+	"li":         {},
+	"h1":         {},
+	"h2":         {},
+	"h3":         {},
+	"h4":         {},
+	"h5":         {},
+	"h6":         {},
+	"a":          {"href": true, "title": true},
+	"table":      {},
+	"thead":      {},
+	"tbody":      {},
+	"tr":         {},
+	"th":         {"align": true},
+	"td":         {"align": true},
+	"span":       {"class": true},
+}
+
+// droppedWithContent are tags whose content must not leak as text either.
+var droppedWithContent = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"noscript": true,
+	"template": true,
+	"textarea": true,
+	"title":    true,
+	"svg":      true,
+	"math":     true,
+	"select":   true,
+}
+
+var allowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+var allowedAlign = map[string]bool{
+	"left":   true,
+	"center": true,
+	"right":  true,
+}
+
+const linkRel = "nofollow noopener ugc"
+
+// Sanitize keeps only allowlisted tags and attributes of an html fragment.
+func Sanitize(fragment string) string {
+	out := &strings.Builder{}
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+	open := make([]string, 0)
+	skipDepth := 0
+
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			if tokenizer.Err() != io.EOF {
+				return ""
+			}
+			break
+		}
+		tok := tokenizer.Token()
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedWithContent[tok.Data] {
+				if tt == html.StartTagToken {
+					skipDepth++
+				}
+				continue
+			}
+			attrs, ok := allowedAttrs[tok.Data]
+			if !ok || skipDepth > 0 {
+				continue
+			}
+			writeStartTag(out, tok, attrs)
+			if tt == html.StartTagToken && !isVoid(tok.Data) {
+				open = append(open, tok.Data)
+			}
+		case html.EndTagToken:
+			if droppedWithContent[tok.Data] {
+				if skipDepth > 0 {
+					skipDepth--
+				}
+				continue
+			}
+			if skipDepth > 0 {
+				continue
+			}
+			// close only tags we opened, keeping the output balanced
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == tok.Data {
+					for j := len(open) - 1; j >= i; j-- {
+						out.WriteString("</" + open[j] + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		case html.TextToken:
+			if skipDepth == 0 {
+				out.WriteString(html.EscapeString(tok.Data))
+			}
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i] + ">")
+	}
+	return out.String()
+}
+
+func writeStartTag(out *strings.Builder, tok html.Token, allowed map[string]bool) {
+	out.WriteString("<" + tok.Data)
+	for _, attr := range tok.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" || !allowed[key] {
+			continue
+		}
+		val, ok := cleanAttr(tok.Data, key, attr.Val)
+		if !ok {
+			continue
+		}
+		out.WriteString(" " + key + `="` + html.EscapeString(val) + `"`)
+	}
+	if tok.Data == "a" {
+		out.WriteString(` rel="` + linkRel + `"`)
+	}
+	out.WriteString(">")
+}
+
+func cleanAttr(tag, key, val string) (string, bool) {
+	switch key {
+	case "href":
+		return val, safeURL(val)
+	case "align":
+		return val, allowedAlign[val]
+	case "start":
+		for _, r := range val {
+			if r < '0' || r > '9' {
+				return "", false
+			}
+		}
+		return val, val != ""
+	case "class":
+		switch tag {
+		case "span":
+			return val, val == "spoiler"
+		case "code":
+			return val, strings.HasPrefix(val, "language-") && !strings.ContainsAny(val, " \"'<>")
+		}
+		return "", false
+	}
+	return val, true
+}
+
+// safeURL accepts relative urls and absolute ones with an allowed scheme.
+func safeURL(raw string) bool {
+	if strings.TrimSpace(raw) == "" {
+		return false
+	}
+	for _, r := range raw {
+		if r < ' ' || r == 0x7f {
+			return false
+		}
+	}
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" {
+		// "//host" would inherit the page scheme, only plain paths are allowed
+		return u.Host == "" && !strings.HasPrefix(raw, "//")
+	}
+	return allowedSchemes[strings.ToLower(u.Scheme)]
+}
+
+func isVoid(tag string) bool {
+	return tag == "br" || tag == "hr"
+}
@@ -0,0 +1,105 @@
+package markdown
+
+import (
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Spoilers use reddit syntax: >!hidden text!<
+// A spoiler can not start a line, there ">" opens a blockquote.
+
+var KindSpoiler = gast.NewNodeKind("Spoiler")
+
+type Spoiler struct {
+	gast.BaseInline
+}
+
+func (n *Spoiler) Kind() gast.NodeKind {
+	return KindSpoiler
+}
+
+func (n *Spoiler) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, nil, nil)
+}
+
+const (
+	spoilerOpenChar  = '>'
+	spoilerCloseChar = '<'
+)
+
+type spoilerDelimiterProcessor struct{}
+
+func (p *spoilerDelimiterProcessor) IsDelimiter(b byte) bool {
+	return b == spoilerOpenChar || b == spoilerCloseChar
+}
+
+func (p *spoilerDelimiterProcessor) CanOpenCloser(opener, closer *parser.Delimiter) bool {
+	return opener.Char == spoilerOpenChar && closer.Char == spoilerCloseChar
+}
+
+func (p *spoilerDelimiterProcessor) OnMatch(consumes int) gast.Node {
+	return &Spoiler{}
+}
+
+var defaultSpoilerDelimiterProcessor = &spoilerDelimiterProcessor{}
+
+type spoilerParser struct{}
+
+func (s *spoilerParser) Trigger() []byte {
+	return []byte{'>', '!'}
+}
+
+func (s *spoilerParser) Parse(parent gast.Node, block text.Reader, pc parser.Context) gast.Node {
+	line, segment := block.PeekLine()
+	if len(line) < 2 {
+		return nil
+	}
+	var node *parser.Delimiter
+	switch {
+	case line[0] == '>' && line[1] == '!':
+		node = parser.NewDelimiter(true, false, 2, spoilerOpenChar, defaultSpoilerDelimiterProcessor)
+	case line[0] == '!' && line[1] == '<':
+		node = parser.NewDelimiter(false, true, 2, spoilerCloseChar, defaultSpoilerDelimiterProcessor)
+	default:
+		return nil
+	}
+	node.Segment = segment.WithStop(segment.Start + 2)
+	block.Advance(2)
+	pc.PushDelimiter(node)
+	return node
+}
+
+func (s *spoilerParser) CloseBlock(parent gast.Node, pc parser.Context) {}
+
+type spoilerHTMLRenderer struct{}
+
+func (r *spoilerHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindSpoiler, r.renderSpoiler)
+}
+
+func (r *spoilerHTMLRenderer) renderSpoiler(w util.BufWriter, source []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<span class="spoiler">`)
+	} else {
+		_, _ = w.WriteString("</span>")
+	}
+	return gast.WalkContinue, nil
+}
+
+type spoilerExtension struct{}
+
+// SpoilerExtension adds >!spoiler!< inline syntax to goldmark.
+var SpoilerExtension = &spoilerExtension{}
+
+func (e *spoilerExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		util.Prioritized(&spoilerParser{}, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&spoilerHTMLRenderer{}, 500),
+	))
+}
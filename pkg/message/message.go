@@ -0,0 +1,63 @@
+package message
+
+import (
+	"errors"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/user"
+)
+
+const MaxBodyLength = 10000
+
+// DefaultLimit is how many messages a user may send in a window.
+var DefaultLimit = Limit{Count: 20, Window: 10 * time.Minute}
+
+var (
+	ErrNoConversation = errors.New("no conversation found")
+	ErrSelfMessage    = errors.New("can not message yourself")
+	ErrRateLimited    = errors.New("too many messages")
+)
+
+type Limit struct {
+	Count  int
+	Window time.Duration
+}
+
+type Message struct {
+	ID             int64     `json:"id"`
+	ConversationID int64     `json:"conversation_id"`
+	Sender         user.User `json:"sender"`
+	Body           string    `json:"body"`
+	Created        time.Time `json:"created"`
+	Read           bool      `json:"read"`
+}
+
+// Conversation is seen from one of its two users, With is the other one.
+type Conversation struct {
+	ID          int64     `json:"id"`
+	With        user.User `json:"with"`
+	LastMessage string    `json:"last_message"`
+	Unread      int       `json:"unread"`
+	Updated     time.Time `json:"updated"`
+}
+
+type MessageForm struct {
+	Body string `json:"body" valid:"required~is required"` // at most MaxBodyLength
+}
+
+//go:generate mockgen -source=message.go -destination=repo_mock.go -package=message MessageRepo
+type MessageRepo interface {
+	// Send starts the conversation of the two users if there is none yet.
+	// It returns ErrRateLimited if the sender already sent limit.Count
+	// messages within limit.Window.
+	Send(from, to user.User, body string, limit Limit) (Message, error)
+	ListConversations(userID string, offset, limit int) ([]Conversation, error)
+	// ListMessages returns the newest messages first, ErrNoConversation
+	// if the user is not part of the conversation.
+	ListMessages(userID string, conversationID int64, offset, limit int) ([]Message, error)
+	MarkRead(userID string, conversationID int64) error
+	UnreadCount(userID string) (int, error)
+	// ExportUserData returns the messages the user sent or received,
+	// oldest first.
+	ExportUserData(userID string) ([]Message, error)
+}
@@ -0,0 +1,124 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: message.go
+
+// Package message is a generated GoMock package.
+package message
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	user "github.com/greatjudge/redditclone/pkg/user"
+)
+
+// MockMessageRepo is a mock of MessageRepo interface.
+type MockMessageRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockMessageRepoMockRecorder
+}
+
+// MockMessageRepoMockRecorder is the mock recorder for MockMessageRepo.
+type MockMessageRepoMockRecorder struct {
+	mock *MockMessageRepo
+}
+
+// NewMockMessageRepo creates a new mock instance.
+func NewMockMessageRepo(ctrl *gomock.Controller) *MockMessageRepo {
+	mock := &MockMessageRepo{ctrl: ctrl}
+	mock.recorder = &MockMessageRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMessageRepo) EXPECT() *MockMessageRepoMockRecorder {
+	return m.recorder
+}
+
+// ExportUserData mocks base method.
+func (m *MockMessageRepo) ExportUserData(userID string) ([]Message, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportUserData", userID)
+	ret0, _ := ret[0].([]Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportUserData indicates an expected call of ExportUserData.
+func (mr *MockMessageRepoMockRecorder) ExportUserData(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportUserData", reflect.TypeOf((*MockMessageRepo)(nil).ExportUserData), userID)
+}
+
+// ListConversations mocks base method.
+func (m *MockMessageRepo) ListConversations(userID string, offset, limit int) ([]Conversation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListConversations", userID, offset, limit)
+	ret0, _ := ret[0].([]Conversation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListConversations indicates an expected call of ListConversations.
+func (mr *MockMessageRepoMockRecorder) ListConversations(userID, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListConversations", reflect.TypeOf((*MockMessageRepo)(nil).ListConversations), userID, offset, limit)
+}
+
+// ListMessages mocks base method.
+func (m *MockMessageRepo) ListMessages(userID string, conversationID int64, offset, limit int) ([]Message, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMessages", userID, conversationID, offset, limit)
+	ret0, _ := ret[0].([]Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMessages indicates an expected call of ListMessages.
+func (mr *MockMessageRepoMockRecorder) ListMessages(userID, conversationID, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMessages", reflect.TypeOf((*MockMessageRepo)(nil).ListMessages), userID, conversationID, offset, limit)
+}
+
+// MarkRead mocks base method.
+func (m *MockMessageRepo) MarkRead(userID string, conversationID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkRead", userID, conversationID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkRead indicates an expected call of MarkRead.
+func (mr *MockMessageRepoMockRecorder) MarkRead(userID, conversationID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkRead", reflect.TypeOf((*MockMessageRepo)(nil).MarkRead), userID, conversationID)
+}
+
+// Send mocks base method.
+func (m *MockMessageRepo) Send(from, to user.User, body string, limit Limit) (Message, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", from, to, body, limit)
+	ret0, _ := ret[0].(Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockMessageRepoMockRecorder) Send(from, to, body, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockMessageRepo)(nil).Send), from, to, body, limit)
+}
+
+// UnreadCount mocks base method.
+func (m *MockMessageRepo) UnreadCount(userID string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnreadCount", userID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UnreadCount indicates an expected call of UnreadCount.
+func (mr *MockMessageRepoMockRecorder) UnreadCount(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnreadCount", reflect.TypeOf((*MockMessageRepo)(nil).UnreadCount), userID)
+}
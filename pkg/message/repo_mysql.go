@@ -0,0 +1,274 @@
+package message
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+)
+
+const mysqlDatetimeFormat = "2006-01-02 15:04:05"
+
+type MessageMysqlRepository struct {
+	DB     *sql.DB
+	Logger *zap.SugaredLogger
+}
+
+func NewMysqlRepo(db *sql.DB, logger *zap.SugaredLogger) *MessageMysqlRepository {
+	return &MessageMysqlRepository{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+// pair orders the two users so a conversation has one row.
+func pair(userID, otherID string) (string, string) {
+	if userID < otherID {
+		return userID, otherID
+	}
+	return otherID, userID
+}
+
+func (repo *MessageMysqlRepository) Send(from, to user.User, body string, limit Limit) (Message, error) {
+	if from.ID == to.ID {
+		return Message{}, ErrSelfMessage
+	}
+	created := time.Now().UTC().Truncate(time.Second)
+	createdStr := created.Format(mysqlDatetimeFormat)
+	userA, userB := pair(from.ID, to.ID)
+
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		repo.Logger.Error("in Send, begin: ", err)
+		return Message{}, err
+	}
+	err = repo.checkLimit(tx, from.ID, created.Add(-limit.Window), limit.Count)
+	if err != nil {
+		if !errors.Is(err, ErrRateLimited) {
+			repo.Logger.Error("in Send, limit: ", err)
+		}
+		_ = tx.Rollback()
+		return Message{}, err
+	}
+	msg, err := repo.send(tx, userA, userB, from, to, body, createdStr)
+	if err != nil {
+		repo.Logger.Error("in Send: ", err)
+		_ = tx.Rollback()
+		return Message{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		repo.Logger.Error("in Send, commit: ", err)
+		return Message{}, err
+	}
+	msg.Created = created
+	return msg, nil
+}
+
+// checkLimit counts the sent messages under a lock on the sender's range of
+// the index, so concurrent sends of one user can not both pass the limit.
+func (repo *MessageMysqlRepository) checkLimit(tx *sql.Tx, userID string, since time.Time, limit int) error {
+	count := 0
+	err := tx.
+		QueryRow(
+			"SELECT COUNT(*) FROM messages WHERE sender_id = ? AND created_at >= ? FOR UPDATE",
+			userID,
+			since.Format(mysqlDatetimeFormat),
+		).
+		Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count >= limit {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+func (repo *MessageMysqlRepository) send(tx *sql.Tx, userA, userB string, from, to user.User, body, created string) (Message, error) {
+	_, err := tx.Exec(
+		"INSERT IGNORE INTO conversations (`user_a`, `user_b`, `updated_at`) VALUES (?, ?, ?)",
+		userA,
+		userB,
+		created,
+	)
+	if err != nil {
+		return Message{}, err
+	}
+	msg := Message{Sender: from, Body: body}
+	err = tx.
+		QueryRow("SELECT id FROM conversations WHERE user_a = ? AND user_b = ?", userA, userB).
+		Scan(&msg.ConversationID)
+	if err != nil {
+		return Message{}, err
+	}
+	result, err := tx.Exec(
+		"INSERT INTO messages (`conversation_id`, `sender_id`, `recipient_id`, `body`, `created_at`) VALUES (?, ?, ?, ?, ?)",
+		msg.ConversationID,
+		from.ID,
+		to.ID,
+		body,
+		created,
+	)
+	if err != nil {
+		return Message{}, err
+	}
+	msg.ID, err = result.LastInsertId()
+	if err != nil {
+		return Message{}, err
+	}
+	_, err = tx.Exec("UPDATE conversations SET updated_at = ? WHERE id = ?", created, msg.ConversationID)
+	if err != nil {
+		return Message{}, err
+	}
+	return msg, nil
+}
+
+func (repo *MessageMysqlRepository) ListConversations(userID string, offset, limit int) ([]Conversation, error) {
+	rows, err := repo.DB.Query(
+		"SELECT c.id, MD5(u.id), u.username, c.updated_at, "+
+			"(SELECT m.body FROM messages m WHERE m.conversation_id = c.id ORDER BY m.id DESC LIMIT 1), "+
+			"(SELECT COUNT(*) FROM messages m WHERE m.conversation_id = c.id AND m.recipient_id = ? AND m.is_read = 0) "+
+			"FROM conversations c JOIN users u ON MD5(u.id) = IF(c.user_a = ?, c.user_b, c.user_a) "+
+			"WHERE c.user_a = ? OR c.user_b = ? "+
+			"ORDER BY c.updated_at DESC, c.id DESC LIMIT ? OFFSET ?",
+		userID,
+		userID,
+		userID,
+		userID,
+		limit,
+		offset,
+	)
+	if err != nil {
+		repo.Logger.Error("in ListConversations: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := make([]Conversation, 0)
+	for rows.Next() {
+		conv, updated := Conversation{}, ""
+		err = rows.Scan(&conv.ID, &conv.With.ID, &conv.With.Username, &updated, &conv.LastMessage, &conv.Unread)
+		if err != nil {
+			return nil, fmt.Errorf("fail to scan conversation: %w", err)
+		}
+		conv.Updated, err = time.Parse(mysqlDatetimeFormat, updated)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse updated_at: %w", err)
+		}
+		conversations = append(conversations, conv)
+	}
+	return conversations, rows.Err()
+}
+
+// checkMember returns ErrNoConversation to users outside of the conversation,
+// so they can not tell it exists.
+func (repo *MessageMysqlRepository) checkMember(userID string, conversationID int64) error {
+	userA, userB := "", ""
+	err := repo.DB.
+		QueryRow("SELECT user_a, user_b FROM conversations WHERE id = ?", conversationID).
+		Scan(&userA, &userB)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNoConversation
+	case err != nil:
+		return err
+	case userID != userA && userID != userB:
+		return ErrNoConversation
+	}
+	return nil
+}
+
+func (repo *MessageMysqlRepository) ListMessages(userID string, conversationID int64, offset, limit int) ([]Message, error) {
+	if err := repo.checkMember(userID, conversationID); err != nil {
+		return nil, err
+	}
+	rows, err := repo.DB.Query(
+		"SELECT m.id, m.sender_id, u.username, m.body, m.created_at, m.is_read "+
+			"FROM messages m JOIN users u ON MD5(u.id) = m.sender_id "+
+			"WHERE m.conversation_id = ? ORDER BY m.id DESC LIMIT ? OFFSET ?",
+		conversationID,
+		limit,
+		offset,
+	)
+	if err != nil {
+		repo.Logger.Error("in ListMessages: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]Message, 0)
+	for rows.Next() {
+		msg, created := Message{ConversationID: conversationID}, ""
+		err = rows.Scan(&msg.ID, &msg.Sender.ID, &msg.Sender.Username, &msg.Body, &created, &msg.Read)
+		if err != nil {
+			return nil, fmt.Errorf("fail to scan message: %w", err)
+		}
+		msg.Created, err = time.Parse(mysqlDatetimeFormat, created)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse created_at: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+func (repo *MessageMysqlRepository) MarkRead(userID string, conversationID int64) error {
+	if err := repo.checkMember(userID, conversationID); err != nil {
+		return err
+	}
+	_, err := repo.DB.Exec(
+		"UPDATE messages SET is_read = 1 WHERE conversation_id = ? AND recipient_id = ? AND is_read = 0",
+		conversationID,
+		userID,
+	)
+	if err != nil {
+		repo.Logger.Error("in MarkRead: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *MessageMysqlRepository) UnreadCount(userID string) (int, error) {
+	count := 0
+	err := repo.DB.
+		QueryRow("SELECT COUNT(*) FROM messages WHERE recipient_id = ? AND is_read = 0", userID).
+		Scan(&count)
+	if err != nil {
+		repo.Logger.Error("in UnreadCount: ", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (repo *MessageMysqlRepository) ExportUserData(userID string) ([]Message, error) {
+	rows, err := repo.DB.Query(
+		"SELECT m.id, m.conversation_id, m.sender_id, u.username, m.body, m.created_at, m.is_read "+
+			"FROM messages m JOIN users u ON MD5(u.id) = m.sender_id "+
+			"WHERE m.sender_id = ? OR m.recipient_id = ? ORDER BY m.id",
+		userID,
+		userID,
+	)
+	if err != nil {
+		repo.Logger.Error("in ExportUserData: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]Message, 0)
+	for rows.Next() {
+		msg, created := Message{}, ""
+		err = rows.Scan(&msg.ID, &msg.ConversationID, &msg.Sender.ID, &msg.Sender.Username, &msg.Body, &created, &msg.Read)
+		if err != nil {
+			return nil, fmt.Errorf("fail to scan message: %w", err)
+		}
+		msg.Created, err = time.Parse(mysqlDatetimeFormat, created)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse created_at: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
@@ -0,0 +1,219 @@
+package message
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestSend(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+	bob, alice := user.NewUser("b", "bob", ""), user.NewUser("a", "alice", "")
+
+	limit := Limit{Count: 2, Window: time.Minute}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM messages WHERE sender_id = \? AND created_at >= \? FOR UPDATE`).
+		WithArgs("b", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	// the pair is ordered whoever sends
+	mock.ExpectExec(`INSERT IGNORE INTO conversations`).
+		WithArgs("a", "b", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT id FROM conversations WHERE user_a = \? AND user_b = \?`).
+		WithArgs("a", "b").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec(`INSERT INTO messages`).
+		WithArgs(3, "b", "a", "hi", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(10, 1))
+	mock.ExpectExec(`UPDATE conversations SET updated_at = \? WHERE id = \?`).
+		WithArgs(sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	msg, err := repo.Send(bob, alice, "hi", limit)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if msg.ID != 10 || msg.ConversationID != 3 || msg.Sender != bob {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM messages`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectRollback()
+	if _, err = repo.Send(bob, alice, "hi", limit); err != ErrRateLimited {
+		t.Errorf("expected ErrRateLimited, got %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM messages`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`INSERT IGNORE INTO conversations`).WillReturnError(fmt.Errorf("db error"))
+	mock.ExpectRollback()
+	if _, err = repo.Send(bob, alice, "hi", limit); err == nil {
+		t.Errorf("expected error")
+	}
+
+	if _, err = repo.Send(bob, bob, "hi", limit); err != ErrSelfMessage {
+		t.Errorf("expected ErrSelfMessage, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestListConversations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	rows := sqlmock.NewRows([]string{"id", "with_id", "with_username", "updated_at", "last", "unread"}).
+		AddRow(3, "b", "bob", "2023-01-02 03:04:05", "hi", 2)
+	mock.ExpectQuery(`SELECT c.id, MD5\(u.id\), u.username, c.updated_at, .* FROM conversations c JOIN users u`).
+		WithArgs("a", "a", "a", "a", 11, 0).
+		WillReturnRows(rows)
+
+	items, err := repo.ListConversations("a", 0, 11)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	expect := []Conversation{{
+		ID:          3,
+		With:        user.NewUser("b", "bob", ""),
+		LastMessage: "hi",
+		Unread:      2,
+		Updated:     time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+	}}
+	if !reflect.DeepEqual(items, expect) {
+		t.Errorf("results not match, want %v, have %v", expect, items)
+	}
+}
+
+func TestListMessages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+	member := `SELECT user_a, user_b FROM conversations WHERE id = \?`
+
+	mock.ExpectQuery(member).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"user_a", "user_b"}).AddRow("a", "b"))
+	mock.ExpectQuery(`SELECT m.id, m.sender_id, u.username, m.body, m.created_at, m.is_read FROM messages m`).
+		WithArgs(3, 10, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sender_id", "username", "body", "created_at", "is_read"}).
+			AddRow(10, "b", "bob", "hi", "2023-01-02 03:04:05", true))
+
+	items, err := repo.ListMessages("a", 3, 0, 10)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	expect := []Message{{
+		ID:             10,
+		ConversationID: 3,
+		Sender:         user.NewUser("b", "bob", ""),
+		Body:           "hi",
+		Created:        time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		Read:           true,
+	}}
+	if !reflect.DeepEqual(items, expect) {
+		t.Errorf("results not match, want %v, have %v", expect, items)
+	}
+
+	// outsiders can not tell the conversation exists
+	mock.ExpectQuery(member).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"user_a", "user_b"}).AddRow("a", "b"))
+	if _, err = repo.ListMessages("c", 3, 0, 10); err != ErrNoConversation {
+		t.Errorf("expected ErrNoConversation, got %v", err)
+	}
+	mock.ExpectQuery(member).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"user_a", "user_b"}))
+	if err = repo.MarkRead("a", 4); err != ErrNoConversation {
+		t.Errorf("expected ErrNoConversation, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCounts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	mock.ExpectQuery(`SELECT user_a, user_b FROM conversations WHERE id = \?`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"user_a", "user_b"}).AddRow("a", "b"))
+	mock.ExpectExec(`UPDATE messages SET is_read = 1 WHERE conversation_id = \? AND recipient_id = \? AND is_read = 0`).
+		WithArgs(3, "a").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	if err := repo.MarkRead("a", 3); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM messages WHERE recipient_id = \? AND is_read = 0`).
+		WithArgs("a").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	if count, err := repo.UnreadCount("a"); err != nil || count != 5 {
+		t.Errorf("expected 5 unread, got %v, %v", count, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestExportUserData(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	mock.ExpectQuery(`SELECT m.id, m.conversation_id, m.sender_id, u.username, m.body, m.created_at, m.is_read FROM messages m`).
+		WithArgs("a", "a").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "conversation_id", "sender_id", "username", "body", "created_at", "is_read"}).
+			AddRow(10, 3, "b", "bob", "hi", "2023-01-02 03:04:05", true).
+			AddRow(11, 3, "a", "alice", "hello", "2023-01-02 03:05:00", false))
+	items, err := repo.ExportUserData("a")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(items) != 2 || items[0].ConversationID != 3 || items[1].Sender.Username != "alice" {
+		t.Errorf("unexpected messages %+v", items)
+	}
+
+	mock.ExpectQuery(`SELECT m.id`).WillReturnError(fmt.Errorf("db error"))
+	if _, err = repo.ExportUserData("a"); err == nil {
+		t.Errorf("expected error")
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -1,21 +1,183 @@
 package middleware
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
+const combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+type AccessLogConfig struct {
+	// SampleRate is the share of successful requests written to the logger,
+	// from 0 to 1. Responses with status >= 400 are always logged.
+	SampleRate float64
+	// Combined receives every request in Apache combined log format, if set.
+	Combined io.Writer
+}
+
+// responseRecorder remembers what was sent to the client, so AccessLog can
+// report it after the handler returns.
+type responseRecorder struct {
+	http.ResponseWriter
+	status   int
+	size     int
+	userID   string
+	username string
+	route    string
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(p)
+	rec.size += n
+	return n, err
+}
+
+func (rec *responseRecorder) Flush() {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("underlying ResponseWriter is not a http.Hijacker")
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+func (rec *responseRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// setLogUser attaches the authenticated user to the access log entry
+// of the current request.
+func setLogUser(w http.ResponseWriter, userID, username string) {
+	if rec, ok := w.(*responseRecorder); ok {
+		rec.userID = userID
+		rec.username = username
+	}
+}
+
+// RecordRoute is a mux middleware that stores the matched route template
+// in the access log entry.
+func RecordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rec, ok := w.(*responseRecorder); ok {
+			if route := mux.CurrentRoute(r); route != nil {
+				rec.route, _ = route.GetPathTemplate()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func AccessLog(logger *zap.SugaredLogger, next http.Handler) http.Handler {
+	return AccessLogWithConfig(logger, AccessLogConfig{SampleRate: 1}, next)
+}
+
+func AccessLogWithConfig(logger *zap.SugaredLogger, cfg AccessLogConfig, next http.Handler) http.Handler {
+	mu := &sync.Mutex{}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
-		logger.Infow("New request",
-			"method", r.Method,
-			"remote_addr", r.RemoteAddr,
-			"url", r.URL.Path,
-			"time", time.Since(start),
-		)
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.Status()
+		if status >= http.StatusBadRequest || sampled(cfg.SampleRate) {
+			logger.Infow("New request",
+				"method", r.Method,
+				"remote_addr", r.RemoteAddr,
+				"url", r.URL.Path,
+				"route", rec.route,
+				"status", status,
+				"size", rec.size,
+				"user_id", rec.userID,
+				"user_agent", r.UserAgent(),
+				"time", time.Since(start),
+			)
+		}
+
+		if cfg.Combined != nil {
+			mu.Lock()
+			_, err := io.WriteString(cfg.Combined, combinedLine(r, rec, start))
+			mu.Unlock()
+			if err != nil {
+				logger.Error("fail to write combined access log: ", err)
+			}
+		}
 	})
 }
+
+func sampled(rate float64) bool {
+	switch {
+	case rate >= 1:
+		return true
+	case rate <= 0:
+		return false
+	}
+	return rand.Float64() < rate
+}
+
+func combinedLine(r *http.Request, rec *responseRecorder, start time.Time) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	size := "-"
+	if rec.size > 0 {
+		size = fmt.Sprint(rec.size)
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		host,
+		orDash(rec.username),
+		start.Format(combinedTimeFormat),
+		r.Method,
+		r.URL.RequestURI(),
+		r.Proto,
+		rec.Status(),
+		size,
+		quoteEscape(orDash(r.Referer())),
+		quoteEscape(orDash(r.UserAgent())),
+	)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func quoteEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
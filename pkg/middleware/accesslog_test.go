@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/user"
+)
+
+type stubSessions struct {
+	sess session.Session
+}
+
+func (s stubSessions) Create(u user.User) (string, error) {
+	return "", nil
+}
+
+func (s stubSessions) Check(r *http.Request) (session.Session, error) {
+	return s.sess, nil
+}
+
+func TestAccessLogRecordsResponse(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	combined := &bytes.Buffer{}
+
+	sm := stubSessions{sess: session.NewSession("token", user.NewUser("42", "rick", ""))}
+	router := mux.NewRouter()
+	router.Use(RecordRoute)
+	router.Handle("/api/post/{POST_ID}", Auth(sm, http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+			_, _ = w.Write([]byte("hello"))
+		},
+	)))
+
+	handler := AccessLogWithConfig(
+		zap.New(core).Sugar(),
+		AccessLogConfig{SampleRate: 0, Combined: combined},
+		router,
+	)
+
+	r := httptest.NewRequest("GET", "/api/post/1?x=y", nil)
+	r.Header.Set("User-Agent", "tester")
+	r.Header.Set("Referer", "http://example.com/")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	// status >= 400 is logged despite zero sample rate
+	entries := logs.All()
+	if !assert.Len(t, entries, 1) {
+		return
+	}
+	fields := entries[0].ContextMap()
+	assert.Equal(t, int64(http.StatusTeapot), fields["status"])
+	assert.Equal(t, int64(5), fields["size"])
+	assert.Equal(t, "42", fields["user_id"])
+	assert.Equal(t, "tester", fields["user_agent"])
+	assert.Equal(t, "/api/post/{POST_ID}", fields["route"])
+
+	line := combined.String()
+	assert.True(t, strings.HasPrefix(line, "192.0.2.1 - rick ["), line)
+	assert.Contains(t, line, `"GET /api/post/1?x=y HTTP/1.1" 418 5 "http://example.com/" "tester"`)
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	handler := AccessLogWithConfig(
+		zap.New(core).Sugar(),
+		AccessLogConfig{SampleRate: 0},
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Len(t, logs.All(), 0)
+
+	handler = AccessLog(zap.New(core).Sugar(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if assert.Len(t, logs.All(), 1) {
+		assert.Equal(t, int64(http.StatusOK), logs.All()[0].ContextMap()["status"])
+	}
+}
+
+func TestResponseRecorderFlushHijack(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &responseRecorder{ResponseWriter: w}
+
+	var flusher http.Flusher = rec
+	flusher.Flush()
+	assert.True(t, w.Flushed)
+	assert.Equal(t, http.StatusOK, rec.Status())
+
+	var hijacker http.Hijacker = rec
+	_, _, err := hijacker.Hijack()
+	assert.NotNil(t, err)
+}
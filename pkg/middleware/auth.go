@@ -7,14 +7,46 @@ import (
 	"github.com/greatjudge/redditclone/pkg/session"
 )
 
-func Auth(sm session.SessionsManager, next http.Handler) http.Handler {
+// Auth lets through only requests with a valid token. Sessions of API
+// tokens must also have every one of the scopes, routes without scopes
+// are closed to them.
+func Auth(sm session.SessionsManager, next http.Handler, scopes ...string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		sess, err := sm.Check(r)
 		if err != nil {
 			sending.SendJSONMessage(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if !sess.Allows(scopes...) {
+			sendForbiddenScope(w)
+			return
+		}
+		setLogUser(w, sess.User.ID, sess.User.Username)
+		ctx := session.ContextWithSession(r.Context(), sess)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// OptionalAuth adds the session to the context when the request carries
+// a valid token, other requests pass through as anonymous. Scopes are
+// checked as in Auth.
+func OptionalAuth(sm session.SessionsManager, next http.Handler, scopes ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := sm.Check(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !sess.Allows(scopes...) {
+			sendForbiddenScope(w)
+			return
+		}
+		setLogUser(w, sess.User.ID, sess.User.Username)
 		ctx := session.ContextWithSession(r.Context(), sess)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+func sendForbiddenScope(w http.ResponseWriter) {
+	sending.SendJSONMessage(w, "not allowed with this api token", http.StatusForbidden)
+}
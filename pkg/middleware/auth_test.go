@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/user"
+)
+
+func TestAuthScopes(t *testing.T) {
+	u := user.NewUser("42", "rick", "")
+	login := session.NewSession("token", u)
+	token := session.Session{User: u, APIToken: true, Scopes: []string{"read", "vote"}}
+	// a token whose scopes were all lost reaches nothing
+	empty := session.Session{User: u, APIToken: true}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	cases := []struct {
+		name   string
+		sess   session.Session
+		scopes []string
+		code   int
+	}{
+		{"login without scopes", login, nil, http.StatusTeapot},
+		{"login with scopes", login, []string{"post"}, http.StatusTeapot},
+		{"token with scope", token, []string{"vote"}, http.StatusTeapot},
+		{"token without scope", token, []string{"post"}, http.StatusForbidden},
+		{"token on session only route", token, nil, http.StatusForbidden},
+		{"token without scopes", empty, []string{"read"}, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, mw := range []func(session.SessionsManager, http.Handler, ...string) http.Handler{Auth, OptionalAuth} {
+				w := httptest.NewRecorder()
+				mw(stubSessions{sess: tc.sess}, ok, tc.scopes...).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+				assert.Equal(t, tc.code, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/mail"
+	"github.com/greatjudge/redditclone/pkg/periodic"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+)
+
+var digestActions = map[string]string{
+	KindComment: "commented on your post",
+	KindReply:   "replied to your comment on post",
+	KindMention: "mentioned you on post",
+}
+
+// Digest builds one email summing up the notifications, newest first as
+// List and PendingDigest return them. It is sent through any mail.Mailer.
+func Digest(to string, notifications []Notification) mail.Message {
+	body := &strings.Builder{}
+	fmt.Fprintf(body, "You have %v new notifications:\n\n", len(notifications))
+	for _, n := range notifications {
+		fmt.Fprintf(
+			body,
+			"- %v u/%v %v %v\n",
+			n.Created.Format("2006-01-02 15:04"),
+			n.Actor.Username,
+			digestActions[n.Kind],
+			n.PostID,
+		)
+	}
+	return mail.Message{
+		To:      to,
+		Subject: fmt.Sprintf("%v new notifications", len(notifications)),
+		Body:    body.String(),
+	}
+}
+
+// MaxDigestSize caps how many notifications one digest email lists.
+const MaxDigestSize = 50
+
+// EmailFinder resolves the email of a user, user.UserRepo implements it.
+type EmailFinder interface {
+	GetEmail(userID string) (user.Email, error)
+}
+
+// Digester periodically emails users with a verified email a digest of
+// their unread notifications they were not emailed about yet.
+type Digester struct {
+	Notifications NotificationRepo
+	Users         EmailFinder
+	Mailer        mail.Mailer
+	Logger        *zap.SugaredLogger
+	loop          *periodic.Loop
+}
+
+func NewDigester(
+	notifications NotificationRepo,
+	users EmailFinder,
+	mailer mail.Mailer,
+	logger *zap.SugaredLogger,
+	interval time.Duration,
+) *Digester {
+	d := &Digester{
+		Notifications: notifications,
+		Users:         users,
+		Mailer:        mailer,
+		Logger:        logger,
+	}
+	d.loop = periodic.NewLoop(d.run, periodic.Config{Interval: interval})
+	return d
+}
+
+// Run sends the pending digests once and returns the number of sent emails.
+// A digest that fails to send is retried by the next run.
+func (d *Digester) Run() (int, error) {
+	userIDs, err := d.Notifications.DigestUsers()
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, userID := range userIDs {
+		ok, err := d.send(userID)
+		if err != nil {
+			d.Logger.Errorf("fail to send digest to %v: %v", userID, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// send emails the digest of the user if they have a verified email, the
+// notifications are not digested again either way.
+func (d *Digester) send(userID string) (bool, error) {
+	notifications, err := d.Notifications.PendingDigest(userID, MaxDigestSize)
+	if err != nil || len(notifications) == 0 {
+		return false, err
+	}
+	email, err := d.Users.GetEmail(userID)
+	switch {
+	case errors.Is(err, user.ErrNoEmail) || errors.Is(err, user.ErrNoUser):
+	case err != nil:
+		return false, err
+	case email.Verified:
+		if err = d.Mailer.Send(Digest(email.Address, notifications)); err != nil {
+			return false, err
+		}
+	}
+	// the newest come first, older pending ones past the cap are dropped too
+	if err = d.Notifications.MarkDigested(userID, notifications[0].ID); err != nil {
+		return false, err
+	}
+	return email.Verified, nil
+}
+
+// Start sends digests periodically until ctx is done.
+func (d *Digester) Start(ctx context.Context) {
+	d.loop.Start(ctx)
+}
+
+// Wait blocks until the loop started by Start has stopped.
+func (d *Digester) Wait() {
+	d.loop.Wait()
+}
+
+func (d *Digester) run() {
+	sent, err := d.Run()
+	if err != nil {
+		d.Logger.Errorf("fail to send digests: %v", err)
+		return
+	}
+	if sent > 0 {
+		d.Logger.Infof("sent %v notification digests", sent)
+	}
+}
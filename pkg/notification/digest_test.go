@@ -0,0 +1,66 @@
+package notification
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/greatjudge/redditclone/pkg/mail"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDigestMessage(t *testing.T) {
+	created := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	msg := Digest("u@example.com", []Notification{
+		{Kind: KindReply, Actor: user.User{Username: "bob"}, PostID: "p2", Created: created},
+		{Kind: KindComment, Actor: user.User{Username: "alice"}, PostID: "p1", Created: created},
+	})
+	assert.Equal(t, "u@example.com", msg.To)
+	assert.Equal(t, "2 new notifications", msg.Subject)
+	assert.Equal(t, "You have 2 new notifications:\n\n"+
+		"- 2023-01-02 03:04 u/bob replied to your comment on post p2\n"+
+		"- 2023-01-02 03:04 u/alice commented on your post p1\n", msg.Body)
+}
+
+func TestDigesterRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	notifications := NewMockNotificationRepo(ctrl)
+	users := user.NewMockUserRepo(ctrl)
+	out := &bytes.Buffer{}
+	d := NewDigester(notifications, users, mail.NewLogMailer(out), zap.NewNop().Sugar(), time.Hour)
+
+	pending := []Notification{
+		{ID: 9, Kind: KindReply, Actor: user.User{Username: "bob"}, PostID: "p2"},
+		{ID: 7, Kind: KindComment, Actor: user.User{Username: "bob"}, PostID: "p1"},
+	}
+	notifications.EXPECT().DigestUsers().Return([]string{"a", "b", "c", "d"}, nil)
+	// a verified email gets the digest
+	notifications.EXPECT().PendingDigest("a", MaxDigestSize).Return(pending, nil)
+	users.EXPECT().GetEmail("a").Return(user.Email{Address: "a@example.com", Verified: true}, nil)
+	notifications.EXPECT().MarkDigested("a", int64(9)).Return(nil)
+	// an unverified email or none is skipped for good
+	notifications.EXPECT().PendingDigest("b", MaxDigestSize).Return(pending[1:], nil)
+	users.EXPECT().GetEmail("b").Return(user.Email{Address: "b@example.com"}, nil)
+	notifications.EXPECT().MarkDigested("b", int64(7)).Return(nil)
+	notifications.EXPECT().PendingDigest("c", MaxDigestSize).Return(pending, nil)
+	users.EXPECT().GetEmail("c").Return(user.Email{}, user.ErrNoEmail)
+	notifications.EXPECT().MarkDigested("c", int64(9)).Return(nil)
+	// a failure is retried by the next run
+	notifications.EXPECT().PendingDigest("d", MaxDigestSize).Return(pending, nil)
+	users.EXPECT().GetEmail("d").Return(user.Email{}, fmt.Errorf("db error"))
+
+	sent, err := d.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Contains(t, out.String(), "To: a@example.com\nSubject: 2 new notifications")
+	assert.NotContains(t, out.String(), "b@example.com")
+
+	notifications.EXPECT().DigestUsers().Return(nil, fmt.Errorf("db error"))
+	_, err = d.Run()
+	assert.NotNil(t, err)
+}
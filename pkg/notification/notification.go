@@ -0,0 +1,77 @@
+package notification
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/user"
+)
+
+const (
+	KindComment = "comment"
+	KindReply   = "reply"
+	KindMention = "mention"
+)
+
+// MaxMentions caps how many users one comment can notify by mentioning them.
+const MaxMentions = 10
+
+var ErrNoNotification = errors.New("no notification found")
+
+type Notification struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"-"`
+	Kind      string    `json:"kind"`
+	Actor     user.User `json:"actor"`
+	PostID    string    `json:"post_id"`
+	CommentID string    `json:"comment_id"`
+	Created   time.Time `json:"created"`
+	Read      bool      `json:"read"`
+}
+
+//go:generate mockgen -source=notification.go -destination=repo_mock.go -package=notification NotificationRepo
+type NotificationRepo interface {
+	Add(notifications []Notification) error
+	// List returns the newest notifications of the user first.
+	List(userID string, unreadOnly bool, offset, limit int) ([]Notification, error)
+	MarkRead(userID string, id int64) error
+	MarkAllRead(userID string) error
+	UnreadCount(userID string) (int, error)
+	// EraseActor replaces a deleted account in notifications it caused.
+	EraseActor(userID string, erased user.User) error
+	// ExportUserData returns the notifications of the user, oldest first.
+	ExportUserData(userID string) ([]Notification, error)
+	// DigestUsers returns the users with unread notifications not in a
+	// digest yet.
+	DigestUsers() ([]string, error)
+	// PendingDigest returns the unread notifications of the user not in a
+	// digest yet, newest first.
+	PendingDigest(userID string, limit int) ([]Notification, error)
+	// MarkDigested keeps the notifications of the user up to lastID out of
+	// later digests.
+	MarkDigested(userID string, lastID int64) error
+}
+
+// mentionRe matches u/username not preceded by a word character or a slash,
+// so links like example.com/u/name are not mentions.
+var mentionRe = regexp.MustCompile(`(?:^|[^\w/])u/([a-zA-Z0-9_]+)`)
+
+// Mentions returns the unique usernames mentioned in the text in order.
+func Mentions(text string) []string {
+	usernames := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, match := range mentionRe.FindAllStringSubmatch(text, -1) {
+		key := strings.ToLower(match[1])
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		usernames = append(usernames, match[1])
+		if len(usernames) == MaxMentions {
+			break
+		}
+	}
+	return usernames
+}
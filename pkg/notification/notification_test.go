@@ -0,0 +1,27 @@
+package notification
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMentions(t *testing.T) {
+	cases := []struct {
+		text   string
+		expect []string
+	}{
+		{"hi u/alice and u/bob_2!", []string{"alice", "bob_2"}},
+		{"u/alice at the start, again u/Alice", []string{"alice"}},
+		{"see https://example.com/u/alice or mu/bob", []string{}},
+		{"(u/carol)", []string{"carol"}},
+		{"no mentions", []string{}},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.expect, Mentions(tc.text), tc.text)
+	}
+
+	many := strings.Repeat("u/a u/b u/c u/d u/e u/f ", 2) + "u/g u/h u/i u/j u/k u/l"
+	assert.Len(t, Mentions(many), MaxMentions)
+}
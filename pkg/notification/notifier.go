@@ -0,0 +1,126 @@
+package notification
+
+import (
+	"errors"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+)
+
+// UserFinder resolves mentioned usernames.
+type UserFinder interface {
+	GetByUsername(username string) (user.User, error)
+}
+
+// BlockChecker tells whether userID blocked otherID.
+type BlockChecker interface {
+	IsBlocked(userID, otherID string) (bool, error)
+}
+
+// PostRepo notifies about new comments on top of a post.PostRepo.
+// Failing to notify is logged and does not fail the comment.
+type PostRepo struct {
+	post.PostRepo
+	Notifications NotificationRepo
+	Users         UserFinder
+	Blocks        BlockChecker
+	Logger        *zap.SugaredLogger
+}
+
+func NewPostRepo(
+	repo post.PostRepo,
+	notifications NotificationRepo,
+	users UserFinder,
+	blocks BlockChecker,
+	logger *zap.SugaredLogger,
+) *PostRepo {
+	return &PostRepo{
+		PostRepo:      repo,
+		Notifications: notifications,
+		Users:         users,
+		Blocks:        blocks,
+		Logger:        logger,
+	}
+}
+
+func (repo *PostRepo) AddComment(postID string, comm comment.Comment) (comment.Comment, error) {
+	added, err := repo.PostRepo.AddComment(postID, comm)
+	if err != nil {
+		return added, err
+	}
+	notifications := repo.commentNotifications(postID, added)
+	if err := repo.Notifications.Add(notifications); err != nil {
+		repo.Logger.Errorf("fail to notify about comment %v: %v", added.ID, err)
+	}
+	return added, nil
+}
+
+// commentNotifications gives one notification per recipient, a reply wins
+// over a comment on the post, which wins over a mention.
+func (repo *PostRepo) commentNotifications(postID string, comm comment.Comment) []Notification {
+	recipients := make([]string, 0)
+	kinds := make(map[string]string)
+	add := func(userID, kind string) {
+		if userID == "" || userID == comm.Author.ID || kinds[userID] != "" {
+			return
+		}
+		recipients = append(recipients, userID)
+		kinds[userID] = kind
+	}
+
+	if comm.ParentID != "" {
+		parent, err := repo.PostRepo.GetComment(postID, comm.ParentID)
+		if err != nil {
+			repo.Logger.Errorf("fail to find parent of comment %v: %v", comm.ID, err)
+		}
+		add(parent.Author.ID, KindReply)
+	}
+	p, err := repo.PostRepo.GetByID(postID)
+	if err != nil {
+		repo.Logger.Errorf("fail to find post %v: %v", postID, err)
+	}
+	add(p.Author.ID, KindComment)
+	for _, username := range Mentions(comm.Body) {
+		mentioned, err := repo.Users.GetByUsername(username)
+		switch {
+		case errors.Is(err, user.ErrNoUser):
+			continue
+		case err != nil:
+			repo.Logger.Errorf("fail to find mentioned user %v: %v", username, err)
+			continue
+		}
+		add(mentioned.ID, KindMention)
+	}
+
+	created := time.Now()
+	notifications := make([]Notification, 0, len(recipients))
+	for _, userID := range recipients {
+		if repo.blocked(userID, comm.Author.ID) {
+			continue
+		}
+		notifications = append(notifications, Notification{
+			UserID:    userID,
+			Kind:      kinds[userID],
+			Actor:     comm.Author,
+			PostID:    postID,
+			CommentID: comm.ID,
+			Created:   created,
+		})
+	}
+	return notifications
+}
+
+func (repo *PostRepo) blocked(userID, actorID string) bool {
+	if repo.Blocks == nil {
+		return false
+	}
+	blocked, err := repo.Blocks.IsBlocked(userID, actorID)
+	if err != nil {
+		repo.Logger.Errorf("fail to check block of %v by %v: %v", actorID, userID, err)
+		return false
+	}
+	return blocked
+}
@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/controls"
+	"github.com/greatjudge/redditclone/pkg/post"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type notifierMocks struct {
+	posts         *post.MockPostRepo
+	notifications *MockNotificationRepo
+	users         *user.MockUserRepo
+	blocks        *controls.MockControlsRepo
+}
+
+func newTestNotifier(ctrl *gomock.Controller) (*PostRepo, notifierMocks) {
+	m := notifierMocks{
+		posts:         post.NewMockPostRepo(ctrl),
+		notifications: NewMockNotificationRepo(ctrl),
+		users:         user.NewMockUserRepo(ctrl),
+		blocks:        controls.NewMockControlsRepo(ctrl),
+	}
+	return NewPostRepo(m.posts, m.notifications, m.users, m.blocks, zap.NewNop().Sugar()), m
+}
+
+func TestAddCommentNotifies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo, m := newTestNotifier(ctrl)
+
+	alice := user.NewUser("a", "alice", "")
+	bob := user.NewUser("b", "bob", "")
+	carol := user.NewUser("c", "carol", "")
+	dave := user.NewUser("d", "dave", "")
+	comm := comment.Comment{
+		Author:   carol,
+		Body:     "u/alice u/dave u/carol u/ghost",
+		ParentID: "c0",
+	}
+
+	var added comment.Comment
+	m.posts.EXPECT().AddComment("p1", gomock.Any()).DoAndReturn(
+		func(postID string, c comment.Comment) (comment.Comment, error) {
+			c.ID, c.PostID = "c1", postID
+			added = c
+			return c, nil
+		})
+	m.posts.EXPECT().GetComment("p1", "c0").Return(comment.Comment{ID: "c0", Author: bob}, nil)
+	m.posts.EXPECT().GetByID("p1").Return(post.Post{ID: "p1", Author: alice}, nil)
+	m.users.EXPECT().GetByUsername("alice").Return(alice, nil)
+	m.users.EXPECT().GetByUsername("dave").Return(dave, nil)
+	m.users.EXPECT().GetByUsername("carol").Return(carol, nil)
+	m.users.EXPECT().GetByUsername("ghost").Return(user.User{}, user.ErrNoUser)
+	m.blocks.EXPECT().IsBlocked("b", "c").Return(false, nil)
+	m.blocks.EXPECT().IsBlocked("a", "c").Return(false, nil)
+	// dave blocked carol and does not hear from her
+	m.blocks.EXPECT().IsBlocked("d", "c").Return(true, nil)
+
+	var notifications []Notification
+	m.notifications.EXPECT().Add(gomock.Any()).DoAndReturn(func(n []Notification) error {
+		notifications = n
+		return nil
+	})
+
+	_, err := repo.AddComment("p1", comm)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, added.ID)
+	if assert.Len(t, notifications, 2) {
+		assert.Equal(t, "b", notifications[0].UserID)
+		assert.Equal(t, KindReply, notifications[0].Kind)
+		assert.Equal(t, "a", notifications[1].UserID)
+		assert.Equal(t, KindComment, notifications[1].Kind)
+		for _, n := range notifications {
+			assert.Equal(t, carol, n.Actor)
+			assert.Equal(t, "p1", n.PostID)
+			assert.Equal(t, added.ID, n.CommentID)
+		}
+	}
+}
+
+func TestAddCommentErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo, m := newTestNotifier(ctrl)
+
+	// nothing is sent when the comment is not added
+	m.posts.EXPECT().AddComment("p1", gomock.Any()).Return(comment.Comment{}, post.ErrNoPost)
+	_, err := repo.AddComment("p1", comment.Comment{Body: "hi"})
+	assert.Equal(t, post.ErrNoPost, err)
+
+	// a failed notification does not fail the comment
+	alice := user.NewUser("a", "alice", "")
+	bob := user.NewUser("b", "bob", "")
+	m.posts.EXPECT().AddComment("p1", gomock.Any()).Return(comment.Comment{ID: "c1", PostID: "p1", Author: bob}, nil)
+	m.posts.EXPECT().GetByID("p1").Return(post.Post{ID: "p1", Author: alice}, nil)
+	m.blocks.EXPECT().IsBlocked("a", "b").Return(false, nil)
+	m.notifications.EXPECT().Add(gomock.Any()).Return(fmt.Errorf("db error"))
+	_, err = repo.AddComment("p1", comment.Comment{Author: bob, Body: "hi"})
+	assert.Nil(t, err)
+
+	// own posts do not notify
+	m.posts.EXPECT().AddComment("p1", gomock.Any()).Return(comment.Comment{ID: "c2", PostID: "p1", Author: alice}, nil)
+	m.posts.EXPECT().GetByID("p1").Return(post.Post{ID: "p1", Author: alice}, nil)
+	m.notifications.EXPECT().Add([]Notification{}).Return(nil)
+	_, err = repo.AddComment("p1", comment.Comment{Author: alice, Body: "hi"})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,180 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: notification.go
+
+// Package notification is a generated GoMock package.
+package notification
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	user "github.com/greatjudge/redditclone/pkg/user"
+)
+
+// MockNotificationRepo is a mock of NotificationRepo interface.
+type MockNotificationRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockNotificationRepoMockRecorder
+}
+
+// MockNotificationRepoMockRecorder is the mock recorder for MockNotificationRepo.
+type MockNotificationRepoMockRecorder struct {
+	mock *MockNotificationRepo
+}
+
+// NewMockNotificationRepo creates a new mock instance.
+func NewMockNotificationRepo(ctrl *gomock.Controller) *MockNotificationRepo {
+	mock := &MockNotificationRepo{ctrl: ctrl}
+	mock.recorder = &MockNotificationRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNotificationRepo) EXPECT() *MockNotificationRepoMockRecorder {
+	return m.recorder
+}
+
+// Add mocks base method.
+func (m *MockNotificationRepo) Add(notifications []Notification) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Add", notifications)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Add indicates an expected call of Add.
+func (mr *MockNotificationRepoMockRecorder) Add(notifications interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockNotificationRepo)(nil).Add), notifications)
+}
+
+// DigestUsers mocks base method.
+func (m *MockNotificationRepo) DigestUsers() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DigestUsers")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DigestUsers indicates an expected call of DigestUsers.
+func (mr *MockNotificationRepoMockRecorder) DigestUsers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DigestUsers", reflect.TypeOf((*MockNotificationRepo)(nil).DigestUsers))
+}
+
+// EraseActor mocks base method.
+func (m *MockNotificationRepo) EraseActor(userID string, erased user.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EraseActor", userID, erased)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EraseActor indicates an expected call of EraseActor.
+func (mr *MockNotificationRepoMockRecorder) EraseActor(userID, erased interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EraseActor", reflect.TypeOf((*MockNotificationRepo)(nil).EraseActor), userID, erased)
+}
+
+// ExportUserData mocks base method.
+func (m *MockNotificationRepo) ExportUserData(userID string) ([]Notification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportUserData", userID)
+	ret0, _ := ret[0].([]Notification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportUserData indicates an expected call of ExportUserData.
+func (mr *MockNotificationRepoMockRecorder) ExportUserData(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportUserData", reflect.TypeOf((*MockNotificationRepo)(nil).ExportUserData), userID)
+}
+
+// List mocks base method.
+func (m *MockNotificationRepo) List(userID string, unreadOnly bool, offset, limit int) ([]Notification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", userID, unreadOnly, offset, limit)
+	ret0, _ := ret[0].([]Notification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockNotificationRepoMockRecorder) List(userID, unreadOnly, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockNotificationRepo)(nil).List), userID, unreadOnly, offset, limit)
+}
+
+// MarkAllRead mocks base method.
+func (m *MockNotificationRepo) MarkAllRead(userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkAllRead", userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkAllRead indicates an expected call of MarkAllRead.
+func (mr *MockNotificationRepoMockRecorder) MarkAllRead(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkAllRead", reflect.TypeOf((*MockNotificationRepo)(nil).MarkAllRead), userID)
+}
+
+// MarkDigested mocks base method.
+func (m *MockNotificationRepo) MarkDigested(userID string, lastID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkDigested", userID, lastID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkDigested indicates an expected call of MarkDigested.
+func (mr *MockNotificationRepoMockRecorder) MarkDigested(userID, lastID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkDigested", reflect.TypeOf((*MockNotificationRepo)(nil).MarkDigested), userID, lastID)
+}
+
+// MarkRead mocks base method.
+func (m *MockNotificationRepo) MarkRead(userID string, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkRead", userID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkRead indicates an expected call of MarkRead.
+func (mr *MockNotificationRepoMockRecorder) MarkRead(userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkRead", reflect.TypeOf((*MockNotificationRepo)(nil).MarkRead), userID, id)
+}
+
+// PendingDigest mocks base method.
+func (m *MockNotificationRepo) PendingDigest(userID string, limit int) ([]Notification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PendingDigest", userID, limit)
+	ret0, _ := ret[0].([]Notification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PendingDigest indicates an expected call of PendingDigest.
+func (mr *MockNotificationRepoMockRecorder) PendingDigest(userID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PendingDigest", reflect.TypeOf((*MockNotificationRepo)(nil).PendingDigest), userID, limit)
+}
+
+// UnreadCount mocks base method.
+func (m *MockNotificationRepo) UnreadCount(userID string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnreadCount", userID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UnreadCount indicates an expected call of UnreadCount.
+func (mr *MockNotificationRepoMockRecorder) UnreadCount(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnreadCount", reflect.TypeOf((*MockNotificationRepo)(nil).UnreadCount), userID)
+}
@@ -0,0 +1,215 @@
+package notification
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/greatjudge/redditclone/pkg/user"
+)
+
+const mysqlDatetimeFormat = "2006-01-02 15:04:05"
+
+type NotificationMysqlRepository struct {
+	DB     *sql.DB
+	Logger *zap.SugaredLogger
+}
+
+func NewMysqlRepo(db *sql.DB, logger *zap.SugaredLogger) *NotificationMysqlRepository {
+	return &NotificationMysqlRepository{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+func (repo *NotificationMysqlRepository) Add(notifications []Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(notifications))
+	args := make([]interface{}, 0, 7*len(notifications))
+	for i, n := range notifications {
+		placeholders[i] = "(?, ?, ?, ?, ?, ?, ?, TRUE)"
+		args = append(args,
+			n.UserID,
+			n.Kind,
+			n.Actor.ID,
+			n.Actor.Username,
+			n.PostID,
+			n.CommentID,
+			n.Created.UTC().Format(mysqlDatetimeFormat),
+		)
+	}
+	_, err := repo.DB.Exec(
+		"INSERT INTO notifications (`user_id`, `kind`, `actor_id`, `actor_username`, `post_id`, `comment_id`, `created_at`, `digest_pending`) VALUES "+
+			strings.Join(placeholders, ", "),
+		args...,
+	)
+	if err != nil {
+		repo.Logger.Error("in Add notifications: ", err)
+		return err
+	}
+	return nil
+}
+
+const selectNotifications = "SELECT id, kind, actor_id, actor_username, post_id, comment_id, created_at, is_read FROM notifications WHERE user_id = ?"
+
+func (repo *NotificationMysqlRepository) List(userID string, unreadOnly bool, offset, limit int) ([]Notification, error) {
+	query := selectNotifications
+	if unreadOnly {
+		query += " AND is_read = 0"
+	}
+	rows, err := repo.DB.Query(query+" ORDER BY id DESC LIMIT ? OFFSET ?", userID, limit, offset)
+	if err != nil {
+		repo.Logger.Error("in List notifications: ", err)
+		return nil, err
+	}
+	return scanNotifications(rows, userID)
+}
+
+func scanNotifications(rows *sql.Rows, userID string) ([]Notification, error) {
+	defer rows.Close()
+
+	notifications := make([]Notification, 0)
+	for rows.Next() {
+		n, created := Notification{UserID: userID}, ""
+		err := rows.Scan(&n.ID, &n.Kind, &n.Actor.ID, &n.Actor.Username, &n.PostID, &n.CommentID, &created, &n.Read)
+		if err != nil {
+			return nil, fmt.Errorf("fail to scan notification: %w", err)
+		}
+		n.Created, err = time.Parse(mysqlDatetimeFormat, created)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse created_at: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (repo *NotificationMysqlRepository) MarkRead(userID string, id int64) error {
+	result, err := repo.DB.Exec(
+		"UPDATE notifications SET is_read = 1 WHERE id = ? AND user_id = ?",
+		id,
+		userID,
+	)
+	if err != nil {
+		repo.Logger.Error("in MarkRead: ", err)
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != 0 {
+		return nil
+	}
+	// mysql counts changed rows only, a notification read before is not missing
+
+	count := 0
+	err = repo.DB.
+		QueryRow("SELECT COUNT(*) FROM notifications WHERE id = ? AND user_id = ?", id, userID).
+		Scan(&count)
+	if err != nil {
+		repo.Logger.Error("in MarkRead: ", err)
+		return err
+	}
+	if count == 0 {
+		return ErrNoNotification
+	}
+	return nil
+}
+
+func (repo *NotificationMysqlRepository) MarkAllRead(userID string) error {
+	_, err := repo.DB.Exec("UPDATE notifications SET is_read = 1 WHERE user_id = ? AND is_read = 0", userID)
+	if err != nil {
+		repo.Logger.Error("in MarkAllRead: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *NotificationMysqlRepository) UnreadCount(userID string) (int, error) {
+	count := 0
+	err := repo.DB.
+		QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND is_read = 0", userID).
+		Scan(&count)
+	if err != nil {
+		repo.Logger.Error("in UnreadCount: ", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (repo *NotificationMysqlRepository) EraseActor(userID string, erased user.User) error {
+	_, err := repo.DB.Exec(
+		"UPDATE notifications SET actor_id = ?, actor_username = ? WHERE actor_id = ?",
+		erased.ID,
+		erased.Username,
+		userID,
+	)
+	if err != nil {
+		repo.Logger.Error("in EraseActor: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *NotificationMysqlRepository) ExportUserData(userID string) ([]Notification, error) {
+	rows, err := repo.DB.Query(
+		selectNotifications+" ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		repo.Logger.Error("in ExportUserData notifications: ", err)
+		return nil, err
+	}
+	return scanNotifications(rows, userID)
+}
+
+func (repo *NotificationMysqlRepository) DigestUsers() ([]string, error) {
+	rows, err := repo.DB.Query("SELECT DISTINCT user_id FROM notifications WHERE digest_pending = TRUE AND is_read = 0")
+	if err != nil {
+		repo.Logger.Error("in DigestUsers: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := make([]string, 0)
+	for rows.Next() {
+		userID := ""
+		if err = rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("fail to scan user id: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+func (repo *NotificationMysqlRepository) PendingDigest(userID string, limit int) ([]Notification, error) {
+	rows, err := repo.DB.Query(
+		selectNotifications+" AND is_read = 0 AND digest_pending = TRUE ORDER BY id DESC LIMIT ?",
+		userID,
+		limit,
+	)
+	if err != nil {
+		repo.Logger.Error("in PendingDigest: ", err)
+		return nil, err
+	}
+	return scanNotifications(rows, userID)
+}
+
+func (repo *NotificationMysqlRepository) MarkDigested(userID string, lastID int64) error {
+	_, err := repo.DB.Exec(
+		"UPDATE notifications SET digest_pending = FALSE WHERE user_id = ? AND id <= ? AND digest_pending = TRUE",
+		userID,
+		lastID,
+	)
+	if err != nil {
+		repo.Logger.Error("in MarkDigested: ", err)
+		return err
+	}
+	return nil
+}
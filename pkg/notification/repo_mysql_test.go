@@ -0,0 +1,243 @@
+package notification
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestAdd(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+	created := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	actor := user.NewUser("c", "carol", "")
+
+	if err := repo.Add(nil); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+	mock.ExpectExec(`INSERT INTO notifications .* VALUES \(\?, \?, \?, \?, \?, \?, \?, TRUE\), \(\?, \?, \?, \?, \?, \?, \?, TRUE\)`).
+		WithArgs(
+			"a", KindComment, "c", "carol", "p1", "c1", "2023-01-02 03:04:05",
+			"b", KindReply, "c", "carol", "p1", "c1", "2023-01-02 03:04:05",
+		).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	err = repo.Add([]Notification{
+		{UserID: "a", Kind: KindComment, Actor: actor, PostID: "p1", CommentID: "c1", Created: created},
+		{UserID: "b", Kind: KindReply, Actor: actor, PostID: "p1", CommentID: "c1", Created: created},
+	})
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	rows := sqlmock.NewRows([]string{"id", "kind", "actor_id", "actor_username", "post_id", "comment_id", "created_at", "is_read"}).
+		AddRow(7, KindMention, "c", "carol", "p1", "c1", "2023-01-02 03:04:05", false)
+	mock.ExpectQuery(`SELECT .* FROM notifications WHERE user_id = \? AND is_read = 0 ORDER BY id DESC LIMIT \? OFFSET \?`).
+		WithArgs("a", 10, 0).
+		WillReturnRows(rows)
+
+	items, err := repo.List("a", true, 0, 10)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	expect := []Notification{{
+		ID:        7,
+		UserID:    "a",
+		Kind:      KindMention,
+		Actor:     user.NewUser("c", "carol", ""),
+		PostID:    "p1",
+		CommentID: "c1",
+		Created:   time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+	}}
+	if !reflect.DeepEqual(items, expect) {
+		t.Errorf("results not match, want %v, have %v", expect, items)
+	}
+}
+
+func TestMarkRead(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	mock.ExpectExec(`UPDATE notifications SET is_read = 1 WHERE id = \? AND user_id = \?`).
+		WithArgs(1, "a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.MarkRead("a", 1); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+
+	// already read
+	mock.ExpectExec(`UPDATE notifications`).
+		WithArgs(2, "a").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM notifications WHERE id = \? AND user_id = \?`).
+		WithArgs(2, "a").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	if err := repo.MarkRead("a", 2); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+
+	// someone else's
+	mock.ExpectExec(`UPDATE notifications`).
+		WithArgs(3, "a").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM notifications`).
+		WithArgs(3, "a").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	if err := repo.MarkRead("a", 3); err != ErrNoNotification {
+		t.Errorf("expected ErrNoNotification, got %v", err)
+	}
+
+	mock.ExpectExec(`UPDATE notifications SET is_read = 1 WHERE user_id = \? AND is_read = 0`).
+		WithArgs("a").
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	if err := repo.MarkAllRead("a"); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM notifications WHERE user_id = \? AND is_read = 0`).
+		WithArgs("a").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+	if count, err := repo.UnreadCount("a"); err != nil || count != 4 {
+		t.Errorf("expected 4 unread, got %v, %v", count, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestEraseActor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	mock.ExpectExec(`UPDATE notifications SET actor_id = \?, actor_username = \? WHERE actor_id = \?`).
+		WithArgs("", "[deleted]", "c").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	if err := repo.EraseActor("c", user.User{Username: "[deleted]"}); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+
+	mock.ExpectExec(`UPDATE notifications`).
+		WithArgs("", "[deleted]", "c").
+		WillReturnError(fmt.Errorf("db error"))
+	if err := repo.EraseActor("c", user.User{Username: "[deleted]"}); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestExportUserData(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	rows := sqlmock.NewRows([]string{"id", "kind", "actor_id", "actor_username", "post_id", "comment_id", "created_at", "is_read"}).
+		AddRow(1, KindComment, "c", "carol", "p1", "c1", "2023-01-02 03:04:05", true).
+		AddRow(2, KindReply, "d", "dave", "p1", "c2", "2023-01-03 03:04:05", false)
+	mock.ExpectQuery(`SELECT .* FROM notifications WHERE user_id = \? ORDER BY id$`).
+		WithArgs("a").
+		WillReturnRows(rows)
+	items, err := repo.ExportUserData("a")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(items) != 2 || items[0].ID != 1 || !items[0].Read || items[1].Actor.Username != "dave" {
+		t.Errorf("unexpected notifications: %v", items)
+	}
+
+	mock.ExpectQuery(`SELECT .* FROM notifications`).
+		WithArgs("a").
+		WillReturnError(fmt.Errorf("db error"))
+	if _, err = repo.ExportUserData("a"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	mock.ExpectQuery(`SELECT DISTINCT user_id FROM notifications WHERE digest_pending = TRUE AND is_read = 0`).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("a").AddRow("b"))
+	userIDs, err := repo.DigestUsers()
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if !reflect.DeepEqual(userIDs, []string{"a", "b"}) {
+		t.Errorf("unexpected users: %v", userIDs)
+	}
+
+	rows := sqlmock.NewRows([]string{"id", "kind", "actor_id", "actor_username", "post_id", "comment_id", "created_at", "is_read"}).
+		AddRow(9, KindReply, "c", "carol", "p1", "c2", "2023-01-03 03:04:05", false).
+		AddRow(7, KindMention, "c", "carol", "p1", "c1", "2023-01-02 03:04:05", false)
+	mock.ExpectQuery(`SELECT .* FROM notifications WHERE user_id = \? AND is_read = 0 AND digest_pending = TRUE ORDER BY id DESC LIMIT \?`).
+		WithArgs("a", MaxDigestSize).
+		WillReturnRows(rows)
+	items, err := repo.PendingDigest("a", MaxDigestSize)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(items) != 2 || items[0].ID != 9 || items[1].Kind != KindMention {
+		t.Errorf("unexpected notifications: %v", items)
+	}
+
+	mock.ExpectExec(`UPDATE notifications SET digest_pending = FALSE WHERE user_id = \? AND id <= \?`).
+		WithArgs("a", 9).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	if err = repo.MarkDigested("a", 9); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+
+	mock.ExpectQuery(`SELECT DISTINCT user_id`).WillReturnError(fmt.Errorf("db error"))
+	if _, err = repo.DigestUsers(); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,13 @@
+package oidc
+
+import "errors"
+
+var ErrAlreadyLinked = errors.New("identity already linked")
+
+//go:generate mockgen -source=identity.go -destination=identity_mock.go -package=oidc IdentityRepo
+type IdentityRepo interface {
+	// FindUser returns the user the subject of the issuer is linked to,
+	// or ErrNoIdentity.
+	FindUser(issuer, subject string) (string, error)
+	Link(issuer, subject, userID string) error
+}
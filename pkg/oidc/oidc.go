@@ -0,0 +1,265 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrBadIDToken = errors.New("invalid id token")
+	ErrNoIdentity = errors.New("no linked identity found")
+)
+
+// Config is the client registration at the provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// Claims are what the relying party reads from a verified ID token.
+type Claims struct {
+	Issuer            string `json:"iss"`
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+type idToken struct {
+	Claims
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	Nonce     string   `json:"nonce"`
+}
+
+// Valid is left to Provider.verify, it knows the expected values and
+// the clock.
+func (t *idToken) Valid() error {
+	return nil
+}
+
+// audience is a single string or a list of strings in ID tokens.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	single := ""
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect provider seen by a relying party using
+// the authorization code flow with PKCE.
+type Provider struct {
+	cfg       Config
+	client    *http.Client
+	endpoints discovery
+	mu        *sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	now       func() time.Time
+}
+
+// NewProvider reads the provider metadata from its discovery document.
+func NewProvider(ctx context.Context, cfg Config, client *http.Client) (*Provider, error) {
+	p := &Provider{
+		cfg:    cfg,
+		client: client,
+		mu:     &sync.Mutex{},
+		keys:   make(map[string]*rsa.PublicKey),
+		now:    time.Now,
+	}
+	wellKnown := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &p.endpoints); err != nil {
+		return nil, fmt.Errorf("fail to discover %v: %w", cfg.Issuer, err)
+	}
+	if p.endpoints.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("discovery of %v names issuer %v", cfg.Issuer, p.endpoints.Issuer)
+	}
+	return p, nil
+}
+
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+// NewState returns a random value for the state and nonce parameters.
+func NewState() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("fail to read random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Challenge is the S256 PKCE challenge of the verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL is where the user signs in at the provider. The verifier is
+// kept by the relying party until Exchange.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", Challenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(p.endpoints.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.endpoints.AuthorizationEndpoint + sep + query.Encode()
+}
+
+// Exchange trades the code from the redirect for an ID token and returns
+// its claims once verified.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoints.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Claims{}, fmt.Errorf("fail to request token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Claims{}, fmt.Errorf("token endpoint answered %v", resp.Status)
+	}
+	tokens := struct {
+		IDToken string `json:"id_token"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return Claims{}, fmt.Errorf("fail to decode token response: %w", err)
+	}
+	return p.verify(ctx, tokens.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	token := &idToken{}
+	parser := &jwt.Parser{ValidMethods: []string{"RS256"}}
+	_, err := parser.ParseWithClaims(rawIDToken, token, func(parsed *jwt.Token) (interface{}, error) {
+		kid, _ := parsed.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrBadIDToken, err)
+	}
+	switch {
+	case token.Issuer != p.cfg.Issuer:
+		return Claims{}, fmt.Errorf("%w: issuer %v", ErrBadIDToken, token.Issuer)
+	case !token.Audience.contains(p.cfg.ClientID):
+		return Claims{}, fmt.Errorf("%w: audience %v", ErrBadIDToken, token.Audience)
+	case token.ExpiresAt <= p.now().Unix():
+		return Claims{}, fmt.Errorf("%w: expired", ErrBadIDToken)
+	case token.Nonce != nonce:
+		return Claims{}, fmt.Errorf("%w: nonce does not match", ErrBadIDToken)
+	case token.Subject == "":
+		return Claims{}, fmt.Errorf("%w: no subject", ErrBadIDToken)
+	}
+	return token.Claims, nil
+}
+
+// key returns the signing key by id, the key set is fetched again when
+// the provider rotates to an unknown key.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	set := struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}{}
+	if err := p.getJSON(ctx, p.endpoints.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fail to fetch keys: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.keys = keys
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, target string, obj any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v answered %v", target, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(obj)
+}
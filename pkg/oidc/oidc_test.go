@@ -0,0 +1,103 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Provider) {
+	fake := oidctest.NewProvider("client", "secret")
+	t.Cleanup(fake.Close)
+	p, err := NewProvider(context.Background(), Config{
+		Issuer:       fake.Issuer(),
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/api/oidc/callback",
+	}, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("cant discover provider: %v", err)
+	}
+	return p, fake
+}
+
+func TestAuthCodeFlow(t *testing.T) {
+	p, fake := newTestProvider(t)
+	alice := oidctest.User{Subject: "alice-id", Email: "alice@example.com", EmailVerified: true, PreferredUsername: "alice"}
+
+	authURL, err := url.Parse(p.AuthCodeURL("state", "nonce", "verifier"))
+	assert.Nil(t, err)
+	query := authURL.Query()
+	assert.Equal(t, fake.Issuer()+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, Challenge("verifier"), query.Get("code_challenge"))
+	assert.NotContains(t, authURL.String(), "verifier")
+
+	back, err := fake.Login(authURL.String(), alice)
+	assert.Nil(t, err)
+	assert.Equal(t, "state", back.Query().Get("state"))
+	claims, err := p.Exchange(context.Background(), back.Query().Get("code"), "verifier", "nonce")
+	assert.Nil(t, err)
+	assert.Equal(t, Claims{
+		Issuer:            fake.Issuer(),
+		Subject:           "alice-id",
+		Email:             "alice@example.com",
+		EmailVerified:     true,
+		PreferredUsername: "alice",
+	}, claims)
+
+	// the code is single use
+	_, err = p.Exchange(context.Background(), back.Query().Get("code"), "verifier", "nonce")
+	assert.NotNil(t, err)
+
+	// a code stolen without the verifier is useless
+	back, _ = fake.Login(p.AuthCodeURL("state", "nonce", "verifier"), alice)
+	_, err = p.Exchange(context.Background(), back.Query().Get("code"), "other verifier", "nonce")
+	assert.NotNil(t, err)
+
+	back, _ = fake.Login(p.AuthCodeURL("state", "nonce", "verifier"), alice)
+	_, err = p.Exchange(context.Background(), back.Query().Get("code"), "verifier", "other nonce")
+	assert.True(t, errors.Is(err, ErrBadIDToken))
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	p, fake := newTestProvider(t)
+	alice := oidctest.User{Subject: "alice-id"}
+	exchange := func() error {
+		back, err := fake.Login(p.AuthCodeURL("state", "nonce", "verifier"), alice)
+		if err != nil {
+			return err
+		}
+		_, err = p.Exchange(context.Background(), back.Query().Get("code"), "verifier", "nonce")
+		return err
+	}
+
+	// tokens live an hour
+	p.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	assert.True(t, errors.Is(exchange(), ErrBadIDToken))
+	p.now = time.Now
+	assert.Nil(t, exchange())
+
+	// a token signed by a key the provider did not publish
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	fake.Key = other
+	assert.True(t, errors.Is(exchange(), ErrBadIDToken))
+}
+
+func TestNewProviderChecksIssuer(t *testing.T) {
+	fake := oidctest.NewProvider("client", "secret")
+	defer fake.Close()
+
+	// the discovery document is found, but names the issuer without the slash
+	_, err := NewProvider(context.Background(), Config{Issuer: fake.Issuer() + "/"}, http.DefaultClient)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,54 @@
+package oidc
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+)
+
+type IdentityMysqlRepo struct {
+	DB     *sql.DB
+	Logger *zap.SugaredLogger
+}
+
+func NewIdentityMysqlRepo(db *sql.DB, logger *zap.SugaredLogger) *IdentityMysqlRepo {
+	return &IdentityMysqlRepo{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+func (repo *IdentityMysqlRepo) FindUser(issuer, subject string) (string, error) {
+	userID := ""
+	err := repo.DB.
+		QueryRow("SELECT user_id FROM external_identities WHERE issuer = ? AND subject = ?", issuer, subject).
+		Scan(&userID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "", ErrNoIdentity
+	case err != nil:
+		repo.Logger.Error("in FindUser: ", err)
+		return "", err
+	}
+	return userID, nil
+}
+
+func (repo *IdentityMysqlRepo) Link(issuer, subject, userID string) error {
+	_, err := repo.DB.Exec(
+		"INSERT INTO external_identities (`issuer`, `subject`, `user_id`) VALUES (?, ?, ?)",
+		issuer,
+		subject,
+		userID,
+	)
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == 1062:
+		return ErrAlreadyLinked
+	case err != nil:
+		repo.Logger.Error("in Link: ", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package oidc
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestIdentityRepo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := NewIdentityMysqlRepo(db, zap.NewNop().Sugar())
+	find := `SELECT user_id FROM external_identities WHERE issuer = \? AND subject = \?`
+
+	mock.ExpectQuery(find).WithArgs("https://idp", "alice-id").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("1"))
+	userID, err := repo.FindUser("https://idp", "alice-id")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", userID)
+
+	mock.ExpectQuery(find).WithArgs("https://idp", "bob-id").WillReturnError(sql.ErrNoRows)
+	_, err = repo.FindUser("https://idp", "bob-id")
+	assert.Equal(t, ErrNoIdentity, err)
+
+	mock.ExpectExec("INSERT INTO external_identities").WithArgs("https://idp", "bob-id", "2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, repo.Link("https://idp", "bob-id", "2"))
+
+	mock.ExpectExec("INSERT INTO external_identities").WithArgs("https://idp", "bob-id", "3").
+		WillReturnError(&mysql.MySQLError{Number: 1062})
+	assert.Equal(t, ErrAlreadyLinked, repo.Link("https://idp", "bob-id", "3"))
+
+	mock.ExpectExec("INSERT INTO external_identities").WillReturnError(fmt.Errorf("db error"))
+	assert.NotNil(t, repo.Link("https://idp", "bob-id", "3"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,170 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+//go:embed openapi.json
+var document []byte
+
+type Spec struct {
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+
+	// operations by path and lower-case method, resolved by Load
+	operations map[string]map[string]Operation
+}
+
+// PathItem maps lower-case HTTP methods to operations; path level
+// parameters are ignored since only bodies are validated.
+type PathItem map[string]json.RawMessage
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+type Operation struct {
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+type Discriminator struct {
+	PropertyName string            `json:"propertyName"`
+	Mapping      map[string]string `json:"mapping"`
+}
+
+type Schema struct {
+	Ref           string             `json:"$ref"`
+	Type          string             `json:"type"`
+	Format        string             `json:"format"`
+	Pattern       string             `json:"pattern"`
+	Enum          []any              `json:"enum"`
+	Required      []string           `json:"required"`
+	Properties    map[string]*Schema `json:"properties"`
+	Items         *Schema            `json:"items"`
+	OneOf         []*Schema          `json:"oneOf"`
+	Discriminator *Discriminator     `json:"discriminator"`
+	MinLength     *int               `json:"minLength"`
+	MaxLength     *int               `json:"maxLength"`
+	MinItems      *int               `json:"minItems"`
+	MaxItems      *int               `json:"maxItems"`
+	Minimum       *float64           `json:"minimum"`
+	Maximum       *float64           `json:"maximum"`
+
+	// pattern is compiled by Load
+	pattern *regexp.Regexp
+}
+
+// Document returns the raw OpenAPI document served to clients.
+func Document() []byte {
+	return document
+}
+
+// Load parses the document, resolves its operations and compiles schema
+// patterns, so that requests are validated without decoding anything again.
+func Load() (*Spec, error) {
+	spec := &Spec{}
+	err := json.Unmarshal(document, spec)
+	if err != nil {
+		return nil, fmt.Errorf("fail to unmarshal openapi document: %w", err)
+	}
+	spec.operations = make(map[string]map[string]Operation, len(spec.Paths))
+	for path, item := range spec.Paths {
+		ops := make(map[string]Operation)
+		for _, method := range methods {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			op := Operation{}
+			if err = json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("fail to unmarshal %v %v: %w", method, path, err)
+			}
+			if op.RequestBody != nil {
+				for _, media := range op.RequestBody.Content {
+					if err = compilePatterns(media.Schema); err != nil {
+						return nil, fmt.Errorf("in %v %v: %w", method, path, err)
+					}
+				}
+			}
+			ops[method] = op
+		}
+		spec.operations[path] = ops
+	}
+	for name, schema := range spec.Components.Schemas {
+		if err = compilePatterns(schema); err != nil {
+			return nil, fmt.Errorf("in schema %v: %w", name, err)
+		}
+	}
+	return spec, nil
+}
+
+// compilePatterns compiles patterns of the schema and the schemas nested
+// in it, references are compiled with the components.
+func compilePatterns(schema *Schema) error {
+	if schema == nil {
+		return nil
+	}
+	if schema.Pattern != "" && schema.pattern == nil {
+		re, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return fmt.Errorf("fail to compile pattern %v: %w", schema.Pattern, err)
+		}
+		schema.pattern = re
+	}
+	nested := append([]*Schema{schema.Items}, schema.OneOf...)
+	for _, prop := range schema.Properties {
+		nested = append(nested, prop)
+	}
+	for _, n := range nested {
+		if err := compilePatterns(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Operation finds the operation registered for a mux path template and method.
+func (s *Spec) Operation(path, method string) (Operation, bool) {
+	op, ok := s.operations[path][strings.ToLower(method)]
+	return op, ok
+}
+
+func (s *Spec) resolve(schema *Schema) (*Schema, error) {
+	for schema != nil && schema.Ref != "" {
+		name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/")
+		if !ok {
+			return nil, fmt.Errorf("unsupported $ref %v", schema.Ref)
+		}
+		schema, ok = s.Components.Schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown schema %v", name)
+		}
+	}
+	return schema, nil
+}
+
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write(document)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,288 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"github.com/greatjudge/redditclone/pkg/sending"
+)
+
+const bodyLocation = "body"
+
+// maxBodySize caps JSON bodies read for validation, the largest documented
+// body, a text post, is far below it.
+const maxBodySize = 1 << 20
+
+// ValidateBody checks a decoded JSON document against the schema and returns
+// one error per offending field.
+func (s *Spec) ValidateBody(data any, schema *Schema) []sending.FieldError {
+	errs := make([]sending.FieldError, 0)
+	s.validate(data, schema, "", &errs)
+	return errs
+}
+
+func (s *Spec) validate(data any, schema *Schema, param string, errs *[]sending.FieldError) {
+	schema, err := s.resolve(schema)
+	if err != nil || schema == nil {
+		addError(errs, param, data, "schema error")
+		return
+	}
+
+	if len(schema.OneOf) != 0 {
+		s.validateOneOf(data, schema, param, errs)
+		return
+	}
+
+	if schema.Type != "" && !hasType(data, schema.Type) {
+		addError(errs, param, data, "must be of type "+schema.Type)
+		return
+	}
+	if len(schema.Enum) != 0 && !inEnum(data, schema.Enum) {
+		addError(errs, param, data, "must be one of "+joinEnum(schema.Enum))
+		return
+	}
+
+	switch val := data.(type) {
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := val[name]; !ok {
+				addError(errs, joinParam(param, name), nil, "is required")
+			}
+		}
+		for name, prop := range schema.Properties {
+			if fieldVal, ok := val[name]; ok {
+				s.validate(fieldVal, prop, joinParam(param, name), errs)
+			}
+		}
+	case []any:
+		if schema.MinItems != nil && len(val) < *schema.MinItems {
+			addError(errs, param, nil, fmt.Sprintf("must contain at least %d items", *schema.MinItems))
+		}
+		if schema.MaxItems != nil && len(val) > *schema.MaxItems {
+			addError(errs, param, nil, fmt.Sprintf("must contain at most %d items", *schema.MaxItems))
+		}
+		if schema.Items != nil {
+			for i, item := range val {
+				s.validate(item, schema.Items, joinParam(param, strconv.Itoa(i)), errs)
+			}
+		}
+	case string:
+		validateString(val, schema, param, errs)
+	case float64:
+		if schema.Minimum != nil && val < *schema.Minimum {
+			addError(errs, param, val, fmt.Sprintf("must be at least %v", *schema.Minimum))
+		}
+		if schema.Maximum != nil && val > *schema.Maximum {
+			addError(errs, param, val, fmt.Sprintf("must be at most %v", *schema.Maximum))
+		}
+	}
+}
+
+func (s *Spec) validateOneOf(data any, schema *Schema, param string, errs *[]sending.FieldError) {
+	if d := schema.Discriminator; d != nil {
+		obj, ok := data.(map[string]any)
+		if !ok {
+			addError(errs, param, data, "must be of type object")
+			return
+		}
+		prop := joinParam(param, d.PropertyName)
+		kind, ok := obj[d.PropertyName].(string)
+		if !ok {
+			addError(errs, prop, obj[d.PropertyName], "is required")
+			return
+		}
+		ref, ok := d.Mapping[kind]
+		if !ok {
+			kinds := make([]any, 0, len(d.Mapping))
+			for k := range d.Mapping {
+				kinds = append(kinds, k)
+			}
+			addError(errs, prop, kind, "must be one of "+joinEnum(kinds))
+			return
+		}
+		s.validate(data, &Schema{Ref: ref}, param, errs)
+		return
+	}
+
+	matched := 0
+	for _, variant := range schema.OneOf {
+		if len(s.ValidateBody(data, variant)) == 0 {
+			matched++
+		}
+	}
+	if matched != 1 {
+		addError(errs, param, nil, "must match exactly one schema")
+	}
+}
+
+// validateString reports only the first failed check, one error per field.
+func validateString(val string, schema *Schema, param string, errs *[]sending.FieldError) {
+	if msg := checkString(val, schema); msg != "" {
+		addError(errs, param, val, msg)
+	}
+}
+
+func checkString(val string, schema *Schema) string {
+	length := utf8.RuneCountInString(val)
+	switch {
+	case schema.MinLength != nil && length < *schema.MinLength:
+		if *schema.MinLength == 1 {
+			return "is required"
+		}
+		return fmt.Sprintf("must be at least %d characters long", *schema.MinLength)
+	case schema.MaxLength != nil && length > *schema.MaxLength:
+		return fmt.Sprintf("must be at most %d characters long", *schema.MaxLength)
+	case schema.Format == "uri" && !isURI(val):
+		return "is invalid"
+	case schema.Format == "date-time" && !isDateTime(val):
+		return "must be an RFC 3339 date-time"
+	}
+	if schema.pattern != nil && !schema.pattern.MatchString(val) {
+		return "has invalid format"
+	}
+	return ""
+}
+
+func isURI(val string) bool {
+	u, err := url.ParseRequestURI(val)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+func isDateTime(val string) bool {
+	_, err := time.Parse(time.RFC3339, val)
+	return err == nil
+}
+
+func hasType(data any, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := data.(map[string]any)
+		return ok
+	case "array":
+		_, ok := data.([]any)
+		return ok
+	case "string":
+		_, ok := data.(string)
+		return ok
+	case "boolean":
+		_, ok := data.(bool)
+		return ok
+	case "number":
+		_, ok := data.(float64)
+		return ok
+	case "integer":
+		num, ok := data.(float64)
+		return ok && num == float64(int64(num))
+	}
+	return true
+}
+
+func inEnum(data any, enum []any) bool {
+	for _, v := range enum {
+		if v == data {
+			return true
+		}
+	}
+	return false
+}
+
+func joinEnum(enum []any) string {
+	vals := make([]string, len(enum))
+	for i, v := range enum {
+		vals[i] = fmt.Sprint(v)
+	}
+	return strings.Join(vals, ", ")
+}
+
+func joinParam(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func addError(errs *[]sending.FieldError, param string, value any, msg string) {
+	*errs = append(*errs, sending.FieldError{
+		Location: bodyLocation,
+		Param:    param,
+		Value:    value,
+		Msg:      msg,
+	})
+}
+
+// Validate is a mux middleware rejecting JSON bodies that do not match
+// the request schema of the matched operation.
+func Validate(spec *Spec) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			schema := spec.requestSchema(r)
+			if schema == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > maxBodySize {
+				sending.SendJSONMessage(w, "body is too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+			switch {
+			case err != nil && len(body) == maxBodySize:
+				// chunked bodies have no length to check upfront
+				sending.SendJSONMessage(w, "body is too large", http.StatusRequestEntityTooLarge)
+				return
+			case err != nil:
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			var data any
+			if err = json.Unmarshal(body, &data); err != nil {
+				sending.SendJSONMessage(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			if errs := spec.ValidateBody(data, schema); len(errs) != 0 {
+				sending.SendFieldErrors(w, errs)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s *Spec) requestSchema(r *http.Request) *Schema {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return nil
+	}
+	path, err := route.GetPathTemplate()
+	if err != nil {
+		return nil
+	}
+	op, ok := s.Operation(path, r.Method)
+	if !ok || op.RequestBody == nil {
+		return nil
+	}
+	// other documented media types, e.g. multipart uploads, are left to handlers
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if _, documented := op.RequestBody.Content[mediaType]; err == nil && documented && mediaType != "application/json" {
+		return nil
+	}
+	media, ok := op.RequestBody.Content["application/json"]
+	if !ok {
+		return nil
+	}
+	return media.Schema
+}
@@ -0,0 +1,244 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/greatjudge/redditclone/pkg/sending"
+)
+
+func newTestRouter(t *testing.T) (*mux.Router, *string) {
+	spec, err := Load()
+	if err != nil {
+		t.Fatalf("fail to load spec: %v", err)
+	}
+	received := new(string)
+	router := mux.NewRouter()
+	router.Use(Validate(spec))
+	router.HandleFunc("/api/posts", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*received = string(body)
+		w.WriteHeader(http.StatusCreated)
+	}).Methods("POST")
+	router.HandleFunc("/api/post/{POST_ID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+	return router, received
+}
+
+func TestValidateNewPost(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   string
+		code   int
+		params []string
+	}{
+		{
+			name: "text post",
+			body: `{"type":"text","title":"t","category":"music","text":"hello"}`,
+			code: http.StatusCreated,
+		},
+		{
+			name: "link post",
+			body: `{"type":"link","title":"t","category":"music","url":"https://example.com/a?b=c"}`,
+			code: http.StatusCreated,
+		},
+		{
+			name:   "unknown type",
+			body:   `{"type":"video","title":"t","category":"music"}`,
+			code:   http.StatusUnprocessableEntity,
+			params: []string{"type"},
+		},
+		{
+			name:   "bad url",
+			body:   `{"type":"link","title":"t","category":"music","url":"not a url"}`,
+			code:   http.StatusUnprocessableEntity,
+			params: []string{"url"},
+		},
+		{
+			name:   "url of another scheme",
+			body:   `{"type":"link","title":"t","category":"music","url":"ftp://example.com/a"}`,
+			code:   http.StatusUnprocessableEntity,
+			params: []string{"url"},
+		},
+		{
+			name:   "missing url and empty title",
+			body:   `{"type":"link","title":"","category":"music"}`,
+			code:   http.StatusUnprocessableEntity,
+			params: []string{"title", "url"},
+		},
+		{
+			name:   "wrong field type",
+			body:   `{"type":"text","title":5,"category":"music"}`,
+			code:   http.StatusUnprocessableEntity,
+			params: []string{"title"},
+		},
+		{
+			name: "poll post",
+			body: `{"type":"poll","title":"q","category":"music","options":["a","b"],"closes_at":"2030-01-02T15:04:05Z"}`,
+			code: http.StatusCreated,
+		},
+		{
+			name:   "poll with one option and bad closing time",
+			body:   `{"type":"poll","title":"q","category":"music","options":["a"],"closes_at":"tomorrow"}`,
+			code:   http.StatusUnprocessableEntity,
+			params: []string{"options", "closes_at"},
+		},
+		{
+			name: "broken json",
+			body: `{"type":`,
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			router, received := newTestRouter(t)
+			r := httptest.NewRequest("POST", "/api/posts", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.code, w.Code)
+			if tc.code == http.StatusCreated {
+				assert.Equal(t, tc.body, *received, "handler must get the original body")
+			}
+			if tc.params == nil {
+				return
+			}
+			resp := sending.FieldErrors{}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("cant unmarshal response: %v", err)
+			}
+			params := make([]string, 0, len(resp.Errors))
+			for _, e := range resp.Errors {
+				params = append(params, e.Param)
+			}
+			assert.ElementsMatch(t, tc.params, params)
+		})
+	}
+}
+
+func TestValidateBodyTooLarge(t *testing.T) {
+	router, _ := newTestRouter(t)
+	text := strings.Repeat("a", maxBodySize)
+	body := `{"type":"text","title":"t","category":"music","text":"` + text + `"}`
+
+	r := httptest.NewRequest("POST", "/api/posts", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// a chunked body has no length and is cut while read
+	r = httptest.NewRequest("POST", "/api/posts", strings.NewReader(body))
+	r.ContentLength = -1
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestLoadCompilesPatterns(t *testing.T) {
+	spec, err := Load()
+	if err != nil {
+		t.Fatalf("fail to load spec: %v", err)
+	}
+	schema, err := spec.resolve(&Schema{Ref: "#/components/schemas/NewLinkPost"})
+	if assert.Nil(t, err) && assert.NotNil(t, schema.Properties["url"]) {
+		assert.NotNil(t, schema.Properties["url"].pattern)
+	}
+	op, ok := spec.Operation("/api/posts", "POST")
+	assert.True(t, ok)
+	assert.NotNil(t, op.RequestBody)
+	_, ok = spec.Operation("/api/posts", "PATCH")
+	assert.False(t, ok)
+}
+
+func TestValidateSkipsOperationsWithoutBody(t *testing.T) {
+	router, _ := newTestRouter(t)
+	r := httptest.NewRequest("GET", "/api/post/1", strings.NewReader("not json"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestValidateSkipsMultipart(t *testing.T) {
+	router, received := newTestRouter(t)
+	body := "--b\r\nContent-Disposition: form-data; name=\"type\"\r\n\r\nimage\r\n--b--\r\n"
+	r := httptest.NewRequest("POST", "/api/posts", strings.NewReader(body))
+	r.Header.Set("Content-Type", "multipart/form-data; boundary=b")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, body, *received)
+}
+
+func TestSpecCoversRoutes(t *testing.T) {
+	spec, err := Load()
+	if err != nil {
+		t.Fatalf("fail to load spec: %v", err)
+	}
+	routes := map[string][]string{
+		"/api/register":                            {"POST"},
+		"/api/login":                               {"POST"},
+		"/api/posts/":                              {"GET"},
+		"/api/posts":                               {"POST"},
+		"/api/posts/{CATEGORY_NAME}":               {"GET"},
+		"/api/post/{POST_ID}":                      {"GET", "POST", "DELETE"},
+		"/api/post/{POST_ID}/{COMMENT_ID}":         {"DELETE"},
+		"/api/post/{POST_ID}/comments":             {"GET"},
+		"/api/post/{POST_ID}/upvote":               {"GET"},
+		"/api/post/{POST_ID}/downvote":             {"GET"},
+		"/api/post/{POST_ID}/unvote":               {"GET"},
+		"/api/user/{USER_LOGIN}":                   {"GET"},
+		"/api/files/{KEY}":                         {"GET"},
+		"/api/post/{POST_ID}/poll/{OPTION}":        {"POST"},
+		"/api/user/{USER_LOGIN}/profile":           {"GET"},
+		"/api/me/profile":                          {"PUT"},
+		"/api/me":                                  {"DELETE"},
+		"/api/me/export":                           {"GET"},
+		"/api/me/password":                         {"POST"},
+		"/api/password/reset":                      {"POST"},
+		"/api/password/reset/confirm":              {"POST"},
+		"/api/post/{POST_ID}/save":                 {"POST"},
+		"/api/post/{POST_ID}/unsave":               {"POST"},
+		"/api/post/{POST_ID}/{COMMENT_ID}/save":    {"POST"},
+		"/api/post/{POST_ID}/{COMMENT_ID}/unsave":  {"POST"},
+		"/api/post/{POST_ID}/restore":              {"POST"},
+		"/api/post/{POST_ID}/{COMMENT_ID}/restore": {"POST"},
+		"/api/saved":                               {"GET"},
+		"/api/post/{POST_ID}/hide":                 {"POST"},
+		"/api/post/{POST_ID}/unhide":               {"POST"},
+		"/api/user/{USER_LOGIN}/block":             {"POST"},
+		"/api/user/{USER_LOGIN}/unblock":           {"POST"},
+		"/api/me/blocked":                          {"GET"},
+		"/api/me/tokens":                           {"GET", "POST"},
+		"/api/me/tokens/{TOKEN_ID}":                {"DELETE"},
+		"/api/me/role":                             {"GET"},
+		"/api/user/{USER_LOGIN}/role":              {"PUT"},
+		"/api/user/{USER_LOGIN}/ban":               {"POST"},
+		"/api/user/{USER_LOGIN}/unban":             {"POST"},
+		"/api/oidc/login":                          {"GET"},
+		"/api/oidc/callback":                       {"GET"},
+		"/api/me/oidc/link":                        {"POST"},
+	}
+	for path, methods := range routes {
+		for _, method := range methods {
+			_, ok := spec.Operation(path, method)
+			assert.True(t, ok, "%v %v is not described", method, path)
+		}
+	}
+}
+
+func TestHandlerServesDocument(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.True(t, json.Valid(w.Body.Bytes()))
+}
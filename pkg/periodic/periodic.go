@@ -0,0 +1,61 @@
+package periodic
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Interval time.Duration
+	// RunFirst runs the job right away on Start.
+	RunFirst bool
+	// RunLast runs the job once more after ctx is done, for jobs that
+	// must not lose buffered work on shutdown.
+	RunLast bool
+}
+
+// Loop runs a background job every interval, the jobs of a loop never
+// overlap.
+type Loop struct {
+	cfg Config
+	job func()
+	wg  *sync.WaitGroup
+}
+
+func NewLoop(job func(), cfg Config) *Loop {
+	return &Loop{
+		cfg: cfg,
+		job: job,
+		wg:  &sync.WaitGroup{},
+	}
+}
+
+// Start runs the job periodically until ctx is done.
+func (l *Loop) Start(ctx context.Context) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(l.cfg.Interval)
+		defer ticker.Stop()
+		if l.cfg.RunFirst {
+			l.job()
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				if l.cfg.RunLast {
+					l.job()
+				}
+				return
+			case <-ticker.C:
+				l.job()
+			}
+		}
+	}()
+}
+
+// Wait blocks until the loop started by Start has stopped.
+func (l *Loop) Wait() {
+	l.wg.Wait()
+}
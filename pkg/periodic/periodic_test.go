@@ -0,0 +1,45 @@
+package periodic
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunFirst(t *testing.T) {
+	runs := int32(0)
+	loop := NewLoop(func() { atomic.AddInt32(&runs, 1) }, Config{Interval: time.Hour, RunFirst: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	loop.Start(ctx)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) == 1 }, time.Second, time.Millisecond)
+	cancel()
+	loop.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+}
+
+func TestRunLast(t *testing.T) {
+	runs := int32(0)
+	loop := NewLoop(func() { atomic.AddInt32(&runs, 1) }, Config{Interval: time.Hour, RunLast: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	loop.Start(ctx)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&runs))
+	cancel()
+	loop.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+}
+
+func TestStops(t *testing.T) {
+	runs := int32(0)
+	loop := NewLoop(func() { atomic.AddInt32(&runs, 1) }, Config{Interval: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	loop.Start(ctx)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 2 }, time.Second, time.Millisecond)
+	cancel()
+	loop.Wait()
+	stopped := atomic.LoadInt32(&runs)
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, stopped, atomic.LoadInt32(&runs))
+}
@@ -0,0 +1,166 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/greatjudge/redditclone/pkg/user"
+)
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Roles go from the lowest to the highest.
+var Roles = []Role{RoleUser, RoleModerator, RoleAdmin}
+
+// Permission lets a role act on resources of other users.
+type Permission string
+
+const (
+	PostDeleteAny     Permission = "post.delete.any"
+	PostRestoreAny    Permission = "post.restore.any"
+	CommentRemove     Permission = "comment.remove"
+	CommentRestoreAny Permission = "comment.restore.any"
+	RoleAssign        Permission = "role.assign"
+	UserBan           Permission = "user.ban"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser:      {},
+	RoleModerator: {PostDeleteAny, PostRestoreAny, CommentRemove, CommentRestoreAny, UserBan},
+	RoleAdmin:     {PostDeleteAny, PostRestoreAny, CommentRemove, CommentRestoreAny, UserBan, RoleAssign},
+}
+
+// Action is what a handler asks to do with a resource.
+type Action string
+
+const (
+	DeletePost     Action = "post.delete"
+	RestorePost    Action = "post.restore"
+	DeleteComment  Action = "comment.delete"
+	RestoreComment Action = "comment.restore"
+	AssignRole     Action = "role.assign"
+	BanUser        Action = "user.ban"
+)
+
+// rule allows an action to the owner of the resource, if owner is set,
+// and to roles with the permission.
+type rule struct {
+	owner      bool
+	permission Permission
+}
+
+var rules = map[Action]rule{
+	DeletePost:     {owner: true, permission: PostDeleteAny},
+	RestorePost:    {owner: true, permission: PostRestoreAny},
+	DeleteComment:  {owner: true, permission: CommentRemove},
+	RestoreComment: {owner: true, permission: CommentRestoreAny},
+	AssignRole:     {permission: RoleAssign},
+	BanUser:        {permission: UserBan},
+}
+
+var (
+	ErrForbidden   = errors.New("action is not allowed")
+	ErrUnknownRole = errors.New("unknown role")
+	ErrLastAdmin   = errors.New("can not take the role of the last admin")
+	ErrBanned      = errors.New("user is banned")
+)
+
+// Resource is what an action is done to, only its owner matters so far.
+type Resource struct {
+	OwnerID string
+}
+
+// Owned is a resource of the user.
+func Owned(ownerID string) Resource {
+	return Resource{OwnerID: ownerID}
+}
+
+//go:generate mockgen -source=policy.go -destination=repo_mock.go -package=policy RoleRepo
+type RoleRepo interface {
+	// Role is RoleUser for users never given another role.
+	Role(userID string) (Role, error)
+	// SetRole returns ErrLastAdmin instead of leaving no admin.
+	SetRole(userID string, role Role) error
+	Count(role Role) (int, error)
+}
+
+// BanRepo keeps banned users, Sessions refuses them.
+type BanRepo interface {
+	Ban(userID string) error
+	Unban(userID string) error
+	IsBanned(userID string) (bool, error)
+}
+
+// Policy decides who may do what, repositories do not check it.
+type Policy struct {
+	Roles RoleRepo
+}
+
+func New(roles RoleRepo) *Policy {
+	return &Policy{Roles: roles}
+}
+
+// Authorize returns ErrForbidden unless the subject may do the action with
+// the resource. Owners are allowed without looking their role up.
+func (p *Policy) Authorize(subject user.User, action Action, resource Resource) error {
+	r, ok := rules[action]
+	if !ok {
+		return fmt.Errorf("no rule for action %v", action)
+	}
+	if r.owner && subject.ID != "" && subject.ID == resource.OwnerID {
+		return nil
+	}
+	role, err := p.Roles.Role(subject.ID)
+	if err != nil {
+		return fmt.Errorf("fail to get role of %v: %w", subject.ID, err)
+	}
+	if !Can(role, r.permission) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Can reports whether the role has the permission.
+func Can(role Role, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions lists what the role may do beyond its own resources.
+func Permissions(role Role) []Permission {
+	return append([]Permission{}, rolePermissions[role]...)
+}
+
+// Outranks reports whether role is strictly higher than other.
+func Outranks(role, other Role) bool {
+	return rank(role) > rank(other)
+}
+
+func rank(role Role) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseRole checks the role is one of Roles.
+func ParseRole(s string) (Role, error) {
+	for _, role := range Roles {
+		if string(role) == s {
+			return role, nil
+		}
+	}
+	return "", ErrUnknownRole
+}
@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorize(t *testing.T) {
+	author := user.User{ID: "1", Username: "author"}
+	other := user.User{ID: "2", Username: "other"}
+	cases := []struct {
+		name    string
+		subject user.User
+		role    Role
+		action  Action
+		err     error
+	}{
+		{"user deletes own post", author, "", DeletePost, nil},
+		{"user deletes post of other", other, RoleUser, DeletePost, ErrForbidden},
+		{"moderator deletes post", other, RoleModerator, DeletePost, nil},
+		{"moderator removes comment", other, RoleModerator, DeleteComment, nil},
+		{"admin restores comment", other, RoleAdmin, RestoreComment, nil},
+		{"moderator assigns role", other, RoleModerator, AssignRole, ErrForbidden},
+		{"admin assigns role", other, RoleAdmin, AssignRole, nil},
+		{"user bans", other, RoleUser, BanUser, ErrForbidden},
+		{"moderator bans", other, RoleModerator, BanUser, nil},
+		{"admin bans", other, RoleAdmin, BanUser, nil},
+		// owning does not help with actions only roles have
+		{"owner assigns role", author, RoleUser, AssignRole, ErrForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			roles := NewMockRoleRepo(ctrl)
+			if tc.role != "" {
+				roles.EXPECT().Role(tc.subject.ID).Return(tc.role, nil)
+			}
+			err := New(roles).Authorize(tc.subject, tc.action, Owned(author.ID))
+			assert.Equal(t, tc.err, err)
+		})
+	}
+}
+
+func TestAuthorizeErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	roles := NewMockRoleRepo(ctrl)
+	p := New(roles)
+
+	roles.EXPECT().Role("2").Return(Role(""), fmt.Errorf("some error"))
+	err := p.Authorize(user.User{ID: "2"}, DeletePost, Owned("1"))
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, ErrForbidden)
+
+	err = p.Authorize(user.User{ID: "1"}, Action("post.pin"), Owned("1"))
+	assert.NotNil(t, err)
+
+	// anonymized content has no owner
+	roles.EXPECT().Role("").Return(RoleUser, nil)
+	assert.Equal(t, ErrForbidden, p.Authorize(user.User{}, DeletePost, Owned("")))
+}
+
+func TestParseRole(t *testing.T) {
+	role, err := ParseRole("moderator")
+	assert.Nil(t, err)
+	assert.Equal(t, RoleModerator, role)
+	_, err = ParseRole("root")
+	assert.Equal(t, ErrUnknownRole, err)
+}
+
+func TestOutranks(t *testing.T) {
+	assert.True(t, Outranks(RoleAdmin, RoleModerator))
+	assert.True(t, Outranks(RoleModerator, RoleUser))
+	assert.False(t, Outranks(RoleModerator, RoleModerator))
+	assert.False(t, Outranks(RoleUser, RoleAdmin))
+}
@@ -0,0 +1,144 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: policy.go
+
+// Package policy is a generated GoMock package.
+package policy
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockRoleRepo is a mock of RoleRepo interface.
+type MockRoleRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockRoleRepoMockRecorder
+}
+
+// MockRoleRepoMockRecorder is the mock recorder for MockRoleRepo.
+type MockRoleRepoMockRecorder struct {
+	mock *MockRoleRepo
+}
+
+// NewMockRoleRepo creates a new mock instance.
+func NewMockRoleRepo(ctrl *gomock.Controller) *MockRoleRepo {
+	mock := &MockRoleRepo{ctrl: ctrl}
+	mock.recorder = &MockRoleRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRoleRepo) EXPECT() *MockRoleRepoMockRecorder {
+	return m.recorder
+}
+
+// Count mocks base method.
+func (m *MockRoleRepo) Count(role Role) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Count", role)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Count indicates an expected call of Count.
+func (mr *MockRoleRepoMockRecorder) Count(role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Count", reflect.TypeOf((*MockRoleRepo)(nil).Count), role)
+}
+
+// Role mocks base method.
+func (m *MockRoleRepo) Role(userID string) (Role, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Role", userID)
+	ret0, _ := ret[0].(Role)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Role indicates an expected call of Role.
+func (mr *MockRoleRepoMockRecorder) Role(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Role", reflect.TypeOf((*MockRoleRepo)(nil).Role), userID)
+}
+
+// SetRole mocks base method.
+func (m *MockRoleRepo) SetRole(userID string, role Role) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetRole", userID, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetRole indicates an expected call of SetRole.
+func (mr *MockRoleRepoMockRecorder) SetRole(userID, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRole", reflect.TypeOf((*MockRoleRepo)(nil).SetRole), userID, role)
+}
+
+// MockBanRepo is a mock of BanRepo interface.
+type MockBanRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockBanRepoMockRecorder
+}
+
+// MockBanRepoMockRecorder is the mock recorder for MockBanRepo.
+type MockBanRepoMockRecorder struct {
+	mock *MockBanRepo
+}
+
+// NewMockBanRepo creates a new mock instance.
+func NewMockBanRepo(ctrl *gomock.Controller) *MockBanRepo {
+	mock := &MockBanRepo{ctrl: ctrl}
+	mock.recorder = &MockBanRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBanRepo) EXPECT() *MockBanRepoMockRecorder {
+	return m.recorder
+}
+
+// Ban mocks base method.
+func (m *MockBanRepo) Ban(userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ban", userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ban indicates an expected call of Ban.
+func (mr *MockBanRepoMockRecorder) Ban(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ban", reflect.TypeOf((*MockBanRepo)(nil).Ban), userID)
+}
+
+// IsBanned mocks base method.
+func (m *MockBanRepo) IsBanned(userID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsBanned", userID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsBanned indicates an expected call of IsBanned.
+func (mr *MockBanRepoMockRecorder) IsBanned(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsBanned", reflect.TypeOf((*MockBanRepo)(nil).IsBanned), userID)
+}
+
+// Unban mocks base method.
+func (m *MockBanRepo) Unban(userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unban", userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unban indicates an expected call of Unban.
+func (mr *MockBanRepoMockRecorder) Unban(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unban", reflect.TypeOf((*MockBanRepo)(nil).Unban), userID)
+}
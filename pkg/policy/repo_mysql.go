@@ -0,0 +1,127 @@
+package policy
+
+import (
+	"database/sql"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+type MysqlRepo struct {
+	DB     *sql.DB
+	Logger *zap.SugaredLogger
+}
+
+func NewMysqlRepo(db *sql.DB, logger *zap.SugaredLogger) *MysqlRepo {
+	return &MysqlRepo{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+func (repo *MysqlRepo) Role(userID string) (Role, error) {
+	role := ""
+	err := repo.DB.QueryRow("SELECT role FROM user_roles WHERE user_id = ?", userID).Scan(&role)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return RoleUser, nil
+	case err != nil:
+		repo.Logger.Error("in Role: ", err)
+		return "", err
+	}
+	return Role(role), nil
+}
+
+// SetRole keeps rows only for roles other than RoleUser.
+func (repo *MysqlRepo) SetRole(userID string, role Role) error {
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		repo.Logger.Error("in SetRole, begin: ", err)
+		return err
+	}
+	if err = repo.setRole(tx, userID, role); err != nil {
+		if !errors.Is(err, ErrLastAdmin) {
+			repo.Logger.Error("in SetRole: ", err)
+		}
+		_ = tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		repo.Logger.Error("in SetRole, commit: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *MysqlRepo) setRole(tx *sql.Tx, userID string, role Role) error {
+	if role != RoleAdmin {
+		// admin rows stay locked till commit, so two admins demoting each
+		// other at once still leave one
+		admins, isAdmin := 0, 0
+		err := tx.
+			QueryRow(
+				"SELECT COUNT(*), COALESCE(SUM(user_id = ?), 0) FROM user_roles WHERE role = ? FOR UPDATE",
+				userID,
+				string(RoleAdmin),
+			).
+			Scan(&admins, &isAdmin)
+		if err != nil {
+			return err
+		}
+		if isAdmin > 0 && admins == 1 {
+			return ErrLastAdmin
+		}
+	}
+	var err error
+	if role == RoleUser {
+		_, err = tx.Exec("DELETE FROM user_roles WHERE user_id = ?", userID)
+	} else {
+		_, err = tx.Exec(
+			"INSERT INTO user_roles (`user_id`, `role`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `role` = VALUES(`role`)",
+			userID,
+			string(role),
+		)
+	}
+	return err
+}
+
+func (repo *MysqlRepo) Count(role Role) (int, error) {
+	count := 0
+	err := repo.DB.QueryRow("SELECT COUNT(*) FROM user_roles WHERE role = ?", string(role)).Scan(&count)
+	if err != nil {
+		repo.Logger.Error("in Count: ", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (repo *MysqlRepo) Ban(userID string) error {
+	_, err := repo.DB.Exec("INSERT IGNORE INTO user_bans (`user_id`) VALUES (?)", userID)
+	if err != nil {
+		repo.Logger.Error("in Ban: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *MysqlRepo) Unban(userID string) error {
+	_, err := repo.DB.Exec("DELETE FROM user_bans WHERE user_id = ?", userID)
+	if err != nil {
+		repo.Logger.Error("in Unban: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *MysqlRepo) IsBanned(userID string) (bool, error) {
+	count := 0
+	err := repo.DB.QueryRow("SELECT COUNT(*) FROM user_bans WHERE user_id = ?", userID).Scan(&count)
+	if err != nil {
+		repo.Logger.Error("in IsBanned: ", err)
+		return false, err
+	}
+	return count > 0, nil
+}
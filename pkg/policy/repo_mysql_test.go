@@ -0,0 +1,129 @@
+package policy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestRole(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+	query := `SELECT role FROM user_roles WHERE user_id = \?`
+
+	mock.ExpectQuery(query).WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("admin"))
+	role, err := repo.Role("1")
+	assert.Nil(t, err)
+	assert.Equal(t, RoleAdmin, role)
+
+	mock.ExpectQuery(query).WithArgs("2").WillReturnRows(sqlmock.NewRows([]string{"role"}))
+	role, err = repo.Role("2")
+	assert.Nil(t, err)
+	assert.Equal(t, RoleUser, role)
+
+	mock.ExpectQuery(query).WithArgs("3").WillReturnError(fmt.Errorf("some error"))
+	_, err = repo.Role("3")
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSetRole(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+	admins := `SELECT COUNT\(\*\), COALESCE\(SUM\(user_id = \?\), 0\) FROM user_roles WHERE role = \? FOR UPDATE`
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(admins).WithArgs("1", "admin").WillReturnRows(sqlmock.NewRows([]string{"count", "is_admin"}).AddRow(1, 0))
+	mock.ExpectExec("INSERT INTO user_roles").WithArgs("1", "moderator").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.Nil(t, repo.SetRole("1", RoleModerator))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(admins).WithArgs("1", "admin").WillReturnRows(sqlmock.NewRows([]string{"count", "is_admin"}).AddRow(2, 1))
+	mock.ExpectExec(`DELETE FROM user_roles WHERE user_id = \?`).WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.Nil(t, repo.SetRole("1", RoleUser))
+
+	// admins are not counted to make another one
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO user_roles").WithArgs("2", "admin").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.Nil(t, repo.SetRole("2", RoleAdmin))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(admins).WithArgs("2", "admin").WillReturnRows(sqlmock.NewRows([]string{"count", "is_admin"}).AddRow(1, 1))
+	mock.ExpectRollback()
+	assert.Equal(t, ErrLastAdmin, repo.SetRole("2", RoleModerator))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(admins).WillReturnError(fmt.Errorf("some error"))
+	mock.ExpectRollback()
+	assert.NotNil(t, repo.SetRole("2", RoleUser))
+
+	assert.Equal(t, ErrUnknownRole, repo.SetRole("1", Role("root")))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCount(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+	query := `SELECT COUNT\(\*\) FROM user_roles WHERE role = \?`
+
+	mock.ExpectQuery(query).WithArgs("admin").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	count, err := repo.Count(RoleAdmin)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	mock.ExpectQuery(query).WithArgs("admin").WillReturnError(fmt.Errorf("some error"))
+	_, err = repo.Count(RoleAdmin)
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestBans(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	mock.ExpectExec(`INSERT IGNORE INTO user_bans`).WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, repo.Ban("1"))
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM user_bans WHERE user_id = \?`).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	banned, err := repo.IsBanned("1")
+	assert.Nil(t, err)
+	assert.True(t, banned)
+
+	mock.ExpectExec(`DELETE FROM user_bans WHERE user_id = \?`).WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Nil(t, repo.Unban("1"))
+
+	mock.ExpectExec(`INSERT IGNORE INTO user_bans`).WillReturnError(fmt.Errorf("some error"))
+	assert.NotNil(t, repo.Ban("2"))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM user_bans`).WillReturnError(fmt.Errorf("some error"))
+	_, err = repo.IsBanned("2")
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,36 @@
+package policy
+
+import (
+	"net/http"
+
+	"github.com/greatjudge/redditclone/pkg/session"
+)
+
+// Sessions refuses sessions of banned users on top of another manager,
+// so a ban ends logins and API tokens at once.
+type Sessions struct {
+	session.SessionsManager
+	Bans BanRepo
+}
+
+func NewSessions(sm session.SessionsManager, bans BanRepo) *Sessions {
+	return &Sessions{
+		SessionsManager: sm,
+		Bans:            bans,
+	}
+}
+
+func (s *Sessions) Check(r *http.Request) (session.Session, error) {
+	sess, err := s.SessionsManager.Check(r)
+	if err != nil {
+		return session.Session{}, err
+	}
+	banned, err := s.Bans.IsBanned(sess.User.ID)
+	if err != nil {
+		return session.Session{}, err
+	}
+	if banned {
+		return session.Session{}, ErrBanned
+	}
+	return sess, nil
+}
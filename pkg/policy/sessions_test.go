@@ -0,0 +1,43 @@
+package policy
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/greatjudge/redditclone/pkg/session"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionsCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sm := session.NewMockSessionsManager(ctrl)
+	bans := NewMockBanRepo(ctrl)
+	s := NewSessions(sm, bans)
+	r := httptest.NewRequest("GET", "/", nil)
+	sess := session.NewSession("token", user.User{ID: "1", Username: "rick"})
+
+	sm.EXPECT().Check(r).Return(sess, nil)
+	bans.EXPECT().IsBanned("1").Return(false, nil)
+	got, err := s.Check(r)
+	assert.Nil(t, err)
+	assert.Equal(t, sess, got)
+
+	sm.EXPECT().Check(r).Return(sess, nil)
+	bans.EXPECT().IsBanned("1").Return(true, nil)
+	_, err = s.Check(r)
+	assert.Equal(t, ErrBanned, err)
+
+	sm.EXPECT().Check(r).Return(sess, nil)
+	bans.EXPECT().IsBanned("1").Return(false, fmt.Errorf("db error"))
+	_, err = s.Check(r)
+	assert.NotNil(t, err)
+
+	sm.EXPECT().Check(r).Return(session.Session{}, session.ErrNoAuth)
+	_, err = s.Check(r)
+	assert.Equal(t, session.ErrNoAuth, err)
+}
@@ -0,0 +1,89 @@
+package post
+
+import (
+	"sort"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/comment"
+)
+
+const (
+	ActivityPost    = "post"
+	ActivityComment = "comment"
+)
+
+// Activity is a post or a comment in the history of a user.
+type Activity struct {
+	Kind      string `json:"kind" bson:"kind"`
+	PostID    string `json:"post_id" bson:"post_id"`
+	Title     string `json:"title" bson:"title"`
+	Category  string `json:"category" bson:"category"`
+	Score     int    `json:"score,omitempty" bson:"score,omitempty"`
+	CommentID string `json:"comment_id,omitempty" bson:"comment_id,omitempty"`
+	Body      string `json:"body,omitempty" bson:"body,omitempty"`
+	Created   string `json:"created" bson:"created"`
+}
+
+// Karma sums scores of posts of a user. Comments can not be voted on, so
+// they only count and add no karma.
+type Karma struct {
+	Post         int `json:"post" bson:"post_karma"`
+	PostCount    int `json:"post_count" bson:"post_count"`
+	CommentCount int `json:"comment_count" bson:"comment_count"`
+}
+
+func (k Karma) Total() int {
+	return k.Post
+}
+
+// userActivity lists everything username did in p and its comments.
+func (p Post) userActivity(username string, comments []comment.Comment) []Activity {
+	items := make([]Activity, 0)
+	if p.Author.Username == username {
+		items = append(items, Activity{
+			Kind:     ActivityPost,
+			PostID:   p.ID,
+			Title:    p.Title,
+			Category: p.Category,
+			Score:    p.Score,
+			Created:  p.Created,
+		})
+	}
+	for _, comm := range comments {
+		if comm.Author.Username == username && comm.DeletedAt == nil {
+			items = append(items, Activity{
+				Kind:      ActivityComment,
+				PostID:    p.ID,
+				Title:     p.Title,
+				Category:  p.Category,
+				CommentID: comm.ID,
+				Body:      comm.Body,
+				Created:   comm.Created,
+			})
+		}
+	}
+	return items
+}
+
+// sortActivity puts the newest items first. Creation times are compared
+// parsed, as strings they drop trailing zeros of milliseconds.
+func sortActivity(items []Activity) {
+	created := func(i int) time.Time {
+		t, _ := time.Parse(creationTimeLayout, items[i].Created)
+		return t
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return created(i).After(created(j))
+	})
+}
+
+func paginate(items []Activity, offset, limit int) []Activity {
+	if offset >= len(items) {
+		return make([]Activity, 0)
+	}
+	items = items[offset:]
+	if limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
@@ -4,6 +4,7 @@ import (
 	context "context"
 
 	mongo "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // mockgen -source=post.go -destination=repo_mock.go -package=post PostRepo
@@ -17,7 +18,15 @@ type CollectionHelper interface {
 	FindOne(context.Context, interface{}) SingleResultHelper
 	InsertOne(context.Context, interface{}) (interface{}, error)
 	DeleteOne(ctx context.Context, filter interface{}) (int64, error)
+	DeleteMany(ctx context.Context, filter interface{}) (int64, error)
+	CountDocuments(ctx context.Context, filter interface{}) (int64, error)
 	UpdateOne(ctx context.Context, filter interface{}, update interface{}) (*mongo.UpdateResult, error)
+	UpdateMany(ctx context.Context, filter interface{}, update interface{}) (*mongo.UpdateResult, error)
+	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) SingleResultHelper
+	FindOneAndDelete(ctx context.Context, filter interface{}) SingleResultHelper
+	CreateIndex(ctx context.Context, model mongo.IndexModel) (string, error)
+	Aggregate(ctx context.Context, pipeline interface{}) (*mongo.Cursor, error)
+	BulkWrite(ctx context.Context, models []mongo.WriteModel) (*mongo.BulkWriteResult, error)
 }
 
 type SingleResultHelper interface {
@@ -87,14 +96,53 @@ func (mc *MongoCollection) InsertOne(ctx context.Context, document interface{})
 }
 
 func (mc *MongoCollection) DeleteOne(ctx context.Context, filter interface{}) (int64, error) {
-	count, err := mc.Coll.DeleteOne(ctx, filter)
-	return count.DeletedCount, err
+	result, err := mc.Coll.DeleteOne(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (mc *MongoCollection) DeleteMany(ctx context.Context, filter interface{}) (int64, error) {
+	result, err := mc.Coll.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (mc *MongoCollection) CountDocuments(ctx context.Context, filter interface{}) (int64, error) {
+	return mc.Coll.CountDocuments(ctx, filter)
 }
 
 func (mc *MongoCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
 	return mc.Coll.UpdateOne(ctx, filter, update)
 }
 
+func (mc *MongoCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+	return mc.Coll.UpdateMany(ctx, filter, update)
+}
+
+func (mc *MongoCollection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) SingleResultHelper {
+	return &MongoSingleResult{Sr: mc.Coll.FindOneAndUpdate(ctx, filter, update, opts...)}
+}
+
+func (mc *MongoCollection) FindOneAndDelete(ctx context.Context, filter interface{}) SingleResultHelper {
+	return &MongoSingleResult{Sr: mc.Coll.FindOneAndDelete(ctx, filter)}
+}
+
 func (sr *MongoSingleResult) Decode(v interface{}) error {
 	return sr.Sr.Decode(v)
 }
+
+func (mc *MongoCollection) CreateIndex(ctx context.Context, model mongo.IndexModel) (string, error) {
+	return mc.Coll.Indexes().CreateOne(ctx, model)
+}
+
+func (mc *MongoCollection) Aggregate(ctx context.Context, pipeline interface{}) (*mongo.Cursor, error) {
+	return mc.Coll.Aggregate(ctx, pipeline)
+}
+
+func (mc *MongoCollection) BulkWrite(ctx context.Context, models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	return mc.Coll.BulkWrite(ctx, models)
+}
@@ -10,6 +10,7 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 	mongo "go.mongodb.org/mongo-driver/mongo"
+	options "go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // MockDatabaseHelper is a mock of DatabaseHelper interface.
@@ -86,6 +87,81 @@ func (m *MockCollectionHelper) EXPECT() *MockCollectionHelperMockRecorder {
 	return m.recorder
 }
 
+// Aggregate mocks base method.
+func (m *MockCollectionHelper) Aggregate(ctx context.Context, pipeline interface{}) (*mongo.Cursor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Aggregate", ctx, pipeline)
+	ret0, _ := ret[0].(*mongo.Cursor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Aggregate indicates an expected call of Aggregate.
+func (mr *MockCollectionHelperMockRecorder) Aggregate(ctx, pipeline interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Aggregate", reflect.TypeOf((*MockCollectionHelper)(nil).Aggregate), ctx, pipeline)
+}
+
+// BulkWrite mocks base method.
+func (m *MockCollectionHelper) BulkWrite(ctx context.Context, models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BulkWrite", ctx, models)
+	ret0, _ := ret[0].(*mongo.BulkWriteResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BulkWrite indicates an expected call of BulkWrite.
+func (mr *MockCollectionHelperMockRecorder) BulkWrite(ctx, models interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BulkWrite", reflect.TypeOf((*MockCollectionHelper)(nil).BulkWrite), ctx, models)
+}
+
+// CountDocuments mocks base method.
+func (m *MockCollectionHelper) CountDocuments(ctx context.Context, filter interface{}) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountDocuments", ctx, filter)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountDocuments indicates an expected call of CountDocuments.
+func (mr *MockCollectionHelperMockRecorder) CountDocuments(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountDocuments", reflect.TypeOf((*MockCollectionHelper)(nil).CountDocuments), ctx, filter)
+}
+
+// CreateIndex mocks base method.
+func (m *MockCollectionHelper) CreateIndex(ctx context.Context, model mongo.IndexModel) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateIndex", ctx, model)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateIndex indicates an expected call of CreateIndex.
+func (mr *MockCollectionHelperMockRecorder) CreateIndex(ctx, model interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateIndex", reflect.TypeOf((*MockCollectionHelper)(nil).CreateIndex), ctx, model)
+}
+
+// DeleteMany mocks base method.
+func (m *MockCollectionHelper) DeleteMany(ctx context.Context, filter interface{}) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMany", ctx, filter)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMany indicates an expected call of DeleteMany.
+func (mr *MockCollectionHelperMockRecorder) DeleteMany(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMany", reflect.TypeOf((*MockCollectionHelper)(nil).DeleteMany), ctx, filter)
+}
+
 // DeleteOne mocks base method.
 func (m *MockCollectionHelper) DeleteOne(ctx context.Context, filter interface{}) (int64, error) {
 	m.ctrl.T.Helper()
@@ -130,6 +206,39 @@ func (mr *MockCollectionHelperMockRecorder) FindOne(arg0, arg1 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOne", reflect.TypeOf((*MockCollectionHelper)(nil).FindOne), arg0, arg1)
 }
 
+// FindOneAndDelete mocks base method.
+func (m *MockCollectionHelper) FindOneAndDelete(ctx context.Context, filter interface{}) SingleResultHelper {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindOneAndDelete", ctx, filter)
+	ret0, _ := ret[0].(SingleResultHelper)
+	return ret0
+}
+
+// FindOneAndDelete indicates an expected call of FindOneAndDelete.
+func (mr *MockCollectionHelperMockRecorder) FindOneAndDelete(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOneAndDelete", reflect.TypeOf((*MockCollectionHelper)(nil).FindOneAndDelete), ctx, filter)
+}
+
+// FindOneAndUpdate mocks base method.
+func (m *MockCollectionHelper) FindOneAndUpdate(ctx context.Context, filter, update interface{}, opts ...*options.FindOneAndUpdateOptions) SingleResultHelper {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, filter, update}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "FindOneAndUpdate", varargs...)
+	ret0, _ := ret[0].(SingleResultHelper)
+	return ret0
+}
+
+// FindOneAndUpdate indicates an expected call of FindOneAndUpdate.
+func (mr *MockCollectionHelperMockRecorder) FindOneAndUpdate(ctx, filter, update interface{}, opts ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, filter, update}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOneAndUpdate", reflect.TypeOf((*MockCollectionHelper)(nil).FindOneAndUpdate), varargs...)
+}
+
 // InsertOne mocks base method.
 func (m *MockCollectionHelper) InsertOne(arg0 context.Context, arg1 interface{}) (interface{}, error) {
 	m.ctrl.T.Helper()
@@ -145,6 +254,21 @@ func (mr *MockCollectionHelperMockRecorder) InsertOne(arg0, arg1 interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertOne", reflect.TypeOf((*MockCollectionHelper)(nil).InsertOne), arg0, arg1)
 }
 
+// UpdateMany mocks base method.
+func (m *MockCollectionHelper) UpdateMany(ctx context.Context, filter, update interface{}) (*mongo.UpdateResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMany", ctx, filter, update)
+	ret0, _ := ret[0].(*mongo.UpdateResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateMany indicates an expected call of UpdateMany.
+func (mr *MockCollectionHelperMockRecorder) UpdateMany(ctx, filter, update interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMany", reflect.TypeOf((*MockCollectionHelper)(nil).UpdateMany), ctx, filter, update)
+}
+
 // UpdateOne mocks base method.
 func (m *MockCollectionHelper) UpdateOne(ctx context.Context, filter, update interface{}) (*mongo.UpdateResult, error) {
 	m.ctrl.T.Helper()
@@ -0,0 +1,64 @@
+package post
+
+import (
+	"github.com/greatjudge/redditclone/pkg/comment"
+)
+
+// Filter hides what a viewer chose not to see: posts they hid and
+// everything written by users they blocked.
+type Filter struct {
+	HiddenPosts  []string
+	BlockedUsers []string
+}
+
+func (f Filter) Empty() bool {
+	return len(f.HiddenPosts) == 0 && len(f.BlockedUsers) == 0
+}
+
+func contains(list []string, val string) bool {
+	for _, elem := range list {
+		if elem == val {
+			return true
+		}
+	}
+	return false
+}
+
+// Blocks tells whether content of the user must be hidden.
+func (f Filter) Blocks(userID string) bool {
+	return contains(f.BlockedUsers, userID)
+}
+
+// Hides tells whether the post must be left out of listings.
+func (f Filter) Hides(p Post) bool {
+	return contains(f.HiddenPosts, p.ID) || f.Blocks(p.Author.ID)
+}
+
+// Apply drops comments of blocked users, the stored post is not changed.
+func (f Filter) Apply(p Post) Post {
+	if len(f.BlockedUsers) == 0 || len(p.Comments) == 0 {
+		return p
+	}
+	comments := make([]comment.Comment, 0, len(p.Comments))
+	for _, comm := range p.Comments {
+		if !f.Blocks(comm.Author.ID) {
+			comments = append(comments, comm)
+		}
+	}
+	p.Comments = comments
+	return p
+}
+
+// ApplyAll leaves out hidden posts and filters comments of the rest.
+func (f Filter) ApplyAll(posts []Post) []Post {
+	if f.Empty() {
+		return posts
+	}
+	filtered := make([]Post, 0, len(posts))
+	for _, p := range posts {
+		if !f.Hides(p) {
+			filtered = append(filtered, f.Apply(p))
+		}
+	}
+	return filtered
+}
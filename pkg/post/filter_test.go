@@ -0,0 +1,31 @@
+package post
+
+import (
+	"testing"
+
+	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterApplyAll(t *testing.T) {
+	alice, bob := user.User{ID: "a", Username: "alice"}, user.User{ID: "b", Username: "bob"}
+	posts := []Post{
+		{ID: "1", Author: alice, Comments: []comment.Comment{{ID: "c1", Author: bob}, {ID: "c2", Author: alice}}},
+		{ID: "2", Author: bob},
+		{ID: "3", Author: alice},
+	}
+	f := Filter{HiddenPosts: []string{"3"}, BlockedUsers: []string{"b"}}
+
+	filtered := f.ApplyAll(posts)
+	if assert.Len(t, filtered, 1) {
+		assert.Equal(t, "1", filtered[0].ID)
+		assert.Equal(t, []comment.Comment{{ID: "c2", Author: alice}}, filtered[0].Comments)
+	}
+	// the stored comments are untouched
+	assert.Len(t, posts[0].Comments, 2)
+
+	assert.Equal(t, posts, Filter{}.ApplyAll(posts))
+	assert.True(t, f.Blocks("b"))
+	assert.False(t, f.Blocks("a"))
+}
@@ -0,0 +1,32 @@
+package post
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	cases := map[string]string{
+		"https://example.com/a/b":                            "https://example.com/a/b",
+		"HTTP://Example.COM/a/b/":                            "https://example.com/a/b",
+		"http://www.example.com:80/a?utm_source=x&id=2":      "https://example.com/a?id=2",
+		"https://example.com:443/?fbclid=abc#section":        "https://example.com",
+		"https://example.com:8443/a?b=2&a=1&gclid=z&UTM_x=1": "https://example.com:8443/a?a=1&b=2",
+		"https://example.com/Case/Sensitive/Path":            "https://example.com/Case/Sensitive/Path",
+	}
+	for raw, expected := range cases {
+		normalized, err := NormalizeURL(raw)
+		assert.Nil(t, err, raw)
+		assert.Equal(t, expected, normalized, raw)
+	}
+
+	_, err := NormalizeURL("not a url")
+	assert.NotNil(t, err)
+}
+
+func TestInitPostNormalizesURL(t *testing.T) {
+	p := Post{Type: LINK, URL: "http://www.Example.com/page/?utm_medium=email"}
+	InitPost(&p, Posts[0].Author)
+	assert.Equal(t, "https://example.com/page", p.NormalizedURL)
+}
@@ -0,0 +1,119 @@
+package post
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	MinPollOptions      = 2
+	MaxPollOptions      = 10
+	MaxPollOptionLength = 120
+)
+
+var (
+	ErrNotPoll      = errors.New("post is not a poll")
+	ErrNoPollOption = errors.New("no poll option found")
+	ErrPollClosed   = errors.New("poll is closed")
+	ErrAlreadyVoted = errors.New("already voted in poll")
+)
+
+type PollOption struct {
+	Text  string `json:"text" bson:"text"`
+	Votes int    `json:"votes" bson:"votes"`
+}
+
+// PollVote is the option a user chose, votes live in their own collection
+// and the poll keeps only the counters.
+type PollVote struct {
+	PostID string `json:"post_id" bson:"post_id"`
+	UserID string `json:"-" bson:"user_id"`
+	Option int    `json:"option" bson:"option"`
+}
+
+// Poll is the question of a poll post, the question itself is the post title.
+type Poll struct {
+	Options    []PollOption `json:"options" bson:"options"`
+	TotalVotes int          `json:"total_votes" bson:"total_votes"`
+	ClosesAt   *time.Time   `json:"closes_at,omitempty" bson:"closes_at,omitempty"`
+
+	// set per viewer by WithPollVote and ForViewer
+	Closed         bool `json:"closed" bson:"-"`
+	ResultsVisible bool `json:"results_visible" bson:"-"`
+	VotedOption    *int `json:"voted_option,omitempty" bson:"-"`
+}
+
+func NewPoll(options []string, closesAt *time.Time) *Poll {
+	poll := &Poll{
+		Options:  make([]PollOption, 0, len(options)),
+		ClosesAt: closesAt,
+	}
+	for _, text := range options {
+		poll.Options = append(poll.Options, PollOption{Text: text})
+	}
+	return poll
+}
+
+func (p *Poll) IsClosed(now time.Time) bool {
+	return p.ClosesAt != nil && !now.Before(*p.ClosesAt)
+}
+
+// checkPollVote tells why a vote can not be counted, nil if it can.
+// Whether the user already voted is up to the repository.
+func (p *Post) checkPollVote(option int, now time.Time) error {
+	switch {
+	case p.Type != POLL || p.Poll == nil:
+		return ErrNotPoll
+	case option < 0 || option >= len(p.Poll.Options):
+		return ErrNoPollOption
+	case p.Poll.IsClosed(now):
+		return ErrPollClosed
+	}
+	return nil
+}
+
+// countPollVote moves the counters of the option by n.
+func (p *Post) countPollVote(option int, n int) {
+	p.Poll.Options[option].Votes += n
+	p.Poll.TotalVotes += n
+}
+
+func (p *Post) VotePoll(option int, now time.Time) error {
+	if err := p.checkPollVote(option, now); err != nil {
+		return err
+	}
+	p.countPollVote(option, 1)
+	return nil
+}
+
+// WithPollVote sets the option the viewer chose.
+func (p Post) WithPollVote(option int) Post {
+	if p.Poll == nil {
+		return p
+	}
+	poll := *p.Poll
+	poll.VotedOption = &option
+	p.Poll = &poll
+	return p
+}
+
+// ForViewer returns the post as its viewer may see it: poll counts are
+// hidden until WithPollVote marks the option of the viewer or the poll
+// closes.
+func (p Post) ForViewer(now time.Time) Post {
+	if p.Poll == nil {
+		return p
+	}
+	poll := *p.Poll
+	poll.Options = append([]PollOption(nil), p.Poll.Options...)
+	poll.Closed = poll.IsClosed(now)
+	poll.ResultsVisible = poll.Closed || poll.VotedOption != nil
+	if !poll.ResultsVisible {
+		for i := range poll.Options {
+			poll.Options[i].Votes = 0
+		}
+		poll.TotalVotes = 0
+	}
+	p.Poll = &poll
+	return p
+}
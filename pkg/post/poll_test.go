@@ -0,0 +1,76 @@
+package post
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/greatjudge/redditclone/pkg/user"
+)
+
+func newPollPost(closesAt *time.Time) Post {
+	form := PostForm{
+		Type:     POLL,
+		Title:    "best editor?",
+		Category: "programming",
+		Options:  []string{"vim", "emacs", "nano"},
+		ClosesAt: closesAt,
+	}
+	p := form.Post()
+	InitPost(&p, user.User{ID: "author", Username: "author"})
+	return p
+}
+
+func TestVotePoll(t *testing.T) {
+	now := time.Now()
+	p := newPollPost(nil)
+
+	assert.Nil(t, p.VotePoll(1, now))
+	assert.Nil(t, p.VotePoll(1, now))
+	assert.Nil(t, p.VotePoll(0, now))
+	assert.Equal(t, ErrNoPollOption, p.VotePoll(3, now))
+	assert.Equal(t, ErrNoPollOption, p.VotePoll(-1, now))
+	assert.Equal(t, []PollOption{{"vim", 1}, {"emacs", 2}, {"nano", 0}}, p.Poll.Options)
+	assert.Equal(t, 3, p.Poll.TotalVotes)
+
+	closesAt := now.Add(time.Hour)
+	closing := newPollPost(&closesAt)
+	assert.Nil(t, closing.VotePoll(0, now))
+	assert.Equal(t, ErrPollClosed, closing.VotePoll(0, closesAt))
+
+	text := Post{Type: TEXT}
+	assert.Equal(t, ErrNotPoll, text.VotePoll(0, now))
+}
+
+func TestPollForViewer(t *testing.T) {
+	now := time.Now()
+	closesAt := now.Add(time.Hour)
+	p := newPollPost(&closesAt)
+	assert.Nil(t, p.VotePoll(2, now))
+
+	anon := p.ForViewer(now)
+	assert.False(t, anon.Poll.ResultsVisible)
+	assert.Nil(t, anon.Poll.VotedOption)
+	assert.Equal(t, 0, anon.Poll.TotalVotes)
+	assert.Equal(t, 0, anon.Poll.Options[2].Votes)
+	// the stored post is left untouched
+	assert.Equal(t, 1, p.Poll.Options[2].Votes)
+
+	voter := p.WithPollVote(2).ForViewer(now)
+	assert.True(t, voter.Poll.ResultsVisible)
+	if assert.NotNil(t, voter.Poll.VotedOption) {
+		assert.Equal(t, 2, *voter.Poll.VotedOption)
+	}
+	assert.Equal(t, 1, voter.Poll.Options[2].Votes)
+	assert.Nil(t, p.Poll.VotedOption)
+
+	closed := p.ForViewer(closesAt)
+	assert.True(t, closed.Poll.Closed)
+	assert.True(t, closed.Poll.ResultsVisible)
+	assert.Equal(t, 1, closed.Poll.TotalVotes)
+
+	text := Post{Type: TEXT}
+	assert.Equal(t, text, text.ForViewer(now))
+	assert.Equal(t, text, text.WithPollVote(0))
+}
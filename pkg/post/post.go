@@ -5,53 +5,143 @@ import (
 	"time"
 
 	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/markdown"
+	"github.com/greatjudge/redditclone/pkg/unfurl"
+	"github.com/greatjudge/redditclone/pkg/upload"
 	"github.com/greatjudge/redditclone/pkg/user"
 	"github.com/greatjudge/redditclone/pkg/vote"
 )
 
 const (
-	TEXT = "text"
+	TEXT  = "text"
+	LINK  = "link"
+	IMAGE = "image"
+	POLL  = "poll"
 )
 
+const (
+	MaxTitleLength    = 300
+	MaxCategoryLength = 64
+	MaxTextLength     = 40000
+	MaxURLLength      = 2048
+)
+
+// URLSchemes lists the schemes a link post is allowed to point to.
+var URLSchemes = []string{"http", "https"}
+
+// ReadOnlyFields are set by the server and must not come from the client.
+var ReadOnlyFields = []string{
+	"id", "score", "votes", "upvotes", "downvotes", "views", "author", "comments", "comment_count", "created", "upvotePercentage", "image", "poll", "deleted_at",
+}
+
 var (
 	ErrNoPost            = errors.New("no post found")
 	ErrPostAlreadyExists = errors.New("post already exists")
-	ErrNoAccess          = errors.New("no access")
+	ErrNotRestorable     = errors.New("nothing to restore")
+)
+
+// ErasePolicy is what happens to posts and comments of a deleted account.
+type ErasePolicy string
+
+const (
+	// EraseAnonymize keeps the content under ErasedAuthor.
+	EraseAnonymize ErasePolicy = "anonymize"
+	// EraseDelete deletes the content as its author would, it is purged
+	// once the retention window passes.
+	EraseDelete ErasePolicy = "delete"
 )
 
+// ErasedAuthor replaces the author of whatever a deleted account leaves.
+var ErasedAuthor = user.User{Username: comment.DeletedBody}
+
+// UserData is everything the post store keeps about a user, deleted
+// items included.
+type UserData struct {
+	Posts     []Post
+	Comments  []comment.Comment
+	Votes     []vote.Vote
+	PollVotes []PollVote
+}
+
 type Post struct {
 	ID               string            `json:"id" bson:"_id"`
 	Title            string            `json:"title" bson:"title"`
 	Views            int               `json:"views" bson:"views"`
-	Type             string            `json:"type" bson:"type" valid:"required, in(text|link)"`
-	URL              string            `json:"url,omitempty" bson:"url,omitempty" valid:"url"`
+	Type             string            `json:"type" bson:"type"`
+	URL              string            `json:"url,omitempty" bson:"url,omitempty"`
+	NormalizedURL    string            `json:"-" bson:"normalized_url,omitempty"`
 	Text             string            `json:"text,omitempty" bson:"text,omitempty"`
+	TextHTML         string            `json:"text_html,omitempty" bson:"text_html,omitempty"`
 	Author           user.User         `json:"author" bson:"author"`
 	Category         string            `json:"category" bson:"category"`
-	Votes            []vote.Vote       `json:"votes" bson:"votes"`
-	Comments         []comment.Comment `json:"comments" bson:"comments"`
+	Votes            []vote.Vote       `json:"votes" bson:"-"` // vote of the viewer only, stored in its own collection
+	Upvotes          int               `json:"upvotes" bson:"upvotes"`
+	Downvotes        int               `json:"downvotes" bson:"downvotes"`
+	Comments         []comment.Comment `json:"comments,omitempty" bson:"comments,omitempty"` // first page, in single post responses only
+	CommentCount     int               `json:"comment_count" bson:"comment_count"`
 	Created          string            `json:"created" bson:"created"`
 	UpvotePercentage int               `json:"upvotePercentage" bson:"upvotePercentage"`
 	Score            int               `json:"score" bson:"score"`
+	Preview          *unfurl.Preview   `json:"preview,omitempty" bson:"preview,omitempty"`
+	Image            *upload.Image     `json:"image,omitempty" bson:"image,omitempty"`
+	Poll             *Poll             `json:"poll,omitempty" bson:"poll,omitempty"`
+	DeletedAt        *time.Time        `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	// Saved is set per viewer
+	Saved bool `json:"saved" bson:"-"`
+}
+
+type PostForm struct {
+	Type     string `json:"type" valid:"required~is required,in(text|link|image|poll)~is not a known post type"`
+	Title    string `json:"title" valid:"required~is required"`    // at most MaxTitleLength
+	Category string `json:"category" valid:"required~is required"` // at most MaxCategoryLength
+	URL      string `json:"url"`
+	Text     string `json:"text"` // at most MaxTextLength
+	// poll posts only
+	Options  []string   `json:"options"`
+	ClosesAt *time.Time `json:"closes_at"`
+}
+
+func (f PostForm) Post() Post {
+	p := Post{
+		Type:     f.Type,
+		Title:    f.Title,
+		Category: f.Category,
+		URL:      f.URL,
+		Text:     f.Text,
+	}
+	if f.Type == POLL {
+		p.Poll = NewPoll(f.Options, f.ClosesAt)
+	}
+	return p
 }
 
 func (p *Post) SyncUpvotePercentage() {
-	if len(p.Votes) != 0 {
-		upvoteCnt := (p.Score + len(p.Votes)) / 2
-		p.UpvotePercentage = upvoteCnt * 100 / len(p.Votes)
+	if total := p.VoteCount(); total != 0 {
+		p.UpvotePercentage = p.Upvotes * 100 / total
 	} else {
 		p.UpvotePercentage = 0
 	}
 }
 
+// VoteCount is the number of users who voted for the post.
+func (p Post) VoteCount() int {
+	return p.Upvotes + p.Downvotes
+}
+
 func InitPost(post *Post, usr user.User) {
 	post.Author = usr
-	post.Comments = make([]comment.Comment, 0)
 	post.Score = 1
-	if post.Type == TEXT {
+	post.Upvotes = 1
+	switch post.Type {
+	case TEXT, POLL:
+		post.URL = ""
+		post.TextHTML = markdown.Render(post.Text)
+	case IMAGE:
 		post.URL = ""
-	} else {
 		post.Text = ""
+	default:
+		post.Text = ""
+		post.NormalizedURL, _ = NormalizeURL(post.URL)
 	}
 	post.Votes = []vote.Vote{
 		{
@@ -62,70 +152,83 @@ func InitPost(post *Post, usr user.User) {
 	post.SyncUpvotePercentage()
 }
 
-func (p Post) findUserVote(userID string) (*vote.Vote, int) {
-	for i, vote := range p.Votes {
-		if vote.UserID == userID {
-			return &p.Votes[i], i
-		}
-	}
-	return nil, -1
-}
-
-func (p *Post) changeVotes(userID string, desiredValue int) {
-	v, _ := p.findUserVote(userID)
-	switch {
-	case v == nil:
-		{
-			v = &vote.Vote{
-				UserID: userID,
-				Value:  desiredValue,
-			}
-			p.Votes = append(p.Votes, *v)
-		}
-	case v.Value == desiredValue:
+// ChangeVote moves the counters of the post from the previous vote of
+// a user to the new one, 0 stands for no vote.
+func (p *Post) ChangeVote(from int, to int) {
+	if from == to {
 		return
-	default:
-		p.Score -= v.Value
-		v.Value = desiredValue
 	}
-	p.Score += v.Value
+	p.countVote(from, -1)
+	p.countVote(to, 1)
+	p.Score += to - from
 	p.SyncUpvotePercentage()
 }
 
-func (p *Post) Upvote(userID string) {
-	p.changeVotes(userID, 1)
-}
-
-func (p *Post) Downvote(userID string) {
-	p.changeVotes(userID, -1)
+func (p *Post) countVote(value int, n int) {
+	switch value {
+	case 1:
+		p.Upvotes += n
+	case -1:
+		p.Downvotes += n
+	}
 }
 
-func (p *Post) Unvote(userID string) {
-	v, i := p.findUserVote(userID)
-	if v == nil {
-		return
+// WithVote sets the vote of the viewer, 0 stands for no vote.
+func (p Post) WithVote(userID string, value int) Post {
+	p.Votes = make([]vote.Vote, 0, 1)
+	if value != 0 {
+		p.Votes = append(p.Votes, vote.Vote{PostID: p.ID, UserID: userID, Value: value})
 	}
-	p.Score -= v.Value
-	p.Votes[i] = p.Votes[len(p.Votes)-1]
-	p.Votes = p.Votes[:len(p.Votes)-1]
-	p.SyncUpvotePercentage()
+	return p
 }
 
 //go:generate mockgen -source=post.go -destination=repo_mock.go -package=post PostRepo
 type PostRepo interface {
-	GetAll() ([]Post, error)
+	GetAll(f Filter) ([]Post, error)
 	GetByID(id string) (Post, error)
-	GetByCategory(category string) ([]Post, error)
+	GetByIDs(ids []string) ([]Post, error)
+	GetByCategory(category string, f Filter) ([]Post, error)
 	Add(post Post) (Post, error)
-	AddComment(id string, comm comment.Comment) (Post, error)
-	DeleteComment(postID string, commentID string, userID string) (Post, error)
+	AddComment(postID string, comm comment.Comment) (comment.Comment, error)
+	DeleteComment(postID string, commentID string) error
+	GetComment(postID string, commentID string) (comment.Comment, error)
+	GetComments(postID string, f Filter, offset int, limit int) ([]comment.Comment, error)
+	GetCommentsByIDs(ids []string) ([]comment.Comment, error)
 	Upvote(postID string, userID string) (Post, error)
 	Downvote(postID string, userID string) (Post, error)
 	Unvote(postID string, userID string) (Post, error)
-	Delete(postID string, userID string) error
+	GetVotes(userID string, postIDs []string) ([]vote.Vote, error)
+	Delete(postID string) error
+	// GetAuthorID returns who wrote the post, or its comment for a non empty
+	// commentID. Deleted items are found too, so that restoring them can be
+	// authorized.
+	GetAuthorID(postID string, commentID string) (string, error)
+	// Restore and RestoreComment bring back items deleted after deletedAfter.
+	Restore(postID string, deletedAfter time.Time) (Post, error)
+	RestoreComment(postID string, commentID string, deletedAfter time.Time) (comment.Comment, error)
+	// Purge removes items deleted before deletedBefore for good.
+	Purge(deletedBefore time.Time) (int, error)
 	GetUserPosts(username string) ([]Post, error)
+	SetPreview(postID string, preview unfurl.Preview) error
+	AddViews(counts map[string]int) error
+	GetByNormalizedURL(category string, normalizedURL string) (Post, error)
+	VotePoll(postID string, userID string, option int) (Post, error)
+	GetPollVotes(userID string, postIDs []string) ([]PollVote, error)
+	GetUserActivity(username string, offset int, limit int) ([]Activity, error)
+	GetUserKarma(username string) (Karma, error)
+	// EraseUser handles posts and comments of a deleted account by the
+	// policy. Votes of the user are dropped, post scores stay as they are,
+	// while poll votes are counted down. Images are dropped from the posts
+	// of the user, their files are left to the caller.
+	EraseUser(userID string, policy ErasePolicy) error
+	// UserImages returns the images of posts by the user that no post of
+	// another author shares, keys are derived from the content.
+	UserImages(userID string) ([]upload.Image, error)
+	ExportUserData(userID string) (UserData, error)
 }
 
+const creationTimeLayout = "2006-01-02T15:04:05.999Z"
+
 func CreationTime() string {
-	return time.Now().Format("2006-01-02T15:04:05.999Z")
+	return time.Now().Format(creationTimeLayout)
 }
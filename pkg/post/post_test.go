@@ -1,7 +1,6 @@
 package post
 
 import (
-	"reflect"
 	"testing"
 
 	"github.com/greatjudge/redditclone/pkg/comment"
@@ -37,6 +36,7 @@ func CheckInit(t *testing.T, pType string) {
 		},
 	})
 	assert.Equal(t, post.Score, 1)
+	assert.Equal(t, post.Upvotes, 1)
 	assert.Equal(t, post.UpvotePercentage, 100)
 }
 
@@ -48,22 +48,24 @@ func TestInitPost(t *testing.T) {
 type TestCase struct {
 	expectedScore            int
 	expectedUpvotePercentage int
-	expectedVotes            []vote.Vote
+	expectedUpvotes          int
+	expectedDownvotes        int
 	p                        Post
-	method                   string
-	idArg                    string
-	casename                 string
+	// vote of the user before the change, 0 for none
+	from     int
+	method   string
+	casename string
 }
 
 func Check(t *testing.T, tc TestCase) {
 	p := tc.p
 	switch tc.method {
 	case "upvote":
-		p.Upvote(tc.idArg)
+		p.ChangeVote(tc.from, 1)
 	case "downvote":
-		p.Downvote(tc.idArg)
+		p.ChangeVote(tc.from, -1)
 	case "unvote":
-		p.Unvote(tc.idArg)
+		p.ChangeVote(tc.from, 0)
 	}
 
 	if p.Score != tc.expectedScore {
@@ -72,13 +74,14 @@ func Check(t *testing.T, tc TestCase) {
 	if p.UpvotePercentage != tc.expectedUpvotePercentage {
 		t.Errorf("bad UpvotePercentage. expected %d, got %d", tc.expectedUpvotePercentage, p.UpvotePercentage)
 	}
-	if !reflect.DeepEqual(p.Votes, tc.expectedVotes) {
-		t.Errorf("bad votes. Expected %v,\n got %v", tc.expectedVotes, tc.expectedUpvotePercentage)
+	if p.Upvotes != tc.expectedUpvotes || p.Downvotes != tc.expectedDownvotes {
+		t.Errorf("bad counters. expected %d/%d, got %d/%d",
+			tc.expectedUpvotes, tc.expectedDownvotes, p.Upvotes, p.Downvotes)
 	}
 }
 
-func TestUpvote(t *testing.T) {
-	p := Post{
+func testPost() Post {
+	return Post{
 		ID:    "1",
 		Title: "title",
 		Views: 2,
@@ -87,78 +90,55 @@ func TestUpvote(t *testing.T) {
 			ID:       "1",
 			Username: "username",
 		},
-		Category: "category",
-		Votes: []vote.Vote{
-			{
-				UserID: "1",
-				Value:  1,
-			},
-		},
+		Category:         "category",
+		Upvotes:          1,
 		Comments:         make([]comment.Comment, 0),
 		Created:          CreationTime(),
 		UpvotePercentage: 100,
 		Score:            1,
 	}
+}
 
+// downvotedPost is a post its author voted against.
+func downvotedPost() Post {
+	p := testPost()
+	p.Score = -1
+	p.UpvotePercentage = 0
+	p.Upvotes = 0
+	p.Downvotes = 1
+	return p
+}
+
+func TestUpvote(t *testing.T) {
 	cases := []TestCase{
 		{
-			p:                        p,
-			expectedScore:            p.Score + 1,
+			p:                        testPost(),
+			expectedScore:            2,
 			expectedUpvotePercentage: 100,
-			expectedVotes: []vote.Vote{
-				{
-					UserID: "1",
-					Value:  1,
-				},
-				{
-					UserID: "2",
-					Value:  1,
-				},
-			},
-			idArg:    "2",
-			method:   "upvote",
-			casename: "new vote",
+			expectedUpvotes:          2,
+			method:                   "upvote",
+			casename:                 "new vote",
 		},
 		{
-			p:                        p,
-			expectedScore:            p.Score,
+			p:                        testPost(),
+			expectedScore:            1,
 			expectedUpvotePercentage: 100,
-			expectedVotes: []vote.Vote{
-				{
-					UserID: "1",
-					Value:  1,
-				},
-			},
-			idArg:    "1",
-			method:   "upvote",
-			casename: "exist vote",
+			expectedUpvotes:          1,
+			from:                     1,
+			method:                   "upvote",
+			casename:                 "exist vote",
 		},
-	}
-
-	p.Score = -1
-	p.UpvotePercentage = 0
-	p.Votes = []vote.Vote{
 		{
-			UserID: "1",
-			Value:  -1,
+			p:                        downvotedPost(),
+			expectedScore:            1,
+			expectedUpvotePercentage: 100,
+			expectedUpvotes:          1,
+			from:                     -1,
+			method:                   "upvote",
+			casename:                 "opposite vote",
 		},
 	}
 
-	cases = append(cases, TestCase{
-		p:                        p,
-		expectedScore:            1,
-		expectedUpvotePercentage: 100,
-		expectedVotes: []vote.Vote{
-			{
-				UserID: "1",
-				Value:  1,
-			},
-		},
-		idArg:    "1",
-		method:   "upvote",
-		casename: "opposite vote",
-	})
-
 	for _, tc := range cases {
 		t.Run(tc.casename, func(t *testing.T) {
 			Check(t, tc)
@@ -167,87 +147,36 @@ func TestUpvote(t *testing.T) {
 }
 
 func TestDownvote(t *testing.T) {
-	p := Post{
-		ID:    "1",
-		Title: "title",
-		Views: 2,
-		Type:  "text",
-		Author: user.User{
-			ID:       "1",
-			Username: "username",
-		},
-		Category: "category",
-		Votes: []vote.Vote{
-			{
-				UserID: "1",
-				Value:  1,
-			},
-		},
-		Comments:         make([]comment.Comment, 0),
-		Created:          CreationTime(),
-		UpvotePercentage: 100,
-		Score:            1,
-	}
-
 	cases := []TestCase{
 		{
-			p:                        p,
-			expectedScore:            p.Score - 1,
+			p:                        testPost(),
+			expectedScore:            0,
 			expectedUpvotePercentage: 50,
-			expectedVotes: []vote.Vote{
-				{
-					UserID: "1",
-					Value:  1,
-				},
-				{
-					UserID: "2",
-					Value:  -1,
-				},
-			},
-			idArg:    "2",
-			method:   "downvote",
-			casename: "new vote",
+			expectedUpvotes:          1,
+			expectedDownvotes:        1,
+			method:                   "downvote",
+			casename:                 "new vote",
 		},
 		{
-			p:                        p,
+			p:                        testPost(),
 			expectedScore:            -1,
 			expectedUpvotePercentage: 0,
-			expectedVotes: []vote.Vote{
-				{
-					UserID: "1",
-					Value:  -1,
-				},
-			},
-			idArg:    "1",
-			method:   "downvote",
-			casename: "opposite vote",
+			expectedDownvotes:        1,
+			from:                     1,
+			method:                   "downvote",
+			casename:                 "opposite vote",
 		},
-	}
-
-	p.Score = -1
-	p.UpvotePercentage = 0
-	p.Votes = []vote.Vote{
 		{
-			UserID: "1",
-			Value:  -1,
+			p:                        downvotedPost(),
+			expectedScore:            -1,
+			expectedUpvotePercentage: 0,
+			expectedDownvotes:        1,
+			from:                     -1,
+			method:                   "downvote",
+			casename:                 "exist vote",
 		},
 	}
 
-	cases = append(cases, TestCase{
-		p:                        p,
-		expectedScore:            -1,
-		expectedUpvotePercentage: 0,
-		expectedVotes: []vote.Vote{
-			{
-				UserID: "1",
-				Value:  -1,
-			},
-		},
-		idArg:    "1",
-		method:   "downvote",
-		casename: "exist vote",
-	})
-
 	for _, tc := range cases {
 		t.Run(tc.casename, func(t *testing.T) {
 			Check(t, tc)
@@ -256,76 +185,62 @@ func TestDownvote(t *testing.T) {
 }
 
 func TestUnvote(t *testing.T) {
-	p := Post{
-		ID:    "1",
-		Title: "title",
-		Views: 2,
-		Type:  "text",
-		Author: user.User{
-			ID:       "1",
-			Username: "username",
-		},
-		Category: "category",
-		Votes: []vote.Vote{
-			{
-				UserID: "1",
-				Value:  1,
-			},
-		},
-		Comments:         make([]comment.Comment, 0),
-		Created:          CreationTime(),
-		UpvotePercentage: 100,
-		Score:            1,
-	}
-
 	cases := []TestCase{
 		{
-			p:                        p,
-			expectedScore:            p.Score - 1,
+			p:                        testPost(),
+			expectedScore:            0,
 			expectedUpvotePercentage: 0,
-			expectedVotes:            []vote.Vote{},
-			idArg:                    "1",
+			from:                     1,
 			method:                   "unvote",
 			casename:                 "exist +1 vote",
 		},
 		{
-			p:                        p,
-			expectedScore:            p.Score,
+			p:                        testPost(),
+			expectedScore:            1,
 			expectedUpvotePercentage: 100,
-			expectedVotes: []vote.Vote{
-				{
-					UserID: "1",
-					Value:  1,
-				},
-			},
-			idArg:    "2",
-			method:   "unvote",
-			casename: "no vote",
+			expectedUpvotes:          1,
+			method:                   "unvote",
+			casename:                 "no vote",
 		},
-	}
-
-	p.Score = -1
-	p.UpvotePercentage = 0
-	p.Votes = []vote.Vote{
 		{
-			UserID: "1",
-			Value:  -1,
+			p:                        downvotedPost(),
+			expectedScore:            0,
+			expectedUpvotePercentage: 0,
+			from:                     -1,
+			method:                   "unvote",
+			casename:                 "exist -1 vote",
 		},
 	}
 
-	cases = append(cases, TestCase{
-		p:                        p,
-		expectedScore:            p.Score + 1,
-		expectedUpvotePercentage: 0,
-		expectedVotes:            []vote.Vote{},
-		idArg:                    "1",
-		method:                   "unvote",
-		casename:                 "exist -1 vote",
-	})
-
 	for _, tc := range cases {
 		t.Run(tc.casename, func(t *testing.T) {
 			Check(t, tc)
 		})
 	}
 }
+
+// TestUpvotePercentageRounding pins the formula used while every vote was
+// kept in the post: (score + votes) / 2 * 100 / votes.
+func TestUpvotePercentageRounding(t *testing.T) {
+	p := testPost()
+	for _, tc := range []struct {
+		value    int
+		expected int
+	}{
+		{value: 1, expected: 100},
+		{value: -1, expected: 66},
+		{value: -1, expected: 50},
+		{value: -1, expected: 40},
+	} {
+		p.ChangeVote(0, tc.value)
+		assert.Equal(t, tc.expected, p.UpvotePercentage)
+		assert.Equal(t, (p.Score+p.VoteCount())/2*100/p.VoteCount(), p.UpvotePercentage)
+	}
+}
+
+func TestInitPostRendersMarkdown(t *testing.T) {
+	p := Post{Type: TEXT, Text: "**bold** <script>alert(1)</script>"}
+	InitPost(&p, user.User{ID: "1", Username: "username"})
+	assert.Equal(t, "**bold** <script>alert(1)</script>", p.Text)
+	assert.Equal(t, "<p><strong>bold</strong> alert(1)</p>\n", p.TextHTML)
+}
@@ -2,56 +2,112 @@ package post
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/unfurl"
+	"github.com/greatjudge/redditclone/pkg/upload"
+	"github.com/greatjudge/redditclone/pkg/vote"
 )
 
 type PostMemoryRepository struct {
 	id2Post map[string]*Post
-	mu      *sync.RWMutex
+	// comments of every post in the order they were added
+	comments map[string][]comment.Comment
+	// votes of every post by user id
+	votes map[string]map[string]int
+	// options chosen in every poll by user id
+	pollVotes map[string]map[string]int
+	mu        *sync.RWMutex
 }
 
 func NewMemoryRepo() *PostMemoryRepository {
 	return &PostMemoryRepository{
-		id2Post: make(map[string]*Post),
-		mu:      &sync.RWMutex{},
+		id2Post:   make(map[string]*Post),
+		comments:  make(map[string][]comment.Comment),
+		votes:     make(map[string]map[string]int),
+		pollVotes: make(map[string]map[string]int),
+		mu:        &sync.RWMutex{},
 	}
 }
 
-func (repo *PostMemoryRepository) GetAll() ([]Post, error) {
+// livePost returns the post unless it is missing or deleted.
+func (repo *PostMemoryRepository) livePost(id string) (*Post, bool) {
+	post, ok := repo.id2Post[id]
+	if !ok || post.DeletedAt != nil {
+		return nil, false
+	}
+	return post, true
+}
+
+// findLiveComment returns the index of the comment unless it is missing
+// or deleted, -1 otherwise.
+func (repo *PostMemoryRepository) findLiveComment(postID string, commentID string) int {
+	i := repo.findComment(postID, commentID)
+	if i == -1 || repo.comments[postID][i].DeletedAt != nil {
+		return -1
+	}
+	return i
+}
+
+// findComment returns the index of the comment, -1 if there is none.
+func (repo *PostMemoryRepository) findComment(postID string, commentID string) int {
+	for i, comm := range repo.comments[postID] {
+		if comm.ID == commentID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (repo *PostMemoryRepository) GetAll(f Filter) ([]Post, error) {
 	repo.mu.RLock()
 	defer repo.mu.RUnlock()
 	posts := make([]Post, 0, len(repo.id2Post))
 	for _, post := range repo.id2Post {
-		posts = append(posts, *post)
+		if post.DeletedAt == nil {
+			posts = append(posts, *post)
+		}
 	}
-	return posts, nil
+	return f.ApplyAll(posts), nil
 }
 
 func (repo *PostMemoryRepository) GetByID(id string) (Post, error) {
 	repo.mu.RLock()
 	defer repo.mu.RUnlock()
-	post, ok := repo.id2Post[id]
+	post, ok := repo.livePost(id)
 	if !ok {
 		return Post{}, ErrNoPost
 	}
-	post.Views += 1
 	return *post, nil
 }
 
-func (repo *PostMemoryRepository) GetByCategory(category string) ([]Post, error) {
+func (repo *PostMemoryRepository) GetByIDs(ids []string) ([]Post, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	posts := make([]Post, 0, len(ids))
+	for _, id := range ids {
+		if post, ok := repo.livePost(id); ok {
+			posts = append(posts, *post)
+		}
+	}
+	return posts, nil
+}
+
+func (repo *PostMemoryRepository) GetByCategory(category string, f Filter) ([]Post, error) {
 	repo.mu.RLock()
 	defer repo.mu.RUnlock()
 	posts := make([]Post, 0, len(repo.id2Post))
 	for _, post := range repo.id2Post {
-		if post.Category == category {
+		if post.Category == category && post.DeletedAt == nil {
 			posts = append(posts, *post)
 		}
 	}
-	return posts, nil
+	return f.ApplyAll(posts), nil
 }
 
 func (repo *PostMemoryRepository) Add(post Post) (Post, error) {
@@ -63,102 +119,259 @@ func (repo *PostMemoryRepository) Add(post Post) (Post, error) {
 	}
 	post.ID = uid.String()
 	post.Created = CreationTime()
-	repo.id2Post[post.ID] = &post
+	stored := post
+	stored.Votes = nil
+	repo.id2Post[post.ID] = &stored
+	repo.votes[post.ID] = make(map[string]int)
+	for _, v := range post.Votes {
+		repo.votes[post.ID][v.UserID] = v.Value
+	}
 	return post, nil
 }
 
-func (repo *PostMemoryRepository) AddComment(postID string, comm comment.Comment) (Post, error) {
+func (repo *PostMemoryRepository) AddComment(postID string, comm comment.Comment) (comment.Comment, error) {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
-	post, ok := repo.id2Post[postID]
+	post, ok := repo.livePost(postID)
 	if !ok {
-		return Post{}, ErrNoPost
+		return comment.Comment{}, ErrNoPost
 	}
-
-	uid, err := uuid.NewUUID()
-	if err != nil {
-		return Post{}, fmt.Errorf("in post add comment: %w", err)
+	parentIdx := -1
+	if comm.ParentID != "" {
+		parentIdx = repo.findLiveComment(postID, comm.ParentID)
+		if parentIdx == -1 {
+			return comment.Comment{}, comment.ErrNoComment
+		}
 	}
 
-	comm.ID = uid.String()
+	if comm.ID == "" {
+		uid, err := uuid.NewUUID()
+		if err != nil {
+			return comment.Comment{}, fmt.Errorf("in post add comment: %w", err)
+		}
+		comm.ID = uid.String()
+	}
+	comm.PostID = postID
 	comm.Created = CreationTime()
-	post.Comments = append(post.Comments, comm)
-	return *post, nil
+	if parentIdx != -1 {
+		repo.comments[postID][parentIdx].ReplyCount++
+	}
+	repo.comments[postID] = append(repo.comments[postID], comm)
+	post.CommentCount++
+	return comm, nil
 }
 
-func (repo *PostMemoryRepository) DeleteComment(postID string, commentID string, userID string) (Post, error) {
+func (repo *PostMemoryRepository) DeleteComment(postID string, commentID string) error {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
-	post, ok := repo.id2Post[postID]
+	post, ok := repo.livePost(postID)
 	if !ok {
-		return Post{}, ErrNoPost
+		return ErrNoPost
+	}
+	commIdx := repo.findLiveComment(postID, commentID)
+	if commIdx == -1 {
+		return comment.ErrNoComment
 	}
 
-	commIdx := -1
-	for i, comm := range post.Comments {
-		if comm.ID == commentID {
-			commIdx = i
+	comm := &repo.comments[postID][commIdx]
+	now := time.Now()
+	comm.DeletedAt = &now
+	post.CommentCount--
+	return nil
+}
+
+func (repo *PostMemoryRepository) GetComment(postID string, commentID string) (comment.Comment, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	commIdx := repo.findLiveComment(postID, commentID)
+	if commIdx == -1 {
+		return comment.Comment{}, comment.ErrNoComment
+	}
+	return repo.comments[postID][commIdx], nil
+}
+
+func (repo *PostMemoryRepository) GetComments(postID string, f Filter, offset int, limit int) ([]comment.Comment, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	comments := make([]comment.Comment, 0)
+	for _, comm := range repo.comments[postID] {
+		if f.Blocks(comm.Author.ID) || !comm.Visible() {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if len(comments) == limit {
 			break
 		}
+		if comm.DeletedAt != nil {
+			comm = comm.Placeholder()
+		}
+		comments = append(comments, comm)
 	}
-	if commIdx == -1 {
-		return Post{}, comment.ErrNoComment
-	}
+	return comments, nil
+}
 
-	comm := post.Comments[commIdx]
-	if comm.Author.ID != userID {
-		return Post{}, ErrNoAccess
+func (repo *PostMemoryRepository) GetCommentsByIDs(ids []string) ([]comment.Comment, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	comments := make([]comment.Comment, 0, len(ids))
+	for _, comms := range repo.comments {
+		for _, comm := range comms {
+			if contains(ids, comm.ID) && comm.DeletedAt == nil {
+				comments = append(comments, comm)
+			}
+		}
 	}
-	post.Comments[commIdx] = post.Comments[len(post.Comments)-1]
-	post.Comments = post.Comments[:len(post.Comments)-1]
-	return *post, nil
+	return comments, nil
 }
 
-func (repo *PostMemoryRepository) Upvote(postID string, userID string) (Post, error) {
+func (repo *PostMemoryRepository) vote(postID string, userID string, value int) (Post, error) {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
-	post, ok := repo.id2Post[postID]
+	post, ok := repo.livePost(postID)
 	if !ok {
 		return Post{}, ErrNoPost
 	}
-	post.Upvote(userID)
-	return *post, nil
+	votes := repo.votes[postID]
+	if votes == nil {
+		votes = make(map[string]int)
+		repo.votes[postID] = votes
+	}
+	post.ChangeVote(votes[userID], value)
+	if value == 0 {
+		delete(votes, userID)
+	} else {
+		votes[userID] = value
+	}
+	return post.WithVote(userID, value), nil
+}
+
+func (repo *PostMemoryRepository) Upvote(postID string, userID string) (Post, error) {
+	return repo.vote(postID, userID, 1)
 }
 
 func (repo *PostMemoryRepository) Downvote(postID string, userID string) (Post, error) {
+	return repo.vote(postID, userID, -1)
+}
+
+func (repo *PostMemoryRepository) Unvote(postID string, userID string) (Post, error) {
+	return repo.vote(postID, userID, 0)
+}
+
+func (repo *PostMemoryRepository) GetVotes(userID string, postIDs []string) ([]vote.Vote, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	votes := make([]vote.Vote, 0)
+	for _, postID := range postIDs {
+		if value, ok := repo.votes[postID][userID]; ok {
+			votes = append(votes, vote.Vote{PostID: postID, UserID: userID, Value: value})
+		}
+	}
+	return votes, nil
+}
+
+func (repo *PostMemoryRepository) Delete(postID string) error {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
+	post, ok := repo.livePost(postID)
+	if !ok {
+		return ErrNoPost
+	}
+	now := time.Now()
+	post.DeletedAt = &now
+	return nil
+}
+
+func (repo *PostMemoryRepository) GetAuthorID(postID string, commentID string) (string, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
 	post, ok := repo.id2Post[postID]
 	if !ok {
-		return Post{}, ErrNoPost
+		return "", ErrNoPost
 	}
-	post.Downvote(userID)
-	return *post, nil
+	if commentID == "" {
+		return post.Author.ID, nil
+	}
+	commIdx := repo.findComment(postID, commentID)
+	if commIdx == -1 {
+		return "", comment.ErrNoComment
+	}
+	return repo.comments[postID][commIdx].Author.ID, nil
 }
 
-func (repo *PostMemoryRepository) Unvote(postID string, userID string) (Post, error) {
+func (repo *PostMemoryRepository) Restore(postID string, deletedAfter time.Time) (Post, error) {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
 	post, ok := repo.id2Post[postID]
 	if !ok {
 		return Post{}, ErrNoPost
 	}
-	post.Unvote(userID)
+	if post.DeletedAt == nil || !post.DeletedAt.After(deletedAfter) {
+		return Post{}, ErrNotRestorable
+	}
+	post.DeletedAt = nil
 	return *post, nil
 }
 
-func (repo *PostMemoryRepository) Delete(postID string, userID string) error {
+func (repo *PostMemoryRepository) RestoreComment(postID string, commentID string, deletedAfter time.Time) (comment.Comment, error) {
 	repo.mu.Lock()
 	defer repo.mu.Unlock()
-	post, ok := repo.id2Post[postID]
+	post, ok := repo.livePost(postID)
 	if !ok {
-		return ErrNoPost
+		return comment.Comment{}, ErrNoPost
+	}
+	commIdx := repo.findComment(postID, commentID)
+	if commIdx == -1 {
+		return comment.Comment{}, comment.ErrNoComment
 	}
-	if post.Author.ID != userID {
-		return ErrNoAccess
+	comm := &repo.comments[postID][commIdx]
+	if comm.DeletedAt == nil || !comm.DeletedAt.After(deletedAfter) {
+		return comment.Comment{}, ErrNotRestorable
 	}
-	delete(repo.id2Post, postID)
-	return nil
+	comm.DeletedAt = nil
+	post.CommentCount++
+	return *comm, nil
+}
+
+// Purge removes posts deleted before deletedBefore with everything in them,
+// and deleted comments without replies. Comments left as placeholders go
+// once their replies are purged.
+func (repo *PostMemoryRepository) Purge(deletedBefore time.Time) (int, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	purged := 0
+	for postID, post := range repo.id2Post {
+		if isDeletedBefore(post.DeletedAt, deletedBefore) {
+			delete(repo.id2Post, postID)
+			delete(repo.comments, postID)
+			delete(repo.votes, postID)
+			purged++
+			continue
+		}
+		kept := make([]comment.Comment, 0, len(repo.comments[postID]))
+		var gone []comment.Comment
+		for _, comm := range repo.comments[postID] {
+			if isDeletedBefore(comm.DeletedAt, deletedBefore) && comm.ReplyCount == 0 {
+				gone = append(gone, comm)
+				continue
+			}
+			kept = append(kept, comm)
+		}
+		repo.comments[postID] = kept
+		for _, comm := range gone {
+			if i := repo.findComment(postID, comm.ParentID); i != -1 {
+				repo.comments[postID][i].ReplyCount--
+			}
+		}
+		purged += len(gone)
+	}
+	return purged, nil
+}
+
+func isDeletedBefore(deletedAt *time.Time, t time.Time) bool {
+	return deletedAt != nil && deletedAt.Before(t)
 }
 
 func (repo *PostMemoryRepository) GetUserPosts(username string) ([]Post, error) {
@@ -166,9 +379,199 @@ func (repo *PostMemoryRepository) GetUserPosts(username string) ([]Post, error)
 	defer repo.mu.RUnlock()
 	posts := make([]Post, 0)
 	for _, p := range repo.id2Post {
-		if p.Author.Username == username {
+		if p.Author.Username == username && p.DeletedAt == nil {
 			posts = append(posts, *p)
 		}
 	}
 	return posts, nil
 }
+
+func (repo *PostMemoryRepository) SetPreview(postID string, preview unfurl.Preview) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	post, ok := repo.livePost(postID)
+	if !ok {
+		return ErrNoPost
+	}
+	post.Preview = &preview
+	return nil
+}
+
+// AddViews adds buffered view counts, unknown posts are skipped.
+func (repo *PostMemoryRepository) AddViews(counts map[string]int) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for postID, n := range counts {
+		if post, ok := repo.livePost(postID); ok {
+			post.Views += n
+		}
+	}
+	return nil
+}
+
+func (repo *PostMemoryRepository) GetByNormalizedURL(category string, normalizedURL string) (Post, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	for _, p := range repo.id2Post {
+		if p.Category == category && p.NormalizedURL == normalizedURL && p.DeletedAt == nil {
+			return *p, nil
+		}
+	}
+	return Post{}, ErrNoPost
+}
+
+func (repo *PostMemoryRepository) VotePoll(postID string, userID string, option int) (Post, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	post, ok := repo.livePost(postID)
+	if !ok {
+		return Post{}, ErrNoPost
+	}
+	if err := post.checkPollVote(option, time.Now()); err != nil {
+		return Post{}, err
+	}
+	votes := repo.pollVotes[postID]
+	if votes == nil {
+		votes = make(map[string]int)
+		repo.pollVotes[postID] = votes
+	}
+	if _, voted := votes[userID]; voted {
+		return Post{}, ErrAlreadyVoted
+	}
+	votes[userID] = option
+	post.countPollVote(option, 1)
+	return post.WithPollVote(option), nil
+}
+
+func (repo *PostMemoryRepository) GetPollVotes(userID string, postIDs []string) ([]PollVote, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	votes := make([]PollVote, 0)
+	for _, postID := range postIDs {
+		if option, ok := repo.pollVotes[postID][userID]; ok {
+			votes = append(votes, PollVote{PostID: postID, UserID: userID, Option: option})
+		}
+	}
+	return votes, nil
+}
+
+func (repo *PostMemoryRepository) GetUserActivity(username string, offset int, limit int) ([]Activity, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	items := make([]Activity, 0)
+	for _, p := range repo.id2Post {
+		if p.DeletedAt == nil {
+			items = append(items, p.userActivity(username, repo.comments[p.ID])...)
+		}
+	}
+	sortActivity(items)
+	return paginate(items, offset, limit), nil
+}
+
+func (repo *PostMemoryRepository) GetUserKarma(username string) (Karma, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	karma := Karma{}
+	for _, p := range repo.id2Post {
+		if p.DeletedAt != nil {
+			continue
+		}
+		if p.Author.Username == username {
+			karma.Post += p.Score
+			karma.PostCount++
+		}
+		for _, comm := range repo.comments[p.ID] {
+			if comm.Author.Username == username && comm.DeletedAt == nil {
+				karma.CommentCount++
+			}
+		}
+	}
+	return karma, nil
+}
+
+func (repo *PostMemoryRepository) EraseUser(userID string, policy ErasePolicy) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	now := time.Now()
+	for postID, post := range repo.id2Post {
+		comments := repo.comments[postID]
+		for i := range comments {
+			if comments[i].Author.ID != userID {
+				continue
+			}
+			if policy == EraseDelete && comments[i].DeletedAt == nil {
+				comments[i].DeletedAt = &now
+				post.CommentCount--
+			}
+			comments[i].Author = ErasedAuthor
+		}
+		if post.Author.ID == userID {
+			if policy == EraseDelete && post.DeletedAt == nil {
+				post.DeletedAt = &now
+			}
+			post.Author = ErasedAuthor
+			post.Image = nil
+		}
+		delete(repo.votes[postID], userID)
+		if option, ok := repo.pollVotes[postID][userID]; ok {
+			post.countPollVote(option, -1)
+			delete(repo.pollVotes[postID], userID)
+		}
+	}
+	return nil
+}
+
+func (repo *PostMemoryRepository) UserImages(userID string) ([]upload.Image, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	images := make([]upload.Image, 0)
+	shared := make(map[string]bool)
+	for _, post := range repo.id2Post {
+		switch {
+		case post.Image == nil:
+		case post.Author.ID == userID:
+			images = append(images, *post.Image)
+		default:
+			shared[post.Image.Key] = true
+		}
+	}
+	own := make([]upload.Image, 0, len(images))
+	for _, img := range images {
+		if !shared[img.Key] {
+			own = append(own, img)
+		}
+	}
+	return own, nil
+}
+
+func (repo *PostMemoryRepository) ExportUserData(userID string) (UserData, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	data := UserData{
+		Posts:     make([]Post, 0),
+		Comments:  make([]comment.Comment, 0),
+		Votes:     make([]vote.Vote, 0),
+		PollVotes: make([]PollVote, 0),
+	}
+	for postID, post := range repo.id2Post {
+		if post.Author.ID == userID {
+			data.Posts = append(data.Posts, *post)
+		}
+		for _, comm := range repo.comments[postID] {
+			if comm.Author.ID == userID {
+				data.Comments = append(data.Comments, comm)
+			}
+		}
+		if value, ok := repo.votes[postID][userID]; ok {
+			data.Votes = append(data.Votes, vote.Vote{PostID: postID, UserID: userID, Value: value})
+		}
+		if option, ok := repo.pollVotes[postID][userID]; ok {
+			data.PollVotes = append(data.PollVotes, PollVote{PostID: postID, UserID: userID, Option: option})
+		}
+	}
+	sort.Slice(data.Posts, func(i, j int) bool { return data.Posts[i].Created < data.Posts[j].Created })
+	sort.Slice(data.Comments, func(i, j int) bool { return data.Comments[i].Created < data.Comments[j].Created })
+	sort.Slice(data.Votes, func(i, j int) bool { return data.Votes[i].PostID < data.Votes[j].PostID })
+	sort.Slice(data.PollVotes, func(i, j int) bool { return data.PollVotes[i].PostID < data.PollVotes[j].PostID })
+	return data, nil
+}
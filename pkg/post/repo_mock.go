@@ -6,9 +6,13 @@ package post
 
 import (
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	comment "github.com/greatjudge/redditclone/pkg/comment"
+	unfurl "github.com/greatjudge/redditclone/pkg/unfurl"
+	upload "github.com/greatjudge/redditclone/pkg/upload"
+	vote "github.com/greatjudge/redditclone/pkg/vote"
 )
 
 // MockPostRepo is a mock of PostRepo interface.
@@ -50,47 +54,60 @@ func (mr *MockPostRepoMockRecorder) Add(post interface{}) *gomock.Call {
 }
 
 // AddComment mocks base method.
-func (m *MockPostRepo) AddComment(id string, comm comment.Comment) (Post, error) {
+func (m *MockPostRepo) AddComment(postID string, comm comment.Comment) (comment.Comment, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddComment", id, comm)
-	ret0, _ := ret[0].(Post)
+	ret := m.ctrl.Call(m, "AddComment", postID, comm)
+	ret0, _ := ret[0].(comment.Comment)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AddComment indicates an expected call of AddComment.
-func (mr *MockPostRepoMockRecorder) AddComment(id, comm interface{}) *gomock.Call {
+func (mr *MockPostRepoMockRecorder) AddComment(postID, comm interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddComment", reflect.TypeOf((*MockPostRepo)(nil).AddComment), id, comm)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddComment", reflect.TypeOf((*MockPostRepo)(nil).AddComment), postID, comm)
+}
+
+// AddViews mocks base method.
+func (m *MockPostRepo) AddViews(counts map[string]int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddViews", counts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddViews indicates an expected call of AddViews.
+func (mr *MockPostRepoMockRecorder) AddViews(counts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddViews", reflect.TypeOf((*MockPostRepo)(nil).AddViews), counts)
 }
 
 // Delete mocks base method.
-func (m *MockPostRepo) Delete(postID, userID string) error {
+func (m *MockPostRepo) Delete(postID string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Delete", postID, userID)
+	ret := m.ctrl.Call(m, "Delete", postID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Delete indicates an expected call of Delete.
-func (mr *MockPostRepoMockRecorder) Delete(postID, userID interface{}) *gomock.Call {
+func (mr *MockPostRepoMockRecorder) Delete(postID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockPostRepo)(nil).Delete), postID, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockPostRepo)(nil).Delete), postID)
 }
 
 // DeleteComment mocks base method.
-func (m *MockPostRepo) DeleteComment(postID, commentID, userID string) (Post, error) {
+func (m *MockPostRepo) DeleteComment(postID, commentID string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteComment", postID, commentID, userID)
-	ret0, _ := ret[0].(Post)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret := m.ctrl.Call(m, "DeleteComment", postID, commentID)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // DeleteComment indicates an expected call of DeleteComment.
-func (mr *MockPostRepoMockRecorder) DeleteComment(postID, commentID, userID interface{}) *gomock.Call {
+func (mr *MockPostRepoMockRecorder) DeleteComment(postID, commentID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteComment", reflect.TypeOf((*MockPostRepo)(nil).DeleteComment), postID, commentID, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteComment", reflect.TypeOf((*MockPostRepo)(nil).DeleteComment), postID, commentID)
 }
 
 // Downvote mocks base method.
@@ -108,34 +125,78 @@ func (mr *MockPostRepoMockRecorder) Downvote(postID, userID interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Downvote", reflect.TypeOf((*MockPostRepo)(nil).Downvote), postID, userID)
 }
 
+// EraseUser mocks base method.
+func (m *MockPostRepo) EraseUser(userID string, policy ErasePolicy) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EraseUser", userID, policy)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EraseUser indicates an expected call of EraseUser.
+func (mr *MockPostRepoMockRecorder) EraseUser(userID, policy interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EraseUser", reflect.TypeOf((*MockPostRepo)(nil).EraseUser), userID, policy)
+}
+
+// ExportUserData mocks base method.
+func (m *MockPostRepo) ExportUserData(userID string) (UserData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportUserData", userID)
+	ret0, _ := ret[0].(UserData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportUserData indicates an expected call of ExportUserData.
+func (mr *MockPostRepoMockRecorder) ExportUserData(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportUserData", reflect.TypeOf((*MockPostRepo)(nil).ExportUserData), userID)
+}
+
 // GetAll mocks base method.
-func (m *MockPostRepo) GetAll() ([]Post, error) {
+func (m *MockPostRepo) GetAll(f Filter) ([]Post, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAll")
+	ret := m.ctrl.Call(m, "GetAll", f)
 	ret0, _ := ret[0].([]Post)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAll indicates an expected call of GetAll.
-func (mr *MockPostRepoMockRecorder) GetAll() *gomock.Call {
+func (mr *MockPostRepoMockRecorder) GetAll(f interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockPostRepo)(nil).GetAll), f)
+}
+
+// GetAuthorID mocks base method.
+func (m *MockPostRepo) GetAuthorID(postID, commentID string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuthorID", postID, commentID)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuthorID indicates an expected call of GetAuthorID.
+func (mr *MockPostRepoMockRecorder) GetAuthorID(postID, commentID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockPostRepo)(nil).GetAll))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuthorID", reflect.TypeOf((*MockPostRepo)(nil).GetAuthorID), postID, commentID)
 }
 
 // GetByCategory mocks base method.
-func (m *MockPostRepo) GetByCategory(category string) ([]Post, error) {
+func (m *MockPostRepo) GetByCategory(category string, f Filter) ([]Post, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetByCategory", category)
+	ret := m.ctrl.Call(m, "GetByCategory", category, f)
 	ret0, _ := ret[0].([]Post)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetByCategory indicates an expected call of GetByCategory.
-func (mr *MockPostRepoMockRecorder) GetByCategory(category interface{}) *gomock.Call {
+func (mr *MockPostRepoMockRecorder) GetByCategory(category, f interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByCategory", reflect.TypeOf((*MockPostRepo)(nil).GetByCategory), category)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByCategory", reflect.TypeOf((*MockPostRepo)(nil).GetByCategory), category, f)
 }
 
 // GetByID mocks base method.
@@ -153,6 +214,126 @@ func (mr *MockPostRepoMockRecorder) GetByID(id interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockPostRepo)(nil).GetByID), id)
 }
 
+// GetByIDs mocks base method.
+func (m *MockPostRepo) GetByIDs(ids []string) ([]Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByIDs", ids)
+	ret0, _ := ret[0].([]Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByIDs indicates an expected call of GetByIDs.
+func (mr *MockPostRepoMockRecorder) GetByIDs(ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByIDs", reflect.TypeOf((*MockPostRepo)(nil).GetByIDs), ids)
+}
+
+// GetByNormalizedURL mocks base method.
+func (m *MockPostRepo) GetByNormalizedURL(category, normalizedURL string) (Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByNormalizedURL", category, normalizedURL)
+	ret0, _ := ret[0].(Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByNormalizedURL indicates an expected call of GetByNormalizedURL.
+func (mr *MockPostRepoMockRecorder) GetByNormalizedURL(category, normalizedURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByNormalizedURL", reflect.TypeOf((*MockPostRepo)(nil).GetByNormalizedURL), category, normalizedURL)
+}
+
+// GetComment mocks base method.
+func (m *MockPostRepo) GetComment(postID, commentID string) (comment.Comment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetComment", postID, commentID)
+	ret0, _ := ret[0].(comment.Comment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetComment indicates an expected call of GetComment.
+func (mr *MockPostRepoMockRecorder) GetComment(postID, commentID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetComment", reflect.TypeOf((*MockPostRepo)(nil).GetComment), postID, commentID)
+}
+
+// GetComments mocks base method.
+func (m *MockPostRepo) GetComments(postID string, f Filter, offset, limit int) ([]comment.Comment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetComments", postID, f, offset, limit)
+	ret0, _ := ret[0].([]comment.Comment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetComments indicates an expected call of GetComments.
+func (mr *MockPostRepoMockRecorder) GetComments(postID, f, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetComments", reflect.TypeOf((*MockPostRepo)(nil).GetComments), postID, f, offset, limit)
+}
+
+// GetCommentsByIDs mocks base method.
+func (m *MockPostRepo) GetCommentsByIDs(ids []string) ([]comment.Comment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommentsByIDs", ids)
+	ret0, _ := ret[0].([]comment.Comment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCommentsByIDs indicates an expected call of GetCommentsByIDs.
+func (mr *MockPostRepoMockRecorder) GetCommentsByIDs(ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommentsByIDs", reflect.TypeOf((*MockPostRepo)(nil).GetCommentsByIDs), ids)
+}
+
+// GetPollVotes mocks base method.
+func (m *MockPostRepo) GetPollVotes(userID string, postIDs []string) ([]PollVote, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPollVotes", userID, postIDs)
+	ret0, _ := ret[0].([]PollVote)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPollVotes indicates an expected call of GetPollVotes.
+func (mr *MockPostRepoMockRecorder) GetPollVotes(userID, postIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPollVotes", reflect.TypeOf((*MockPostRepo)(nil).GetPollVotes), userID, postIDs)
+}
+
+// GetUserActivity mocks base method.
+func (m *MockPostRepo) GetUserActivity(username string, offset, limit int) ([]Activity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserActivity", username, offset, limit)
+	ret0, _ := ret[0].([]Activity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserActivity indicates an expected call of GetUserActivity.
+func (mr *MockPostRepoMockRecorder) GetUserActivity(username, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserActivity", reflect.TypeOf((*MockPostRepo)(nil).GetUserActivity), username, offset, limit)
+}
+
+// GetUserKarma mocks base method.
+func (m *MockPostRepo) GetUserKarma(username string) (Karma, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserKarma", username)
+	ret0, _ := ret[0].(Karma)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserKarma indicates an expected call of GetUserKarma.
+func (mr *MockPostRepoMockRecorder) GetUserKarma(username interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserKarma", reflect.TypeOf((*MockPostRepo)(nil).GetUserKarma), username)
+}
+
 // GetUserPosts mocks base method.
 func (m *MockPostRepo) GetUserPosts(username string) ([]Post, error) {
 	m.ctrl.T.Helper()
@@ -168,6 +349,80 @@ func (mr *MockPostRepoMockRecorder) GetUserPosts(username interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserPosts", reflect.TypeOf((*MockPostRepo)(nil).GetUserPosts), username)
 }
 
+// GetVotes mocks base method.
+func (m *MockPostRepo) GetVotes(userID string, postIDs []string) ([]vote.Vote, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVotes", userID, postIDs)
+	ret0, _ := ret[0].([]vote.Vote)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVotes indicates an expected call of GetVotes.
+func (mr *MockPostRepoMockRecorder) GetVotes(userID, postIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVotes", reflect.TypeOf((*MockPostRepo)(nil).GetVotes), userID, postIDs)
+}
+
+// Purge mocks base method.
+func (m *MockPostRepo) Purge(deletedBefore time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", deletedBefore)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Purge indicates an expected call of Purge.
+func (mr *MockPostRepoMockRecorder) Purge(deletedBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockPostRepo)(nil).Purge), deletedBefore)
+}
+
+// Restore mocks base method.
+func (m *MockPostRepo) Restore(postID string, deletedAfter time.Time) (Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restore", postID, deletedAfter)
+	ret0, _ := ret[0].(Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Restore indicates an expected call of Restore.
+func (mr *MockPostRepoMockRecorder) Restore(postID, deletedAfter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockPostRepo)(nil).Restore), postID, deletedAfter)
+}
+
+// RestoreComment mocks base method.
+func (m *MockPostRepo) RestoreComment(postID, commentID string, deletedAfter time.Time) (comment.Comment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreComment", postID, commentID, deletedAfter)
+	ret0, _ := ret[0].(comment.Comment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreComment indicates an expected call of RestoreComment.
+func (mr *MockPostRepoMockRecorder) RestoreComment(postID, commentID, deletedAfter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreComment", reflect.TypeOf((*MockPostRepo)(nil).RestoreComment), postID, commentID, deletedAfter)
+}
+
+// SetPreview mocks base method.
+func (m *MockPostRepo) SetPreview(postID string, preview unfurl.Preview) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPreview", postID, preview)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPreview indicates an expected call of SetPreview.
+func (mr *MockPostRepoMockRecorder) SetPreview(postID, preview interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPreview", reflect.TypeOf((*MockPostRepo)(nil).SetPreview), postID, preview)
+}
+
 // Unvote mocks base method.
 func (m *MockPostRepo) Unvote(postID, userID string) (Post, error) {
 	m.ctrl.T.Helper()
@@ -197,3 +452,33 @@ func (mr *MockPostRepoMockRecorder) Upvote(postID, userID interface{}) *gomock.C
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upvote", reflect.TypeOf((*MockPostRepo)(nil).Upvote), postID, userID)
 }
+
+// UserImages mocks base method.
+func (m *MockPostRepo) UserImages(userID string) ([]upload.Image, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserImages", userID)
+	ret0, _ := ret[0].([]upload.Image)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UserImages indicates an expected call of UserImages.
+func (mr *MockPostRepoMockRecorder) UserImages(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserImages", reflect.TypeOf((*MockPostRepo)(nil).UserImages), userID)
+}
+
+// VotePoll mocks base method.
+func (m *MockPostRepo) VotePoll(postID, userID string, option int) (Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VotePoll", postID, userID, option)
+	ret0, _ := ret[0].(Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VotePoll indicates an expected call of VotePoll.
+func (mr *MockPostRepoMockRecorder) VotePoll(postID, userID, option interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VotePoll", reflect.TypeOf((*MockPostRepo)(nil).VotePoll), postID, userID, option)
+}
@@ -4,29 +4,113 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/markdown"
+	"github.com/greatjudge/redditclone/pkg/unfurl"
+	"github.com/greatjudge/redditclone/pkg/upload"
+	"github.com/greatjudge/redditclone/pkg/vote"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type PostMongoDBRepository struct {
-	posts CollectionHelper
+	posts     CollectionHelper
+	comments  CollectionHelper
+	votes     CollectionHelper
+	pollVotes CollectionHelper
 }
 
-func NewMongoDBRepo(collecion *mongo.Collection) *PostMongoDBRepository {
-	mc := &MongoCollection{
-		Coll: collecion,
-	}
+func NewMongoDBRepo(collecion *mongo.Collection, comments *mongo.Collection, votes *mongo.Collection, pollVotes *mongo.Collection) *PostMongoDBRepository {
 	return &PostMongoDBRepository{
-		posts: mc,
+		posts:     &MongoCollection{Coll: collecion},
+		comments:  &MongoCollection{Coll: comments},
+		votes:     &MongoCollection{Coll: votes},
+		pollVotes: &MongoCollection{Coll: pollVotes},
 	}
 }
 
-func (repo *PostMongoDBRepository) GetAll() ([]Post, error) {
+// EnsureIndexes creates the indexes the repository queries rely on.
+func (repo *PostMongoDBRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := repo.posts.CreateIndex(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "category", Value: 1},
+			{Key: "normalized_url", Value: 1},
+		},
+		Options: options.Index().
+			SetName("category_normalized_url").
+			SetPartialFilterExpression(bson.M{"normalized_url": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		return fmt.Errorf("fail to create normalized_url index: %w", err)
+	}
+	_, err = repo.posts.CreateIndex(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "author.username", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("fail to create author.username index: %w", err)
+	}
+
+	commentIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "post_id", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "author.username", Value: 1}}},
+	}
+	for _, model := range commentIndexes {
+		_, err = repo.comments.CreateIndex(ctx, model)
+		if err != nil {
+			return fmt.Errorf("fail to create comments index: %w", err)
+		}
+	}
+
+	_, err = repo.votes.CreateIndex(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "user", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("fail to create votes index: %w", err)
+	}
+	_, err = repo.pollVotes.CreateIndex(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("fail to create poll votes index: %w", err)
+	}
+	return nil
+}
+
+// notDeleted leaves soft deleted documents out of a query.
+func notDeleted(query bson.M) bson.M {
+	query["deleted_at"] = bson.M{"$exists": false}
+	return query
+}
+
+// filterQuery adds the viewer filter to a query, comments of blocked
+// users are dropped after decoding.
+func filterQuery(query bson.M, f Filter) bson.M {
+	if len(f.HiddenPosts) != 0 {
+		query["_id"] = bson.M{"$nin": f.HiddenPosts}
+	}
+	if len(f.BlockedUsers) != 0 {
+		query["author.id"] = bson.M{"$nin": f.BlockedUsers}
+	}
+	return query
+}
+
+func applyToComments(posts []Post, f Filter) []Post {
+	for i := range posts {
+		posts[i] = f.Apply(posts[i])
+	}
+	return posts
+}
+
+func (repo *PostMongoDBRepository) GetAll(f Filter) ([]Post, error) {
 	posts := []Post{}
-	c, err := repo.posts.Find(context.Background(), bson.D{})
+	c, err := repo.posts.Find(context.Background(), filterQuery(notDeleted(bson.M{}), f))
 	if err != nil {
 		return nil, fmt.Errorf("fail to get posts %w", err)
 	}
@@ -34,12 +118,12 @@ func (repo *PostMongoDBRepository) GetAll() ([]Post, error) {
 	if err != nil {
 		return nil, fmt.Errorf("fail to get all posts %w", err)
 	}
-	return posts, nil
+	return applyToComments(posts, f), nil
 }
 
 func (repo *PostMongoDBRepository) getPost(id string) (Post, error) {
 	post := Post{}
-	filter := bson.M{"_id": id}
+	filter := notDeleted(bson.M{"_id": id})
 	err := repo.posts.FindOne(context.Background(), filter).Decode(&post)
 	switch {
 	case errors.Is(err, mongo.ErrNoDocuments):
@@ -51,20 +135,26 @@ func (repo *PostMongoDBRepository) getPost(id string) (Post, error) {
 }
 
 func (repo *PostMongoDBRepository) GetByID(id string) (Post, error) {
-	post, err := repo.getPost(id)
+	return repo.getPost(id)
+}
+
+// GetByIDs returns the posts found, missing ids are skipped.
+func (repo *PostMongoDBRepository) GetByIDs(ids []string) ([]Post, error) {
+	posts := make([]Post, 0, len(ids))
+	c, err := repo.posts.Find(context.Background(), notDeleted(bson.M{"_id": bson.M{"$in": ids}}))
 	if err != nil {
-		return post, err
+		return nil, fmt.Errorf("fail to find posts by ids %w", err)
 	}
-	post.Views += 1
-	filter := bson.M{"_id": id}
-	update := bson.M{"$set": bson.M{"views": post.Views}}
-	_, err = repo.posts.UpdateOne(context.Background(), filter, update)
-	return post, err
+	err = c.All(context.Background(), &posts)
+	if err != nil {
+		return nil, fmt.Errorf("fail to get all posts %w", err)
+	}
+	return posts, nil
 }
 
-func (repo *PostMongoDBRepository) GetByCategory(category string) ([]Post, error) {
+func (repo *PostMongoDBRepository) GetByCategory(category string, f Filter) ([]Post, error) {
 	posts := make([]Post, 0)
-	c, err := repo.posts.Find(context.Background(), bson.M{"category": category})
+	c, err := repo.posts.Find(context.Background(), filterQuery(notDeleted(bson.M{"category": category}), f))
 	if err != nil {
 		return nil, fmt.Errorf(`fail to find posts by caterory "%v" %w`, category, err)
 	}
@@ -72,7 +162,7 @@ func (repo *PostMongoDBRepository) GetByCategory(category string) ([]Post, error
 	if err != nil {
 		return nil, fmt.Errorf("fail to get all posts %w", err)
 	}
-	return posts, nil
+	return applyToComments(posts, f), nil
 }
 
 func (repo *PostMongoDBRepository) Add(post Post) (Post, error) {
@@ -82,98 +172,444 @@ func (repo *PostMongoDBRepository) Add(post Post) (Post, error) {
 	if err != nil {
 		return Post{}, fmt.Errorf("fail to insert post: %w", err)
 	}
+	for _, v := range post.Votes {
+		v.PostID = post.ID
+		_, err = repo.votes.InsertOne(context.Background(), v)
+		if err != nil {
+			return Post{}, fmt.Errorf("fail to insert vote of post %v: %w", post.ID, err)
+		}
+	}
 	return post, nil
 }
 
-func (repo *PostMongoDBRepository) AddComment(id string, comm comment.Comment) (Post, error) {
-	comm.ID = uuid.NewString()
+// AddComment stores the comment and counts it on the post.
+func (repo *PostMongoDBRepository) AddComment(postID string, comm comment.Comment) (comment.Comment, error) {
+	if comm.ParentID != "" {
+		_, err := repo.GetComment(postID, comm.ParentID)
+		if errors.Is(err, comment.ErrNoComment) {
+			// either the post or the parent comment is gone
+			if _, err = repo.getPost(postID); err != nil {
+				return comment.Comment{}, err
+			}
+			return comment.Comment{}, comment.ErrNoComment
+		}
+		if err != nil {
+			return comment.Comment{}, err
+		}
+	}
+	if comm.ID == "" {
+		comm.ID = uuid.NewString()
+	}
+	comm.PostID = postID
 	comm.Created = CreationTime()
 
-	filter := bson.M{"_id": id}
-	update := bson.M{"$push": bson.M{"comments": comm}}
-	result, err := repo.posts.UpdateOne(context.Background(), filter, update)
+	err := repo.incCommentCount(postID, 1)
 	if err != nil {
-		return Post{}, err
+		return comment.Comment{}, err
 	}
-	if result.ModifiedCount == 0 {
-		return Post{}, ErrNoPost
+	if comm.ParentID != "" {
+		// counted ahead of the insert, an extra count only keeps
+		// a deleted parent as a placeholder longer
+		err = repo.incReplyCount(postID, comm.ParentID, 1)
 	}
-	return repo.getPost(id)
-
+	if err == nil {
+		_, err = repo.comments.InsertOne(context.Background(), comm)
+	}
+	if err != nil {
+		if incErr := repo.incCommentCount(postID, -1); incErr != nil {
+			err = fmt.Errorf("%w, and %v", err, incErr)
+		}
+		return comment.Comment{}, fmt.Errorf("fail to insert comment: %w", err)
+	}
+	return comm, nil
 }
 
-func (repo *PostMongoDBRepository) DeleteComment(postID string, commentID string, userID string) (Post, error) {
-	filter := bson.M{"_id": postID}
-	pullFilter := bson.M{"comments": bson.M{"$and": bson.A{
-		bson.M{"id": commentID},
-		bson.M{"author.id": userID},
-	}}}
-	update := bson.M{"$pull": pullFilter}
+func (repo *PostMongoDBRepository) incReplyCount(postID string, commentID string, delta int) error {
+	filter := bson.M{"post_id": postID, "id": commentID}
+	update := bson.M{"$inc": bson.M{"reply_count": delta}}
+	_, err := repo.comments.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("fail to count replies of comment %v: %w", commentID, err)
+	}
+	return nil
+}
 
+func (repo *PostMongoDBRepository) incCommentCount(postID string, delta int) error {
+	filter := notDeleted(bson.M{"_id": postID})
+	update := bson.M{"$inc": bson.M{"comment_count": delta}}
 	result, err := repo.posts.UpdateOne(context.Background(), filter, update)
 	if err != nil {
-		return Post{}, err
+		return fmt.Errorf("fail to count comments of post %v: %w", postID, err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNoPost
 	}
+	return nil
+}
+
+func (repo *PostMongoDBRepository) DeleteComment(postID string, commentID string) error {
+	filter := notDeleted(bson.M{"post_id": postID, "id": commentID})
+	update := bson.M{"$set": bson.M{"deleted_at": time.Now()}}
+	result, err := repo.comments.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("fail to delete comment %v: %w", commentID, err)
+	}
+	if result.MatchedCount == 0 {
+		if _, err = repo.getPost(postID); err != nil {
+			return err
+		}
+		return comment.ErrNoComment
+	}
+	return repo.incCommentCount(postID, -1)
+}
+
+func (repo *PostMongoDBRepository) GetComment(postID string, commentID string) (comment.Comment, error) {
+	comm := comment.Comment{}
+	filter := notDeleted(bson.M{"post_id": postID, "id": commentID})
+	err := repo.comments.FindOne(context.Background(), filter).Decode(&comm)
 	switch {
-	case result.MatchedCount == 0:
-		return Post{}, ErrNoPost
-	case result.ModifiedCount == 0:
-		return Post{}, comment.ErrNoComment
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return comment.Comment{}, comment.ErrNoComment
+	case err != nil:
+		return comment.Comment{}, fmt.Errorf("fail to find comment %v: %w", commentID, err)
 	}
-	return repo.getPost(postID)
+	return comm, nil
 }
 
-func (repo *PostMongoDBRepository) Upvote(postID string, userID string) (Post, error) {
-	post, err := repo.getPost(postID)
+// GetComments gives a page of comments of the post in the order they were
+// added, comments of blocked users are left out. Deleted comments with
+// replies come as placeholders.
+func (repo *PostMongoDBRepository) GetComments(postID string, f Filter, offset int, limit int) ([]comment.Comment, error) {
+	match := bson.M{
+		"post_id": postID,
+		"$or": bson.A{
+			bson.M{"deleted_at": bson.M{"$exists": false}},
+			bson.M{"reply_count": bson.M{"$gt": 0}},
+		},
+	}
+	if len(f.BlockedUsers) != 0 {
+		match["author.id"] = bson.M{"$nin": f.BlockedUsers}
+	}
+	pipeline := bson.A{
+		bson.M{"$match": match},
+		bson.M{"$sort": bson.M{"_id": 1}},
+		bson.M{"$skip": offset},
+		bson.M{"$limit": limit},
+	}
+	c, err := repo.comments.Aggregate(context.Background(), pipeline)
 	if err != nil {
-		return Post{}, err
+		return nil, fmt.Errorf("fail to find comments of post %v: %w", postID, err)
+	}
+	comments := make([]comment.Comment, 0)
+	err = c.All(context.Background(), &comments)
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode comments of post %v: %w", postID, err)
+	}
+	for i, comm := range comments {
+		if comm.DeletedAt != nil {
+			comments[i] = comm.Placeholder()
+		}
 	}
-	post.Upvote(userID)
-	filter := bson.M{"_id": post.ID}
-	update := bson.M{"$set": post}
-	_, err = repo.posts.UpdateOne(context.Background(), filter, update)
-	return post, err
+	return comments, nil
 }
 
-func (repo *PostMongoDBRepository) Downvote(postID string, userID string) (Post, error) {
+// GetCommentsByIDs returns the comments found, missing ids are skipped.
+func (repo *PostMongoDBRepository) GetCommentsByIDs(ids []string) ([]comment.Comment, error) {
+	comments := make([]comment.Comment, 0, len(ids))
+	c, err := repo.comments.Find(context.Background(), notDeleted(bson.M{"id": bson.M{"$in": ids}}))
+	if err != nil {
+		return nil, fmt.Errorf("fail to find comments by ids %w", err)
+	}
+	err = c.All(context.Background(), &comments)
+	if err != nil {
+		return nil, fmt.Errorf("fail to get all comments %w", err)
+	}
+	return comments, nil
+}
+
+func (repo *PostMongoDBRepository) vote(postID string, userID string, value int) (Post, error) {
 	post, err := repo.getPost(postID)
 	if err != nil {
 		return Post{}, err
 	}
-	post.Downvote(userID)
-	filter := bson.M{"_id": post.ID}
-	update := bson.M{"$set": post}
-	_, err = repo.posts.UpdateOne(context.Background(), filter, update)
-	return post, err
+	from, err := repo.swapVote(postID, userID, value)
+	if err != nil {
+		return Post{}, err
+	}
+	if from != value {
+		post, err = repo.countVote(postID, from, value)
+		if err != nil {
+			return Post{}, err
+		}
+	}
+	return post.WithVote(userID, value), nil
+}
+
+// swapVote stores the vote of the user and returns the previous one,
+// 0 stands for no vote.
+func (repo *PostMongoDBRepository) swapVote(postID string, userID string, value int) (int, error) {
+	filter := bson.M{"post_id": postID, "user": userID}
+	var result SingleResultHelper
+	if value == 0 {
+		result = repo.votes.FindOneAndDelete(context.Background(), filter)
+	} else {
+		update := bson.M{"$set": bson.M{"vote": value}}
+		opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+		result = repo.votes.FindOneAndUpdate(context.Background(), filter, update, opts)
+	}
+	prev := vote.Vote{}
+	err := result.Decode(&prev)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return 0, nil
+	case err != nil:
+		return 0, fmt.Errorf("fail to save vote of %v for post %v: %w", userID, postID, err)
+	}
+	return prev.Value, nil
+}
+
+// countVote moves the counters of the post in a single update, so
+// concurrent votes of different users are all counted. The upvote
+// percentage is computed the same way as Post.SyncUpvotePercentage does.
+func (repo *PostMongoDBRepository) countVote(postID string, from int, to int) (Post, error) {
+	delta := Post{}
+	delta.ChangeVote(from, to)
+	total := bson.M{"$add": bson.A{"$upvotes", "$downvotes"}}
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"score":     bson.M{"$add": bson.A{"$score", delta.Score}},
+			"upvotes":   bson.M{"$add": bson.A{"$upvotes", delta.Upvotes}},
+			"downvotes": bson.M{"$add": bson.A{"$downvotes", delta.Downvotes}},
+		}},
+		bson.M{"$set": bson.M{"upvotePercentage": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{total, 0}},
+			0,
+			bson.M{"$toInt": bson.M{"$floor": bson.M{"$divide": bson.A{
+				bson.M{"$multiply": bson.A{"$upvotes", 100}},
+				total,
+			}}}},
+		}}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	post := Post{}
+	err := repo.posts.FindOneAndUpdate(context.Background(), bson.M{"_id": postID}, update, opts).Decode(&post)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return Post{}, ErrNoPost
+	case err != nil:
+		return Post{}, fmt.Errorf("fail to count vote for post %v: %w", postID, err)
+	}
+	return post, nil
+}
+
+func (repo *PostMongoDBRepository) Upvote(postID string, userID string) (Post, error) {
+	return repo.vote(postID, userID, 1)
+}
+
+func (repo *PostMongoDBRepository) Downvote(postID string, userID string) (Post, error) {
+	return repo.vote(postID, userID, -1)
 }
 
 func (repo *PostMongoDBRepository) Unvote(postID string, userID string) (Post, error) {
-	post, err := repo.getPost(postID)
+	return repo.vote(postID, userID, 0)
+}
+
+func (repo *PostMongoDBRepository) GetVotes(userID string, postIDs []string) ([]vote.Vote, error) {
+	filter := bson.M{"user": userID, "post_id": bson.M{"$in": postIDs}}
+	c, err := repo.votes.Find(context.Background(), filter)
 	if err != nil {
-		return Post{}, err
+		return nil, fmt.Errorf("fail to find votes of %v: %w", userID, err)
+	}
+	votes := make([]vote.Vote, 0, len(postIDs))
+	err = c.All(context.Background(), &votes)
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode votes of %v: %w", userID, err)
 	}
-	post.Unvote(userID)
-	filter := bson.M{"_id": post.ID}
-	update := bson.M{"$set": post}
-	_, err = repo.posts.UpdateOne(context.Background(), filter, update)
-	return post, err
+	return votes, nil
 }
 
-func (repo *PostMongoDBRepository) Delete(postID string, userID string) error {
-	filter := bson.M{"$and": bson.A{
-		bson.M{"_id": postID},
-		bson.M{"author.id": userID},
-	}}
-	_, err := repo.posts.DeleteOne(context.Background(), filter)
+func (repo *PostMongoDBRepository) Delete(postID string) error {
+	filter := notDeleted(bson.M{"_id": postID})
+	update := bson.M{"$set": bson.M{"deleted_at": time.Now()}}
+	result, err := repo.posts.UpdateOne(context.Background(), filter, update)
 	if err != nil {
-		return err
+		return fmt.Errorf("fail to delete post %v: %w", postID, err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNoPost
 	}
 	return nil
 }
 
+func (repo *PostMongoDBRepository) GetAuthorID(postID string, commentID string) (string, error) {
+	if commentID == "" {
+		post := Post{}
+		err := repo.posts.FindOne(context.Background(), bson.M{"_id": postID}).Decode(&post)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			return "", ErrNoPost
+		case err != nil:
+			return "", fmt.Errorf("fail to FindOne with id:%v, %w", postID, err)
+		}
+		return post.Author.ID, nil
+	}
+	comm := comment.Comment{}
+	err := repo.comments.FindOne(context.Background(), bson.M{"post_id": postID, "id": commentID}).Decode(&comm)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return "", comment.ErrNoComment
+	case err != nil:
+		return "", fmt.Errorf("fail to find comment %v: %w", commentID, err)
+	}
+	return comm.Author.ID, nil
+}
+
+// restorable matches documents deleted after deletedAfter.
+func restorable(query bson.M, deletedAfter time.Time) bson.M {
+	query["deleted_at"] = bson.M{"$gt": deletedAfter}
+	return query
+}
+
+func (repo *PostMongoDBRepository) Restore(postID string, deletedAfter time.Time) (Post, error) {
+	filter := restorable(bson.M{"_id": postID}, deletedAfter)
+	update := bson.M{"$unset": bson.M{"deleted_at": ""}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	post := Post{}
+	err := repo.posts.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&post)
+	if err == nil {
+		return post, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return Post{}, fmt.Errorf("fail to restore post %v: %w", postID, err)
+	}
+	err = repo.posts.FindOne(context.Background(), bson.M{"_id": postID}).Decode(&post)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return Post{}, ErrNoPost
+	case err != nil:
+		return Post{}, fmt.Errorf("fail to FindOne with id:%v, %w", postID, err)
+	}
+	return Post{}, ErrNotRestorable
+}
+
+func (repo *PostMongoDBRepository) RestoreComment(postID string, commentID string, deletedAfter time.Time) (comment.Comment, error) {
+	if _, err := repo.getPost(postID); err != nil {
+		return comment.Comment{}, err
+	}
+	filter := restorable(bson.M{"post_id": postID, "id": commentID}, deletedAfter)
+	update := bson.M{"$unset": bson.M{"deleted_at": ""}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	comm := comment.Comment{}
+	err := repo.comments.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&comm)
+	if err == nil {
+		return comm, repo.incCommentCount(postID, 1)
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return comment.Comment{}, fmt.Errorf("fail to restore comment %v: %w", commentID, err)
+	}
+	err = repo.comments.FindOne(context.Background(), bson.M{"post_id": postID, "id": commentID}).Decode(&comm)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return comment.Comment{}, comment.ErrNoComment
+	case err != nil:
+		return comment.Comment{}, fmt.Errorf("fail to find comment %v: %w", commentID, err)
+	}
+	return comment.Comment{}, ErrNotRestorable
+}
+
+// Purge removes posts deleted before deletedBefore with their comments and
+// votes, and deleted comments without replies. Comments left as
+// placeholders go once their replies are purged.
+func (repo *PostMongoDBRepository) Purge(deletedBefore time.Time) (int, error) {
+	posts, err := repo.purgePosts(deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	comments, err := repo.purgeComments(deletedBefore)
+	return posts + comments, err
+}
+
+func (repo *PostMongoDBRepository) purgePosts(deletedBefore time.Time) (int, error) {
+	ctx := context.Background()
+	filter := bson.M{"deleted_at": bson.M{"$lt": deletedBefore}}
+	c, err := repo.posts.Find(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("fail to find deleted posts: %w", err)
+	}
+	posts := make([]Post, 0)
+	if err = c.All(ctx, &posts); err != nil {
+		return 0, fmt.Errorf("fail to decode deleted posts: %w", err)
+	}
+	if len(posts) == 0 {
+		return 0, nil
+	}
+	ids := make([]string, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	// comments and votes go first, so a failure leaves the post to retry
+	if _, err = repo.comments.DeleteMany(ctx, bson.M{"post_id": bson.M{"$in": ids}}); err != nil {
+		return 0, fmt.Errorf("fail to purge comments of deleted posts: %w", err)
+	}
+	if _, err = repo.votes.DeleteMany(ctx, bson.M{"post_id": bson.M{"$in": ids}}); err != nil {
+		return 0, fmt.Errorf("fail to purge votes of deleted posts: %w", err)
+	}
+	filter["_id"] = bson.M{"$in": ids}
+	purged, err := repo.posts.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("fail to purge deleted posts: %w", err)
+	}
+	return int(purged), nil
+}
+
+func (repo *PostMongoDBRepository) purgeComments(deletedBefore time.Time) (int, error) {
+	ctx := context.Background()
+	filter := bson.M{
+		"deleted_at":  bson.M{"$lt": deletedBefore},
+		"reply_count": bson.M{"$not": bson.M{"$gt": 0}},
+	}
+	c, err := repo.comments.Find(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("fail to find deleted comments: %w", err)
+	}
+	comments := make([]comment.Comment, 0)
+	if err = c.All(ctx, &comments); err != nil {
+		return 0, fmt.Errorf("fail to decode deleted comments: %w", err)
+	}
+	if len(comments) == 0 {
+		return 0, nil
+	}
+	ids := make([]string, len(comments))
+	for i, comm := range comments {
+		ids[i] = comm.ID
+	}
+	filter["id"] = bson.M{"$in": ids}
+	purged, err := repo.comments.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("fail to purge deleted comments: %w", err)
+	}
+
+	// parents are counted down after the replies are gone: a failure here
+	// keeps a placeholder longer, never drops a comment with replies
+	models := make([]mongo.WriteModel, 0)
+	for _, comm := range comments {
+		if comm.ParentID != "" {
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"post_id": comm.PostID, "id": comm.ParentID}).
+				SetUpdate(bson.M{"$inc": bson.M{"reply_count": -1}}))
+		}
+	}
+	if len(models) != 0 {
+		if _, err = repo.comments.BulkWrite(ctx, models); err != nil {
+			return int(purged), fmt.Errorf("fail to count down replies: %w", err)
+		}
+	}
+	return int(purged), nil
+}
+
 func (repo *PostMongoDBRepository) GetUserPosts(username string) ([]Post, error) {
 	posts := make([]Post, 0)
-	c, err := repo.posts.Find(context.Background(), bson.M{"author.username": username})
+	c, err := repo.posts.Find(context.Background(), notDeleted(bson.M{"author.username": username}))
 	if err != nil {
 		return nil, fmt.Errorf(`fail to find posts by author "%v", %w`, username, err)
 	}
@@ -183,3 +619,625 @@ func (repo *PostMongoDBRepository) GetUserPosts(username string) ([]Post, error)
 	}
 	return posts, nil
 }
+
+func (repo *PostMongoDBRepository) SetPreview(postID string, preview unfurl.Preview) error {
+	filter := bson.M{"_id": postID}
+	update := bson.M{"$set": bson.M{"preview": preview}}
+	result, err := repo.posts.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("fail to set preview of post %v: %w", postID, err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNoPost
+	}
+	return nil
+}
+
+// AddViews increments views of many posts in one round trip.
+func (repo *PostMongoDBRepository) AddViews(counts map[string]int) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(counts))
+	for postID, n := range counts {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": postID}).
+			SetUpdate(bson.M{"$inc": bson.M{"views": n}}))
+	}
+	_, err := repo.posts.BulkWrite(context.Background(), models)
+	if err != nil {
+		return fmt.Errorf("fail to add views: %w", err)
+	}
+	return nil
+}
+
+func (repo *PostMongoDBRepository) GetByNormalizedURL(category string, normalizedURL string) (Post, error) {
+	post := Post{}
+	filter := notDeleted(bson.M{"category": category, "normalized_url": normalizedURL})
+	err := repo.posts.FindOne(context.Background(), filter).Decode(&post)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return Post{}, ErrNoPost
+	case err != nil:
+		return Post{}, fmt.Errorf("fail to find post by url %v: %w", normalizedURL, err)
+	}
+	return post, nil
+}
+
+// VotePoll stores the vote before counting it, the unique index of poll
+// votes keeps concurrent votes of one user from both being counted.
+func (repo *PostMongoDBRepository) VotePoll(postID string, userID string, option int) (Post, error) {
+	post, err := repo.getPost(postID)
+	if err != nil {
+		return Post{}, err
+	}
+	if err = post.checkPollVote(option, time.Now()); err != nil {
+		return Post{}, err
+	}
+	_, err = repo.pollVotes.InsertOne(context.Background(), PollVote{PostID: postID, UserID: userID, Option: option})
+	switch {
+	case mongo.IsDuplicateKeyError(err):
+		return Post{}, ErrAlreadyVoted
+	case err != nil:
+		return Post{}, fmt.Errorf("fail to save vote of %v in poll %v: %w", userID, postID, err)
+	}
+	optionPath := fmt.Sprintf("poll.options.%d", option)
+	update := bson.M{"$inc": bson.M{
+		optionPath + ".votes": 1,
+		"poll.total_votes":    1,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = repo.posts.FindOneAndUpdate(context.Background(), bson.M{"_id": postID}, update, opts).Decode(&post)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return Post{}, ErrNoPost
+	case err != nil:
+		return Post{}, fmt.Errorf("fail to count vote in poll %v: %w", postID, err)
+	}
+	return post.WithPollVote(option), nil
+}
+
+func (repo *PostMongoDBRepository) GetPollVotes(userID string, postIDs []string) ([]PollVote, error) {
+	filter := bson.M{"user_id": userID, "post_id": bson.M{"$in": postIDs}}
+	c, err := repo.pollVotes.Find(context.Background(), filter)
+	if err != nil {
+		return nil, fmt.Errorf("fail to find poll votes of %v: %w", userID, err)
+	}
+	votes := make([]PollVote, 0, len(postIDs))
+	err = c.All(context.Background(), &votes)
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode poll votes of %v: %w", userID, err)
+	}
+	return votes, nil
+}
+
+// createdAtField parses creation times, as strings they drop trailing
+// zeros of milliseconds and do not sort.
+var createdAtField = bson.M{"$addFields": bson.M{"created_at": bson.M{"$dateFromString": bson.M{
+	"dateString": "$created",
+	"onError":    nil,
+}}}}
+
+// latestActivity runs the pipeline over the collection and gives the newest
+// offset+limit items, which is enough to build the page after merging.
+func latestActivity(coll CollectionHelper, pipeline bson.A, offset int, limit int) ([]Activity, error) {
+	pipeline = append(pipeline,
+		createdAtField,
+		bson.M{"$sort": bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: 1}}},
+		bson.M{"$limit": offset + limit},
+	)
+	c, err := coll.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]Activity, 0)
+	err = c.All(context.Background(), &items)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (repo *PostMongoDBRepository) GetUserActivity(username string, offset int, limit int) ([]Activity, error) {
+	posts, err := latestActivity(repo.posts, bson.A{
+		bson.M{"$match": notDeleted(bson.M{"author.username": username})},
+		bson.M{"$project": bson.M{
+			"kind":     ActivityPost,
+			"post_id":  "$_id",
+			"title":    "$title",
+			"category": "$category",
+			"score":    "$score",
+			"created":  "$created",
+		}},
+	}, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("fail to aggregate posts of %v: %w", username, err)
+	}
+	comments, err := latestActivity(repo.comments, bson.A{
+		bson.M{"$match": notDeleted(bson.M{"author.username": username})},
+		bson.M{"$project": bson.M{
+			"kind":       ActivityComment,
+			"post_id":    "$post_id",
+			"comment_id": "$id",
+			"body":       "$body",
+			"created":    "$created",
+		}},
+	}, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("fail to aggregate comments of %v: %w", username, err)
+	}
+
+	items := append(posts, comments...)
+	sortActivity(items)
+	items = paginate(items, offset, limit)
+	return repo.fillPostTitles(items)
+}
+
+// fillPostTitles copies titles and categories of commented posts
+// into comment items.
+func (repo *PostMongoDBRepository) fillPostTitles(items []Activity) ([]Activity, error) {
+	ids := make([]string, 0)
+	for _, item := range items {
+		if item.Kind == ActivityComment {
+			ids = append(ids, item.PostID)
+		}
+	}
+	if len(ids) == 0 {
+		return items, nil
+	}
+	posts, err := repo.GetByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]Post, len(posts))
+	for _, p := range posts {
+		byID[p.ID] = p
+	}
+	for i, item := range items {
+		if p, ok := byID[item.PostID]; ok && item.Kind == ActivityComment {
+			items[i].Title = p.Title
+			items[i].Category = p.Category
+		}
+	}
+	return items, nil
+}
+
+func (repo *PostMongoDBRepository) GetUserKarma(username string) (Karma, error) {
+	pipeline := bson.A{
+		bson.M{"$match": notDeleted(bson.M{"author.username": username})},
+		bson.M{"$group": bson.M{
+			"_id":        nil,
+			"post_karma": bson.M{"$sum": "$score"},
+			"post_count": bson.M{"$sum": 1},
+		}},
+	}
+	c, err := repo.posts.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return Karma{}, fmt.Errorf("fail to aggregate karma of %v: %w", username, err)
+	}
+	results := make([]Karma, 0, 1)
+	err = c.All(context.Background(), &results)
+	if err != nil {
+		return Karma{}, fmt.Errorf("fail to decode karma of %v: %w", username, err)
+	}
+	karma := Karma{}
+	if len(results) != 0 {
+		karma = results[0]
+	}
+	count, err := repo.comments.CountDocuments(context.Background(), notDeleted(bson.M{"author.username": username}))
+	if err != nil {
+		return Karma{}, fmt.Errorf("fail to count comments of %v: %w", username, err)
+	}
+	karma.CommentCount = int(count)
+	return karma, nil
+}
+
+// MigrateComments moves comments embedded in post documents to the comments
+// collection. It is safe to run again after a failure: moved comments are
+// not duplicated and every post is counted once.
+func (repo *PostMongoDBRepository) MigrateComments(ctx context.Context) (int, error) {
+	c, err := repo.posts.Find(ctx, bson.M{"comments": bson.M{"$exists": true}})
+	if err != nil {
+		return 0, fmt.Errorf("fail to find posts with comments: %w", err)
+	}
+	defer c.Close(ctx)
+
+	moved := 0
+	for c.Next(ctx) {
+		p := Post{}
+		if err = c.Decode(&p); err != nil {
+			return moved, fmt.Errorf("fail to decode post: %w", err)
+		}
+		if len(p.Comments) != 0 {
+			models := make([]mongo.WriteModel, 0, len(p.Comments))
+			for _, comm := range p.Comments {
+				comm.PostID = p.ID
+				models = append(models, mongo.NewUpdateOneModel().
+					SetFilter(bson.M{"id": comm.ID}).
+					SetUpdate(bson.M{"$setOnInsert": comm}).
+					SetUpsert(true))
+			}
+			if _, err = repo.comments.BulkWrite(ctx, models); err != nil {
+				return moved, fmt.Errorf("fail to move comments of post %v: %w", p.ID, err)
+			}
+		}
+		filter := bson.M{"_id": p.ID, "comments": bson.M{"$exists": true}}
+		update := bson.M{
+			"$unset": bson.M{"comments": ""},
+			"$inc":   bson.M{"comment_count": len(p.Comments)},
+		}
+		if _, err = repo.posts.UpdateOne(ctx, filter, update); err != nil {
+			return moved, fmt.Errorf("fail to unset comments of post %v: %w", p.ID, err)
+		}
+		moved += len(p.Comments)
+	}
+	if err = c.Err(); err != nil {
+		return moved, fmt.Errorf("fail to iterate posts: %w", err)
+	}
+	return moved, nil
+}
+
+// legacyVotes is the part of a post document that held every vote before
+// votes got their own collection.
+type legacyVotes struct {
+	ID    string      `bson:"_id"`
+	Votes []vote.Vote `bson:"votes"`
+}
+
+// MigrateVotes moves votes embedded in post documents to the votes
+// collection and sets the vote counters of the posts. Like MigrateComments
+// it is safe to run again after a failure.
+func (repo *PostMongoDBRepository) MigrateVotes(ctx context.Context) (int, error) {
+	c, err := repo.posts.Find(ctx, bson.M{"votes": bson.M{"$exists": true}})
+	if err != nil {
+		return 0, fmt.Errorf("fail to find posts with votes: %w", err)
+	}
+	defer c.Close(ctx)
+
+	moved := 0
+	for c.Next(ctx) {
+		p := legacyVotes{}
+		if err = c.Decode(&p); err != nil {
+			return moved, fmt.Errorf("fail to decode post: %w", err)
+		}
+		counters := Post{}
+		if len(p.Votes) != 0 {
+			models := make([]mongo.WriteModel, 0, len(p.Votes))
+			for _, v := range p.Votes {
+				v.PostID = p.ID
+				counters.countVote(v.Value, 1)
+				models = append(models, mongo.NewUpdateOneModel().
+					SetFilter(bson.M{"post_id": p.ID, "user": v.UserID}).
+					SetUpdate(bson.M{"$setOnInsert": v}).
+					SetUpsert(true))
+			}
+			if _, err = repo.votes.BulkWrite(ctx, models); err != nil {
+				return moved, fmt.Errorf("fail to move votes of post %v: %w", p.ID, err)
+			}
+		}
+		filter := bson.M{"_id": p.ID, "votes": bson.M{"$exists": true}}
+		update := bson.M{
+			"$unset": bson.M{"votes": ""},
+			"$set":   bson.M{"upvotes": counters.Upvotes, "downvotes": counters.Downvotes},
+		}
+		if _, err = repo.posts.UpdateOne(ctx, filter, update); err != nil {
+			return moved, fmt.Errorf("fail to unset votes of post %v: %w", p.ID, err)
+		}
+		moved += len(p.Votes)
+	}
+	if err = c.Err(); err != nil {
+		return moved, fmt.Errorf("fail to iterate posts: %w", err)
+	}
+	return moved, nil
+}
+
+// legacyPollVoters is the part of a poll post that held every poll vote
+// before poll votes got their own collection.
+type legacyPollVoters struct {
+	ID   string `bson:"_id"`
+	Poll struct {
+		Voters []PollVote `bson:"voters"`
+	} `bson:"poll"`
+}
+
+// MigratePollVotes moves poll votes embedded in post documents to the poll
+// votes collection, the option counters of the posts are already right.
+// Like MigrateVotes it is safe to run again after a failure.
+func (repo *PostMongoDBRepository) MigratePollVotes(ctx context.Context) (int, error) {
+	c, err := repo.posts.Find(ctx, bson.M{"poll.voters": bson.M{"$exists": true}})
+	if err != nil {
+		return 0, fmt.Errorf("fail to find polls with votes: %w", err)
+	}
+	defer c.Close(ctx)
+
+	moved := 0
+	for c.Next(ctx) {
+		p := legacyPollVoters{}
+		if err = c.Decode(&p); err != nil {
+			return moved, fmt.Errorf("fail to decode post: %w", err)
+		}
+		if len(p.Poll.Voters) != 0 {
+			models := make([]mongo.WriteModel, 0, len(p.Poll.Voters))
+			for _, v := range p.Poll.Voters {
+				v.PostID = p.ID
+				models = append(models, mongo.NewUpdateOneModel().
+					SetFilter(bson.M{"post_id": p.ID, "user_id": v.UserID}).
+					SetUpdate(bson.M{"$setOnInsert": v}).
+					SetUpsert(true))
+			}
+			if _, err = repo.pollVotes.BulkWrite(ctx, models); err != nil {
+				return moved, fmt.Errorf("fail to move poll votes of post %v: %w", p.ID, err)
+			}
+		}
+		filter := bson.M{"_id": p.ID, "poll.voters": bson.M{"$exists": true}}
+		if _, err = repo.posts.UpdateOne(ctx, filter, bson.M{"$unset": bson.M{"poll.voters": ""}}); err != nil {
+			return moved, fmt.Errorf("fail to unset poll votes of post %v: %w", p.ID, err)
+		}
+		moved += len(p.Poll.Voters)
+	}
+	if err = c.Err(); err != nil {
+		return moved, fmt.Errorf("fail to iterate posts: %w", err)
+	}
+	return moved, nil
+}
+
+// MigrateNormalizedURLs sets the normalized url of link posts created
+// before duplicate links were detected. Links that fail to normalize are
+// left as they are, so it is safe to run again.
+func (repo *PostMongoDBRepository) MigrateNormalizedURLs(ctx context.Context) (int, error) {
+	c, err := repo.posts.Find(ctx, bson.M{"type": LINK, "normalized_url": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, fmt.Errorf("fail to find links to normalize: %w", err)
+	}
+	defer c.Close(ctx)
+
+	updated := 0
+	for c.Next(ctx) {
+		p := Post{}
+		if err = c.Decode(&p); err != nil {
+			return updated, fmt.Errorf("fail to decode post: %w", err)
+		}
+		normalized, err := NormalizeURL(p.URL)
+		if err != nil || normalized == "" {
+			continue
+		}
+		filter := bson.M{"_id": p.ID, "normalized_url": bson.M{"$exists": false}}
+		if _, err = repo.posts.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"normalized_url": normalized}}); err != nil {
+			return updated, fmt.Errorf("fail to set normalized url of post %v: %w", p.ID, err)
+		}
+		updated++
+	}
+	if err = c.Err(); err != nil {
+		return updated, fmt.Errorf("fail to iterate posts: %w", err)
+	}
+	return updated, nil
+}
+
+// MigrateHTML renders the markdown of posts and comments stored before it
+// was rendered on write. Like MigrateNormalizedURLs it is safe to run again.
+func (repo *PostMongoDBRepository) MigrateHTML(ctx context.Context) (int, error) {
+	posts, err := renderMissingHTML(ctx, repo.posts, "_id", "text", "text_html")
+	if err != nil {
+		return posts, fmt.Errorf("posts: %w", err)
+	}
+	comments, err := renderMissingHTML(ctx, repo.comments, "id", "body", "body_html")
+	if err != nil {
+		return posts + comments, fmt.Errorf("comments: %w", err)
+	}
+	return posts + comments, nil
+}
+
+// renderMissingHTML sets the target field of documents with a non empty
+// markdown source field and no target yet.
+func renderMissingHTML(ctx context.Context, coll CollectionHelper, idKey, source, target string) (int, error) {
+	c, err := coll.Find(ctx, bson.M{source: bson.M{"$gt": ""}, target: bson.M{"$exists": false}})
+	if err != nil {
+		return 0, fmt.Errorf("fail to find documents to render: %w", err)
+	}
+	defer c.Close(ctx)
+
+	rendered := 0
+	for c.Next(ctx) {
+		doc := bson.M{}
+		if err = c.Decode(&doc); err != nil {
+			return rendered, fmt.Errorf("fail to decode document: %w", err)
+		}
+		text, _ := doc[source].(string)
+		filter := bson.M{idKey: doc[idKey], target: bson.M{"$exists": false}}
+		update := bson.M{"$set": bson.M{target: markdown.Render(text)}}
+		if _, err = coll.UpdateOne(ctx, filter, update); err != nil {
+			return rendered, fmt.Errorf("fail to render %v: %w", doc[idKey], err)
+		}
+		rendered++
+	}
+	if err = c.Err(); err != nil {
+		return rendered, fmt.Errorf("fail to iterate documents: %w", err)
+	}
+	return rendered, nil
+}
+
+func (repo *PostMongoDBRepository) EraseUser(userID string, policy ErasePolicy) error {
+	ctx := context.Background()
+	if policy == EraseDelete {
+		if err := repo.deleteUserComments(userID); err != nil {
+			return err
+		}
+		filter := notDeleted(bson.M{"author.id": userID})
+		_, err := repo.posts.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"deleted_at": time.Now()}})
+		if err != nil {
+			return fmt.Errorf("fail to delete posts of %v: %w", userID, err)
+		}
+	}
+	// the author goes last, so a failed erase is found and retried by id
+	if _, err := repo.votes.DeleteMany(ctx, bson.M{"user": userID}); err != nil {
+		return fmt.Errorf("fail to delete votes of %v: %w", userID, err)
+	}
+	if err := repo.deleteUserPollVotes(userID); err != nil {
+		return err
+	}
+	anonymize := bson.M{"$set": bson.M{"author": ErasedAuthor}}
+	if _, err := repo.comments.UpdateMany(ctx, bson.M{"author.id": userID}, anonymize); err != nil {
+		return fmt.Errorf("fail to anonymize comments of %v: %w", userID, err)
+	}
+	anonymizePosts := bson.M{"$set": bson.M{"author": ErasedAuthor}, "$unset": bson.M{"image": ""}}
+	if _, err := repo.posts.UpdateMany(ctx, bson.M{"author.id": userID}, anonymizePosts); err != nil {
+		return fmt.Errorf("fail to anonymize posts of %v: %w", userID, err)
+	}
+	return nil
+}
+
+// deleteUserPollVotes drops poll votes of the user and counts them down
+// on their polls. The votes go first: a failure in between leaves the
+// counts high rather than counted down twice on retry.
+func (repo *PostMongoDBRepository) deleteUserPollVotes(userID string) error {
+	ctx := context.Background()
+	c, err := repo.pollVotes.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return fmt.Errorf("fail to find poll votes of %v: %w", userID, err)
+	}
+	votes := make([]PollVote, 0)
+	if err = c.All(ctx, &votes); err != nil {
+		return fmt.Errorf("fail to decode poll votes of %v: %w", userID, err)
+	}
+	if len(votes) == 0 {
+		return nil
+	}
+	if _, err = repo.pollVotes.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		return fmt.Errorf("fail to delete poll votes of %v: %w", userID, err)
+	}
+	models := make([]mongo.WriteModel, len(votes))
+	for i, v := range votes {
+		optionPath := fmt.Sprintf("poll.options.%d", v.Option)
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": v.PostID}).
+			SetUpdate(bson.M{"$inc": bson.M{
+				optionPath + ".votes": -1,
+				"poll.total_votes":    -1,
+			}})
+	}
+	if _, err = repo.posts.BulkWrite(ctx, models); err != nil {
+		return fmt.Errorf("fail to count down poll votes of %v: %w", userID, err)
+	}
+	return nil
+}
+
+func (repo *PostMongoDBRepository) UserImages(userID string) ([]upload.Image, error) {
+	ctx := context.Background()
+	c, err := repo.posts.Find(ctx, bson.M{"author.id": userID, "image": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, fmt.Errorf("fail to find images of %v: %w", userID, err)
+	}
+	posts := make([]Post, 0)
+	if err = c.All(ctx, &posts); err != nil {
+		return nil, fmt.Errorf("fail to decode images of %v: %w", userID, err)
+	}
+	if len(posts) == 0 {
+		return []upload.Image{}, nil
+	}
+	keys := make([]string, len(posts))
+	for i, p := range posts {
+		keys[i] = p.Image.Key
+	}
+	filter := bson.M{"author.id": bson.M{"$ne": userID}, "image.key": bson.M{"$in": keys}}
+	c, err = repo.posts.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("fail to find shared images of %v: %w", userID, err)
+	}
+	others := make([]Post, 0)
+	if err = c.All(ctx, &others); err != nil {
+		return nil, fmt.Errorf("fail to decode shared images of %v: %w", userID, err)
+	}
+	shared := make(map[string]bool, len(others))
+	for _, p := range others {
+		shared[p.Image.Key] = true
+	}
+	images := make([]upload.Image, 0, len(posts))
+	for _, p := range posts {
+		if !shared[p.Image.Key] {
+			images = append(images, *p.Image)
+		}
+	}
+	return images, nil
+}
+
+// deleteUserComments soft deletes live comments of the user and counts
+// them down on their posts.
+func (repo *PostMongoDBRepository) deleteUserComments(userID string) error {
+	ctx := context.Background()
+	filter := notDeleted(bson.M{"author.id": userID})
+	c, err := repo.comments.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("fail to find comments of %v: %w", userID, err)
+	}
+	comments := make([]comment.Comment, 0)
+	if err = c.All(ctx, &comments); err != nil {
+		return fmt.Errorf("fail to decode comments of %v: %w", userID, err)
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+	ids := make([]string, len(comments))
+	counts := make(map[string]int)
+	postIDs := make([]string, 0)
+	for i, comm := range comments {
+		ids[i] = comm.ID
+		if counts[comm.PostID] == 0 {
+			postIDs = append(postIDs, comm.PostID)
+		}
+		counts[comm.PostID]++
+	}
+	filter["id"] = bson.M{"$in": ids}
+	_, err = repo.comments.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"deleted_at": time.Now()}})
+	if err != nil {
+		return fmt.Errorf("fail to delete comments of %v: %w", userID, err)
+	}
+	models := make([]mongo.WriteModel, len(postIDs))
+	for i, postID := range postIDs {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(notDeleted(bson.M{"_id": postID})).
+			SetUpdate(bson.M{"$inc": bson.M{"comment_count": -counts[postID]}})
+	}
+	if _, err = repo.posts.BulkWrite(ctx, models); err != nil {
+		return fmt.Errorf("fail to count down comments of %v: %w", userID, err)
+	}
+	return nil
+}
+
+func (repo *PostMongoDBRepository) ExportUserData(userID string) (UserData, error) {
+	ctx := context.Background()
+	data := UserData{
+		Posts:     make([]Post, 0),
+		Comments:  make([]comment.Comment, 0),
+		Votes:     make([]vote.Vote, 0),
+		PollVotes: make([]PollVote, 0),
+	}
+	c, err := repo.posts.Find(ctx, bson.M{"author.id": userID})
+	if err != nil {
+		return UserData{}, fmt.Errorf("fail to find posts of %v: %w", userID, err)
+	}
+	if err = c.All(ctx, &data.Posts); err != nil {
+		return UserData{}, fmt.Errorf("fail to decode posts of %v: %w", userID, err)
+	}
+	c, err = repo.comments.Find(ctx, bson.M{"author.id": userID})
+	if err != nil {
+		return UserData{}, fmt.Errorf("fail to find comments of %v: %w", userID, err)
+	}
+	if err = c.All(ctx, &data.Comments); err != nil {
+		return UserData{}, fmt.Errorf("fail to decode comments of %v: %w", userID, err)
+	}
+	c, err = repo.votes.Find(ctx, bson.M{"user": userID})
+	if err != nil {
+		return UserData{}, fmt.Errorf("fail to find votes of %v: %w", userID, err)
+	}
+	if err = c.All(ctx, &data.Votes); err != nil {
+		return UserData{}, fmt.Errorf("fail to decode votes of %v: %w", userID, err)
+	}
+	c, err = repo.pollVotes.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return UserData{}, fmt.Errorf("fail to find poll votes of %v: %w", userID, err)
+	}
+	if err = c.All(ctx, &data.PollVotes); err != nil {
+		return UserData{}, fmt.Errorf("fail to decode poll votes of %v: %w", userID, err)
+	}
+	return data, nil
+}
@@ -4,9 +4,13 @@ import (
 	context "context"
 	"fmt"
 	"testing"
+	"time"
 
 	gomock "github.com/golang/mock/gomock"
 	"github.com/greatjudge/redditclone/pkg/comment"
+	"github.com/greatjudge/redditclone/pkg/markdown"
+	"github.com/greatjudge/redditclone/pkg/unfurl"
+	"github.com/greatjudge/redditclone/pkg/upload"
 	"github.com/greatjudge/redditclone/pkg/user"
 	"github.com/greatjudge/redditclone/pkg/vote"
 	"github.com/stretchr/testify/assert"
@@ -14,6 +18,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	mongo "go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var Posts []Post = []Post{
@@ -29,12 +34,7 @@ var Posts []Post = []Post{
 			Username: "username",
 		},
 		Category: "music",
-		Votes: []vote.Vote{
-			{
-				UserID: "1",
-				Value:  1,
-			},
-		},
+		Upvotes:  1,
 		Comments: []comment.Comment{
 			{
 				Created: CreationTime(),
@@ -62,12 +62,7 @@ var Posts []Post = []Post{
 			Username: "username2",
 		},
 		Category: "programming",
-		Votes: []vote.Vote{
-			{
-				UserID: "2",
-				Value:  1,
-			},
-		},
+		Upvotes:  1,
 		Comments: []comment.Comment{
 			{
 				Created: CreationTime(),
@@ -95,12 +90,7 @@ var Posts []Post = []Post{
 			Username: "username",
 		},
 		Category: "music",
-		Votes: []vote.Vote{
-			{
-				UserID: "1",
-				Value:  1,
-			},
-		},
+		Upvotes:  1,
 		Comments: []comment.Comment{
 			{
 				Created: CreationTime(),
@@ -156,8 +146,8 @@ func TestGetAll(t *testing.T) {
 	}
 
 	t.Run("some error", func(t *testing.T) {
-		mockColl.EXPECT().Find(context.Background(), bson.D{}).Return(nil, fmt.Errorf("error"))
-		_, err := repo.GetAll()
+		mockColl.EXPECT().Find(context.Background(), notDeleted(bson.M{})).Return(nil, fmt.Errorf("error"))
+		_, err := repo.GetAll(Filter{})
 		assert.NotNil(t, err)
 	})
 
@@ -172,8 +162,8 @@ func TestGetAll(t *testing.T) {
 			return
 		}
 
-		mockColl.EXPECT().Find(context.Background(), bson.D{}).Return(cursor, nil)
-		returned, err := repo.GetAll()
+		mockColl.EXPECT().Find(context.Background(), notDeleted(bson.M{})).Return(cursor, nil)
+		returned, err := repo.GetAll(Filter{})
 		assert.Nil(t, err)
 		assert.Equal(t, Posts, returned)
 	})
@@ -188,14 +178,14 @@ func TestGetAll(t *testing.T) {
 	}
 
 	mt.Run("error all", func(mt *mtest.T) {
-		repo := NewMongoDBRepo(mt.Coll)
+		repo := NewMongoDBRepo(mt.Coll, mt.Coll, mt.Coll, mt.Coll)
 		cursorResposes := []primitive.D{
 			mtest.CreateCursorResponse(1, "foo.bar", mtest.FirstBatch, bsoned),
 			{},
 			mtest.CreateCursorResponse(0, "foo.bar", mtest.NextBatch),
 		}
 		mt.AddMockResponses(cursorResposes...)
-		_, err = repo.GetAll()
+		_, err = repo.GetAll(Filter{})
 		assert.NotNil(t, err)
 		assert.Equal(t, "fail to get all posts command failed", err.Error())
 	})
@@ -216,17 +206,11 @@ func CheckGetByID(t *testing.T, tc TestCaseGetByID) {
 	repo := &PostMongoDBRepository{
 		posts: mockColl,
 	}
-	filter := bson.M{"_id": tc.Post.ID}
+	filter := notDeleted(bson.M{"_id": tc.Post.ID})
 
 	singleResponse := mongo.NewSingleResultFromDocument(tc.Post, tc.Error, nil)
 	mockColl.EXPECT().FindOne(context.Background(), filter).Return(singleResponse)
 
-	if tc.Error == nil {
-		tc.Post.Views += 1
-		update := bson.M{"$set": bson.M{"views": tc.Post.Views}}
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, update)
-	}
-
 	post, err := repo.GetByID(tc.Post.ID)
 
 	switch {
@@ -280,8 +264,8 @@ func TestGetByCategory(t *testing.T) {
 
 	t.Run("some error", func(t *testing.T) {
 		category := "music"
-		mockColl.EXPECT().Find(context.Background(), bson.M{"category": category}).Return(nil, fmt.Errorf("error"))
-		_, err := repo.GetByCategory(category)
+		mockColl.EXPECT().Find(context.Background(), notDeleted(bson.M{"category": category})).Return(nil, fmt.Errorf("error"))
+		_, err := repo.GetByCategory(category, Filter{})
 		assert.NotNil(t, err)
 	})
 
@@ -297,8 +281,8 @@ func TestGetByCategory(t *testing.T) {
 		}
 
 		category := "category"
-		mockColl.EXPECT().Find(context.Background(), bson.M{"category": category}).Return(cursor, nil)
-		returned, err := repo.GetByCategory(category)
+		mockColl.EXPECT().Find(context.Background(), notDeleted(bson.M{"category": category})).Return(cursor, nil)
+		returned, err := repo.GetByCategory(category, Filter{})
 		assert.Nil(t, err)
 		assert.Equal(t, Posts, returned)
 	})
@@ -313,7 +297,7 @@ func TestGetByCategory(t *testing.T) {
 	}
 
 	mt.Run("error all", func(mt *mtest.T) {
-		repo := NewMongoDBRepo(mt.Coll)
+		repo := NewMongoDBRepo(mt.Coll, mt.Coll, mt.Coll, mt.Coll)
 		cursorResposes := []primitive.D{
 			mtest.CreateCursorResponse(1, "foo.bar", mtest.FirstBatch, bsoned),
 			{},
@@ -321,7 +305,7 @@ func TestGetByCategory(t *testing.T) {
 		}
 		mt.AddMockResponses(cursorResposes...)
 		category := "programming"
-		_, err = repo.GetByCategory(category)
+		_, err = repo.GetByCategory(category, Filter{})
 		assert.NotNil(t, err)
 		assert.Equal(t, "fail to get all posts command failed", err.Error())
 	})
@@ -332,9 +316,12 @@ func TestAdd(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockColl := NewMockCollectionHelper(ctrl)
+	mockVotes := NewMockCollectionHelper(ctrl)
 	repo := &PostMongoDBRepository{
 		posts: mockColl,
+		votes: mockVotes,
 	}
+	authorVote := []vote.Vote{{UserID: Posts[0].Author.ID, Value: 1}}
 
 	t.Run("some error", func(t *testing.T) {
 		post := Posts[0]
@@ -345,7 +332,15 @@ func TestAdd(t *testing.T) {
 
 	t.Run("success", func(t *testing.T) {
 		post := Posts[0]
+		post.Votes = authorVote
 		mockColl.EXPECT().InsertOne(context.Background(), gomock.Any()).Return(nil, nil)
+		mockVotes.EXPECT().InsertOne(context.Background(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, doc interface{}) (interface{}, error) {
+				v := doc.(vote.Vote)
+				assert.NotEmpty(t, v.PostID)
+				assert.Equal(t, authorVote[0].UserID, v.UserID)
+				return nil, nil
+			})
 		returned, err := repo.Add(post)
 		assert.Nil(t, err)
 
@@ -353,15 +348,26 @@ func TestAdd(t *testing.T) {
 		post.Created = returned.Created
 		assert.Equal(t, post, returned)
 	})
+
+	t.Run("vote error", func(t *testing.T) {
+		post := Posts[0]
+		post.Votes = authorVote
+		mockColl.EXPECT().InsertOne(context.Background(), gomock.Any()).Return(nil, nil)
+		mockVotes.EXPECT().InsertOne(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("error"))
+		_, err := repo.Add(post)
+		assert.NotNil(t, err)
+	})
 }
 
 func TestAddComment(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockColl := NewMockCollectionHelper(ctrl)
+	mockPosts := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
 	repo := &PostMongoDBRepository{
-		posts: mockColl,
+		posts:    mockPosts,
+		comments: mockComments,
 	}
 
 	post := Posts[0]
@@ -369,35 +375,74 @@ func TestAddComment(t *testing.T) {
 		Author: post.Author,
 		Body:   "some comment",
 	}
-	filter := bson.M{"_id": post.ID}
+	filter := notDeleted(bson.M{"_id": post.ID})
+	inc := bson.M{"$inc": bson.M{"comment_count": 1}}
 
 	t.Run("some error", func(t *testing.T) {
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, gomock.Any()).Return(nil, fmt.Errorf("error"))
+		mockPosts.EXPECT().UpdateOne(context.Background(), filter, inc).Return(nil, fmt.Errorf("error"))
 		_, err := repo.AddComment(post.ID, comm)
 		assert.NotNil(t, err)
 	})
 
-	t.Run("no modified", func(t *testing.T) {
-		result := &mongo.UpdateResult{
-			MatchedCount:  1,
-			ModifiedCount: 0,
-		}
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, gomock.Any()).Return(result, nil)
+	t.Run("no post", func(t *testing.T) {
+		mockPosts.EXPECT().UpdateOne(context.Background(), filter, inc).Return(&mongo.UpdateResult{}, nil)
 		_, err := repo.AddComment(post.ID, comm)
 		assert.Equal(t, ErrNoPost, err)
 	})
 
 	t.Run("success", func(t *testing.T) {
-		result := &mongo.UpdateResult{
-			MatchedCount:  1,
-			ModifiedCount: 1,
-		}
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, gomock.Any()).Return(result, nil)
-		singleResponse := mongo.NewSingleResultFromDocument(post, nil, nil)
-		mockColl.EXPECT().FindOne(context.Background(), bson.M{"_id": post.ID}).Return(singleResponse)
+		mockPosts.EXPECT().UpdateOne(context.Background(), filter, inc).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+		mockComments.EXPECT().InsertOne(context.Background(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, doc interface{}) (interface{}, error) {
+				stored := doc.(comment.Comment)
+				assert.Equal(t, post.ID, stored.PostID)
+				assert.NotEmpty(t, stored.ID)
+				return nil, nil
+			})
 		returned, err := repo.AddComment(post.ID, comm)
 		assert.Nil(t, err)
-		assert.Equal(t, post, returned)
+		assert.Equal(t, post.ID, returned.PostID)
+		assert.Equal(t, comm.Body, returned.Body)
+		assert.NotEmpty(t, returned.Created)
+	})
+
+	t.Run("insert error", func(t *testing.T) {
+		mockPosts.EXPECT().UpdateOne(context.Background(), filter, inc).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+		mockComments.EXPECT().InsertOne(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("error"))
+		// the counter is put back
+		mockPosts.EXPECT().UpdateOne(context.Background(), filter, bson.M{"$inc": bson.M{"comment_count": -1}}).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+		_, err := repo.AddComment(post.ID, comm)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("no parent comment", func(t *testing.T) {
+		reply := comm
+		reply.ParentID = "missing"
+		mockComments.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"post_id": post.ID, "id": "missing"})).
+			Return(mongo.NewSingleResultFromDocument(comment.Comment{}, mongo.ErrNoDocuments, nil))
+		singleResponse := mongo.NewSingleResultFromDocument(post, nil, nil)
+		mockPosts.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"_id": post.ID})).Return(singleResponse)
+		_, err := repo.AddComment(post.ID, reply)
+		assert.Equal(t, comment.ErrNoComment, err)
+	})
+
+	t.Run("reply", func(t *testing.T) {
+		reply := comm
+		reply.ParentID = "c0"
+		mockComments.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"post_id": post.ID, "id": "c0"})).
+			Return(mongo.NewSingleResultFromDocument(comment.Comment{ID: "c0", PostID: post.ID}, nil, nil))
+		mockPosts.EXPECT().UpdateOne(context.Background(), filter, inc).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+		// the parent counts its replies, deleted parents with replies stay as placeholders
+		mockComments.EXPECT().UpdateOne(context.Background(), bson.M{"post_id": post.ID, "id": "c0"},
+			bson.M{"$inc": bson.M{"reply_count": 1}}).Return(&mongo.UpdateResult{MatchedCount: 1}, nil)
+		mockComments.EXPECT().InsertOne(context.Background(), gomock.Any()).Return(nil, nil)
+		returned, err := repo.AddComment(post.ID, reply)
+		assert.Nil(t, err)
+		assert.Equal(t, "c0", returned.ParentID)
 	})
 }
 
@@ -405,207 +450,417 @@ func TestDeleteComment(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockColl := NewMockCollectionHelper(ctrl)
+	mockPosts := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
 	repo := &PostMongoDBRepository{
-		posts: mockColl,
+		posts:    mockPosts,
+		comments: mockComments,
 	}
 
 	post := Posts[0]
 	commentID := "1"
-	userID := post.Author.ID
 
-	filter := bson.M{"_id": post.ID}
-	pullFilter := bson.M{"comments": bson.M{"$and": bson.A{
-		bson.M{"id": commentID},
-		bson.M{"author.id": userID},
-	}}}
-	update := bson.M{"$pull": pullFilter}
+	filter := notDeleted(bson.M{"post_id": post.ID, "id": commentID})
+	softDelete := gomock.Any()
+	dec := bson.M{"$inc": bson.M{"comment_count": -1}}
 
 	t.Run("some error", func(t *testing.T) {
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, update).Return(nil, fmt.Errorf("error"))
-		_, err := repo.DeleteComment(post.ID, commentID, userID)
+		mockComments.EXPECT().UpdateOne(context.Background(), filter, softDelete).Return(nil, fmt.Errorf("error"))
+		err := repo.DeleteComment(post.ID, commentID)
 		assert.NotNil(t, err)
 	})
 
-	t.Run("no modified", func(t *testing.T) {
-		result := &mongo.UpdateResult{
-			MatchedCount:  0,
-			ModifiedCount: 0,
-		}
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, update).Return(result, nil)
-		_, err := repo.DeleteComment(post.ID, commentID, userID)
+	t.Run("no post", func(t *testing.T) {
+		mockComments.EXPECT().UpdateOne(context.Background(), filter, softDelete).Return(&mongo.UpdateResult{}, nil)
+		mockPosts.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"_id": post.ID})).
+			Return(mongo.NewSingleResultFromDocument(Post{}, mongo.ErrNoDocuments, nil))
+		err := repo.DeleteComment(post.ID, commentID)
 		assert.Equal(t, ErrNoPost, err)
 	})
 
 	t.Run("no comment", func(t *testing.T) {
-		result := &mongo.UpdateResult{
-			MatchedCount:  1,
-			ModifiedCount: 0,
-		}
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, update).Return(result, nil)
-		_, err := repo.DeleteComment(post.ID, commentID, userID)
+		mockComments.EXPECT().UpdateOne(context.Background(), filter, softDelete).Return(&mongo.UpdateResult{}, nil)
+		mockPosts.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"_id": post.ID})).
+			Return(mongo.NewSingleResultFromDocument(post, nil, nil))
+		err := repo.DeleteComment(post.ID, commentID)
 		assert.Equal(t, comment.ErrNoComment, err)
 	})
 
 	t.Run("success", func(t *testing.T) {
-		result := &mongo.UpdateResult{
-			MatchedCount:  1,
-			ModifiedCount: 1,
-		}
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, update).Return(result, nil)
-
-		singleResponse := mongo.NewSingleResultFromDocument(post, nil, nil)
-		mockColl.EXPECT().FindOne(context.Background(), bson.M{"_id": post.ID}).Return(singleResponse)
-
-		returned, err := repo.DeleteComment(post.ID, commentID, userID)
+		mockComments.EXPECT().UpdateOne(context.Background(), filter, softDelete).
+			DoAndReturn(func(ctx context.Context, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+				set := update.(bson.M)["$set"].(bson.M)
+				assert.WithinDuration(t, time.Now(), set["deleted_at"].(time.Time), time.Minute)
+				return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+			})
+		mockPosts.EXPECT().UpdateOne(context.Background(), notDeleted(bson.M{"_id": post.ID}), dec).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+		err := repo.DeleteComment(post.ID, commentID)
 		assert.Nil(t, err)
-		assert.Equal(t, post, returned)
 	})
 }
 
-func TestDBUpvote(t *testing.T) {
+func TestGetCommentsMongo(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockColl := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
 	repo := &PostMongoDBRepository{
-		posts: mockColl,
+		comments: mockComments,
+	}
+	stored := []interface{}{
+		comment.Comment{ID: "c1", PostID: "1", Body: "first"},
+		comment.Comment{ID: "c2", PostID: "1", Body: "second"},
 	}
 
-	post := Posts[0]
-	userID := post.Author.ID
-	post.Votes = []vote.Vote{
-		{
-			UserID: userID,
-			Value:  1,
-		},
+	mockComments.EXPECT().Aggregate(context.Background(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, pipeline interface{}) (*mongo.Cursor, error) {
+			stages := pipeline.(bson.A)
+			match := stages[0].(bson.M)["$match"].(bson.M)
+			assert.Equal(t, "1", match["post_id"])
+			assert.Equal(t, bson.M{"$nin": []string{"blocked"}}, match["author.id"])
+			assert.Contains(t, match, "$or")
+			assert.Equal(t, bson.M{"$skip": 5}, stages[2])
+			assert.Equal(t, bson.M{"$limit": 2}, stages[3])
+			return mongo.NewCursorFromDocuments(stored, nil, nil)
+		})
+	comments, err := repo.GetComments("1", Filter{BlockedUsers: []string{"blocked"}}, 5, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []comment.Comment{stored[0].(comment.Comment), stored[1].(comment.Comment)}, comments)
+
+	// deleted comments found have replies and come as placeholders
+	deletedAt := time.Now()
+	deleted := comment.Comment{ID: "c0", PostID: "1", Author: user.NewUser("a", "alice", ""), Body: "gone", ReplyCount: 1, DeletedAt: &deletedAt}
+	mockComments.EXPECT().Aggregate(context.Background(), gomock.Any()).
+		Return(mongo.NewCursorFromDocuments([]interface{}{deleted}, nil, nil))
+	comments, err = repo.GetComments("1", Filter{}, 0, 2)
+	assert.Nil(t, err)
+	if assert.Len(t, comments, 1) {
+		assert.Equal(t, comment.DeletedBody, comments[0].Body)
+		assert.Empty(t, comments[0].Author.Username)
 	}
 
-	filter := bson.M{"_id": post.ID}
-	update := bson.M{"$set": post}
+	mockComments.EXPECT().Aggregate(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("some error"))
+	_, err = repo.GetComments("1", Filter{}, 0, 2)
+	assert.NotNil(t, err)
 
-	t.Run("err in GetByID", func(t *testing.T) {
-		singleResponse := mongo.NewSingleResultFromDocument(nil, fmt.Errorf("some err"), nil)
-		mockColl.EXPECT().FindOne(context.Background(), bson.M{"_id": post.ID}).Return(singleResponse)
-		_, err := repo.Upvote(post.ID, userID)
-		assert.NotNil(t, err)
-	})
+	mockComments.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"post_id": "1", "id": "c1"})).
+		Return(mongo.NewSingleResultFromDocument(stored[0], nil, nil))
+	comm, err := repo.GetComment("1", "c1")
+	assert.Nil(t, err)
+	assert.Equal(t, "first", comm.Body)
 
-	t.Run("success", func(t *testing.T) {
-		result := &mongo.UpdateResult{
-			MatchedCount:  1,
-			ModifiedCount: 1,
-		}
-		singleResponse := mongo.NewSingleResultFromDocument(post, nil, nil)
-		mockColl.EXPECT().FindOne(context.Background(), bson.M{"_id": post.ID}).Return(singleResponse)
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, update).Return(result, nil)
-		returned, err := repo.Upvote(post.ID, userID)
-		assert.Nil(t, err)
-		assert.Equal(t, post, returned)
-	})
+	mockComments.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"post_id": "1", "id": "c3"})).
+		Return(mongo.NewSingleResultFromDocument(comment.Comment{}, mongo.ErrNoDocuments, nil))
+	_, err = repo.GetComment("1", "c3")
+	assert.Equal(t, comment.ErrNoComment, err)
 
-	t.Run("some rror", func(t *testing.T) {
-		singleResponse := mongo.NewSingleResultFromDocument(post, nil, nil)
-		mockColl.EXPECT().FindOne(context.Background(), bson.M{"_id": post.ID}).Return(singleResponse)
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, update).Return(nil, fmt.Errorf("error"))
-		_, err := repo.Upvote(post.ID, userID)
-		assert.NotNil(t, err)
-	})
+	mockComments.EXPECT().Find(context.Background(), notDeleted(bson.M{"id": bson.M{"$in": []string{"c2", "c3"}}})).
+		Return(mongo.NewCursorFromDocuments(stored[1:], nil, nil))
+	comments, err = repo.GetCommentsByIDs([]string{"c2", "c3"})
+	assert.Nil(t, err)
+	assert.Equal(t, []comment.Comment{stored[1].(comment.Comment)}, comments)
 }
 
-func TestDBDownvote(t *testing.T) {
+func TestMigrateComments(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockColl := NewMockCollectionHelper(ctrl)
+	mockPosts := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
 	repo := &PostMongoDBRepository{
-		posts: mockColl,
+		posts:    mockPosts,
+		comments: mockComments,
+	}
+	embedded := Post{ID: "1", Comments: []comment.Comment{{ID: "c1"}, {ID: "c2"}}}
+	empty := Post{ID: "2", Comments: []comment.Comment{}}
+
+	mockPosts.EXPECT().Find(context.Background(), bson.M{"comments": bson.M{"$exists": true}}).
+		Return(mongo.NewCursorFromDocuments([]interface{}{embedded, empty}, nil, nil))
+	mockComments.EXPECT().BulkWrite(context.Background(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+			if assert.Len(t, models, 2) {
+				model := models[0].(*mongo.UpdateOneModel)
+				assert.Equal(t, bson.M{"id": "c1"}, model.Filter)
+				assert.Equal(t, bson.M{"$setOnInsert": comment.Comment{ID: "c1", PostID: "1"}}, model.Update)
+				assert.True(t, *model.Upsert)
+			}
+			return &mongo.BulkWriteResult{UpsertedCount: 2}, nil
+		})
+	for _, p := range []Post{embedded, empty} {
+		filter := bson.M{"_id": p.ID, "comments": bson.M{"$exists": true}}
+		update := bson.M{
+			"$unset": bson.M{"comments": ""},
+			"$inc":   bson.M{"comment_count": len(p.Comments)},
+		}
+		mockPosts.EXPECT().UpdateOne(context.Background(), filter, update).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
 	}
+	moved, err := repo.MigrateComments(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, moved)
+
+	mockPosts.EXPECT().Find(context.Background(), gomock.Any()).
+		Return(mongo.NewCursorFromDocuments([]interface{}{embedded}, nil, nil))
+	mockComments.EXPECT().BulkWrite(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("some error"))
+	moved, err = repo.MigrateComments(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, moved)
+}
 
-	post := Posts[0]
-	userID := post.Author.ID
-	post.Votes = []vote.Vote{
-		{
-			UserID: userID,
-			Value:  -1,
-		},
+// voteMocks wires a repository to mocked posts and votes collections.
+func voteMocks(ctrl *gomock.Controller) (*PostMongoDBRepository, *MockCollectionHelper, *MockCollectionHelper) {
+	mockPosts := NewMockCollectionHelper(ctrl)
+	mockVotes := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts: mockPosts,
+		votes: mockVotes,
 	}
+	return repo, mockPosts, mockVotes
+}
+
+// expectCount expects the counters of the post to move by the deltas and
+// answers with the counted post.
+func expectCount(t *testing.T, mockPosts *MockCollectionHelper, counted Post, score, upvotes, downvotes int) {
+	mockPosts.EXPECT().FindOneAndUpdate(context.Background(), bson.M{"_id": counted.ID}, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) SingleResultHelper {
+			stages := update.(bson.A)
+			assert.Equal(t, bson.M{"$set": bson.M{
+				"score":     bson.M{"$add": bson.A{"$score", score}},
+				"upvotes":   bson.M{"$add": bson.A{"$upvotes", upvotes}},
+				"downvotes": bson.M{"$add": bson.A{"$downvotes", downvotes}},
+			}}, stages[0])
+			return mongo.NewSingleResultFromDocument(counted, nil, nil)
+		})
+}
 
-	filter := bson.M{"_id": post.ID}
-	update := bson.M{"$set": post}
+func TestDBUpvote(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo, mockPosts, mockVotes := voteMocks(ctrl)
+
+	post := Posts[0]
+	userID := "2"
+	voteFilter := bson.M{"post_id": post.ID, "user": userID}
+	voteUpdate := bson.M{"$set": bson.M{"vote": 1}}
+	noVote := func() SingleResultHelper {
+		return mongo.NewSingleResultFromDocument(vote.Vote{}, mongo.ErrNoDocuments, nil)
+	}
 
 	t.Run("err in GetByID", func(t *testing.T) {
 		singleResponse := mongo.NewSingleResultFromDocument(nil, fmt.Errorf("some err"), nil)
-		mockColl.EXPECT().FindOne(context.Background(), bson.M{"_id": post.ID}).Return(singleResponse)
-		_, err := repo.Downvote(post.ID, userID)
+		mockPosts.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"_id": post.ID})).Return(singleResponse)
+		_, err := repo.Upvote(post.ID, userID)
 		assert.NotNil(t, err)
 	})
 
-	t.Run("success", func(t *testing.T) {
-		result := &mongo.UpdateResult{
-			MatchedCount:  1,
-			ModifiedCount: 1,
-		}
-		singleResponse := mongo.NewSingleResultFromDocument(post, nil, nil)
-		mockColl.EXPECT().FindOne(context.Background(), bson.M{"_id": post.ID}).Return(singleResponse)
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, update).Return(result, nil)
-		returned, err := repo.Downvote(post.ID, userID)
+	t.Run("new vote", func(t *testing.T) {
+		counted := post
+		counted.ChangeVote(0, 1)
+		mockPosts.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"_id": post.ID})).
+			Return(mongo.NewSingleResultFromDocument(post, nil, nil))
+		mockVotes.EXPECT().FindOneAndUpdate(context.Background(), voteFilter, voteUpdate, gomock.Any()).Return(noVote())
+		expectCount(t, mockPosts, counted, 1, 1, 0)
+		returned, err := repo.Upvote(post.ID, userID)
 		assert.Nil(t, err)
-		assert.Equal(t, post, returned)
+		assert.Equal(t, counted.WithVote(userID, 1), returned)
+		assert.Equal(t, 2, returned.Upvotes)
+		assert.Equal(t, []vote.Vote{{PostID: post.ID, UserID: userID, Value: 1}}, returned.Votes)
 	})
 
-	t.Run("some rror", func(t *testing.T) {
-		singleResponse := mongo.NewSingleResultFromDocument(post, nil, nil)
-		mockColl.EXPECT().FindOne(context.Background(), bson.M{"_id": post.ID}).Return(singleResponse)
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, update).Return(nil, fmt.Errorf("error"))
-		_, err := repo.Downvote(post.ID, userID)
+	t.Run("exist vote", func(t *testing.T) {
+		mockPosts.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"_id": post.ID})).
+			Return(mongo.NewSingleResultFromDocument(post, nil, nil))
+		mockVotes.EXPECT().FindOneAndUpdate(context.Background(), voteFilter, voteUpdate, gomock.Any()).
+			Return(mongo.NewSingleResultFromDocument(vote.Vote{PostID: post.ID, UserID: userID, Value: 1}, nil, nil))
+		returned, err := repo.Upvote(post.ID, userID)
+		assert.Nil(t, err)
+		assert.Equal(t, post.WithVote(userID, 1), returned)
+	})
+
+	t.Run("vote error", func(t *testing.T) {
+		mockPosts.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"_id": post.ID})).
+			Return(mongo.NewSingleResultFromDocument(post, nil, nil))
+		mockVotes.EXPECT().FindOneAndUpdate(context.Background(), voteFilter, voteUpdate, gomock.Any()).
+			Return(mongo.NewSingleResultFromDocument(nil, fmt.Errorf("error"), nil))
+		_, err := repo.Upvote(post.ID, userID)
 		assert.NotNil(t, err)
 	})
+
+	t.Run("post deleted meanwhile", func(t *testing.T) {
+		mockPosts.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"_id": post.ID})).
+			Return(mongo.NewSingleResultFromDocument(post, nil, nil))
+		mockVotes.EXPECT().FindOneAndUpdate(context.Background(), voteFilter, voteUpdate, gomock.Any()).Return(noVote())
+		mockPosts.EXPECT().FindOneAndUpdate(context.Background(), bson.M{"_id": post.ID}, gomock.Any(), gomock.Any()).
+			Return(mongo.NewSingleResultFromDocument(Post{}, mongo.ErrNoDocuments, nil))
+		_, err := repo.Upvote(post.ID, userID)
+		assert.Equal(t, ErrNoPost, err)
+	})
 }
 
-func TestDBUnvote(t *testing.T) {
+func TestDBDownvote(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
-
-	mockColl := NewMockCollectionHelper(ctrl)
-	repo := &PostMongoDBRepository{
-		posts: mockColl,
-	}
+	repo, mockPosts, mockVotes := voteMocks(ctrl)
 
 	post := Posts[0]
 	userID := post.Author.ID
-	post.Votes = []vote.Vote{}
+	voteFilter := bson.M{"post_id": post.ID, "user": userID}
+
+	t.Run("opposite vote", func(t *testing.T) {
+		counted := post
+		counted.ChangeVote(1, -1)
+		mockPosts.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"_id": post.ID})).
+			Return(mongo.NewSingleResultFromDocument(post, nil, nil))
+		mockVotes.EXPECT().FindOneAndUpdate(context.Background(), voteFilter, bson.M{"$set": bson.M{"vote": -1}}, gomock.Any()).
+			Return(mongo.NewSingleResultFromDocument(vote.Vote{PostID: post.ID, UserID: userID, Value: 1}, nil, nil))
+		expectCount(t, mockPosts, counted, -2, -1, 1)
+		returned, err := repo.Downvote(post.ID, userID)
+		assert.Nil(t, err)
+		assert.Equal(t, counted.WithVote(userID, -1), returned)
+		assert.Equal(t, -1, returned.Score)
+		assert.Equal(t, 0, returned.UpvotePercentage)
+	})
+}
 
-	filter := bson.M{"_id": post.ID}
-	update := bson.M{"$set": post}
+func TestDBUnvote(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo, mockPosts, mockVotes := voteMocks(ctrl)
 
-	t.Run("err in GetByID", func(t *testing.T) {
-		singleResponse := mongo.NewSingleResultFromDocument(nil, fmt.Errorf("some err"), nil)
-		mockColl.EXPECT().FindOne(context.Background(), bson.M{"_id": post.ID}).Return(singleResponse)
-		_, err := repo.Unvote(post.ID, userID)
-		assert.NotNil(t, err)
+	post := Posts[0]
+	userID := post.Author.ID
+	voteFilter := bson.M{"post_id": post.ID, "user": userID}
+
+	t.Run("exist vote", func(t *testing.T) {
+		counted := post
+		counted.ChangeVote(1, 0)
+		mockPosts.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"_id": post.ID})).
+			Return(mongo.NewSingleResultFromDocument(post, nil, nil))
+		mockVotes.EXPECT().FindOneAndDelete(context.Background(), voteFilter).
+			Return(mongo.NewSingleResultFromDocument(vote.Vote{PostID: post.ID, UserID: userID, Value: 1}, nil, nil))
+		expectCount(t, mockPosts, counted, -1, -1, 0)
+		returned, err := repo.Unvote(post.ID, userID)
+		assert.Nil(t, err)
+		assert.Equal(t, []vote.Vote{}, returned.Votes)
+		assert.Equal(t, 0, returned.Score)
 	})
 
-	t.Run("success", func(t *testing.T) {
-		result := &mongo.UpdateResult{
-			MatchedCount:  1,
-			ModifiedCount: 1,
-		}
-		singleResponse := mongo.NewSingleResultFromDocument(post, nil, nil)
-		mockColl.EXPECT().FindOne(context.Background(), bson.M{"_id": post.ID}).Return(singleResponse)
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, update).Return(result, nil)
+	t.Run("no vote", func(t *testing.T) {
+		mockPosts.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"_id": post.ID})).
+			Return(mongo.NewSingleResultFromDocument(post, nil, nil))
+		mockVotes.EXPECT().FindOneAndDelete(context.Background(), voteFilter).
+			Return(mongo.NewSingleResultFromDocument(vote.Vote{}, mongo.ErrNoDocuments, nil))
 		returned, err := repo.Unvote(post.ID, userID)
 		assert.Nil(t, err)
-		assert.Equal(t, post, returned)
+		assert.Equal(t, post.WithVote(userID, 0), returned)
 	})
+}
 
-	t.Run("some rror", func(t *testing.T) {
-		singleResponse := mongo.NewSingleResultFromDocument(post, nil, nil)
-		mockColl.EXPECT().FindOne(context.Background(), bson.M{"_id": post.ID}).Return(singleResponse)
-		mockColl.EXPECT().UpdateOne(context.Background(), filter, update).Return(nil, fmt.Errorf("error"))
-		_, err := repo.Unvote(post.ID, userID)
-		assert.NotNil(t, err)
-	})
+func TestGetVotesMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo, _, mockVotes := voteMocks(ctrl)
+
+	v := vote.Vote{PostID: "1", UserID: "u", Value: -1}
+	filter := bson.M{"user": "u", "post_id": bson.M{"$in": []string{"1", "2"}}}
+	mockVotes.EXPECT().Find(context.Background(), filter).
+		Return(mongo.NewCursorFromDocuments([]interface{}{v}, nil, nil))
+	votes, err := repo.GetVotes("u", []string{"1", "2"})
+	assert.Nil(t, err)
+	assert.Equal(t, []vote.Vote{v}, votes)
+
+	mockVotes.EXPECT().Find(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("some error"))
+	_, err = repo.GetVotes("u", []string{"1"})
+	assert.NotNil(t, err)
+}
+
+func TestMigrateVotes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo, mockPosts, mockVotes := voteMocks(ctrl)
+
+	embedded := legacyVotes{ID: "1", Votes: []vote.Vote{{UserID: "a", Value: 1}, {UserID: "b", Value: -1}, {UserID: "c", Value: 1}}}
+	empty := legacyVotes{ID: "2", Votes: []vote.Vote{}}
+
+	mockPosts.EXPECT().Find(context.Background(), bson.M{"votes": bson.M{"$exists": true}}).
+		Return(mongo.NewCursorFromDocuments([]interface{}{embedded, empty}, nil, nil))
+	mockVotes.EXPECT().BulkWrite(context.Background(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+			if assert.Len(t, models, 3) {
+				model := models[1].(*mongo.UpdateOneModel)
+				assert.Equal(t, bson.M{"post_id": "1", "user": "b"}, model.Filter)
+				assert.Equal(t, bson.M{"$setOnInsert": vote.Vote{PostID: "1", UserID: "b", Value: -1}}, model.Update)
+				assert.True(t, *model.Upsert)
+			}
+			return &mongo.BulkWriteResult{UpsertedCount: 3}, nil
+		})
+	for _, tc := range []struct {
+		id        string
+		upvotes   int
+		downvotes int
+	}{{"1", 2, 1}, {"2", 0, 0}} {
+		filter := bson.M{"_id": tc.id, "votes": bson.M{"$exists": true}}
+		update := bson.M{
+			"$unset": bson.M{"votes": ""},
+			"$set":   bson.M{"upvotes": tc.upvotes, "downvotes": tc.downvotes},
+		}
+		mockPosts.EXPECT().UpdateOne(context.Background(), filter, update).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+	}
+	moved, err := repo.MigrateVotes(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, moved)
+
+	mockPosts.EXPECT().Find(context.Background(), gomock.Any()).
+		Return(mongo.NewCursorFromDocuments([]interface{}{embedded}, nil, nil))
+	mockVotes.EXPECT().BulkWrite(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("some error"))
+	moved, err = repo.MigrateVotes(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, moved)
+}
+
+func TestVotesMemory(t *testing.T) {
+	repo := NewMemoryRepo()
+	p := Post{Type: TEXT, Title: "t"}
+	InitPost(&p, user.User{ID: "a", Username: "alice"})
+	p, err := repo.Add(p)
+	assert.Nil(t, err)
+	assert.Equal(t, []vote.Vote{{UserID: "a", Value: 1}}, p.Votes)
+
+	// stored posts carry no votes, the author's vote is kept aside
+	stored, _ := repo.GetByID(p.ID)
+	assert.Nil(t, stored.Votes)
+	votes, _ := repo.GetVotes("a", []string{p.ID, "missing"})
+	assert.Equal(t, []vote.Vote{{PostID: p.ID, UserID: "a", Value: 1}}, votes)
+
+	voted, err := repo.Downvote(p.ID, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, []vote.Vote{{PostID: p.ID, UserID: "b", Value: -1}}, voted.Votes)
+	assert.Equal(t, 0, voted.Score)
+	assert.Equal(t, 50, voted.UpvotePercentage)
+
+	voted, _ = repo.Downvote(p.ID, "a")
+	assert.Equal(t, -2, voted.Score)
+	assert.Equal(t, 0, voted.UpvotePercentage)
+
+	voted, _ = repo.Unvote(p.ID, "b")
+	assert.Equal(t, []vote.Vote{}, voted.Votes)
+	assert.Equal(t, -1, voted.Score)
+	assert.Equal(t, 1, voted.VoteCount())
+
+	_, err = repo.Upvote("missing", "a")
+	assert.Equal(t, ErrNoPost, err)
+
+	// votes stay with a deleted post until it is purged
+	assert.Nil(t, repo.Delete(p.ID))
+	votes, _ = repo.GetVotes("a", []string{p.ID})
+	assert.Len(t, votes, 1)
+	purged, err := repo.Purge(time.Now().Add(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+	votes, _ = repo.GetVotes("a", []string{p.ID})
+	assert.Empty(t, votes)
 }
 
 func TestDelete(t *testing.T) {
@@ -613,31 +868,41 @@ func TestDelete(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockColl := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
+	mockVotes := NewMockCollectionHelper(ctrl)
 	repo := &PostMongoDBRepository{
-		posts: mockColl,
+		posts:    mockColl,
+		comments: mockComments,
+		votes:    mockVotes,
 	}
 
 	post := Posts[0]
-	userID := post.Author.ID
 
-	filter := bson.M{"$and": bson.A{
-		bson.M{"_id": post.ID},
-		bson.M{"author.id": userID},
-	}}
+	filter := notDeleted(bson.M{"_id": post.ID})
 
 	t.Run("some err", func(t *testing.T) {
-		var r int64 = 0
-		mockColl.EXPECT().DeleteOne(context.Background(), filter).Return(r, fmt.Errorf("error"))
-		err := repo.Delete(post.ID, userID)
+		mockColl.EXPECT().UpdateOne(context.Background(), filter, gomock.Any()).Return(nil, fmt.Errorf("error"))
+		err := repo.Delete(post.ID)
 		assert.NotNil(t, err)
 	})
 
+	// comments and votes are kept until the post is purged
 	t.Run("success", func(t *testing.T) {
-		var r int64 = 1
-		mockColl.EXPECT().DeleteOne(context.Background(), filter).Return(r, nil)
-		err := repo.Delete(post.ID, userID)
+		mockColl.EXPECT().UpdateOne(context.Background(), filter, gomock.Any()).
+			DoAndReturn(func(ctx context.Context, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+				set := update.(bson.M)["$set"].(bson.M)
+				assert.WithinDuration(t, time.Now(), set["deleted_at"].(time.Time), time.Minute)
+				return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+			})
+		err := repo.Delete(post.ID)
 		assert.Nil(t, err)
 	})
+
+	t.Run("no post", func(t *testing.T) {
+		mockColl.EXPECT().UpdateOne(context.Background(), filter, gomock.Any()).Return(&mongo.UpdateResult{}, nil)
+		err := repo.Delete(post.ID)
+		assert.Equal(t, ErrNoPost, err)
+	})
 }
 
 func TestGetUserPosts(t *testing.T) {
@@ -651,7 +916,7 @@ func TestGetUserPosts(t *testing.T) {
 
 	t.Run("some error", func(t *testing.T) {
 		username := "username"
-		mockColl.EXPECT().Find(context.Background(), bson.M{"author.username": username}).Return(nil, fmt.Errorf("error"))
+		mockColl.EXPECT().Find(context.Background(), notDeleted(bson.M{"author.username": username})).Return(nil, fmt.Errorf("error"))
 		_, err := repo.GetUserPosts(username)
 		assert.NotNil(t, err)
 	})
@@ -668,7 +933,7 @@ func TestGetUserPosts(t *testing.T) {
 		}
 
 		username := "name"
-		mockColl.EXPECT().Find(context.Background(), bson.M{"author.username": username}).Return(cursor, nil)
+		mockColl.EXPECT().Find(context.Background(), notDeleted(bson.M{"author.username": username})).Return(cursor, nil)
 		returned, err := repo.GetUserPosts(username)
 		assert.Nil(t, err)
 		assert.Equal(t, Posts, returned)
@@ -684,7 +949,7 @@ func TestGetUserPosts(t *testing.T) {
 	}
 
 	mt.Run("error all", func(mt *mtest.T) {
-		repo := NewMongoDBRepo(mt.Coll)
+		repo := NewMongoDBRepo(mt.Coll, mt.Coll, mt.Coll, mt.Coll)
 		cursorResposes := []primitive.D{
 			mtest.CreateCursorResponse(1, "foo.bar", mtest.FirstBatch, bsoned),
 			{},
@@ -697,3 +962,1057 @@ func TestGetUserPosts(t *testing.T) {
 		assert.Equal(t, "fail to get all posts command failed", err.Error())
 	})
 }
+
+func TestSetPreview(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockColl := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts: mockColl,
+	}
+	preview := unfurl.Preview{Title: "title", SiteName: "site"}
+	filter := bson.M{"_id": "1"}
+	update := bson.M{"$set": bson.M{"preview": preview}}
+
+	mockColl.EXPECT().UpdateOne(context.Background(), filter, update).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+	assert.Nil(t, repo.SetPreview("1", preview))
+
+	mockColl.EXPECT().UpdateOne(context.Background(), filter, update).
+		Return(&mongo.UpdateResult{}, nil)
+	assert.Equal(t, ErrNoPost, repo.SetPreview("1", preview))
+
+	mockColl.EXPECT().UpdateOne(context.Background(), filter, update).
+		Return(nil, fmt.Errorf("some error"))
+	assert.NotNil(t, repo.SetPreview("1", preview))
+}
+
+func TestAddViewsMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockColl := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts: mockColl,
+	}
+	models := []mongo.WriteModel{
+		mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": "1"}).
+			SetUpdate(bson.M{"$inc": bson.M{"views": 3}}),
+	}
+
+	mockColl.EXPECT().BulkWrite(context.Background(), models).
+		Return(&mongo.BulkWriteResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+	assert.Nil(t, repo.AddViews(map[string]int{"1": 3}))
+
+	mockColl.EXPECT().BulkWrite(context.Background(), models).
+		Return(nil, fmt.Errorf("some error"))
+	assert.NotNil(t, repo.AddViews(map[string]int{"1": 3}))
+
+	// nothing to write, no round trip
+	assert.Nil(t, repo.AddViews(map[string]int{}))
+}
+
+func TestGetAllFiltered(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockColl := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts: mockColl,
+	}
+	f := Filter{HiddenPosts: []string{"hidden"}, BlockedUsers: []string{"blocked"}}
+	stored := Post{
+		ID: "1",
+		Comments: []comment.Comment{
+			{ID: "c1", Author: user.User{ID: "blocked"}},
+			{ID: "c2", Author: user.User{ID: "other"}},
+		},
+	}
+
+	query := notDeleted(bson.M{
+		"_id":       bson.M{"$nin": f.HiddenPosts},
+		"author.id": bson.M{"$nin": f.BlockedUsers},
+	})
+	mockColl.EXPECT().Find(context.Background(), query).
+		Return(mongo.NewCursorFromDocuments([]interface{}{stored}, nil, nil))
+	posts, err := repo.GetAll(f)
+	assert.Nil(t, err)
+	if assert.Len(t, posts, 1) {
+		assert.Equal(t, []comment.Comment{stored.Comments[1]}, posts[0].Comments)
+	}
+
+	query = notDeleted(bson.M{"category": "music", "author.id": bson.M{"$nin": f.BlockedUsers}})
+	mockColl.EXPECT().Find(context.Background(), query).
+		Return(mongo.NewCursorFromDocuments([]interface{}{}, nil, nil))
+	_, err = repo.GetByCategory("music", Filter{BlockedUsers: f.BlockedUsers})
+	assert.Nil(t, err)
+}
+
+func TestGetByIDsMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockColl := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts: mockColl,
+	}
+	filter := notDeleted(bson.M{"_id": bson.M{"$in": []string{Posts[0].ID, "missing"}}})
+	mockColl.EXPECT().Find(context.Background(), filter).
+		Return(mongo.NewCursorFromDocuments([]interface{}{Posts[0]}, nil, nil))
+	posts, err := repo.GetByIDs([]string{Posts[0].ID, "missing"})
+	assert.Nil(t, err)
+	assert.Equal(t, []Post{Posts[0]}, posts)
+
+	mockColl.EXPECT().Find(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("some error"))
+	_, err = repo.GetByIDs([]string{"1"})
+	assert.NotNil(t, err)
+}
+
+func TestVotePollMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPosts := NewMockCollectionHelper(ctrl)
+	mockPollVotes := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts:     mockPosts,
+		pollVotes: mockPollVotes,
+	}
+	poll := newPollPost(nil)
+	poll.ID = "1"
+	counted := poll
+	counted.Poll = NewPoll([]string{"vim", "emacs", "nano"}, nil)
+	_ = counted.VotePoll(1, time.Now())
+	idFilter := notDeleted(bson.M{"_id": "1"})
+
+	mockPosts.EXPECT().FindOne(context.Background(), idFilter).
+		Return(mongo.NewSingleResultFromDocument(poll, nil, nil))
+	mockPollVotes.EXPECT().InsertOne(context.Background(), PollVote{PostID: "1", UserID: "u1", Option: 1}).
+		Return(nil, nil)
+	mockPosts.EXPECT().FindOneAndUpdate(context.Background(), bson.M{"_id": "1"}, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) SingleResultHelper {
+			inc := update.(bson.M)["$inc"].(bson.M)
+			assert.Equal(t, 1, inc["poll.options.1.votes"])
+			assert.Equal(t, 1, inc["poll.total_votes"])
+			return mongo.NewSingleResultFromDocument(counted, nil, nil)
+		})
+	p, err := repo.VotePoll("1", "u1", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, p.Poll.Options[1].Votes)
+	if assert.NotNil(t, p.Poll.VotedOption) {
+		assert.Equal(t, 1, *p.Poll.VotedOption)
+	}
+
+	// the unique index refuses a second vote of the user
+	mockPosts.EXPECT().FindOne(context.Background(), idFilter).
+		Return(mongo.NewSingleResultFromDocument(counted, nil, nil))
+	mockPollVotes.EXPECT().InsertOne(context.Background(), gomock.Any()).
+		Return(nil, mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}})
+	_, err = repo.VotePoll("1", "u1", 0)
+	assert.Equal(t, ErrAlreadyVoted, err)
+
+	mockPosts.EXPECT().FindOne(context.Background(), idFilter).
+		Return(mongo.NewSingleResultFromDocument(counted, nil, nil))
+	mockPollVotes.EXPECT().InsertOne(context.Background(), gomock.Any()).
+		Return(nil, fmt.Errorf("some error"))
+	_, err = repo.VotePoll("1", "u2", 0)
+	assert.NotNil(t, err)
+
+	mockPosts.EXPECT().FindOne(context.Background(), idFilter).
+		Return(mongo.NewSingleResultFromDocument(counted, nil, nil))
+	_, err = repo.VotePoll("1", "u2", 7)
+	assert.Equal(t, ErrNoPollOption, err)
+
+	mockPosts.EXPECT().FindOne(context.Background(), idFilter).
+		Return(mongo.NewSingleResultFromDocument(Post{}, mongo.ErrNoDocuments, nil))
+	_, err = repo.VotePoll("1", "u2", 0)
+	assert.Equal(t, ErrNoPost, err)
+}
+
+func TestVotePollMemory(t *testing.T) {
+	repo := NewMemoryRepo()
+	p, _ := repo.Add(newPollPost(nil))
+
+	voted, err := repo.VotePoll(p.ID, "u1", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, voted.Poll.Options[1].Votes)
+	if assert.NotNil(t, voted.Poll.VotedOption) {
+		assert.Equal(t, 1, *voted.Poll.VotedOption)
+	}
+	_, err = repo.VotePoll(p.ID, "u1", 2)
+	assert.Equal(t, ErrAlreadyVoted, err)
+	_, err = repo.VotePoll(p.ID, "u2", 3)
+	assert.Equal(t, ErrNoPollOption, err)
+	_, err = repo.VotePoll("missing", "u2", 0)
+	assert.Equal(t, ErrNoPost, err)
+
+	votes, _ := repo.GetPollVotes("u1", []string{p.ID, "missing"})
+	assert.Equal(t, []PollVote{{PostID: p.ID, UserID: "u1", Option: 1}}, votes)
+	stored, _ := repo.GetByID(p.ID)
+	assert.Equal(t, 1, stored.Poll.TotalVotes)
+	assert.Nil(t, stored.Poll.VotedOption)
+}
+
+func TestGetPollVotesMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPollVotes := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{pollVotes: mockPollVotes}
+	v := PollVote{PostID: "1", UserID: "u", Option: 2}
+	filter := bson.M{"user_id": "u", "post_id": bson.M{"$in": []string{"1", "2"}}}
+	mockPollVotes.EXPECT().Find(context.Background(), filter).
+		Return(mongo.NewCursorFromDocuments([]interface{}{v}, nil, nil))
+	votes, err := repo.GetPollVotes("u", []string{"1", "2"})
+	assert.Nil(t, err)
+	assert.Equal(t, []PollVote{v}, votes)
+
+	mockPollVotes.EXPECT().Find(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("some error"))
+	_, err = repo.GetPollVotes("u", []string{"1"})
+	assert.NotNil(t, err)
+}
+
+func TestMigratePollVotes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPosts := NewMockCollectionHelper(ctrl)
+	mockPollVotes := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts:     mockPosts,
+		pollVotes: mockPollVotes,
+	}
+	embedded := legacyPollVoters{ID: "1"}
+	embedded.Poll.Voters = []PollVote{{UserID: "a", Option: 0}, {UserID: "b", Option: 2}}
+	empty := legacyPollVoters{ID: "2"}
+
+	mockPosts.EXPECT().Find(context.Background(), bson.M{"poll.voters": bson.M{"$exists": true}}).
+		Return(mongo.NewCursorFromDocuments([]interface{}{embedded, empty}, nil, nil))
+	mockPollVotes.EXPECT().BulkWrite(context.Background(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+			if assert.Len(t, models, 2) {
+				model := models[1].(*mongo.UpdateOneModel)
+				assert.Equal(t, bson.M{"post_id": "1", "user_id": "b"}, model.Filter)
+				assert.Equal(t, bson.M{"$setOnInsert": PollVote{PostID: "1", UserID: "b", Option: 2}}, model.Update)
+				assert.True(t, *model.Upsert)
+			}
+			return &mongo.BulkWriteResult{UpsertedCount: 2}, nil
+		})
+	for _, id := range []string{"1", "2"} {
+		filter := bson.M{"_id": id, "poll.voters": bson.M{"$exists": true}}
+		mockPosts.EXPECT().UpdateOne(context.Background(), filter, bson.M{"$unset": bson.M{"poll.voters": ""}}).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+	}
+	moved, err := repo.MigratePollVotes(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, moved)
+
+	mockPosts.EXPECT().Find(context.Background(), gomock.Any()).
+		Return(mongo.NewCursorFromDocuments([]interface{}{embedded}, nil, nil))
+	mockPollVotes.EXPECT().BulkWrite(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("some error"))
+	moved, err = repo.MigratePollVotes(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, moved)
+}
+
+func TestGetByNormalizedURL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockColl := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts: mockColl,
+	}
+	filter := notDeleted(bson.M{"category": "music", "normalized_url": "https://example.com"})
+
+	mockColl.EXPECT().FindOne(context.Background(), filter).
+		Return(mongo.NewSingleResultFromDocument(Posts[2], nil, nil))
+	p, err := repo.GetByNormalizedURL("music", "https://example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, Posts[2].ID, p.ID)
+
+	mockColl.EXPECT().FindOne(context.Background(), filter).
+		Return(mongo.NewSingleResultFromDocument(Post{}, mongo.ErrNoDocuments, nil))
+	_, err = repo.GetByNormalizedURL("music", "https://example.com")
+	assert.Equal(t, ErrNoPost, err)
+}
+
+func TestMigrateNormalizedURLs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockColl := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts: mockColl,
+	}
+	links := []interface{}{
+		Post{ID: "1", Type: LINK, URL: "HTTP://Example.COM/a/?utm_source=x"},
+		Post{ID: "2", Type: LINK, URL: "not a url"},
+	}
+	mockColl.EXPECT().Find(context.Background(), bson.M{"type": LINK, "normalized_url": bson.M{"$exists": false}}).
+		Return(mongo.NewCursorFromDocuments(links, nil, nil))
+	filter := bson.M{"_id": "1", "normalized_url": bson.M{"$exists": false}}
+	mockColl.EXPECT().UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{"normalized_url": "https://example.com/a"}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+	updated, err := repo.MigrateNormalizedURLs(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, updated)
+
+	mockColl.EXPECT().Find(context.Background(), gomock.Any()).
+		Return(mongo.NewCursorFromDocuments(links, nil, nil))
+	mockColl.EXPECT().UpdateOne(context.Background(), gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("some error"))
+	updated, err = repo.MigrateNormalizedURLs(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, updated)
+}
+
+func TestMigrateHTML(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockColl := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts:    mockColl,
+		comments: mockComments,
+	}
+	mockColl.EXPECT().Find(context.Background(), bson.M{"text": bson.M{"$gt": ""}, "text_html": bson.M{"$exists": false}}).
+		Return(mongo.NewCursorFromDocuments([]interface{}{Post{ID: "1", Type: TEXT, Text: "**hi**"}}, nil, nil))
+	mockColl.EXPECT().UpdateOne(
+		context.Background(),
+		bson.M{"_id": "1", "text_html": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"text_html": markdown.Render("**hi**")}},
+	).Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+	comments := []interface{}{
+		comment.Comment{ID: "c1", PostID: "1", Body: "one"},
+		comment.Comment{ID: "c2", PostID: "1", Body: "_two_"},
+	}
+	mockComments.EXPECT().Find(context.Background(), bson.M{"body": bson.M{"$gt": ""}, "body_html": bson.M{"$exists": false}}).
+		Return(mongo.NewCursorFromDocuments(comments, nil, nil))
+	mockComments.EXPECT().UpdateOne(
+		context.Background(),
+		bson.M{"id": "c1", "body_html": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"body_html": markdown.Render("one")}},
+	).Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+	mockComments.EXPECT().UpdateOne(
+		context.Background(),
+		bson.M{"id": "c2", "body_html": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"body_html": markdown.Render("_two_")}},
+	).Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+	rendered, err := repo.MigrateHTML(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, rendered)
+
+	mockColl.EXPECT().Find(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("some error"))
+	_, err = repo.MigrateHTML(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockColl := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
+	mockVotes := NewMockCollectionHelper(ctrl)
+	mockPollVotes := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts:     mockColl,
+		comments:  mockComments,
+		votes:     mockVotes,
+		pollVotes: mockPollVotes,
+	}
+	mockColl.EXPECT().CreateIndex(context.Background(), gomock.Any()).Return("", nil).Times(2)
+	mockComments.EXPECT().CreateIndex(context.Background(), gomock.Any()).Return("", nil).Times(3)
+	unique := func(ctx context.Context, model mongo.IndexModel) (string, error) {
+		assert.True(t, *model.Options.Unique)
+		return "", nil
+	}
+	mockVotes.EXPECT().CreateIndex(context.Background(), gomock.Any()).DoAndReturn(unique)
+	mockPollVotes.EXPECT().CreateIndex(context.Background(), gomock.Any()).DoAndReturn(unique)
+	assert.Nil(t, repo.EnsureIndexes(context.Background()))
+
+	mockColl.EXPECT().CreateIndex(context.Background(), gomock.Any()).Return("", fmt.Errorf("some error"))
+	assert.NotNil(t, repo.EnsureIndexes(context.Background()))
+}
+
+func TestGetUserActivityMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPosts := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts:    mockPosts,
+		comments: mockComments,
+	}
+	posts := []interface{}{
+		Activity{Kind: ActivityPost, PostID: "1", Title: "t", Category: "c", Score: 3, Created: "2023-02-01T00:00:00Z"},
+		Activity{Kind: ActivityPost, PostID: "2", Title: "old", Category: "c", Score: 1, Created: "2023-01-01T00:00:00Z"},
+	}
+	comments := []interface{}{
+		Activity{Kind: ActivityComment, PostID: "3", CommentID: "c", Body: "hi", Created: "2023-02-02T00:00:00Z"},
+	}
+	latest := func(items []interface{}) func(context.Context, interface{}) (*mongo.Cursor, error) {
+		return func(ctx context.Context, pipeline interface{}) (*mongo.Cursor, error) {
+			stages := pipeline.(bson.A)
+			assert.Equal(t, bson.M{"$match": notDeleted(bson.M{"author.username": "u"})}, stages[0])
+			// enough items of each kind to fill the page after merging
+			assert.Equal(t, bson.M{"$limit": 3}, stages[len(stages)-1])
+			return mongo.NewCursorFromDocuments(items, nil, nil)
+		}
+	}
+	mockPosts.EXPECT().Aggregate(context.Background(), gomock.Any()).DoAndReturn(latest(posts))
+	mockComments.EXPECT().Aggregate(context.Background(), gomock.Any()).DoAndReturn(latest(comments))
+	// the newest comment is on the skipped page, titles are not needed
+	got, err := repo.GetUserActivity("u", 1, 2)
+	assert.Nil(t, err)
+	commented := comments[0].(Activity)
+	commented.Title, commented.Category = "theirs", "music"
+	assert.Equal(t, []Activity{posts[0].(Activity), posts[1].(Activity)}, got)
+
+	mockPosts.EXPECT().Aggregate(context.Background(), gomock.Any()).DoAndReturn(latest(posts))
+	mockComments.EXPECT().Aggregate(context.Background(), gomock.Any()).DoAndReturn(latest(comments))
+	mockPosts.EXPECT().Find(context.Background(), notDeleted(bson.M{"_id": bson.M{"$in": []string{"3"}}})).
+		Return(mongo.NewCursorFromDocuments([]interface{}{Post{ID: "3", Title: "theirs", Category: "music"}}, nil, nil))
+	got, err = repo.GetUserActivity("u", 0, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []Activity{commented, posts[0].(Activity), posts[1].(Activity)}, got)
+
+	mockPosts.EXPECT().Aggregate(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("some error"))
+	_, err = repo.GetUserActivity("u", 0, 2)
+	assert.NotNil(t, err)
+}
+
+func TestGetUserKarmaMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPosts := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts:    mockPosts,
+		comments: mockComments,
+	}
+	commentsFilter := notDeleted(bson.M{"author.username": "u"})
+	doc := bson.M{"_id": nil, "post_karma": 7, "post_count": 2}
+	mockPosts.EXPECT().Aggregate(context.Background(), gomock.Any()).
+		Return(mongo.NewCursorFromDocuments([]interface{}{doc}, nil, nil))
+	mockComments.EXPECT().CountDocuments(context.Background(), commentsFilter).Return(int64(3), nil)
+	karma, err := repo.GetUserKarma("u")
+	assert.Nil(t, err)
+	assert.Equal(t, Karma{Post: 7, PostCount: 2, CommentCount: 3}, karma)
+	assert.Equal(t, 7, karma.Total())
+
+	// no posts and no comments
+	mockPosts.EXPECT().Aggregate(context.Background(), gomock.Any()).
+		Return(mongo.NewCursorFromDocuments(nil, nil, nil))
+	mockComments.EXPECT().CountDocuments(context.Background(), commentsFilter).Return(int64(0), nil)
+	karma, err = repo.GetUserKarma("u")
+	assert.Nil(t, err)
+	assert.Equal(t, Karma{}, karma)
+
+	mockPosts.EXPECT().Aggregate(context.Background(), gomock.Any()).
+		Return(mongo.NewCursorFromDocuments(nil, nil, nil))
+	mockComments.EXPECT().CountDocuments(context.Background(), commentsFilter).Return(int64(0), fmt.Errorf("some error"))
+	_, err = repo.GetUserKarma("u")
+	assert.NotNil(t, err)
+}
+
+func TestUserActivityMemory(t *testing.T) {
+	repo := NewMemoryRepo()
+	u := user.User{ID: "1", Username: "u"}
+	other := user.User{ID: "2", Username: "other"}
+
+	p := Post{Type: TEXT, Title: "mine", Category: "c"}
+	InitPost(&p, u)
+	p, _ = repo.Add(p)
+	p2 := Post{Type: TEXT, Title: "theirs", Category: "c"}
+	InitPost(&p2, other)
+	p2, _ = repo.Add(p2)
+	_, _ = repo.Upvote(p.ID, other.ID)
+	_, _ = repo.AddComment(p2.ID, comment.Comment{Author: u, Body: "first"})
+	_, _ = repo.AddComment(p2.ID, comment.Comment{Author: other, Body: "reply"})
+	// same second, the comment is newer by milliseconds only
+	repo.id2Post[p.ID].Created = "2023-01-01T10:00:00Z"
+	repo.comments[p2.ID][0].Created = "2023-01-01T10:00:00.5Z"
+
+	items, err := repo.GetUserActivity("u", 0, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, items, 2) {
+		assert.Equal(t, ActivityComment, items[0].Kind)
+		assert.Equal(t, "first", items[0].Body)
+		assert.Equal(t, ActivityPost, items[1].Kind)
+		assert.Equal(t, "mine", items[1].Title)
+	}
+	items, _ = repo.GetUserActivity("u", 1, 10)
+	assert.Len(t, items, 1)
+	items, _ = repo.GetUserActivity("u", 5, 10)
+	assert.Len(t, items, 0)
+
+	karma, err := repo.GetUserKarma("u")
+	assert.Nil(t, err)
+	assert.Equal(t, Karma{Post: 2, PostCount: 1, CommentCount: 1}, karma)
+}
+
+func TestAddViewsMemory(t *testing.T) {
+	repo := NewMemoryRepo()
+	p := Post{Type: TEXT, Title: "t", Category: "c"}
+	InitPost(&p, user.User{ID: "1", Username: "u"})
+	p, _ = repo.Add(p)
+
+	// reading does not count by itself
+	got, _ := repo.GetByID(p.ID)
+	assert.Equal(t, 0, got.Views)
+
+	assert.Nil(t, repo.AddViews(map[string]int{p.ID: 2, "missing": 1}))
+	got, _ = repo.GetByID(p.ID)
+	assert.Equal(t, 2, got.Views)
+}
+
+func TestCommentsMemory(t *testing.T) {
+	repo := NewMemoryRepo()
+	u := user.User{ID: "1", Username: "u"}
+	blocked := user.User{ID: "2", Username: "blocked"}
+	p := Post{Type: TEXT, Title: "t", Category: "c"}
+	InitPost(&p, u)
+	p, _ = repo.Add(p)
+
+	first, err := repo.AddComment(p.ID, comment.Comment{Author: u, Body: "first"})
+	assert.Nil(t, err)
+	assert.Equal(t, p.ID, first.PostID)
+	_, err = repo.AddComment(p.ID, comment.Comment{Author: blocked, Body: "second", ParentID: first.ID})
+	assert.Nil(t, err)
+	_, err = repo.AddComment(p.ID, comment.Comment{Author: u, Body: "third"})
+	assert.Nil(t, err)
+	_, err = repo.AddComment(p.ID, comment.Comment{Author: u, ParentID: "missing"})
+	assert.Equal(t, comment.ErrNoComment, err)
+	_, err = repo.AddComment("missing", comment.Comment{Author: u})
+	assert.Equal(t, ErrNoPost, err)
+
+	got, _ := repo.GetByID(p.ID)
+	assert.Equal(t, 3, got.CommentCount)
+	assert.Empty(t, got.Comments)
+
+	comments, _ := repo.GetComments(p.ID, Filter{}, 1, 1)
+	if assert.Len(t, comments, 1) {
+		assert.Equal(t, "second", comments[0].Body)
+	}
+	comments, _ = repo.GetComments(p.ID, Filter{BlockedUsers: []string{blocked.ID}}, 1, 5)
+	if assert.Len(t, comments, 1) {
+		assert.Equal(t, "third", comments[0].Body)
+	}
+
+	assert.Nil(t, repo.DeleteComment(p.ID, first.ID))
+	assert.Equal(t, comment.ErrNoComment, repo.DeleteComment(p.ID, first.ID))
+	_, err = repo.GetComment(p.ID, first.ID)
+	assert.Equal(t, comment.ErrNoComment, err)
+	got, _ = repo.GetByID(p.ID)
+	assert.Equal(t, 2, got.CommentCount)
+
+	assert.Nil(t, repo.Delete(p.ID))
+	comments, _ = repo.GetCommentsByIDs([]string{first.ID})
+	assert.Empty(t, comments)
+}
+
+func TestSoftDeleteMemory(t *testing.T) {
+	repo := NewMemoryRepo()
+	u := user.User{ID: "1", Username: "u"}
+	other := user.User{ID: "2", Username: "other"}
+	p := Post{Type: TEXT, Title: "t", Category: "c"}
+	InitPost(&p, u)
+	p, _ = repo.Add(p)
+	parent, _ := repo.AddComment(p.ID, comment.Comment{Author: u, Body: "parent"})
+	reply, _ := repo.AddComment(p.ID, comment.Comment{Author: other, Body: "reply", ParentID: parent.ID})
+	lonely, _ := repo.AddComment(p.ID, comment.Comment{Author: u, Body: "lonely"})
+	window := time.Now().Add(-time.Hour)
+
+	// a deleted comment with replies stays as a placeholder
+	assert.Nil(t, repo.DeleteComment(p.ID, parent.ID))
+	assert.Nil(t, repo.DeleteComment(p.ID, lonely.ID))
+	comments, _ := repo.GetComments(p.ID, Filter{}, 0, 10)
+	if assert.Len(t, comments, 2) {
+		assert.Equal(t, comment.DeletedBody, comments[0].Body)
+		assert.Empty(t, comments[0].Author.Username)
+		assert.NotNil(t, comments[0].DeletedAt)
+		assert.Equal(t, reply.ID, comments[1].ID)
+	}
+	_, err := repo.AddComment(p.ID, comment.Comment{Author: u, Body: "late", ParentID: parent.ID})
+	assert.Equal(t, comment.ErrNoComment, err)
+
+	_, err = repo.RestoreComment(p.ID, lonely.ID, time.Now().Add(time.Hour))
+	assert.Equal(t, ErrNotRestorable, err)
+	_, err = repo.RestoreComment(p.ID, reply.ID, window)
+	assert.Equal(t, ErrNotRestorable, err)
+	restored, err := repo.RestoreComment(p.ID, lonely.ID, window)
+	assert.Nil(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	got, _ := repo.GetByID(p.ID)
+	assert.Equal(t, 2, got.CommentCount)
+
+	// deleted posts leave listings and come back with their comments
+	assert.Nil(t, repo.Delete(p.ID))
+	_, err = repo.GetByID(p.ID)
+	assert.Equal(t, ErrNoPost, err)
+	all, _ := repo.GetAll(Filter{})
+	assert.Empty(t, all)
+	_, err = repo.Restore("missing", window)
+	assert.Equal(t, ErrNoPost, err)
+	// deleted items still have authors to authorize restoring
+	authorID, err := repo.GetAuthorID(p.ID, "")
+	assert.Nil(t, err)
+	assert.Equal(t, u.ID, authorID)
+	authorID, _ = repo.GetAuthorID(p.ID, reply.ID)
+	assert.Equal(t, other.ID, authorID)
+	_, err = repo.GetAuthorID(p.ID, "missing")
+	assert.Equal(t, comment.ErrNoComment, err)
+	back, err := repo.Restore(p.ID, window)
+	assert.Nil(t, err)
+	assert.Nil(t, back.DeletedAt)
+	_, err = repo.Restore(p.ID, window)
+	assert.Equal(t, ErrNotRestorable, err)
+
+	// the placeholder goes with its last reply
+	assert.Nil(t, repo.DeleteComment(p.ID, reply.ID))
+	purged, err := repo.Purge(time.Now().Add(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+	purged, _ = repo.Purge(time.Now().Add(time.Second))
+	assert.Equal(t, 1, purged)
+	comments, _ = repo.GetComments(p.ID, Filter{}, 0, 10)
+	if assert.Len(t, comments, 1) {
+		assert.Equal(t, lonely.ID, comments[0].ID)
+	}
+}
+
+func TestGetAuthorIDMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPosts := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts:    mockPosts,
+		comments: mockComments,
+	}
+
+	// deleted posts are found too
+	mockPosts.EXPECT().FindOne(context.Background(), bson.M{"_id": "1"}).
+		Return(mongo.NewSingleResultFromDocument(Post{ID: "1", Author: user.User{ID: "a"}}, nil, nil))
+	authorID, err := repo.GetAuthorID("1", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", authorID)
+
+	mockPosts.EXPECT().FindOne(context.Background(), bson.M{"_id": "2"}).
+		Return(mongo.NewSingleResultFromDocument(Post{}, mongo.ErrNoDocuments, nil))
+	_, err = repo.GetAuthorID("2", "")
+	assert.Equal(t, ErrNoPost, err)
+
+	mockComments.EXPECT().FindOne(context.Background(), bson.M{"post_id": "1", "id": "c1"}).
+		Return(mongo.NewSingleResultFromDocument(comment.Comment{ID: "c1", Author: user.User{ID: "b"}}, nil, nil))
+	authorID, err = repo.GetAuthorID("1", "c1")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", authorID)
+
+	mockComments.EXPECT().FindOne(context.Background(), bson.M{"post_id": "1", "id": "c2"}).
+		Return(mongo.NewSingleResultFromDocument(comment.Comment{}, mongo.ErrNoDocuments, nil))
+	_, err = repo.GetAuthorID("1", "c2")
+	assert.Equal(t, comment.ErrNoComment, err)
+}
+
+func TestRestoreMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPosts := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts: mockPosts,
+	}
+	window := time.Now().Add(-time.Hour)
+	filter := bson.M{"_id": "1", "deleted_at": bson.M{"$gt": window}}
+	update := bson.M{"$unset": bson.M{"deleted_at": ""}}
+
+	mockPosts.EXPECT().FindOneAndUpdate(context.Background(), filter, update, gomock.Any()).
+		Return(mongo.NewSingleResultFromDocument(Post{ID: "1", Title: "back"}, nil, nil))
+	p, err := repo.Restore("1", window)
+	assert.Nil(t, err)
+	assert.Equal(t, "back", p.Title)
+
+	for _, tc := range []struct {
+		name   string
+		stored *mongo.SingleResult
+		err    error
+	}{
+		{"no post", mongo.NewSingleResultFromDocument(Post{}, mongo.ErrNoDocuments, nil), ErrNoPost},
+		{"expired", mongo.NewSingleResultFromDocument(Post{ID: "1", Author: user.User{ID: "a"}}, nil, nil), ErrNotRestorable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mockPosts.EXPECT().FindOneAndUpdate(context.Background(), filter, update, gomock.Any()).
+				Return(mongo.NewSingleResultFromDocument(Post{}, mongo.ErrNoDocuments, nil))
+			mockPosts.EXPECT().FindOne(context.Background(), bson.M{"_id": "1"}).Return(tc.stored)
+			_, err := repo.Restore("1", window)
+			assert.Equal(t, tc.err, err)
+		})
+	}
+
+	mockPosts.EXPECT().FindOneAndUpdate(context.Background(), filter, update, gomock.Any()).
+		Return(mongo.NewSingleResultFromDocument(Post{}, fmt.Errorf("some error"), nil))
+	_, err = repo.Restore("1", window)
+	assert.NotNil(t, err)
+}
+
+func TestRestoreCommentMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPosts := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts:    mockPosts,
+		comments: mockComments,
+	}
+	window := time.Now().Add(-time.Hour)
+	filter := bson.M{"post_id": "1", "id": "c1", "deleted_at": bson.M{"$gt": window}}
+	update := bson.M{"$unset": bson.M{"deleted_at": ""}}
+	livePost := func() {
+		mockPosts.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"_id": "1"})).
+			Return(mongo.NewSingleResultFromDocument(Post{ID: "1"}, nil, nil))
+	}
+
+	livePost()
+	mockComments.EXPECT().FindOneAndUpdate(context.Background(), filter, update, gomock.Any()).
+		Return(mongo.NewSingleResultFromDocument(comment.Comment{ID: "c1", PostID: "1", Body: "back"}, nil, nil))
+	mockPosts.EXPECT().UpdateOne(context.Background(), notDeleted(bson.M{"_id": "1"}), bson.M{"$inc": bson.M{"comment_count": 1}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+	comm, err := repo.RestoreComment("1", "c1", window)
+	assert.Nil(t, err)
+	assert.Equal(t, "back", comm.Body)
+
+	livePost()
+	mockComments.EXPECT().FindOneAndUpdate(context.Background(), filter, update, gomock.Any()).
+		Return(mongo.NewSingleResultFromDocument(comment.Comment{}, mongo.ErrNoDocuments, nil))
+	mockComments.EXPECT().FindOne(context.Background(), bson.M{"post_id": "1", "id": "c1"}).
+		Return(mongo.NewSingleResultFromDocument(comment.Comment{ID: "c1", Author: user.User{ID: "a"}}, nil, nil))
+	_, err = repo.RestoreComment("1", "c1", window)
+	assert.Equal(t, ErrNotRestorable, err)
+
+	livePost()
+	mockComments.EXPECT().FindOneAndUpdate(context.Background(), filter, update, gomock.Any()).
+		Return(mongo.NewSingleResultFromDocument(comment.Comment{}, mongo.ErrNoDocuments, nil))
+	mockComments.EXPECT().FindOne(context.Background(), bson.M{"post_id": "1", "id": "c1"}).
+		Return(mongo.NewSingleResultFromDocument(comment.Comment{}, mongo.ErrNoDocuments, nil))
+	_, err = repo.RestoreComment("1", "c1", window)
+	assert.Equal(t, comment.ErrNoComment, err)
+
+	// comments of deleted posts are not restored
+	mockPosts.EXPECT().FindOne(context.Background(), notDeleted(bson.M{"_id": "1"})).
+		Return(mongo.NewSingleResultFromDocument(Post{}, mongo.ErrNoDocuments, nil))
+	_, err = repo.RestoreComment("1", "c1", window)
+	assert.Equal(t, ErrNoPost, err)
+}
+
+func TestPurgeMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPosts := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
+	mockVotes := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts:    mockPosts,
+		comments: mockComments,
+		votes:    mockVotes,
+	}
+	before := time.Now().Add(-time.Hour)
+	postsFilter := bson.M{"deleted_at": bson.M{"$lt": before}}
+	commentsFilter := bson.M{
+		"deleted_at":  bson.M{"$lt": before},
+		"reply_count": bson.M{"$not": bson.M{"$gt": 0}},
+	}
+	inPosts := bson.M{"post_id": bson.M{"$in": []string{"1", "2"}}}
+
+	mockPosts.EXPECT().Find(context.Background(), postsFilter).
+		Return(mongo.NewCursorFromDocuments([]interface{}{Post{ID: "1"}, Post{ID: "2"}}, nil, nil))
+	mockComments.EXPECT().DeleteMany(context.Background(), inPosts).Return(int64(4), nil)
+	mockVotes.EXPECT().DeleteMany(context.Background(), inPosts).Return(int64(2), nil)
+	mockPosts.EXPECT().DeleteMany(context.Background(), bson.M{
+		"deleted_at": bson.M{"$lt": before},
+		"_id":        bson.M{"$in": []string{"1", "2"}},
+	}).Return(int64(2), nil)
+	mockComments.EXPECT().Find(context.Background(), commentsFilter).
+		Return(mongo.NewCursorFromDocuments([]interface{}{
+			comment.Comment{ID: "c1", PostID: "3"},
+			comment.Comment{ID: "c2", PostID: "3", ParentID: "c0"},
+		}, nil, nil))
+	mockComments.EXPECT().DeleteMany(context.Background(), bson.M{
+		"deleted_at":  bson.M{"$lt": before},
+		"reply_count": bson.M{"$not": bson.M{"$gt": 0}},
+		"id":          bson.M{"$in": []string{"c1", "c2"}},
+	}).Return(int64(2), nil)
+	mockComments.EXPECT().BulkWrite(context.Background(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+			if assert.Len(t, models, 1) {
+				model := models[0].(*mongo.UpdateOneModel)
+				assert.Equal(t, bson.M{"post_id": "3", "id": "c0"}, model.Filter)
+				assert.Equal(t, bson.M{"$inc": bson.M{"reply_count": -1}}, model.Update)
+			}
+			return &mongo.BulkWriteResult{ModifiedCount: 1}, nil
+		})
+	purged, err := repo.Purge(before)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, purged)
+
+	// nothing to purge
+	mockPosts.EXPECT().Find(context.Background(), postsFilter).
+		Return(mongo.NewCursorFromDocuments(nil, nil, nil))
+	mockComments.EXPECT().Find(context.Background(), commentsFilter).
+		Return(mongo.NewCursorFromDocuments(nil, nil, nil))
+	purged, err = repo.Purge(before)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, purged)
+
+	// posts stay when their comments could not go
+	mockPosts.EXPECT().Find(context.Background(), postsFilter).
+		Return(mongo.NewCursorFromDocuments([]interface{}{Post{ID: "1"}, Post{ID: "2"}}, nil, nil))
+	mockComments.EXPECT().DeleteMany(context.Background(), inPosts).Return(int64(0), fmt.Errorf("some error"))
+	_, err = repo.Purge(before)
+	assert.NotNil(t, err)
+}
+
+func TestEraseUserMemory(t *testing.T) {
+	u := user.User{ID: "1", Username: "u"}
+	other := user.User{ID: "2", Username: "other"}
+	setup := func() (*PostMemoryRepository, Post, Post) {
+		repo := NewMemoryRepo()
+		own := Post{Type: TEXT, Title: "own", Category: "c"}
+		InitPost(&own, u)
+		own, _ = repo.Add(own)
+		theirs := Post{Type: TEXT, Title: "theirs", Category: "c"}
+		InitPost(&theirs, other)
+		theirs, _ = repo.Add(theirs)
+		_, _ = repo.AddComment(theirs.ID, comment.Comment{Author: u, Body: "mine"})
+		_, _ = repo.AddComment(theirs.ID, comment.Comment{Author: other, Body: "theirs"})
+		_, _ = repo.Upvote(theirs.ID, u.ID)
+		return repo, own, theirs
+	}
+
+	repo, own, theirs := setup()
+	data, err := repo.ExportUserData(u.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, data.Posts, 1) {
+		assert.Equal(t, own.ID, data.Posts[0].ID)
+	}
+	if assert.Len(t, data.Comments, 1) {
+		assert.Equal(t, "mine", data.Comments[0].Body)
+	}
+	assert.ElementsMatch(t, []vote.Vote{
+		{PostID: own.ID, UserID: u.ID, Value: 1},
+		{PostID: theirs.ID, UserID: u.ID, Value: 1},
+	}, data.Votes)
+
+	poll := newPollPost(nil)
+	poll, _ = repo.Add(poll)
+	_, _ = repo.VotePoll(poll.ID, u.ID, 2)
+	_, _ = repo.VotePoll(poll.ID, other.ID, 2)
+	img := Post{Type: IMAGE, Title: "img", Category: "c", Image: &upload.Image{Key: "a.png"}}
+	InitPost(&img, u)
+	img, _ = repo.Add(img)
+	images, _ := repo.UserImages(u.ID)
+	assert.Equal(t, []upload.Image{{Key: "a.png"}}, images)
+	// a file posted by someone else too stays for them
+	copied := Post{Type: IMAGE, Title: "copy", Category: "c", Image: &upload.Image{Key: "a.png"}}
+	InitPost(&copied, other)
+	_, _ = repo.Add(copied)
+	images, _ = repo.UserImages(u.ID)
+	assert.Empty(t, images)
+
+	data, _ = repo.ExportUserData(u.ID)
+	assert.Equal(t, []PollVote{{PostID: poll.ID, UserID: u.ID, Option: 2}}, data.PollVotes)
+
+	// anonymized content stays in place, scores keep the dropped votes
+	assert.Nil(t, repo.EraseUser(u.ID, EraseAnonymize))
+	got, _ := repo.GetByID(own.ID)
+	assert.Equal(t, ErasedAuthor, got.Author)
+	got, _ = repo.GetByID(theirs.ID)
+	assert.Equal(t, 2, got.Score)
+	assert.Equal(t, 2, got.CommentCount)
+	comments, _ := repo.GetComments(theirs.ID, Filter{}, 0, 10)
+	if assert.Len(t, comments, 2) {
+		assert.Equal(t, ErasedAuthor, comments[0].Author)
+		assert.Equal(t, "mine", comments[0].Body)
+	}
+	votes, _ := repo.GetVotes(u.ID, []string{own.ID, theirs.ID})
+	assert.Empty(t, votes)
+	got, _ = repo.GetByID(poll.ID)
+	assert.Equal(t, 1, got.Poll.Options[2].Votes)
+	assert.Equal(t, 1, got.Poll.TotalVotes)
+	got, _ = repo.GetByID(img.ID)
+	assert.Nil(t, got.Image)
+	data, _ = repo.ExportUserData(u.ID)
+	assert.Empty(t, data.Posts)
+	assert.Empty(t, data.PollVotes)
+
+	// deleted content leaves listings and waits for the purge
+	repo, own, theirs = setup()
+	assert.Nil(t, repo.EraseUser(u.ID, EraseDelete))
+	_, err = repo.GetByID(own.ID)
+	assert.Equal(t, ErrNoPost, err)
+	got, _ = repo.GetByID(theirs.ID)
+	assert.Equal(t, 1, got.CommentCount)
+	comments, _ = repo.GetComments(theirs.ID, Filter{}, 0, 10)
+	if assert.Len(t, comments, 1) {
+		assert.Equal(t, "theirs", comments[0].Body)
+	}
+	purged, _ := repo.Purge(time.Now().Add(time.Second))
+	assert.Equal(t, 2, purged)
+}
+
+func TestEraseUserMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPosts := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
+	mockVotes := NewMockCollectionHelper(ctrl)
+	mockPollVotes := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts:     mockPosts,
+		comments:  mockComments,
+		votes:     mockVotes,
+		pollVotes: mockPollVotes,
+	}
+	byAuthor := bson.M{"author.id": "u"}
+	anonymize := bson.M{"$set": bson.M{"author": ErasedAuthor}}
+	anonymizePosts := bson.M{"$set": bson.M{"author": ErasedAuthor}, "$unset": bson.M{"image": ""}}
+	expectAnonymize := func() {
+		mockVotes.EXPECT().DeleteMany(context.Background(), bson.M{"user": "u"}).Return(int64(3), nil)
+		mockPollVotes.EXPECT().Find(context.Background(), bson.M{"user_id": "u"}).
+			Return(mongo.NewCursorFromDocuments(nil, nil, nil))
+		mockComments.EXPECT().UpdateMany(context.Background(), byAuthor, anonymize).Return(&mongo.UpdateResult{}, nil)
+		mockPosts.EXPECT().UpdateMany(context.Background(), byAuthor, anonymizePosts).Return(&mongo.UpdateResult{}, nil)
+	}
+
+	expectAnonymize()
+	assert.Nil(t, repo.EraseUser("u", EraseAnonymize))
+
+	// poll votes are pulled and counted down on their polls
+	mockVotes.EXPECT().DeleteMany(context.Background(), bson.M{"user": "u"}).Return(int64(0), nil)
+	mockPollVotes.EXPECT().Find(context.Background(), bson.M{"user_id": "u"}).
+		Return(mongo.NewCursorFromDocuments([]interface{}{
+			PollVote{PostID: "1", UserID: "u", Option: 2},
+			PollVote{PostID: "2", UserID: "u", Option: 0},
+		}, nil, nil))
+	mockPollVotes.EXPECT().DeleteMany(context.Background(), bson.M{"user_id": "u"}).Return(int64(2), nil)
+	mockPosts.EXPECT().BulkWrite(context.Background(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+			if assert.Len(t, models, 2) {
+				model := models[0].(*mongo.UpdateOneModel)
+				assert.Equal(t, bson.M{"_id": "1"}, model.Filter)
+				assert.Equal(t, bson.M{"$inc": bson.M{"poll.options.2.votes": -1, "poll.total_votes": -1}}, model.Update)
+			}
+			return &mongo.BulkWriteResult{}, nil
+		})
+	mockComments.EXPECT().UpdateMany(context.Background(), byAuthor, anonymize).Return(&mongo.UpdateResult{}, nil)
+	mockPosts.EXPECT().UpdateMany(context.Background(), byAuthor, anonymizePosts).Return(&mongo.UpdateResult{}, nil)
+	assert.Nil(t, repo.EraseUser("u", EraseAnonymize))
+
+	mockComments.EXPECT().Find(context.Background(), notDeleted(bson.M{"author.id": "u"})).
+		Return(mongo.NewCursorFromDocuments([]interface{}{
+			comment.Comment{ID: "c1", PostID: "1"},
+			comment.Comment{ID: "c2", PostID: "2"},
+			comment.Comment{ID: "c3", PostID: "1"},
+		}, nil, nil))
+	commentsFilter := notDeleted(bson.M{"author.id": "u", "id": bson.M{"$in": []string{"c1", "c2", "c3"}}})
+	mockComments.EXPECT().UpdateMany(context.Background(), commentsFilter, gomock.Any()).Return(&mongo.UpdateResult{}, nil)
+	mockPosts.EXPECT().BulkWrite(context.Background(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+			if assert.Len(t, models, 2) {
+				model := models[0].(*mongo.UpdateOneModel)
+				assert.Equal(t, notDeleted(bson.M{"_id": "1"}), model.Filter)
+				assert.Equal(t, bson.M{"$inc": bson.M{"comment_count": -2}}, model.Update)
+			}
+			return &mongo.BulkWriteResult{}, nil
+		})
+	mockPosts.EXPECT().UpdateMany(context.Background(), notDeleted(bson.M{"author.id": "u"}), gomock.Any()).
+		Return(&mongo.UpdateResult{}, nil)
+	expectAnonymize()
+	assert.Nil(t, repo.EraseUser("u", EraseDelete))
+
+	mockVotes.EXPECT().DeleteMany(context.Background(), bson.M{"user": "u"}).Return(int64(0), fmt.Errorf("some error"))
+	assert.NotNil(t, repo.EraseUser("u", EraseAnonymize))
+
+	mockVotes.EXPECT().DeleteMany(context.Background(), bson.M{"user": "u"}).Return(int64(0), nil)
+	mockPollVotes.EXPECT().Find(context.Background(), bson.M{"user_id": "u"}).Return(nil, fmt.Errorf("some error"))
+	assert.NotNil(t, repo.EraseUser("u", EraseAnonymize))
+}
+
+func TestUserImagesMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPosts := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{posts: mockPosts}
+	own := upload.Image{Key: "a.png", ThumbnailKey: "a_thumb.jpg"}
+	shared := upload.Image{Key: "b.png", ThumbnailKey: "b_thumb.jpg"}
+
+	mockPosts.EXPECT().Find(context.Background(), bson.M{"author.id": "u", "image": bson.M{"$exists": true}}).
+		Return(mongo.NewCursorFromDocuments([]interface{}{
+			Post{ID: "1", Image: &own},
+			Post{ID: "2", Image: &shared},
+		}, nil, nil))
+	othersFilter := bson.M{"author.id": bson.M{"$ne": "u"}, "image.key": bson.M{"$in": []string{"a.png", "b.png"}}}
+	mockPosts.EXPECT().Find(context.Background(), othersFilter).
+		Return(mongo.NewCursorFromDocuments([]interface{}{Post{ID: "3", Image: &shared}}, nil, nil))
+	images, err := repo.UserImages("u")
+	assert.Nil(t, err)
+	assert.Equal(t, []upload.Image{own}, images)
+
+	mockPosts.EXPECT().Find(context.Background(), gomock.Any()).
+		Return(mongo.NewCursorFromDocuments(nil, nil, nil))
+	images, err = repo.UserImages("u")
+	assert.Nil(t, err)
+	assert.Empty(t, images)
+
+	mockPosts.EXPECT().Find(context.Background(), gomock.Any()).Return(nil, fmt.Errorf("some error"))
+	_, err = repo.UserImages("u")
+	assert.NotNil(t, err)
+}
+
+func TestExportUserDataMongo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPosts := NewMockCollectionHelper(ctrl)
+	mockComments := NewMockCollectionHelper(ctrl)
+	mockVotes := NewMockCollectionHelper(ctrl)
+	mockPollVotes := NewMockCollectionHelper(ctrl)
+	repo := &PostMongoDBRepository{
+		posts:     mockPosts,
+		comments:  mockComments,
+		votes:     mockVotes,
+		pollVotes: mockPollVotes,
+	}
+	deletedAt := time.Now().UTC().Truncate(time.Millisecond)
+	mockPosts.EXPECT().Find(context.Background(), bson.M{"author.id": "u"}).
+		Return(mongo.NewCursorFromDocuments([]interface{}{Post{ID: "1", DeletedAt: &deletedAt}}, nil, nil))
+	mockComments.EXPECT().Find(context.Background(), bson.M{"author.id": "u"}).
+		Return(mongo.NewCursorFromDocuments([]interface{}{comment.Comment{ID: "c1", PostID: "2"}}, nil, nil))
+	mockVotes.EXPECT().Find(context.Background(), bson.M{"user": "u"}).
+		Return(mongo.NewCursorFromDocuments([]interface{}{vote.Vote{PostID: "2", UserID: "u", Value: -1}}, nil, nil))
+	mockPollVotes.EXPECT().Find(context.Background(), bson.M{"user_id": "u"}).
+		Return(mongo.NewCursorFromDocuments([]interface{}{PollVote{PostID: "3", UserID: "u", Option: 1}}, nil, nil))
+	data, err := repo.ExportUserData("u")
+	assert.Nil(t, err)
+	if assert.Len(t, data.Posts, 1) {
+		assert.Equal(t, deletedAt, *data.Posts[0].DeletedAt)
+	}
+	assert.Equal(t, []comment.Comment{{ID: "c1", PostID: "2"}}, data.Comments)
+	assert.Equal(t, []vote.Vote{{PostID: "2", UserID: "u", Value: -1}}, data.Votes)
+	assert.Equal(t, []PollVote{{PostID: "3", UserID: "u", Option: 1}}, data.PollVotes)
+
+	mockPosts.EXPECT().Find(context.Background(), bson.M{"author.id": "u"}).Return(nil, fmt.Errorf("some error"))
+	_, err = repo.ExportUserData("u")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,83 @@
+package purge
+
+import (
+	"context"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/periodic"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultRetention = 30 * 24 * time.Hour
+	DefaultInterval  = time.Hour
+)
+
+// Store permanently removes what was deleted before the given time,
+// post.PostRepo implements it.
+type Store interface {
+	Purge(deletedBefore time.Time) (int, error)
+}
+
+type Config struct {
+	// Retention is how long deleted posts and comments can be restored
+	// before they are removed for good.
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultRetention
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+}
+
+// Purger periodically removes deleted items whose retention has passed.
+type Purger struct {
+	cfg    Config
+	store  Store
+	Logger *zap.SugaredLogger
+	now    func() time.Time
+	loop   *periodic.Loop
+}
+
+func NewPurger(store Store, logger *zap.SugaredLogger, cfg Config) *Purger {
+	cfg.setDefaults()
+	p := &Purger{
+		cfg:    cfg,
+		store:  store,
+		Logger: logger,
+		now:    time.Now,
+	}
+	p.loop = periodic.NewLoop(p.run, periodic.Config{Interval: cfg.Interval, RunFirst: true})
+	return p
+}
+
+// Run purges once and returns the number of removed items.
+func (p *Purger) Run() (int, error) {
+	return p.store.Purge(p.now().Add(-p.cfg.Retention))
+}
+
+// Start purges right away and then periodically until ctx is done.
+func (p *Purger) Start(ctx context.Context) {
+	p.loop.Start(ctx)
+}
+
+// Wait blocks until the loop started by Start has stopped.
+func (p *Purger) Wait() {
+	p.loop.Wait()
+}
+
+func (p *Purger) run() {
+	purged, err := p.Run()
+	if err != nil {
+		p.Logger.Errorf("fail to purge deleted items: %v", err)
+		return
+	}
+	if purged > 0 {
+		p.Logger.Infof("purged %v deleted items", purged)
+	}
+}
@@ -0,0 +1,69 @@
+package purge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	before []time.Time
+	err    error
+}
+
+func (s *memoryStore) Purge(deletedBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.before = append(s.before, deletedBefore)
+	if s.err != nil {
+		return 0, s.err
+	}
+	return 2, nil
+}
+
+func (s *memoryStore) calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.before)
+}
+
+func TestRun(t *testing.T) {
+	store := &memoryStore{}
+	p := NewPurger(store, zap.NewNop().Sugar(), Config{Retention: time.Hour})
+	now := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	purged, err := p.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, purged)
+	assert.Equal(t, []time.Time{now.Add(-time.Hour)}, store.before)
+
+	store.err = fmt.Errorf("db error")
+	_, err = p.Run()
+	assert.NotNil(t, err)
+}
+
+func TestDefaults(t *testing.T) {
+	p := NewPurger(&memoryStore{}, zap.NewNop().Sugar(), Config{})
+	assert.Equal(t, DefaultRetention, p.cfg.Retention)
+	assert.Equal(t, DefaultInterval, p.cfg.Interval)
+}
+
+func TestStartStops(t *testing.T) {
+	store := &memoryStore{}
+	p := NewPurger(store, zap.NewNop().Sugar(), Config{Interval: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	p.Start(ctx)
+	assert.Eventually(t, func() bool { return store.calls() >= 2 }, time.Second, time.Millisecond)
+	cancel()
+	p.Wait()
+	calls := store.calls()
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, calls, store.calls())
+}
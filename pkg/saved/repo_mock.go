@@ -0,0 +1,92 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: saved.go
+
+// Package saved is a generated GoMock package.
+package saved
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockSavedRepo is a mock of SavedRepo interface.
+type MockSavedRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockSavedRepoMockRecorder
+}
+
+// MockSavedRepoMockRecorder is the mock recorder for MockSavedRepo.
+type MockSavedRepoMockRecorder struct {
+	mock *MockSavedRepo
+}
+
+// NewMockSavedRepo creates a new mock instance.
+func NewMockSavedRepo(ctrl *gomock.Controller) *MockSavedRepo {
+	mock := &MockSavedRepo{ctrl: ctrl}
+	mock.recorder = &MockSavedRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSavedRepo) EXPECT() *MockSavedRepoMockRecorder {
+	return m.recorder
+}
+
+// List mocks base method.
+func (m *MockSavedRepo) List(userID string, offset, limit int) ([]Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", userID, offset, limit)
+	ret0, _ := ret[0].([]Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockSavedRepoMockRecorder) List(userID, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockSavedRepo)(nil).List), userID, offset, limit)
+}
+
+// Save mocks base method.
+func (m *MockSavedRepo) Save(userID, postID, commentID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", userID, postID, commentID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockSavedRepoMockRecorder) Save(userID, postID, commentID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockSavedRepo)(nil).Save), userID, postID, commentID)
+}
+
+// SavedIn mocks base method.
+func (m *MockSavedRepo) SavedIn(userID string, postIDs []string) (Set, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavedIn", userID, postIDs)
+	ret0, _ := ret[0].(Set)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SavedIn indicates an expected call of SavedIn.
+func (mr *MockSavedRepoMockRecorder) SavedIn(userID, postIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavedIn", reflect.TypeOf((*MockSavedRepo)(nil).SavedIn), userID, postIDs)
+}
+
+// Unsave mocks base method.
+func (m *MockSavedRepo) Unsave(userID, postID, commentID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unsave", userID, postID, commentID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unsave indicates an expected call of Unsave.
+func (mr *MockSavedRepoMockRecorder) Unsave(userID, postID, commentID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unsave", reflect.TypeOf((*MockSavedRepo)(nil).Unsave), userID, postID, commentID)
+}
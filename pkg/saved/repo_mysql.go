@@ -0,0 +1,114 @@
+package saved
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const mysqlDatetimeFormat = "2006-01-02 15:04:05"
+
+type SavedMysqlRepository struct {
+	DB     *sql.DB
+	Logger *zap.SugaredLogger
+}
+
+func NewMysqlRepo(db *sql.DB, logger *zap.SugaredLogger) *SavedMysqlRepository {
+	return &SavedMysqlRepository{
+		DB:     db,
+		Logger: logger,
+	}
+}
+
+func (repo *SavedMysqlRepository) Save(userID, postID, commentID string) error {
+	_, err := repo.DB.Exec(
+		"INSERT IGNORE INTO saved (`user_id`, `post_id`, `comment_id`, `saved_at`) VALUES (?, ?, ?, ?)",
+		userID,
+		postID,
+		commentID,
+		time.Now().UTC().Format(mysqlDatetimeFormat),
+	)
+	if err != nil {
+		repo.Logger.Error("in Save: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *SavedMysqlRepository) Unsave(userID, postID, commentID string) error {
+	_, err := repo.DB.Exec(
+		"DELETE FROM saved WHERE user_id = ? AND post_id = ? AND comment_id = ?",
+		userID,
+		postID,
+		commentID,
+	)
+	if err != nil {
+		repo.Logger.Error("in Unsave: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *SavedMysqlRepository) List(userID string, offset, limit int) ([]Item, error) {
+	rows, err := repo.DB.Query(
+		"SELECT post_id, comment_id, saved_at FROM saved WHERE user_id = ? "+
+			"ORDER BY saved_at DESC, post_id, comment_id LIMIT ? OFFSET ?",
+		userID,
+		limit,
+		offset,
+	)
+	if err != nil {
+		repo.Logger.Error("in List saved: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]Item, 0)
+	for rows.Next() {
+		item, savedAt := Item{}, ""
+		err = rows.Scan(&item.PostID, &item.CommentID, &savedAt)
+		if err != nil {
+			return nil, fmt.Errorf("fail to scan saved item: %w", err)
+		}
+		item.SavedAt, err = time.Parse(mysqlDatetimeFormat, savedAt)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse saved_at: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (repo *SavedMysqlRepository) SavedIn(userID string, postIDs []string) (Set, error) {
+	set := make(Set)
+	if len(postIDs) == 0 {
+		return set, nil
+	}
+	args := make([]any, 0, len(postIDs)+1)
+	args = append(args, userID)
+	for _, id := range postIDs {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(postIDs)), ", ")
+	rows, err := repo.DB.Query(
+		"SELECT post_id, comment_id FROM saved WHERE user_id = ? AND post_id IN ("+placeholders+")",
+		args...,
+	)
+	if err != nil {
+		repo.Logger.Error("in SavedIn: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key := Key{}
+		if err = rows.Scan(&key.PostID, &key.CommentID); err != nil {
+			return nil, fmt.Errorf("fail to scan saved key: %w", err)
+		}
+		set[key] = true
+	}
+	return set, rows.Err()
+}
@@ -0,0 +1,108 @@
+package saved
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestSaveUnsave(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	mock.ExpectExec(`INSERT IGNORE INTO saved`).
+		WithArgs("u", "p", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.Save("u", "p", ""); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+
+	mock.ExpectExec(`DELETE FROM saved WHERE user_id = \? AND post_id = \? AND comment_id = \?`).
+		WithArgs("u", "p", "c").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.Unsave("u", "p", "c"); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+
+	mock.ExpectExec(`INSERT IGNORE INTO saved`).WillReturnError(fmt.Errorf("db error"))
+	if err := repo.Save("u", "p", ""); err == nil {
+		t.Errorf("expected error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	rows := sqlmock.NewRows([]string{"post_id", "comment_id", "saved_at"}).
+		AddRow("p2", "c1", "2023-01-02 00:00:00").
+		AddRow("p1", "", "2023-01-01 00:00:00")
+	mock.ExpectQuery(`SELECT post_id, comment_id, saved_at FROM saved WHERE user_id = \? ORDER BY .* LIMIT \? OFFSET \?`).
+		WithArgs("u", 10, 20).
+		WillReturnRows(rows)
+
+	items, err := repo.List("u", 20, 10)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	expect := []Item{
+		{PostID: "p2", CommentID: "c1", SavedAt: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{PostID: "p1", SavedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(items, expect) {
+		t.Errorf("results not match, want %v, have %v", expect, items)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSavedIn(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
+
+	set, err := repo.SavedIn("u", nil)
+	if err != nil || len(set) != 0 {
+		t.Errorf("expected empty set without a query, got %v, %v", set, err)
+	}
+
+	rows := sqlmock.NewRows([]string{"post_id", "comment_id"}).
+		AddRow("p1", "").
+		AddRow("p2", "c1")
+	mock.ExpectQuery(`SELECT post_id, comment_id FROM saved WHERE user_id = \? AND post_id IN \(\?, \?, \?\)`).
+		WithArgs("u", "p1", "p2", "p3").
+		WillReturnRows(rows)
+
+	set, err = repo.SavedIn("u", []string{"p1", "p2", "p3"})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if !set.Post("p1") || set.Post("p2") || !set.Comment("p2", "c1") || set.Post("p3") {
+		t.Errorf("unexpected set %v", set)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
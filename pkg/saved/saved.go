@@ -0,0 +1,38 @@
+package saved
+
+import (
+	"time"
+)
+
+// Item is a saved post, or a saved comment when CommentID is set.
+type Item struct {
+	PostID    string
+	CommentID string
+	SavedAt   time.Time
+}
+
+type Key struct {
+	PostID    string
+	CommentID string
+}
+
+// Set tells which posts and comments a user saved.
+type Set map[Key]bool
+
+func (s Set) Post(postID string) bool {
+	return s[Key{PostID: postID}]
+}
+
+func (s Set) Comment(postID, commentID string) bool {
+	return s[Key{PostID: postID, CommentID: commentID}]
+}
+
+//go:generate mockgen -source=saved.go -destination=repo_mock.go -package=saved SavedRepo
+type SavedRepo interface {
+	// Save and Unsave are idempotent, commentID is empty for posts.
+	Save(userID, postID, commentID string) error
+	Unsave(userID, postID, commentID string) error
+	List(userID string, offset, limit int) ([]Item, error)
+	// SavedIn returns what the user saved among the given posts and their comments.
+	SavedIn(userID string, postIDs []string) (Set, error)
+}
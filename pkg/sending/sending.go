@@ -35,3 +35,28 @@ func JSONMarshalAndSend(w http.ResponseWriter, obj any) {
 		return
 	}
 }
+
+type FieldError struct {
+	Location string `json:"location"`
+	Param    string `json:"param"`
+	Value    any    `json:"value,omitempty"`
+	Msg      string `json:"msg"`
+}
+
+type FieldErrors struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func SendFieldErrors(w http.ResponseWriter, errs []FieldError) {
+	ser, err := json.Marshal(FieldErrors{errs})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_, err = w.Write(ser)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -21,6 +21,36 @@ var (
 type Session struct {
 	Token string
 	User  user.User
+	// APIToken marks sessions of API tokens, only they are limited to
+	// their Scopes.
+	APIToken bool
+	Scopes   []string
+}
+
+// Allows reports whether the session may use routes needing the scopes.
+func (s Session) Allows(scopes ...string) bool {
+	if !s.APIToken {
+		return true
+	}
+	// API tokens only reach routes that name their scopes
+	if len(scopes) == 0 {
+		return false
+	}
+	for _, scope := range scopes {
+		if !contains(s.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
 }
 
 func NewSession(token string, user user.User) Session {
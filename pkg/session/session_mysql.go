@@ -16,9 +16,10 @@ import (
 const MysqlDatetimeFormat = "2006-01-02 15:04:05"
 
 type Sessions struct {
-	Token      string
-	UserID     string
-	Expiration time.Time
+	// the token is a credential and never leaves the server
+	Token      string    `json:"-"`
+	UserID     string    `json:"user_id"`
+	Expiration time.Time `json:"expiration"`
 }
 
 type SessionsManagerMySQL struct {
@@ -112,3 +113,42 @@ func (sm *SessionsManagerMySQL) Get(tokenString string) (Session, error) {
 
 	return NewSession(session.Token, user), nil
 }
+
+// List returns the sessions of the user that have not expired yet.
+func (sm *SessionsManagerMySQL) List(userID string) ([]Sessions, error) {
+	rows, err := sm.DB.Query(
+		"SELECT token, user_id, expiration FROM sessions WHERE user_id = ? AND expiration > ?",
+		userID,
+		time.Now().Format(MysqlDatetimeFormat),
+	)
+	if err != nil {
+		sm.Logger.Error("in List sessions: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := make([]Sessions, 0)
+	for rows.Next() {
+		session, timeVal := Sessions{}, ""
+		if err = rows.Scan(&session.Token, &session.UserID, &timeVal); err != nil {
+			sm.Logger.Error("in List sessions, scan: ", err)
+			return nil, err
+		}
+		session.Expiration, err = time.Parse(MysqlDatetimeFormat, timeVal)
+		if err != nil {
+			sm.Logger.Error("in List sessions, parse timeVal: ", err)
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// Revoke ends every session of the user but the one with the except token.
+func (sm *SessionsManagerMySQL) Revoke(userID string, except string) error {
+	_, err := sm.DB.Exec("DELETE FROM sessions WHERE user_id = ? AND token != ?", userID, except)
+	if err != nil {
+		sm.Logger.Error("in Revoke sessions: ", err)
+		return err
+	}
+	return nil
+}
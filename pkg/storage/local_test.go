@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(filepath.Join(t.TempDir(), "uploads"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	err = store.Put(ctx, "abc.png", strings.NewReader("data"), "image/png")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	rc, info, err := store.Get(ctx, "abc.png")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "data", string(data))
+	assert.Equal(t, "image/png", info.ContentType)
+	assert.Equal(t, int64(4), info.Size)
+	_, seekable := rc.(io.ReadSeeker)
+	assert.True(t, seekable)
+
+	err = store.Delete(ctx, "abc.png")
+	assert.Nil(t, err)
+	_, _, err = store.Get(ctx, "abc.png")
+	assert.True(t, errors.Is(err, ErrNoBlob))
+	assert.True(t, errors.Is(store.Delete(ctx, "abc.png"), ErrNoBlob))
+
+	// temp files are cleaned up
+	entries, _ := os.ReadDir(store.dir)
+	assert.Empty(t, entries)
+}
+
+func TestLocalStoreRejectsBadKeys(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(dir, "uploads"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	for _, key := range []string{"", "../secret", "a/b.png", ".hidden", "a..png", "x.PNG/"} {
+		err = store.Put(ctx, key, strings.NewReader("data"), "")
+		assert.True(t, errors.Is(err, ErrInvalidKey), "key %q", key)
+		_, _, err = store.Get(ctx, key)
+		assert.True(t, errors.Is(err, ErrInvalidKey), "key %q", key)
+	}
+	_, err = os.Stat(filepath.Join(dir, "secret"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrNoBlob     = errors.New("no blob found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// keyRe keeps keys flat and safe to use as file names or object names.
+var keyRe = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,128}(\.[a-z0-9]{1,8})?$`)
+
+func ValidKey(key string) bool {
+	return keyRe.MatchString(key)
+}
+
+type BlobInfo struct {
+	Key         string
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// BlobStore keeps uploaded files. Get returns an io.ReadSeekCloser when
+// the backend supports seeking, so range requests can be served.
+//
+//go:generate mockgen -source=storage.go -destination=storage_mock.go -package=storage BlobStore
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error)
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,347 @@
+package twofactor
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/user"
+	"go.uber.org/zap"
+)
+
+const mysqlDatetimeFormat = "2006-01-02 15:04:05"
+
+type MysqlRepo struct {
+	DB     *sql.DB
+	Logger *zap.SugaredLogger
+	// Issuer names the site in authenticator apps.
+	Issuer string
+	now    func() time.Time
+}
+
+func NewMysqlRepo(db *sql.DB, logger *zap.SugaredLogger, issuer string) *MysqlRepo {
+	return &MysqlRepo{
+		DB:     db,
+		Logger: logger,
+		Issuer: issuer,
+		now:    time.Now,
+	}
+}
+
+func (repo *MysqlRepo) Enabled(userID string) (bool, error) {
+	enabled := 0
+	err := repo.DB.
+		QueryRow("SELECT COUNT(*) FROM two_factor WHERE user_id = ? AND enabled = TRUE", userID).
+		Scan(&enabled)
+	if err != nil {
+		repo.Logger.Error("in Enabled: ", err)
+		return false, err
+	}
+	return enabled != 0, nil
+}
+
+func (repo *MysqlRepo) Enroll(u user.User) (Enrollment, error) {
+	enabled, err := repo.Enabled(u.ID)
+	if err != nil {
+		return Enrollment{}, err
+	}
+	if enabled {
+		return Enrollment{}, ErrAlreadyEnabled
+	}
+	secret, err := NewSecret()
+	if err != nil {
+		return Enrollment{}, err
+	}
+	// the enabled check makes sure only an unconfirmed secret is replaced
+	_, err = repo.DB.Exec(
+		"INSERT INTO two_factor (`user_id`, `secret`, `enabled`, `last_step`) VALUES (?, ?, FALSE, 0) "+
+			"ON DUPLICATE KEY UPDATE `secret` = IF(`enabled`, `secret`, VALUES(`secret`))",
+		u.ID,
+		secret,
+	)
+	if err != nil {
+		repo.Logger.Error("in Enroll: ", err)
+		return Enrollment{}, err
+	}
+	return Enrollment{
+		Secret: secret,
+		URI:    URI(repo.Issuer, u.Username, secret),
+	}, nil
+}
+
+func (repo *MysqlRepo) Confirm(userID, code string) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = repo.inTx("Confirm", func(tx *sql.Tx) error {
+		secret, enabled, lastStep, err := repo.lockSecret(tx, userID)
+		switch {
+		case err != nil:
+			return err
+		case enabled:
+			return ErrAlreadyEnabled
+		}
+		step, ok := Match(secret, normalize(code), repo.now())
+		if !ok || step <= lastStep {
+			return ErrBadCode
+		}
+		_, err = tx.Exec("UPDATE two_factor SET enabled = TRUE, last_step = ? WHERE user_id = ?", step, userID)
+		if err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+		_, err = tx.Exec("DELETE FROM two_factor_recovery WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("delete recovery codes: %w", err)
+		}
+		placeholders := make([]string, len(hashes))
+		args := make([]interface{}, 0, 2*len(hashes))
+		for i, hash := range hashes {
+			placeholders[i] = "(?, ?)"
+			args = append(args, hash, userID)
+		}
+		_, err = tx.Exec(
+			"INSERT INTO two_factor_recovery (`code_hash`, `user_id`) VALUES "+strings.Join(placeholders, ", "),
+			args...,
+		)
+		if err != nil {
+			return fmt.Errorf("insert recovery codes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (repo *MysqlRepo) Disable(userID, code string) error {
+	return repo.inTx("Disable", func(tx *sql.Tx) error {
+		if err := repo.verify(tx, userID, code); err != nil {
+			return err
+		}
+		_, err := tx.Exec("DELETE FROM two_factor WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("delete: %w", err)
+		}
+		_, err = tx.Exec("DELETE FROM two_factor_recovery WHERE user_id = ?", userID)
+		if err != nil {
+			return fmt.Errorf("delete recovery codes: %w", err)
+		}
+		return nil
+	})
+}
+
+func (repo *MysqlRepo) CreateChallenge(userID string) (string, error) {
+	token, hash, err := user.NewToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = repo.DB.Exec(
+		"INSERT INTO login_challenges (`token_hash`, `user_id`, `expires_at`, `attempts`) VALUES (?, ?, ?, 0)",
+		hash,
+		userID,
+		repo.now().Add(ChallengeTTL).Format(mysqlDatetimeFormat),
+	)
+	if err != nil {
+		repo.Logger.Error("in CreateChallenge: ", err)
+		return "", err
+	}
+	return token, nil
+}
+
+func (repo *MysqlRepo) CompleteChallenge(token, code string) (string, error) {
+	hash, userID := user.HashToken(token), ""
+	// a wrong code is counted, so the transaction commits on ErrBadCode
+	codeErr := error(nil)
+	err := repo.inTx("CompleteChallenge", func(tx *sql.Tx) error {
+		attempts := 0
+		err := tx.
+			QueryRow(
+				"SELECT user_id, attempts FROM login_challenges WHERE token_hash = ? AND expires_at > ? FOR UPDATE",
+				hash,
+				repo.now().Format(mysqlDatetimeFormat),
+			).
+			Scan(&userID, &attempts)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrBadChallenge
+		case err != nil:
+			return err
+		}
+		failures, err := repo.lockFailures(tx, userID)
+		if err != nil {
+			return err
+		}
+		codeErr = repo.verify(tx, userID, code)
+		switch {
+		case errors.Is(codeErr, ErrBadCode) && attempts+1 < MaxAttempts:
+			_, err = tx.Exec("UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = ?", hash)
+		case errors.Is(codeErr, ErrBadCode) || codeErr == nil:
+			_, err = tx.Exec("DELETE FROM login_challenges WHERE token_hash = ?", hash)
+		default:
+			return codeErr
+		}
+		if err != nil {
+			return fmt.Errorf("update challenge: %w", err)
+		}
+		return repo.countFailure(tx, userID, failures, codeErr == nil)
+	})
+	switch {
+	case err != nil:
+		return "", err
+	case codeErr != nil:
+		return "", codeErr
+	}
+	return userID, nil
+}
+
+// lockFailures returns the wrong codes of a user since the last accepted
+// one, or ErrLocked while the user is locked out.
+func (repo *MysqlRepo) lockFailures(tx *sql.Tx, userID string) (int, error) {
+	failures, locked := 0, false
+	err := tx.
+		QueryRow(
+			"SELECT failures, locked_until IS NOT NULL AND locked_until > ? FROM two_factor WHERE user_id = ? FOR UPDATE",
+			repo.now().Format(mysqlDatetimeFormat),
+			userID,
+		).
+		Scan(&failures, &locked)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, ErrNotEnrolled
+	case err != nil:
+		return 0, err
+	case locked:
+		return 0, ErrLocked
+	}
+	return failures, nil
+}
+
+// countFailure resets the wrong codes of a user on an accepted code and
+// locks the user out on the MaxFailures-th wrong one.
+func (repo *MysqlRepo) countFailure(tx *sql.Tx, userID string, failures int, ok bool) error {
+	var err error
+	switch {
+	case ok && failures == 0:
+		return nil
+	case ok:
+		_, err = tx.Exec("UPDATE two_factor SET failures = 0 WHERE user_id = ?", userID)
+	case failures+1 < MaxFailures:
+		_, err = tx.Exec("UPDATE two_factor SET failures = ? WHERE user_id = ?", failures+1, userID)
+	default:
+		_, err = tx.Exec(
+			"UPDATE two_factor SET failures = 0, locked_until = ? WHERE user_id = ?",
+			repo.now().Add(LockoutTime).Format(mysqlDatetimeFormat),
+			userID,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("update failures: %w", err)
+	}
+	return nil
+}
+
+// verify checks a code or a recovery code of an enabled user. A code is
+// accepted once, a recovery code is used up.
+func (repo *MysqlRepo) verify(tx *sql.Tx, userID, code string) error {
+	secret, enabled, lastStep, err := repo.lockSecret(tx, userID)
+	switch {
+	case err != nil:
+		return err
+	case !enabled:
+		return ErrNotEnrolled
+	}
+	code = normalize(code)
+	if step, ok := Match(secret, code, repo.now()); ok && step > lastStep {
+		_, err = tx.Exec("UPDATE two_factor SET last_step = ? WHERE user_id = ?", step, userID)
+		if err != nil {
+			return fmt.Errorf("update last step: %w", err)
+		}
+		return nil
+	}
+	result, err := tx.Exec(
+		"DELETE FROM two_factor_recovery WHERE user_id = ? AND code_hash = ?",
+		userID,
+		user.HashToken(code),
+	)
+	if err != nil {
+		return fmt.Errorf("use recovery code: %w", err)
+	}
+	used, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("use recovery code, RowsAffected: %w", err)
+	}
+	if used == 0 {
+		return ErrBadCode
+	}
+	return nil
+}
+
+func (repo *MysqlRepo) lockSecret(tx *sql.Tx, userID string) (string, bool, int64, error) {
+	secret, enabled, lastStep := "", false, int64(0)
+	err := tx.
+		QueryRow("SELECT secret, enabled, last_step FROM two_factor WHERE user_id = ? FOR UPDATE", userID).
+		Scan(&secret, &enabled, &lastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, 0, ErrNotEnrolled
+	}
+	return secret, enabled, lastStep, err
+}
+
+// inTx runs fn in a transaction that is committed if fn succeeds. Errors
+// of this package pass through, others are logged.
+func (repo *MysqlRepo) inTx(name string, fn func(tx *sql.Tx) error) error {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		repo.Logger.Errorf("in %v, begin: %v", name, err)
+		return err
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		if !isOwnError(err) {
+			repo.Logger.Errorf("in %v: %v", name, err)
+		}
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		repo.Logger.Errorf("in %v, commit: %v", name, err)
+		return err
+	}
+	return nil
+}
+
+func isOwnError(err error) bool {
+	for _, own := range []error{ErrNotEnrolled, ErrAlreadyEnabled, ErrBadCode, ErrBadChallenge, ErrLocked} {
+		if errors.Is(err, own) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize lets codes be typed with spaces, dashes and in any case.
+func normalize(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+// newRecoveryCodes returns the codes to show and the hashes to store.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodes)
+	hashes := make([]string, RecoveryCodes)
+	raw := make([]byte, 5)
+	for i := range codes {
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, fmt.Errorf("fail to read random bytes: %w", err)
+		}
+		code := hex.EncodeToString(raw)
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = user.HashToken(code)
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,249 @@
+package twofactor
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/user"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// testNow is in the step of the code 050471 of rfcSecret.
+var testNow = time.Unix(1111111111, 0)
+
+const failuresQuery = `SELECT failures, locked_until IS NOT NULL AND locked_until > \? FROM two_factor WHERE user_id = \? FOR UPDATE`
+
+func expectFailures(mock sqlmock.Sqlmock, failures int, locked bool) {
+	mock.ExpectQuery(failuresQuery).WithArgs(testNow.Format(mysqlDatetimeFormat), "1").
+		WillReturnRows(sqlmock.NewRows([]string{"failures", "locked"}).AddRow(failures, locked))
+}
+
+const lockQuery = `SELECT secret, enabled, last_step FROM two_factor WHERE user_id = \? FOR UPDATE`
+
+func expectSecret(mock sqlmock.Sqlmock, enabled bool, lastStep int64) {
+	mock.ExpectQuery(lockQuery).WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"secret", "enabled", "last_step"}).AddRow(rfcSecret, enabled, lastStep))
+}
+
+func TestEnroll(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar(), "redditclone")
+	repo.now = func() time.Time { return testNow }
+	enabled := `SELECT COUNT\(\*\) FROM two_factor WHERE user_id = \? AND enabled = TRUE`
+
+	mock.ExpectQuery(enabled).WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO two_factor").WithArgs("1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	enrollment, err := repo.Enroll(user.User{ID: "1", Username: "u"})
+	assert.Nil(t, err)
+	assert.Len(t, enrollment.Secret, 32)
+	assert.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/redditclone:u?"))
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+
+	mock.ExpectQuery(enabled).WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	_, err = repo.Enroll(user.User{ID: "1", Username: "u"})
+	assert.Equal(t, ErrAlreadyEnabled, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestConfirm(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar(), "redditclone")
+	repo.now = func() time.Time { return testNow }
+	step := StepAt(testNow)
+
+	mock.ExpectBegin()
+	expectSecret(mock, false, 0)
+	mock.ExpectExec(`UPDATE two_factor SET enabled = TRUE, last_step = \? WHERE user_id = \?`).
+		WithArgs(step, "1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM two_factor_recovery WHERE user_id = \?`).WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	args := make([]driver.Value, 0, 2*RecoveryCodes)
+	for i := 0; i < RecoveryCodes; i++ {
+		args = append(args, sqlmock.AnyArg(), "1")
+	}
+	mock.ExpectExec("INSERT INTO two_factor_recovery").WithArgs(args...).
+		WillReturnResult(sqlmock.NewResult(0, RecoveryCodes))
+	mock.ExpectCommit()
+	codes, err := repo.Confirm("1", "050 471")
+	assert.Nil(t, err)
+	assert.Len(t, codes, RecoveryCodes)
+	assert.Regexp(t, `^[0-9a-f]{5}-[0-9a-f]{5}$`, codes[0])
+
+	mock.ExpectBegin()
+	expectSecret(mock, false, 0)
+	mock.ExpectRollback()
+	_, err = repo.Confirm("1", "123456")
+	assert.Equal(t, ErrBadCode, err)
+
+	mock.ExpectBegin()
+	expectSecret(mock, true, 0)
+	mock.ExpectRollback()
+	_, err = repo.Confirm("1", "050471")
+	assert.Equal(t, ErrAlreadyEnabled, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockQuery).WithArgs("1").WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	_, err = repo.Confirm("1", "050471")
+	assert.Equal(t, ErrNotEnrolled, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDisable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar(), "redditclone")
+	repo.now = func() time.Time { return testNow }
+
+	mock.ExpectBegin()
+	expectSecret(mock, true, 0)
+	mock.ExpectExec(`UPDATE two_factor SET last_step = \? WHERE user_id = \?`).
+		WithArgs(StepAt(testNow), "1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM two_factor WHERE user_id = \?`).WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM two_factor_recovery WHERE user_id = \?`).WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectCommit()
+	assert.Nil(t, repo.Disable("1", "050471"))
+
+	mock.ExpectBegin()
+	expectSecret(mock, false, 0)
+	mock.ExpectRollback()
+	assert.Equal(t, ErrNotEnrolled, repo.Disable("1", "050471"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestChallenge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMysqlRepo(db, zap.NewNop().Sugar(), "redditclone")
+	repo.now = func() time.Time { return testNow }
+	step := StepAt(testNow)
+
+	mock.ExpectExec("INSERT INTO login_challenges").
+		WithArgs(sqlmock.AnyArg(), "1", testNow.Add(ChallengeTTL).Format(mysqlDatetimeFormat)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	token, err := repo.CreateChallenge("1")
+	assert.Nil(t, err)
+	hash := user.HashToken(token)
+
+	lookup := `SELECT user_id, attempts FROM login_challenges WHERE token_hash = \? AND expires_at > \? FOR UPDATE`
+	expectChallenge := func(attempts, failures int) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(lookup).WithArgs(hash, testNow.Format(mysqlDatetimeFormat)).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "attempts"}).AddRow("1", attempts))
+		expectFailures(mock, failures, false)
+	}
+	useRecovery := `DELETE FROM two_factor_recovery WHERE user_id = \? AND code_hash = \?`
+	deleteChallenge := `DELETE FROM login_challenges WHERE token_hash = \?`
+
+	// a code
+	expectChallenge(0, 0)
+	expectSecret(mock, true, step-1)
+	mock.ExpectExec(`UPDATE two_factor SET last_step = \?`).WithArgs(step, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(deleteChallenge).WithArgs(hash).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	userID, err := repo.CompleteChallenge(token, "050471")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", userID)
+
+	// a code already used is only tried as a recovery code, the wrong
+	// attempt is counted
+	expectChallenge(0, 0)
+	expectSecret(mock, true, step)
+	mock.ExpectExec(useRecovery).WithArgs("1", user.HashToken("050471")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE login_challenges SET attempts = attempts \+ 1`).WithArgs(hash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE two_factor SET failures = \? WHERE user_id = \?`).WithArgs(1, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	_, err = repo.CompleteChallenge(token, "050471")
+	assert.Equal(t, ErrBadCode, err)
+
+	// a recovery code, the wrong codes of the user are forgiven
+	expectChallenge(1, 1)
+	expectSecret(mock, true, step)
+	mock.ExpectExec(useRecovery).WithArgs("1", user.HashToken("abcde12345")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(deleteChallenge).WithArgs(hash).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE two_factor SET failures = 0 WHERE user_id = \?`).WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	userID, err = repo.CompleteChallenge(token, "ABCDE-12345")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", userID)
+
+	// the last attempt ends the challenge
+	expectChallenge(MaxAttempts-1, 0)
+	expectSecret(mock, true, step)
+	mock.ExpectExec(useRecovery).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(deleteChallenge).WithArgs(hash).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE two_factor SET failures = \? WHERE user_id = \?`).WithArgs(1, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	_, err = repo.CompleteChallenge(token, "000000")
+	assert.Equal(t, ErrBadCode, err)
+
+	// the last wrong code of the user locks the second step out, whatever
+	// the challenge
+	expectChallenge(0, MaxFailures-1)
+	expectSecret(mock, true, step)
+	mock.ExpectExec(useRecovery).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE login_challenges SET attempts = attempts \+ 1`).WithArgs(hash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE two_factor SET failures = 0, locked_until = \? WHERE user_id = \?`).
+		WithArgs(testNow.Add(LockoutTime).Format(mysqlDatetimeFormat), "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	_, err = repo.CompleteChallenge(token, "000000")
+	assert.Equal(t, ErrBadCode, err)
+
+	// a locked out user is not checked, even with a right code
+	mock.ExpectBegin()
+	mock.ExpectQuery(lookup).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "attempts"}).AddRow("1", 0))
+	expectFailures(mock, 0, true)
+	mock.ExpectRollback()
+	_, err = repo.CompleteChallenge(token, "050471")
+	assert.Equal(t, ErrLocked, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lookup).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	_, err = repo.CompleteChallenge(token, "050471")
+	assert.Equal(t, ErrBadChallenge, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lookup).WillReturnError(fmt.Errorf("db error"))
+	mock.ExpectRollback()
+	_, err = repo.CompleteChallenge(token, "050471")
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
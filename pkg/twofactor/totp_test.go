@@ -0,0 +1,64 @@
+package twofactor
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfcSecret is the key of the RFC 6238 test vectors, "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// the last six digits of the SHA1 vectors of RFC 6238
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tc := range cases {
+		code, err := Code(rfcSecret, StepAt(time.Unix(tc.unix, 0)))
+		assert.Nil(t, err)
+		assert.Equal(t, tc.code, code, tc.unix)
+	}
+
+	_, err := Code("not base32!", 1)
+	assert.NotNil(t, err)
+}
+
+func TestMatch(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := StepAt(now)
+	for _, delta := range []int64{-1, 0, 1} {
+		code, _ := Code(rfcSecret, step+delta)
+		matched, ok := Match(rfcSecret, code, now)
+		assert.True(t, ok)
+		assert.Equal(t, step+delta, matched)
+	}
+	old, _ := Code(rfcSecret, step-2)
+	_, ok := Match(rfcSecret, old, now)
+	assert.False(t, ok)
+}
+
+func TestNewSecret(t *testing.T) {
+	secret, err := NewSecret()
+	assert.Nil(t, err)
+	assert.Len(t, secret, 32)
+	_, err = Code(secret, 1)
+	assert.Nil(t, err)
+
+	uri, err := url.Parse(URI("reddit clone", "u", secret))
+	assert.Nil(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/reddit clone:u", uri.Path)
+	assert.Equal(t, secret, uri.Query().Get("secret"))
+	assert.Equal(t, "reddit clone", uri.Query().Get("issuer"))
+}
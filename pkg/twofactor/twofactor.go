@@ -0,0 +1,59 @@
+package twofactor
+
+import (
+	"errors"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/user"
+)
+
+const (
+	// ChallengeTTL is how long the token between the password and the code
+	// steps of a login can be used.
+	ChallengeTTL = 5 * time.Minute
+	// MaxAttempts is how many wrong codes end a login challenge.
+	MaxAttempts = 5
+	// MaxFailures is how many wrong codes of a user, across login
+	// challenges, lock the second login step for LockoutTime.
+	MaxFailures = 10
+	LockoutTime = 15 * time.Minute
+	// RecoveryCodes is how many single use recovery codes enrollment issues.
+	RecoveryCodes = 10
+)
+
+var (
+	ErrNotEnrolled    = errors.New("two-factor authentication is not enabled")
+	ErrAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrBadCode        = errors.New("invalid code")
+	ErrBadChallenge   = errors.New("invalid or expired login token")
+	ErrLocked         = errors.New("too many invalid codes, try again later")
+)
+
+// Enrollment is what an authenticator app needs, the URI is usually shown
+// as a QR code.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+//go:generate mockgen -source=twofactor.go -destination=repo_mock.go -package=twofactor Repo
+type Repo interface {
+	Enabled(userID string) (bool, error)
+	// Enroll starts enrollment with a new secret, replacing an unconfirmed
+	// one. It is not enabled until Confirm.
+	Enroll(u user.User) (Enrollment, error)
+	// Confirm enables two-factor authentication if the code matches the
+	// enrolled secret and returns the recovery codes.
+	Confirm(userID, code string) ([]string, error)
+	// Disable turns two-factor authentication off, it takes a code or a
+	// recovery code.
+	Disable(userID, code string) error
+	// CreateChallenge returns a token for the second step of a login.
+	CreateChallenge(userID string) (string, error)
+	// CompleteChallenge checks a code or a recovery code for the login
+	// token and returns the user logging in. The token is used up on
+	// success or after MaxAttempts wrong codes. After MaxFailures wrong
+	// codes in a row the user is locked out with ErrLocked, whatever the
+	// token.
+	CompleteChallenge(token, code string) (string, error)
+}
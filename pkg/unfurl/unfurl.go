@@ -0,0 +1,436 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/html"
+)
+
+const (
+	DefaultTimeout     = 5 * time.Second
+	DefaultMaxBodySize = 512 * 1024
+	DefaultCacheTTL    = time.Hour
+	DefaultErrorTTL    = time.Minute
+	DefaultCacheSize   = 1000
+	DefaultWorkers     = 2
+	DefaultQueueSize   = 100
+
+	maxRedirects   = 3
+	maxFieldLength = 500
+)
+
+var (
+	ErrBadScheme   = errors.New("unsupported url scheme")
+	ErrBlockedAddr = errors.New("address is not allowed")
+	ErrBadStatus   = errors.New("unexpected response status")
+	ErrNotHTML     = errors.New("response is not html")
+)
+
+type Preview struct {
+	Title       string `json:"title,omitempty" bson:"title,omitempty"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+	Image       string `json:"image,omitempty" bson:"image,omitempty"`
+	SiteName    string `json:"site_name,omitempty" bson:"site_name,omitempty"`
+}
+
+func (p Preview) Empty() bool {
+	return p == Preview{}
+}
+
+// PreviewStore saves previews produced in background, post.PostRepo implements it.
+type PreviewStore interface {
+	SetPreview(postID string, preview Preview) error
+}
+
+type Config struct {
+	Timeout     time.Duration
+	MaxBodySize int64
+	CacheTTL    time.Duration
+	CacheSize   int
+	Workers     int
+	QueueSize   int
+	// ErrorTTL is how long failed fetches are cached, short so that a
+	// page that was down briefly gets its preview soon.
+	ErrorTTL time.Duration
+	// AllowPrivate disables the SSRF guard, it is meant for tests only.
+	AllowPrivate bool
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = DefaultMaxBodySize
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = DefaultCacheTTL
+	}
+	if cfg.ErrorTTL <= 0 {
+		cfg.ErrorTTL = DefaultErrorTTL
+	}
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = DefaultCacheSize
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+}
+
+type cacheEntry struct {
+	preview Preview
+	err     error
+	expires time.Time
+}
+
+type job struct {
+	postID string
+	url    string
+}
+
+type Unfurler struct {
+	cfg    Config
+	client *http.Client
+	store  PreviewStore
+	Logger *zap.SugaredLogger
+
+	mu    *sync.Mutex
+	cache map[string]cacheEntry
+
+	queue chan job
+	wg    *sync.WaitGroup
+}
+
+func NewUnfurler(store PreviewStore, logger *zap.SugaredLogger, cfg Config) *Unfurler {
+	cfg.setDefaults()
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		dialer.Control = guardAddress
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.Timeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return checkScheme(req.URL)
+		},
+	}
+	return &Unfurler{
+		cfg:    cfg,
+		client: client,
+		store:  store,
+		Logger: logger,
+		mu:     &sync.Mutex{},
+		cache:  make(map[string]cacheEntry),
+		queue:  make(chan job, cfg.QueueSize),
+		wg:     &sync.WaitGroup{},
+	}
+}
+
+// guardAddress refuses connections to loopback, private and other
+// non-public addresses. It runs after DNS resolution, for every
+// connection including redirects, so rebinding tricks do not help.
+func guardAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w: %v", ErrBlockedAddr, address)
+	}
+	return nil
+}
+
+// blockedNets are the non-public ranges the net.IP methods do not cover.
+var blockedNets = []*net.IPNet{
+	// "this network"
+	mustParseCIDR("0.0.0.0/8"),
+	// shared address space of carrier-grade NAT
+	mustParseCIDR("100.64.0.0/10"),
+	// benchmarking
+	mustParseCIDR("198.18.0.0/15"),
+	// NAT64, it reaches IPv4 addresses including private ones
+	mustParseCIDR("64:ff9b::/96"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return false
+	}
+	for _, blocked := range blockedNets {
+		if blocked.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrBadScheme
+	}
+	return nil
+}
+
+// Fetch returns the preview of a page, served from cache when possible.
+func (u *Unfurler) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	u.mu.Lock()
+	entry, ok := u.cache[rawURL]
+	u.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.preview, entry.err
+	}
+
+	preview, err := u.fetch(ctx, rawURL)
+	ttl := u.cfg.CacheTTL
+	if err != nil {
+		ttl = u.cfg.ErrorTTL
+	}
+
+	u.mu.Lock()
+	if len(u.cache) >= u.cfg.CacheSize {
+		u.evictLocked()
+	}
+	u.cache[rawURL] = cacheEntry{
+		preview: preview,
+		err:     err,
+		expires: time.Now().Add(ttl),
+	}
+	u.mu.Unlock()
+	return preview, err
+}
+
+// evictLocked drops expired entries, or the one closest to expiration
+// if all of them are still fresh.
+func (u *Unfurler) evictLocked() {
+	now := time.Now()
+	oldestKey, oldest := "", time.Time{}
+	for key, entry := range u.cache {
+		if now.After(entry.expires) {
+			delete(u.cache, key)
+			continue
+		}
+		if oldestKey == "" || entry.expires.Before(oldest) {
+			oldestKey, oldest = key, entry.expires
+		}
+	}
+	if len(u.cache) >= u.cfg.CacheSize {
+		delete(u.cache, oldestKey)
+	}
+}
+
+func (u *Unfurler) fetch(ctx context.Context, rawURL string) (Preview, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return Preview{}, fmt.Errorf("fail to parse url: %w", err)
+	}
+	if err = checkScheme(target); err != nil {
+		return Preview{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, u.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return Preview{}, fmt.Errorf("fail to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "redditclone-unfurler/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return Preview{}, fmt.Errorf("fail to get %v: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Preview{}, fmt.Errorf("%w: %v", ErrBadStatus, resp.StatusCode)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return Preview{}, ErrNotHTML
+	}
+
+	body := io.LimitReader(resp.Body, u.cfg.MaxBodySize)
+	return parsePreview(body, resp.Request.URL), nil
+}
+
+// parsePreview reads OpenGraph and Twitter card tags from the document head.
+// OpenGraph wins over Twitter cards, which win over plain <title>/description.
+func parsePreview(r io.Reader, base *url.URL) Preview {
+	meta := make(map[string]string)
+	title := ""
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+
+loop:
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			break loop
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := tokenizer.Token()
+			switch tok.Data {
+			case "meta":
+				key, content := "", ""
+				for _, attr := range tok.Attr {
+					switch strings.ToLower(attr.Key) {
+					case "property", "name":
+						key = strings.ToLower(strings.TrimSpace(attr.Val))
+					case "content":
+						content = strings.TrimSpace(attr.Val)
+					}
+				}
+				if _, seen := meta[key]; key != "" && content != "" && !seen {
+					meta[key] = content
+				}
+			case "title":
+				inTitle = true
+			case "body":
+				break loop
+			}
+		case html.TextToken:
+			if inTitle && title == "" {
+				title = strings.TrimSpace(string(tokenizer.Text()))
+			}
+		case html.EndTagToken:
+			tok := tokenizer.Token()
+			switch tok.Data {
+			case "title":
+				inTitle = false
+			case "head":
+				break loop
+			}
+		}
+	}
+
+	preview := Preview{
+		Title:       first(meta["og:title"], meta["twitter:title"], title),
+		Description: first(meta["og:description"], meta["twitter:description"], meta["description"]),
+		Image:       first(meta["og:image"], meta["og:image:url"], meta["twitter:image"], meta["twitter:image:src"]),
+		SiteName:    first(meta["og:site_name"], meta["twitter:site"]),
+	}
+	preview.Title = truncate(preview.Title)
+	preview.Description = truncate(preview.Description)
+	preview.SiteName = truncate(preview.SiteName)
+	preview.Image = resolveImage(preview.Image, base)
+	return preview
+}
+
+func resolveImage(image string, base *url.URL) string {
+	if image == "" {
+		return ""
+	}
+	ref, err := url.Parse(image)
+	if err != nil {
+		return ""
+	}
+	abs := base.ResolveReference(ref)
+	if checkScheme(abs) != nil {
+		return ""
+	}
+	return abs.String()
+}
+
+func first(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func truncate(s string) string {
+	runes := []rune(s)
+	if len(runes) <= maxFieldLength {
+		return s
+	}
+	return string(runes[:maxFieldLength])
+}
+
+// Enqueue schedules a post preview fetch, dropping it if the queue is full.
+func (u *Unfurler) Enqueue(postID, rawURL string) {
+	select {
+	case u.queue <- job{postID: postID, url: rawURL}:
+	default:
+		u.Logger.Warnf("unfurl queue is full, skip post %v", postID)
+	}
+}
+
+// Start runs background workers until ctx is done.
+func (u *Unfurler) Start(ctx context.Context) {
+	for i := 0; i < u.cfg.Workers; i++ {
+		u.wg.Add(1)
+		go func() {
+			defer u.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-u.queue:
+					u.process(ctx, j)
+				}
+			}
+		}()
+	}
+}
+
+// Wait blocks until all workers started by Start have exited.
+func (u *Unfurler) Wait() {
+	u.wg.Wait()
+}
+
+func (u *Unfurler) process(ctx context.Context, j job) {
+	preview, err := u.Fetch(ctx, j.url)
+	if err != nil {
+		u.Logger.Infof("fail to unfurl %v for post %v: %v", j.url, j.postID, err)
+		return
+	}
+	if preview.Empty() {
+		return
+	}
+	err = u.store.SetPreview(j.postID, preview)
+	if err != nil {
+		u.Logger.Errorf("fail to save preview of post %v: %v", j.postID, err)
+	}
+}
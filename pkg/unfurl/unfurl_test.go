@@ -0,0 +1,202 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const page = `<!doctype html>
+<html><head>
+<title>Plain title</title>
+<meta property="og:title" content="OG title">
+<meta name="twitter:title" content="Twitter title">
+<meta name="twitter:description" content="Twitter description">
+<meta property="og:image" content="/img/cover.png">
+<meta property="og:site_name" content="Example">
+</head><body><meta property="og:description" content="in body"></body></html>`
+
+type memoryStore struct {
+	mu       sync.Mutex
+	previews map[string]Preview
+	saved    chan struct{}
+}
+
+func (s *memoryStore) SetPreview(postID string, preview Preview) error {
+	s.mu.Lock()
+	s.previews[postID] = preview
+	s.mu.Unlock()
+	s.saved <- struct{}{}
+	return nil
+}
+
+func newTestUnfurler(store PreviewStore, cfg Config) *Unfurler {
+	cfg.AllowPrivate = true
+	return NewUnfurler(store, zap.NewNop().Sugar(), cfg)
+}
+
+func TestFetch(t *testing.T) {
+	hits := int32(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, page)
+	}))
+	defer srv.Close()
+
+	u := newTestUnfurler(nil, Config{})
+	preview, err := u.Fetch(context.Background(), srv.URL+"/article")
+	assert.Nil(t, err)
+	assert.Equal(t, Preview{
+		Title:       "OG title",
+		Description: "Twitter description",
+		Image:       srv.URL + "/img/cover.png",
+		SiteName:    "Example",
+	}, preview)
+
+	// second fetch is served from cache
+	_, err = u.Fetch(context.Background(), srv.URL+"/article")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestFetchFallbackToTitle(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title> Only title </title><meta name="description" content="desc"></head></html>`)
+	}))
+	defer srv.Close()
+
+	preview, err := newTestUnfurler(nil, Config{}).Fetch(context.Background(), srv.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, Preview{Title: "Only title", Description: "desc"}, preview)
+}
+
+func TestFetchErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{}`)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/huge":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><head>"+strings.Repeat("<!-- padding -->", 1000))
+			fmt.Fprint(w, `<meta property="og:title" content="too far">`)
+		}
+	}))
+	defer srv.Close()
+
+	u := newTestUnfurler(nil, Config{Timeout: 50 * time.Millisecond, MaxBodySize: 1024})
+
+	_, err := u.Fetch(context.Background(), srv.URL+"/missing")
+	assert.True(t, errors.Is(err, ErrBadStatus))
+
+	_, err = u.Fetch(context.Background(), srv.URL+"/json")
+	assert.True(t, errors.Is(err, ErrNotHTML))
+
+	_, err = u.Fetch(context.Background(), srv.URL+"/slow")
+	assert.NotNil(t, err)
+
+	preview, err := u.Fetch(context.Background(), srv.URL+"/huge")
+	assert.Nil(t, err)
+	assert.True(t, preview.Empty())
+
+	_, err = u.Fetch(context.Background(), "ftp://example.com/file")
+	assert.True(t, errors.Is(err, ErrBadScheme))
+}
+
+func TestFetchCachesErrorsBriefly(t *testing.T) {
+	hits := int32(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	u := newTestUnfurler(nil, Config{ErrorTTL: 50 * time.Millisecond})
+	_, err := u.Fetch(context.Background(), srv.URL)
+	assert.True(t, errors.Is(err, ErrBadStatus))
+	_, err = u.Fetch(context.Background(), srv.URL)
+	assert.True(t, errors.Is(err, ErrBadStatus))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = u.Fetch(context.Background(), srv.URL)
+	assert.True(t, errors.Is(err, ErrBadStatus))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestFetchBlocksPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, page)
+	}))
+	defer srv.Close()
+
+	u := NewUnfurler(nil, zap.NewNop().Sugar(), Config{})
+	_, err := u.Fetch(context.Background(), srv.URL)
+	assert.True(t, errors.Is(err, ErrBlockedAddr), "got %v", err)
+}
+
+func TestIsPublicIP(t *testing.T) {
+	cases := map[string]bool{
+		"8.8.8.8":         true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"0.1.2.3":         false,
+		"198.18.0.1":      false,
+		"198.19.255.255":  false,
+		"198.20.0.1":      true,
+		"64:ff9b::a00:1":  false,
+		"::1":             false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+	}
+	for addr, public := range cases {
+		assert.Equal(t, public, isPublicIP(net.ParseIP(addr)), addr)
+	}
+}
+
+func TestBackgroundWorkers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, page)
+	}))
+	defer srv.Close()
+
+	store := &memoryStore{previews: make(map[string]Preview), saved: make(chan struct{}, 1)}
+	u := newTestUnfurler(store, Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	u.Start(ctx)
+
+	u.Enqueue("post1", srv.URL)
+	select {
+	case <-store.saved:
+	case <-time.After(2 * time.Second):
+		t.Fatal("preview was not saved")
+	}
+	cancel()
+	u.Wait()
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	assert.Equal(t, "OG title", store.previews["post1"].Title)
+}
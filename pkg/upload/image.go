@@ -0,0 +1,160 @@
+package upload
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+var (
+	ErrTooLarge        = errors.New("file is too large")
+	ErrUnsupportedType = errors.New("file type is not supported")
+	ErrBadImage        = errors.New("image can not be decoded")
+	ErrTooManyPixels   = errors.New("image dimensions are too large")
+)
+
+type Limits struct {
+	// MaxSize is the largest accepted file in bytes.
+	MaxSize int64
+	// MaxPixels bounds width*height summed over all frames, so small
+	// files can not expand into huge bitmaps.
+	MaxPixels int
+	// ThumbnailSize is the longest side of a thumbnail.
+	ThumbnailSize int
+}
+
+var DefaultLimits = Limits{
+	MaxSize:       10 << 20,
+	MaxPixels:     50_000_000,
+	ThumbnailSize: 320,
+}
+
+const jpegQuality = 90
+
+// imageTypes maps sniffed content types to the extension of stored files.
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Processed is an image re-encoded without metadata.
+type Processed struct {
+	Data        []byte
+	Thumbnail   []byte
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+// ProcessImage checks an uploaded image and re-encodes it. Re-encoding
+// drops EXIF and other metadata, the EXIF orientation is applied to the
+// pixels first so photos keep looking the same.
+func ProcessImage(r io.Reader, limits Limits) (Processed, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limits.MaxSize+1))
+	if err != nil {
+		return Processed{}, fmt.Errorf("fail to read upload: %w", err)
+	}
+	if int64(len(data)) > limits.MaxSize {
+		return Processed{}, ErrTooLarge
+	}
+
+	// the client supplied content type is not trusted
+	contentType := http.DetectContentType(data)
+	ext, ok := imageTypes[contentType]
+	if !ok {
+		return Processed{}, ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Processed{}, ErrBadImage
+	}
+	frames := 1
+	if contentType == "image/gif" {
+		frames, err = gifFrameCount(data)
+		if err != nil {
+			return Processed{}, ErrBadImage
+		}
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 ||
+		cfg.Width*cfg.Height > limits.MaxPixels/frames {
+		return Processed{}, ErrTooManyPixels
+	}
+
+	res := Processed{ContentType: contentType, Ext: ext}
+	var img image.Image
+	buf := &bytes.Buffer{}
+	switch contentType {
+	case "image/gif":
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return Processed{}, ErrBadImage
+		}
+		if err = gif.EncodeAll(buf, anim); err != nil {
+			return Processed{}, fmt.Errorf("fail to encode gif: %w", err)
+		}
+		img = firstFrame(anim)
+	case "image/png":
+		img, err = png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Processed{}, ErrBadImage
+		}
+		if err = png.Encode(buf, img); err != nil {
+			return Processed{}, fmt.Errorf("fail to encode png: %w", err)
+		}
+	case "image/jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Processed{}, ErrBadImage
+		}
+		if orientation := jpegOrientation(data); orientation > 1 {
+			img = orient(toRGBA(img), orientation)
+		}
+		if err = jpeg.Encode(buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return Processed{}, fmt.Errorf("fail to encode jpeg: %w", err)
+		}
+	}
+	res.Data = buf.Bytes()
+	res.Width = img.Bounds().Dx()
+	res.Height = img.Bounds().Dy()
+
+	thumb := &bytes.Buffer{}
+	err = jpeg.Encode(thumb, thumbnail(toRGBA(img), limits.ThumbnailSize), &jpeg.Options{Quality: jpegQuality})
+	if err != nil {
+		return Processed{}, fmt.Errorf("fail to encode thumbnail: %w", err)
+	}
+	res.Thumbnail = thumb.Bytes()
+	return res, nil
+}
+
+// firstFrame draws the first frame on the logical screen of the gif.
+func firstFrame(anim *gif.GIF) image.Image {
+	bounds := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	if bounds.Empty() && len(anim.Image) != 0 {
+		bounds = anim.Image[0].Bounds()
+	}
+	dst := image.NewRGBA(bounds)
+	if len(anim.Image) != 0 {
+		draw.Draw(dst, anim.Image[0].Bounds(), anim.Image[0], anim.Image[0].Bounds().Min, draw.Over)
+	}
+	return dst
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
@@ -0,0 +1,185 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 100, 255})
+		}
+	}
+	// mark the top left corner to check orientation
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	return img
+}
+
+// withOrientation inserts an APP1 EXIF segment right after SOI.
+func withOrientation(jpg []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = append(tiff, 0, 1)
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func TestProcessPNG(t *testing.T) {
+	buf := &bytes.Buffer{}
+	_ = png.Encode(buf, testImage(640, 200))
+
+	res, err := ProcessImage(buf, DefaultLimits)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	assert.Equal(t, "image/png", res.ContentType)
+	assert.Equal(t, ".png", res.Ext)
+	assert.Equal(t, 640, res.Width)
+	assert.Equal(t, 200, res.Height)
+
+	thumb, err := jpeg.Decode(bytes.NewReader(res.Thumbnail))
+	if err != nil {
+		t.Fatalf("thumbnail is not a jpeg: %v", err)
+	}
+	assert.Equal(t, image.Rect(0, 0, 320, 100), thumb.Bounds())
+}
+
+func TestProcessJPEGAppliesOrientationAndStripsExif(t *testing.T) {
+	buf := &bytes.Buffer{}
+	_ = jpeg.Encode(buf, testImage(40, 20), &jpeg.Options{Quality: 100})
+	data := withOrientation(buf.Bytes(), 6)
+	assert.Equal(t, 6, jpegOrientation(data))
+
+	res, err := ProcessImage(bytes.NewReader(data), DefaultLimits)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	assert.Equal(t, 20, res.Width)
+	assert.Equal(t, 40, res.Height)
+	assert.False(t, bytes.Contains(res.Data, []byte("Exif")))
+	assert.Equal(t, 1, jpegOrientation(res.Data))
+
+	img, err := jpeg.Decode(bytes.NewReader(res.Data))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// rotated clockwise, the red corner moves to the top right
+	r, g, _, _ := img.At(17, 2).RGBA()
+	assert.True(t, r>>8 > 200 && g>>8 < 60, "got r=%v g=%v", r>>8, g>>8)
+}
+
+func TestProcessAnimatedGIF(t *testing.T) {
+	anim := &gif.GIF{}
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 30, 30), palette.Plan9)
+		frame.SetColorIndex(i, i, 5)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	buf := &bytes.Buffer{}
+	_ = gif.EncodeAll(buf, anim)
+
+	frames, err := gifFrameCount(buf.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, frames)
+
+	res, err := ProcessImage(bytes.NewReader(buf.Bytes()), DefaultLimits)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	out, err := gif.DecodeAll(bytes.NewReader(res.Data))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	assert.Len(t, out.Image, 3)
+
+	// three frames of 30x30 do not fit into 2000 pixels
+	_, err = ProcessImage(bytes.NewReader(buf.Bytes()), Limits{MaxSize: 1 << 20, MaxPixels: 2000, ThumbnailSize: 10})
+	assert.True(t, errors.Is(err, ErrTooManyPixels))
+}
+
+func TestProcessRejects(t *testing.T) {
+	small := &bytes.Buffer{}
+	_ = png.Encode(small, testImage(100, 100))
+
+	cases := []struct {
+		name   string
+		data   []byte
+		limits Limits
+		err    error
+	}{
+		{
+			name:   "too large",
+			data:   small.Bytes(),
+			limits: Limits{MaxSize: 100, MaxPixels: 1 << 20, ThumbnailSize: 10},
+			err:    ErrTooLarge,
+		},
+		{
+			name:   "too many pixels",
+			data:   small.Bytes(),
+			limits: Limits{MaxSize: 1 << 20, MaxPixels: 100*100 - 1, ThumbnailSize: 10},
+			err:    ErrTooManyPixels,
+		},
+		{
+			name:   "html named as image",
+			data:   []byte("<html><script>alert(1)</script></html>"),
+			limits: DefaultLimits,
+			err:    ErrUnsupportedType,
+		},
+		{
+			name:   "svg",
+			data:   []byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"/>`),
+			limits: DefaultLimits,
+			err:    ErrUnsupportedType,
+		},
+		{
+			name:   "truncated png",
+			data:   small.Bytes()[:60],
+			limits: DefaultLimits,
+			err:    ErrBadImage,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ProcessImage(bytes.NewReader(tc.data), tc.limits)
+			assert.True(t, errors.Is(err, tc.err), "got %v", err)
+		})
+	}
+}
+
+func TestGIFFrameCountMalformed(t *testing.T) {
+	for _, data := range []string{"", "GIF89a", "GIF89a" + strings.Repeat("\x00", 7) + "\x99"} {
+		_, err := gifFrameCount([]byte(data))
+		assert.NotNil(t, err, "data %q", data)
+	}
+}
@@ -0,0 +1,59 @@
+package upload
+
+import (
+	"image"
+)
+
+// thumbnail scales src down to fit a size x size square, averaging the
+// source pixels covered by each thumbnail pixel. Transparent areas are
+// put on white since thumbnails are jpegs.
+func thumbnail(src *image.RGBA, size int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, h*size/w
+		} else {
+			tw, th = w*size/h, size
+		}
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := ty*h/th, (ty+1)*h/th
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := tx*w/tw, (tx+1)*w/tw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, n int
+			for y := y0; y < y1; y++ {
+				i := src.PixOffset(src.Rect.Min.X+x0, src.Rect.Min.Y+y)
+				for x := x0; x < x1; x++ {
+					// pixels are alpha premultiplied, add white behind them
+					white := 255 - int(src.Pix[i+3])
+					r += int(src.Pix[i]) + white
+					g += int(src.Pix[i+1]) + white
+					b += int(src.Pix[i+2]) + white
+					n++
+					i += 4
+				}
+			}
+			di := dst.PixOffset(tx, ty)
+			dst.Pix[di] = uint8(r / n)
+			dst.Pix[di+1] = uint8(g / n)
+			dst.Pix[di+2] = uint8(b / n)
+			dst.Pix[di+3] = 255
+		}
+	}
+	return dst
+}
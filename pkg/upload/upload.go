@@ -0,0 +1,68 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/greatjudge/redditclone/pkg/storage"
+)
+
+// Image describes a stored image and its thumbnail.
+type Image struct {
+	URL          string `json:"url" bson:"url"`
+	ThumbnailURL string `json:"thumbnail_url" bson:"thumbnail_url"`
+	ContentType  string `json:"content_type" bson:"content_type"`
+	Width        int    `json:"width" bson:"width"`
+	Height       int    `json:"height" bson:"height"`
+	Key          string `json:"-" bson:"key"`
+	ThumbnailKey string `json:"-" bson:"thumbnail_key"`
+}
+
+// Uploader processes images and puts them into a blob store. Keys are
+// derived from the content, so a stored file never changes.
+type Uploader struct {
+	Store  storage.BlobStore
+	Limits Limits
+	// BaseURL is prepended to keys to build file urls.
+	BaseURL string
+}
+
+func NewUploader(store storage.BlobStore, baseURL string) *Uploader {
+	return &Uploader{
+		Store:   store,
+		Limits:  DefaultLimits,
+		BaseURL: baseURL,
+	}
+}
+
+func (u *Uploader) UploadImage(ctx context.Context, r io.Reader) (Image, error) {
+	processed, err := ProcessImage(r, u.Limits)
+	if err != nil {
+		return Image{}, err
+	}
+	sum := sha256.Sum256(processed.Data)
+	name := hex.EncodeToString(sum[:16])
+	img := Image{
+		ContentType:  processed.ContentType,
+		Width:        processed.Width,
+		Height:       processed.Height,
+		Key:          name + processed.Ext,
+		ThumbnailKey: name + "_thumb.jpg",
+	}
+
+	err = u.Store.Put(ctx, img.Key, bytes.NewReader(processed.Data), processed.ContentType)
+	if err != nil {
+		return Image{}, fmt.Errorf("fail to store image: %w", err)
+	}
+	err = u.Store.Put(ctx, img.ThumbnailKey, bytes.NewReader(processed.Thumbnail), "image/jpeg")
+	if err != nil {
+		return Image{}, fmt.Errorf("fail to store thumbnail: %w", err)
+	}
+	img.URL = u.BaseURL + img.Key
+	img.ThumbnailURL = u.BaseURL + img.ThumbnailKey
+	return img, nil
+}
@@ -63,3 +63,25 @@ func (repo *UserMemoryRepository) GetByID(userID string) (*User, error) {
 	}
 	return nil, ErrNoUser
 }
+
+func (repo *UserMemoryRepository) GetByUsername(username string) (User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	user, ok := repo.username2User[username]
+	if !ok {
+		return User{}, ErrNoUser
+	}
+	return *user, nil
+}
+
+func (repo *UserMemoryRepository) Delete(userID string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for username, user := range repo.username2User {
+		if user.ID == userID {
+			delete(repo.username2User, username)
+			return nil
+		}
+	}
+	return ErrNoUser
+}
@@ -6,11 +6,15 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"go.uber.org/zap"
 )
 
+const mysqlDatetimeFormat = "2006-01-02 15:04:05"
+
 type UserMysqlRepository struct {
 	DB     *sql.DB
 	Logger *zap.SugaredLogger
@@ -29,15 +33,52 @@ func MD5hashInt(val int64) string {
 	return fmt.Sprintf("%x", hash)
 }
 
-func (repo *UserMysqlRepository) Register(username, password string) (User, error) {
+// duplicateKey returns the name of the unique key err violates. The name is
+// at the end of the message, MySQL 8 prefixes it with the table.
+func duplicateKey(err error) (string, bool) {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062 {
+		return "", false
+	}
+	const marker = "for key '"
+	i := strings.LastIndex(mysqlErr.Message, marker)
+	if i < 0 {
+		return "", true
+	}
+	key := strings.TrimSuffix(mysqlErr.Message[i+len(marker):], "'")
+	return strings.TrimPrefix(key, "users."), true
+}
+
+func (repo *UserMysqlRepository) Register(username, password, email string) (User, error) {
+	return repo.register(
+		`INSERT INTO users (username, password, email) VALUES (?, MD5(?), ?)`,
+		username,
+		password,
+		email,
+	)
+}
+
+func (repo *UserMysqlRepository) RegisterVerified(username, password, email string) (User, error) {
+	return repo.register(
+		`INSERT INTO users (username, password, email, email_verified) VALUES (?, MD5(?), ?, TRUE)`,
+		username,
+		password,
+		email,
+	)
+}
+
+func (repo *UserMysqlRepository) register(query, username, password, email string) (User, error) {
 	result, err := repo.DB.Exec(
-		`INSERT INTO users (username, password) VALUES (?, MD5(?))`,
+		query,
 		username,
 		password,
+		sql.NullString{String: email, Valid: email != ""},
 	)
-	var mysqlErr *mysql.MySQLError
+	key, duplicate := duplicateKey(err)
 	switch {
-	case errors.As(err, &mysqlErr) && mysqlErr.Number == 1062:
+	case duplicate && key == "email":
+		return User{}, ErrEmailTaken
+	case duplicate:
 		return User{}, ErrAlreadyExists
 	case err != nil:
 		repo.Logger.Error("in Register: ", err)
@@ -90,3 +131,325 @@ func (repo *UserMysqlRepository) GetByID(userID string) (User, error) {
 	}
 	return *user, nil
 }
+
+func (repo *UserMysqlRepository) GetByUsername(username string) (User, error) {
+	user := &User{}
+	err := repo.DB.
+		QueryRow("SELECT MD5(id), username FROM users WHERE username = ?", username).
+		Scan(&user.ID, &user.Username)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return User{}, ErrNoUser
+	case err != nil:
+		repo.Logger.Error("in GetByUsername: ", err)
+		return User{}, err
+	}
+	return *user, nil
+}
+
+func (repo *UserMysqlRepository) GetProfile(username string) (Profile, error) {
+	profile, created := Profile{}, ""
+	err := repo.DB.
+		QueryRow(
+			"SELECT MD5(id), username, created_at, bio, avatar_url FROM users WHERE username = ?",
+			username,
+		).
+		Scan(&profile.User.ID, &profile.User.Username, &created, &profile.Bio, &profile.AvatarURL)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Profile{}, ErrNoUser
+	case err != nil:
+		repo.Logger.Error("in GetProfile: ", err)
+		return Profile{}, err
+	}
+	profile.CreatedAt, err = time.Parse(mysqlDatetimeFormat, created)
+	if err != nil {
+		repo.Logger.Error("in GetProfile, parse created_at: ", err)
+		return Profile{}, err
+	}
+	return profile, nil
+}
+
+func (repo *UserMysqlRepository) UpdateProfile(userID string, form ProfileForm) (Profile, error) {
+	_, err := repo.DB.Exec(
+		"UPDATE users SET bio = ?, avatar_url = ? WHERE MD5(id) = ?",
+		form.Bio,
+		form.AvatarURL,
+		userID,
+	)
+	if err != nil {
+		repo.Logger.Error("in UpdateProfile: ", err)
+		return Profile{}, err
+	}
+	user, err := repo.GetByID(userID)
+	if err != nil {
+		return Profile{}, err
+	}
+	return repo.GetProfile(user.Username)
+}
+
+// userTables are cleared of the user's rows, the user row goes last.
+var userTables = []string{
+	"DELETE FROM sessions WHERE user_id = ?",
+	"DELETE FROM saved WHERE user_id = ?",
+	"DELETE FROM hidden_posts WHERE user_id = ?",
+	"DELETE FROM blocks WHERE ? IN (user_id, blocked_id)",
+	"DELETE FROM notifications WHERE user_id = ?",
+	"DELETE FROM password_resets WHERE user_id = ?",
+	"DELETE FROM email_verifications WHERE user_id = ?",
+	"DELETE FROM two_factor WHERE user_id = ?",
+	"DELETE FROM two_factor_recovery WHERE user_id = ?",
+	"DELETE FROM login_challenges WHERE user_id = ?",
+	"DELETE FROM external_identities WHERE user_id = ?",
+	"DELETE FROM api_tokens WHERE user_id = ?",
+	"DELETE FROM user_roles WHERE user_id = ?",
+	"DELETE FROM user_bans WHERE user_id = ?",
+	// the messages of a conversation go with it
+	"DELETE FROM conversations WHERE ? IN (user_a, user_b)",
+	"DELETE FROM users WHERE MD5(id) = ?",
+}
+
+func (repo *UserMysqlRepository) Delete(userID string) error {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		repo.Logger.Error("in Delete, begin: ", err)
+		return err
+	}
+	deleted := int64(0)
+	for _, query := range userTables {
+		result, err := tx.Exec(query, userID)
+		if err != nil {
+			repo.Logger.Error("in Delete: ", err)
+			_ = tx.Rollback()
+			return err
+		}
+		deleted, err = result.RowsAffected()
+		if err != nil {
+			repo.Logger.Error("in Delete, RowsAffected: ", err)
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	if deleted == 0 {
+		_ = tx.Rollback()
+		return ErrNoUser
+	}
+	if err = tx.Commit(); err != nil {
+		repo.Logger.Error("in Delete, commit: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *UserMysqlRepository) ChangePassword(userID, current, password string) error {
+	matched := 0
+	err := repo.DB.
+		QueryRow("SELECT COUNT(*) FROM users WHERE MD5(id) = ? AND password = MD5(?)", userID, current).
+		Scan(&matched)
+	if err != nil {
+		repo.Logger.Error("in ChangePassword: ", err)
+		return err
+	}
+	if matched == 0 {
+		return ErrBadPass
+	}
+	_, err = repo.DB.Exec("UPDATE users SET password = MD5(?) WHERE MD5(id) = ?", password, userID)
+	if err != nil {
+		repo.Logger.Error("in ChangePassword, update: ", err)
+		return err
+	}
+	return nil
+}
+
+func (repo *UserMysqlRepository) CreatePasswordReset(userID string, expires time.Time) (string, error) {
+	token, hash, err := NewToken()
+	if err != nil {
+		return "", err
+	}
+	// a new token replaces the ones sent before
+	_, err = repo.DB.Exec("DELETE FROM password_resets WHERE user_id = ?", userID)
+	if err != nil {
+		repo.Logger.Error("in CreatePasswordReset, delete: ", err)
+		return "", err
+	}
+	_, err = repo.DB.Exec(
+		"INSERT INTO password_resets (`token_hash`, `user_id`, `expires_at`) VALUES (?, ?, ?)",
+		hash,
+		userID,
+		expires.Format(mysqlDatetimeFormat),
+	)
+	if err != nil {
+		repo.Logger.Error("in CreatePasswordReset: ", err)
+		return "", err
+	}
+	return token, nil
+}
+
+func (repo *UserMysqlRepository) ResetPassword(token, password string) (User, error) {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		repo.Logger.Error("in ResetPassword, begin: ", err)
+		return User{}, err
+	}
+	userID, err := repo.resetPassword(tx, HashToken(token), password)
+	if err != nil {
+		_ = tx.Rollback()
+		return User{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		repo.Logger.Error("in ResetPassword, commit: ", err)
+		return User{}, err
+	}
+	return repo.GetByID(userID)
+}
+
+func (repo *UserMysqlRepository) resetPassword(tx *sql.Tx, hash, password string) (string, error) {
+	userID := ""
+	err := tx.
+		QueryRow(
+			"SELECT user_id FROM password_resets WHERE token_hash = ? AND expires_at > ? FOR UPDATE",
+			hash,
+			time.Now().Format(mysqlDatetimeFormat),
+		).
+		Scan(&userID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "", ErrBadResetToken
+	case err != nil:
+		repo.Logger.Error("in ResetPassword: ", err)
+		return "", err
+	}
+	// the token is used up along with any other sent to the user
+	_, err = tx.Exec("DELETE FROM password_resets WHERE user_id = ?", userID)
+	if err != nil {
+		repo.Logger.Error("in ResetPassword, delete: ", err)
+		return "", err
+	}
+	_, err = tx.Exec("UPDATE users SET password = MD5(?) WHERE MD5(id) = ?", password, userID)
+	if err != nil {
+		repo.Logger.Error("in ResetPassword, update: ", err)
+		return "", err
+	}
+	return userID, nil
+}
+
+func (repo *UserMysqlRepository) GetEmail(userID string) (Email, error) {
+	address, email := sql.NullString{}, Email{}
+	err := repo.DB.
+		QueryRow("SELECT email, email_verified FROM users WHERE MD5(id) = ?", userID).
+		Scan(&address, &email.Verified)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Email{}, ErrNoUser
+	case err != nil:
+		repo.Logger.Error("in GetEmail: ", err)
+		return Email{}, err
+	case !address.Valid:
+		return Email{}, ErrNoEmail
+	}
+	email.Address = address.String
+	return email, nil
+}
+
+func (repo *UserMysqlRepository) GetByVerifiedEmail(address string) (User, error) {
+	user := &User{}
+	err := repo.DB.
+		QueryRow("SELECT MD5(id), username FROM users WHERE email = ? AND email_verified = TRUE", address).
+		Scan(&user.ID, &user.Username)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return User{}, ErrNoUser
+	case err != nil:
+		repo.Logger.Error("in GetByVerifiedEmail: ", err)
+		return User{}, err
+	}
+	return *user, nil
+}
+
+func (repo *UserMysqlRepository) CreateEmailVerification(userID string, expires time.Time) (string, error) {
+	now := time.Now()
+	recent := 0
+	err := repo.DB.
+		QueryRow(
+			"SELECT COUNT(*) FROM email_verifications WHERE user_id = ? AND created_at > ?",
+			userID,
+			now.Add(-EmailResendInterval).Format(mysqlDatetimeFormat),
+		).
+		Scan(&recent)
+	if err != nil {
+		repo.Logger.Error("in CreateEmailVerification: ", err)
+		return "", err
+	}
+	if recent != 0 {
+		return "", ErrResendTooSoon
+	}
+	token, hash, err := NewToken()
+	if err != nil {
+		return "", err
+	}
+	// a new token replaces the ones sent before
+	_, err = repo.DB.Exec("DELETE FROM email_verifications WHERE user_id = ?", userID)
+	if err != nil {
+		repo.Logger.Error("in CreateEmailVerification, delete: ", err)
+		return "", err
+	}
+	_, err = repo.DB.Exec(
+		"INSERT INTO email_verifications (`token_hash`, `user_id`, `expires_at`, `created_at`) VALUES (?, ?, ?, ?)",
+		hash,
+		userID,
+		expires.Format(mysqlDatetimeFormat),
+		now.Format(mysqlDatetimeFormat),
+	)
+	if err != nil {
+		repo.Logger.Error("in CreateEmailVerification, insert: ", err)
+		return "", err
+	}
+	return token, nil
+}
+
+func (repo *UserMysqlRepository) VerifyEmail(token string) (User, error) {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		repo.Logger.Error("in VerifyEmail, begin: ", err)
+		return User{}, err
+	}
+	userID, err := repo.verifyEmail(tx, HashToken(token))
+	if err != nil {
+		_ = tx.Rollback()
+		return User{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		repo.Logger.Error("in VerifyEmail, commit: ", err)
+		return User{}, err
+	}
+	return repo.GetByID(userID)
+}
+
+func (repo *UserMysqlRepository) verifyEmail(tx *sql.Tx, hash string) (string, error) {
+	userID := ""
+	err := tx.
+		QueryRow(
+			"SELECT user_id FROM email_verifications WHERE token_hash = ? AND expires_at > ? FOR UPDATE",
+			hash,
+			time.Now().Format(mysqlDatetimeFormat),
+		).
+		Scan(&userID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "", ErrBadVerifyToken
+	case err != nil:
+		repo.Logger.Error("in VerifyEmail: ", err)
+		return "", err
+	}
+	_, err = tx.Exec("DELETE FROM email_verifications WHERE user_id = ?", userID)
+	if err != nil {
+		repo.Logger.Error("in VerifyEmail, delete: ", err)
+		return "", err
+	}
+	_, err = tx.Exec("UPDATE users SET email_verified = TRUE WHERE MD5(id) = ?", userID)
+	if err != nil {
+		repo.Logger.Error("in VerifyEmail, update: ", err)
+		return "", err
+	}
+	return userID, nil
+}
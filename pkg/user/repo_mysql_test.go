@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"go.uber.org/zap"
@@ -175,15 +176,15 @@ func TestRegister(t *testing.T) {
 	repo := NewMysqlRepo(db, zap.NewNop().Sugar())
 
 	username, password := "username", "password"
-	query := `INSERT INTO users \(username, password\) VALUES \(\?, MD5\(\?\)\)`
+	query := `INSERT INTO users \(username, password, email\) VALUES \(\?, MD5\(\?\), \?\)`
 
 	// ok query
 	mock.
 		ExpectExec(query).
-		WithArgs(username, password).
+		WithArgs(username, password, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	user, err := repo.Register(username, password)
+	user, err := repo.Register(username, password, "")
 	if err != nil {
 		t.Errorf("unexpected err: %s", err)
 		return
@@ -202,16 +203,92 @@ func TestRegister(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 
+	// with email
+	mock.
+		ExpectExec(query).
+		WithArgs(username, password, "u@example.com").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	user, err = repo.Register(username, password, "u@example.com")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if user.ID != MD5hashInt(2) {
+		t.Errorf("bad user id: want %v, have %v", MD5hashInt(2), user.ID)
+	}
+
+	// an email verified elsewhere
+	mock.
+		ExpectExec(`INSERT INTO users \(username, password, email, email_verified\) VALUES \(\?, MD5\(\?\), \?, TRUE\)`).
+		WithArgs(username, password, "u@example.com").
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	user, err = repo.RegisterVerified(username, password, "u@example.com")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if user.ID != MD5hashInt(3) {
+		t.Errorf("bad user id: want %v, have %v", MD5hashInt(3), user.ID)
+	}
+
+	// query ErrEmailTaken
+	mock.
+		ExpectExec(query).
+		WithArgs(username, password, "u@example.com").
+		WillReturnError(&mysql.MySQLError{
+			Number:  1062,
+			Message: "Duplicate entry 'u@example.com' for key 'users.email'",
+		})
+
+	_, err = repo.Register(username, password, "u@example.com")
+	if err != ErrEmailTaken {
+		t.Errorf("expected %v, got %v", ErrEmailTaken, err)
+		return
+	}
+
+	// MySQL 5.7 does not prefix the key
+	mock.
+		ExpectExec(query).
+		WithArgs(username, password, "u@example.com").
+		WillReturnError(&mysql.MySQLError{
+			Number:  1062,
+			Message: "Duplicate entry 'u@example.com' for key 'email'",
+		})
+
+	_, err = repo.Register(username, password, "u@example.com")
+	if err != ErrEmailTaken {
+		t.Errorf("expected %v, got %v", ErrEmailTaken, err)
+		return
+	}
+
+	// only the email key itself means the email is taken
+	mock.
+		ExpectExec(query).
+		WithArgs(username, password, nil).
+		WillReturnError(&mysql.MySQLError{
+			Number:  1062,
+			Message: "Duplicate entry 'x' for key 'users.backup_email'",
+		})
+
+	_, err = repo.Register(username, password, "")
+	if err != ErrAlreadyExists {
+		t.Errorf("expected %v, got %v", ErrAlreadyExists, err)
+		return
+	}
+
 	// query ErrAlreadyExists
 	er := &mysql.MySQLError{
-		Number: 1062,
+		Number:  1062,
+		Message: "Duplicate entry 'username' for key 'users.username'",
 	}
 	mock.
 		ExpectExec(query).
-		WithArgs(username, password).
+		WithArgs(username, password, nil).
 		WillReturnError(er)
 
-	_, err = repo.Register(username, password)
+	_, err = repo.Register(username, password, "")
 	if err != ErrAlreadyExists {
 		t.Errorf("expected %v, got %v", ErrAlreadyExists.Error(), err.Error())
 		return
@@ -223,10 +300,10 @@ func TestRegister(t *testing.T) {
 	// query error
 	mock.
 		ExpectExec(query).
-		WithArgs(username, password).
+		WithArgs(username, password, nil).
 		WillReturnError(fmt.Errorf("bad query"))
 
-	_, err = repo.Register(username, password)
+	_, err = repo.Register(username, password, "")
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -238,10 +315,10 @@ func TestRegister(t *testing.T) {
 	// result error
 	mock.
 		ExpectExec(query).
-		WithArgs(username, password).
+		WithArgs(username, password, nil).
 		WillReturnResult(sqlmock.NewErrorResult(fmt.Errorf("bad_result")))
 
-	_, err = repo.Register(username, password)
+	_, err = repo.Register(username, password, "")
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -250,3 +327,392 @@ func TestRegister(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestGetProfile(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := &UserMysqlRepository{
+		DB:     db,
+		Logger: zap.NewNop().Sugar(),
+	}
+	query := `SELECT MD5\(id\), username, created_at, bio, avatar_url FROM users WHERE username = ?`
+	rows := sqlmock.NewRows([]string{"id", "username", "created_at", "bio", "avatar_url"}).
+		AddRow(MD5hashInt(1), "u", "2023-01-02 03:04:05", "hello", "https://example.com/a.png")
+	mock.ExpectQuery(query).WithArgs("u").WillReturnRows(rows)
+
+	profile, err := repo.GetProfile("u")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	expect := Profile{
+		User:      User{ID: MD5hashInt(1), Username: "u"},
+		CreatedAt: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		Bio:       "hello",
+		AvatarURL: "https://example.com/a.png",
+	}
+	if !reflect.DeepEqual(profile, expect) {
+		t.Errorf("results not match, want %v, have %v", expect, profile)
+	}
+
+	mock.ExpectQuery(query).WithArgs("nobody").WillReturnError(sql.ErrNoRows)
+	_, err = repo.GetProfile("nobody")
+	if err != ErrNoUser {
+		t.Errorf("expected %v, got %v", ErrNoUser, err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := &UserMysqlRepository{
+		DB:     db,
+		Logger: zap.NewNop().Sugar(),
+	}
+	id := MD5hashInt(1)
+	mock.ExpectExec(`UPDATE users SET bio = \?, avatar_url = \? WHERE MD5\(id\) = \?`).
+		WithArgs("bio", "", id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT MD5\(id\), username FROM users WHERE MD5\(id\) = ?`).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(id, "u"))
+	mock.ExpectQuery(`SELECT MD5\(id\), username, created_at, bio, avatar_url FROM users WHERE username = ?`).
+		WithArgs("u").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at", "bio", "avatar_url"}).
+			AddRow(id, "u", "2023-01-02 03:04:05", "bio", ""))
+
+	profile, err := repo.UpdateProfile(id, ProfileForm{Bio: "bio"})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if profile.Bio != "bio" || profile.User.Username != "u" {
+		t.Errorf("unexpected profile %v", profile)
+	}
+
+	mock.ExpectExec(`UPDATE users`).WillReturnError(fmt.Errorf("db error"))
+	_, err = repo.UpdateProfile(id, ProfileForm{})
+	if err == nil {
+		t.Errorf("expected error")
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetByUsername(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := &UserMysqlRepository{
+		DB:     db,
+		Logger: zap.NewNop().Sugar(),
+	}
+	query := `SELECT MD5\(id\), username FROM users WHERE username = ?`
+
+	mock.ExpectQuery(query).
+		WithArgs("username").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow("1", "username"))
+	item, err := repo.GetByUsername("username")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if !reflect.DeepEqual(item, User{"1", "username", ""}) {
+		t.Errorf("unexpected user %v", item)
+	}
+
+	mock.ExpectQuery(query).
+		WithArgs("nobody").
+		WillReturnError(sql.ErrNoRows)
+	_, err = repo.GetByUsername("nobody")
+	if err != ErrNoUser {
+		t.Errorf("expected ErrNoUser, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := &UserMysqlRepository{
+		DB:     db,
+		Logger: zap.NewNop().Sugar(),
+	}
+	id := MD5hashInt(1)
+	expectTables := func(userRows int64) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM sessions WHERE user_id = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`DELETE FROM saved WHERE user_id = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM hidden_posts WHERE user_id = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM blocks WHERE \? IN \(user_id, blocked_id\)`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM notifications WHERE user_id = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`DELETE FROM password_resets WHERE user_id = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM email_verifications WHERE user_id = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM two_factor WHERE user_id = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM two_factor_recovery WHERE user_id = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 10))
+		mock.ExpectExec(`DELETE FROM login_challenges WHERE user_id = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM external_identities WHERE user_id = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM api_tokens WHERE user_id = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM user_roles WHERE user_id = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM user_bans WHERE user_id = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM conversations WHERE \? IN \(user_a, user_b\)`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`DELETE FROM users WHERE MD5\(id\) = \?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, userRows))
+	}
+
+	expectTables(1)
+	mock.ExpectCommit()
+	if err = repo.Delete(id); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+
+	expectTables(0)
+	mock.ExpectRollback()
+	if err = repo.Delete(id); err != ErrNoUser {
+		t.Errorf("expected ErrNoUser, got %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM sessions`).WillReturnError(fmt.Errorf("db error"))
+	mock.ExpectRollback()
+	if err = repo.Delete(id); err == nil {
+		t.Errorf("expected error")
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := &UserMysqlRepository{
+		DB:     db,
+		Logger: zap.NewNop().Sugar(),
+	}
+	id := MD5hashInt(1)
+	check := `SELECT COUNT\(\*\) FROM users WHERE MD5\(id\) = \? AND password = MD5\(\?\)`
+
+	mock.ExpectQuery(check).WithArgs(id, "old password").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec(`UPDATE users SET password = MD5\(\?\) WHERE MD5\(id\) = \?`).
+		WithArgs("new password", id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err = repo.ChangePassword(id, "old password", "new password"); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+
+	mock.ExpectQuery(check).WithArgs(id, "wrong").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	if err = repo.ChangePassword(id, "wrong", "new password"); err != ErrBadPass {
+		t.Errorf("expected ErrBadPass, got %v", err)
+	}
+
+	mock.ExpectQuery(check).WillReturnError(fmt.Errorf("db error"))
+	if err = repo.ChangePassword(id, "old password", "new password"); err == nil {
+		t.Errorf("expected error")
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := &UserMysqlRepository{
+		DB:     db,
+		Logger: zap.NewNop().Sugar(),
+	}
+	id := MD5hashInt(1)
+	expires := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// only the hash of the token is stored
+	mock.ExpectExec(`DELETE FROM password_resets WHERE user_id = \?`).WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO password_resets").
+		WithArgs(sqlmock.AnyArg(), id, "2023-01-02 03:04:05").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	token, err := repo.CreatePasswordReset(id, expires)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(token) != 64 || HashToken(token) == token {
+		t.Errorf("unexpected token %v", token)
+	}
+	stored := HashToken(token)
+
+	lookup := `SELECT user_id FROM password_resets WHERE token_hash = \? AND expires_at > \? FOR UPDATE`
+	mock.ExpectBegin()
+	mock.ExpectQuery(lookup).WithArgs(stored, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(id))
+	mock.ExpectExec(`DELETE FROM password_resets WHERE user_id = \?`).WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE users SET password = MD5\(\?\) WHERE MD5\(id\) = \?`).
+		WithArgs("new password", id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT MD5\(id\), username FROM users WHERE MD5\(id\) = ?`).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(id, "u"))
+	u, err := repo.ResetPassword(token, "new password")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if u.Username != "u" {
+		t.Errorf("unexpected user %v", u)
+	}
+
+	// used, expired and unknown tokens look the same
+	mock.ExpectBegin()
+	mock.ExpectQuery(lookup).WithArgs(stored, sqlmock.AnyArg()).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	if _, err = repo.ResetPassword(token, "new password"); err != ErrBadResetToken {
+		t.Errorf("expected ErrBadResetToken, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := &UserMysqlRepository{
+		DB:     db,
+		Logger: zap.NewNop().Sugar(),
+	}
+	id := MD5hashInt(1)
+	query := `SELECT email, email_verified FROM users WHERE MD5\(id\) = \?`
+
+	mock.ExpectQuery(query).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "email_verified"}).AddRow("u@example.com", true))
+	email, err := repo.GetEmail(id)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+	if email != (Email{Address: "u@example.com", Verified: true}) {
+		t.Errorf("unexpected email %v", email)
+	}
+
+	mock.ExpectQuery(query).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "email_verified"}).AddRow(nil, false))
+	if _, err = repo.GetEmail(id); err != ErrNoEmail {
+		t.Errorf("expected ErrNoEmail, got %v", err)
+	}
+
+	mock.ExpectQuery(query).WithArgs(id).WillReturnError(sql.ErrNoRows)
+	if _, err = repo.GetEmail(id); err != ErrNoUser {
+		t.Errorf("expected ErrNoUser, got %v", err)
+	}
+
+	byEmail := `SELECT MD5\(id\), username FROM users WHERE email = \? AND email_verified = TRUE`
+	mock.ExpectQuery(byEmail).WithArgs("u@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(id, "u"))
+	u, err := repo.GetByVerifiedEmail("u@example.com")
+	if err != nil || u.Username != "u" {
+		t.Errorf("unexpected user %v, err %v", u, err)
+	}
+
+	mock.ExpectQuery(byEmail).WithArgs("other@example.com").WillReturnError(sql.ErrNoRows)
+	if _, err = repo.GetByVerifiedEmail("other@example.com"); err != ErrNoUser {
+		t.Errorf("expected ErrNoUser, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := &UserMysqlRepository{
+		DB:     db,
+		Logger: zap.NewNop().Sugar(),
+	}
+	id := MD5hashInt(1)
+	expires := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	recent := `SELECT COUNT\(\*\) FROM email_verifications WHERE user_id = \? AND created_at > \?`
+
+	mock.ExpectQuery(recent).WithArgs(id, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`DELETE FROM email_verifications WHERE user_id = \?`).WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO email_verifications").
+		WithArgs(sqlmock.AnyArg(), id, "2023-01-02 03:04:05", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	token, err := repo.CreateEmailVerification(id, expires)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	stored := HashToken(token)
+
+	// a token sent within EmailResendInterval throttles the next one
+	mock.ExpectQuery(recent).WithArgs(id, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	if _, err = repo.CreateEmailVerification(id, expires); err != ErrResendTooSoon {
+		t.Errorf("expected ErrResendTooSoon, got %v", err)
+	}
+
+	lookup := `SELECT user_id FROM email_verifications WHERE token_hash = \? AND expires_at > \? FOR UPDATE`
+	mock.ExpectBegin()
+	mock.ExpectQuery(lookup).WithArgs(stored, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(id))
+	mock.ExpectExec(`DELETE FROM email_verifications WHERE user_id = \?`).WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE users SET email_verified = TRUE WHERE MD5\(id\) = \?`).WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT MD5\(id\), username FROM users WHERE MD5\(id\) = ?`).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(id, "u"))
+	u, err := repo.VerifyEmail(token)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if u.Username != "u" {
+		t.Errorf("unexpected user %v", u)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lookup).WithArgs(stored, sqlmock.AnyArg()).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	if _, err = repo.VerifyEmail(token); err != ErrBadVerifyToken {
+		t.Errorf("expected ErrBadVerifyToken, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
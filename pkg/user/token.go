@@ -0,0 +1,25 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// NewToken returns a random token and the hash to store in its place.
+func NewToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("fail to read random bytes: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+	return token, HashToken(token), nil
+}
+
+// HashToken is how tokens are looked up, the tokens themselves are never
+// stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,12 +1,35 @@
 package user
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
+
+const (
+	MaxBioLength       = 500
+	MaxAvatarURLLength = 2048
+)
 
 var (
-	ErrNoUser        = errors.New("no user found")
-	ErrBadPass       = errors.New("invald password")
-	ErrBadUserPass   = errors.New("bad username or password")
-	ErrAlreadyExists = errors.New("user already exists")
+	ErrNoUser         = errors.New("no user found")
+	ErrBadPass        = errors.New("invald password")
+	ErrBadUserPass    = errors.New("bad username or password")
+	ErrAlreadyExists  = errors.New("user already exists")
+	ErrBadResetToken  = errors.New("invalid or expired reset token")
+	ErrEmailTaken     = errors.New("email already taken")
+	ErrNoEmail        = errors.New("no email set")
+	ErrBadVerifyToken = errors.New("invalid or expired verification token")
+	ErrResendTooSoon  = errors.New("verification email sent recently")
+)
+
+const (
+	// PasswordResetTTL is how long a password reset token can be used.
+	PasswordResetTTL = time.Hour
+	// EmailVerificationTTL is how long an email verification token can be
+	// used.
+	EmailVerificationTTL = 24 * time.Hour
+	// EmailResendInterval is how often a verification email can be sent.
+	EmailResendInterval = time.Minute
 )
 
 type User struct {
@@ -15,11 +38,57 @@ type User struct {
 	password string
 }
 
+// Email is the address of a user, it is never shown to other users.
+type Email struct {
+	Address  string `json:"address"`
+	Verified bool   `json:"verified"`
+}
+
+// Profile is the public information about a user.
+type Profile struct {
+	User      User      `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+	Bio       string    `json:"bio"`
+	AvatarURL string    `json:"avatar_url"`
+}
+
+type ProfileForm struct {
+	Bio       string `json:"bio" valid:"runelength(0|500)~must be at most 500 characters long"`
+	AvatarURL string `json:"avatar_url" valid:"runelength(0|2048)~must be at most 2048 characters long"`
+}
+
 //go:generate mockgen -source=user.go -destination=repo_mock.go -package=user UserRepo
 type UserRepo interface {
 	Authorize(username, pass string) (User, error)
-	Register(username, password string) (User, error)
+	// Register creates a user, the email is optional and starts
+	// unverified.
+	Register(username, password, email string) (User, error)
+	// RegisterVerified creates a user with an email verified elsewhere,
+	// such as by an identity provider.
+	RegisterVerified(username, password, email string) (User, error)
 	GetByID(userID string) (User, error)
+	GetByUsername(username string) (User, error)
+	GetProfile(username string) (Profile, error)
+	UpdateProfile(userID string, form ProfileForm) (Profile, error)
+	// Delete removes the user with their sessions and everything kept
+	// about them in the user store. Posts and comments are erased
+	// separately.
+	Delete(userID string) error
+	// ChangePassword sets a new password if the current one matches.
+	ChangePassword(userID, current, password string) error
+	// CreatePasswordReset returns a single use token that resets the
+	// password until expires, only its hash is stored.
+	CreatePasswordReset(userID string, expires time.Time) (string, error)
+	ResetPassword(token, password string) (User, error)
+	// GetEmail returns ErrNoEmail if the user did not give one.
+	GetEmail(userID string) (Email, error)
+	// GetByVerifiedEmail finds the user who verified the address.
+	GetByVerifiedEmail(address string) (User, error)
+	// CreateEmailVerification returns a single use token that verifies the
+	// email until expires, or ErrResendTooSoon if one was created less than
+	// EmailResendInterval ago.
+	CreateEmailVerification(userID string, expires time.Time) (string, error)
+	VerifyEmail(token string) (User, error)
 }
 
 func NewUser(id, username, password string) User {
@@ -0,0 +1,180 @@
+package views
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/greatjudge/redditclone/pkg/periodic"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultFlushInterval = 10 * time.Second
+	DefaultDedupWindow   = 30 * time.Minute
+	DefaultMaxTracked    = 100000
+)
+
+// Store applies buffered view increments, post.PostRepo implements it.
+type Store interface {
+	AddViews(counts map[string]int) error
+}
+
+type Config struct {
+	FlushInterval time.Duration
+	// DedupWindow is how long repeated views of a post by the same viewer
+	// are not counted.
+	DedupWindow time.Duration
+	// MaxTracked bounds the number of remembered viewer and post pairs,
+	// the oldest are forgotten first.
+	MaxTracked int
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if cfg.DedupWindow <= 0 {
+		cfg.DedupWindow = DefaultDedupWindow
+	}
+	if cfg.MaxTracked <= 0 {
+		cfg.MaxTracked = DefaultMaxTracked
+	}
+}
+
+type seenKey struct {
+	postID string
+	viewer string
+}
+
+// Counter buffers post views in memory and writes them to the store
+// in batches.
+type Counter struct {
+	cfg    Config
+	store  Store
+	Logger *zap.SugaredLogger
+	now    func() time.Time
+
+	mu      *sync.Mutex
+	pending map[string]int
+	seen    map[seenKey]time.Time
+	// order keeps seen keys by the time they were recorded, the ones
+	// before head are already forgotten
+	order []seenKey
+	head  int
+
+	// flushMu makes flushes run one at a time
+	flushMu *sync.Mutex
+	loop    *periodic.Loop
+}
+
+func NewCounter(store Store, logger *zap.SugaredLogger, cfg Config) *Counter {
+	cfg.setDefaults()
+	c := &Counter{
+		cfg:     cfg,
+		store:   store,
+		Logger:  logger,
+		now:     time.Now,
+		mu:      &sync.Mutex{},
+		pending: make(map[string]int),
+		seen:    make(map[seenKey]time.Time),
+		flushMu: &sync.Mutex{},
+	}
+	c.loop = periodic.NewLoop(c.flush, periodic.Config{Interval: cfg.FlushInterval, RunLast: true})
+	return c
+}
+
+// Record counts a view of the post unless the viewer has already viewed it
+// within the dedup window. It reports whether the view was counted.
+func (c *Counter) Record(postID, viewer string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.prune(now)
+
+	key := seenKey{postID: postID, viewer: viewer}
+	if viewer != "" {
+		if _, ok := c.seen[key]; ok {
+			return false
+		}
+		if len(c.order)-c.head >= c.cfg.MaxTracked {
+			delete(c.seen, c.order[c.head])
+			c.head++
+		}
+		c.seen[key] = now
+		c.order = append(c.order, key)
+	}
+	c.pending[postID]++
+	return true
+}
+
+// prune forgets viewers whose dedup window has passed, c.mu must be held.
+func (c *Counter) prune(now time.Time) {
+	for ; c.head < len(c.order); c.head++ {
+		key := c.order[c.head]
+		if now.Sub(c.seen[key]) < c.cfg.DedupWindow {
+			break
+		}
+		delete(c.seen, key)
+	}
+	// moving the keys only once half of the slice is forgotten keeps
+	// Record amortized constant time
+	if c.head > 0 && c.head*2 >= len(c.order) {
+		n := copy(c.order, c.order[c.head:])
+		for i := n; i < len(c.order); i++ {
+			c.order[i] = seenKey{}
+		}
+		c.order = c.order[:n]
+		c.head = 0
+	}
+}
+
+// Pending returns the number of buffered views of the post.
+func (c *Counter) Pending(postID string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pending[postID]
+}
+
+// Flush writes buffered views to the store. On failure they are kept
+// and retried by the next flush.
+func (c *Counter) Flush() error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.Lock()
+	counts := c.pending
+	c.pending = make(map[string]int)
+	c.mu.Unlock()
+	if len(counts) == 0 {
+		return nil
+	}
+
+	err := c.store.AddViews(counts)
+	if err != nil {
+		c.mu.Lock()
+		for postID, n := range counts {
+			c.pending[postID] += n
+		}
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Start flushes periodically until ctx is done, then flushes once more.
+func (c *Counter) Start(ctx context.Context) {
+	c.loop.Start(ctx)
+}
+
+// Wait blocks until the loop started by Start has done its final flush.
+func (c *Counter) Wait() {
+	c.loop.Wait()
+}
+
+func (c *Counter) flush() {
+	err := c.Flush()
+	if err != nil {
+		c.Logger.Errorf("fail to flush views: %v", err)
+	}
+}
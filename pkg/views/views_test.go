@@ -0,0 +1,126 @@
+package views
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	views  map[string]int
+	err    error
+	called int
+}
+
+func (s *memoryStore) AddViews(counts map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.called++
+	if s.err != nil {
+		return s.err
+	}
+	for postID, n := range counts {
+		s.views[postID] += n
+	}
+	return nil
+}
+
+func (s *memoryStore) get(postID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.views[postID]
+}
+
+func newTestCounter(store Store, cfg Config) (*Counter, *time.Time) {
+	c := NewCounter(store, zap.NewNop().Sugar(), cfg)
+	now := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestRecordDedup(t *testing.T) {
+	store := &memoryStore{views: make(map[string]int)}
+	c, now := newTestCounter(store, Config{DedupWindow: time.Minute})
+
+	assert.True(t, c.Record("p1", "u:1"))
+	assert.False(t, c.Record("p1", "u:1"))
+	assert.True(t, c.Record("p1", "ip:10.0.0.1"))
+	assert.True(t, c.Record("p2", "u:1"))
+	assert.Equal(t, 2, c.Pending("p1"))
+
+	*now = now.Add(time.Minute)
+	assert.True(t, c.Record("p1", "u:1"))
+	assert.Equal(t, 3, c.Pending("p1"))
+	assert.Len(t, c.seen, 1)
+
+	// views without a viewer key are always counted
+	assert.True(t, c.Record("p3", ""))
+	assert.True(t, c.Record("p3", ""))
+	assert.Equal(t, 2, c.Pending("p3"))
+}
+
+func TestRecordMaxTracked(t *testing.T) {
+	store := &memoryStore{views: make(map[string]int)}
+	c, _ := newTestCounter(store, Config{MaxTracked: 2})
+
+	assert.True(t, c.Record("p1", "a"))
+	assert.True(t, c.Record("p1", "b"))
+	assert.True(t, c.Record("p1", "c"))
+	assert.Len(t, c.seen, 2)
+	// the oldest viewer is forgotten
+	assert.True(t, c.Record("p1", "a"))
+	assert.False(t, c.Record("p1", "c"))
+}
+
+func TestRecordCompacts(t *testing.T) {
+	store := &memoryStore{views: make(map[string]int)}
+	c, now := newTestCounter(store, Config{DedupWindow: time.Minute, MaxTracked: 3})
+
+	for i := 0; i < 100; i++ {
+		*now = now.Add(20 * time.Second)
+		assert.True(t, c.Record("p1", fmt.Sprint(i)))
+		// forgotten keys do not pile up in order
+		assert.LessOrEqual(t, len(c.order), 6)
+		assert.Len(t, c.seen, len(c.order)-c.head)
+	}
+	assert.False(t, c.Record("p1", "99"))
+}
+
+func TestFlush(t *testing.T) {
+	store := &memoryStore{views: make(map[string]int), err: fmt.Errorf("some error")}
+	c, _ := newTestCounter(store, Config{})
+
+	c.Record("p1", "a")
+	c.Record("p1", "b")
+	assert.NotNil(t, c.Flush())
+	// failed views are kept and merged with new ones
+	c.Record("p1", "c")
+	assert.Equal(t, 3, c.Pending("p1"))
+
+	store.err = nil
+	assert.Nil(t, c.Flush())
+	assert.Equal(t, 3, store.get("p1"))
+	assert.Equal(t, 0, c.Pending("p1"))
+
+	// empty buffer does not reach the store
+	assert.Nil(t, c.Flush())
+	assert.Equal(t, 2, store.called)
+}
+
+func TestStartFlushesOnShutdown(t *testing.T) {
+	store := &memoryStore{views: make(map[string]int)}
+	c, _ := newTestCounter(store, Config{FlushInterval: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Start(ctx)
+	c.Record("p1", "a")
+	cancel()
+	c.Wait()
+	assert.Equal(t, 1, store.get("p1"))
+}
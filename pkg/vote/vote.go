@@ -1,6 +1,7 @@
 package vote
 
 type Vote struct {
+	PostID string `json:"-" bson:"post_id"`
 	UserID string `json:"user" bson:"user"`
 	Value  int    `json:"vote" bson:"vote" valid:"in(1|-1)"`
 }